@@ -5,6 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"time"
 
 	_ "github.com/lib/pq"
 
@@ -13,35 +15,85 @@ import (
 	"stock-app/internal/repository"
 	"stock-app/pkg/config"
 	"stock-app/pkg/logger"
+	"stock-app/pkg/utils"
 )
 
 // Function to refresh data in database
-func fetchLatestData(repo repository.StockRepo) {
+func fetchLatestData(repo repository.StockRepo, log *logger.Logger) {
 	fmt.Println("Refreshing data...")
-	tsFetcher := timeseries.NewTimeSeriesFetcher(config.AppConfig.TimeSeriesEndpoint, config.AppConfig.AlphaVantageAPIKey, config.AppConfig.SymbolList)
+	tsFetcher := timeseries.NewTimeSeriesFetcher(config.AppConfig.TimeSeriesEndpoint, config.AppConfig.AlphaVantageAPIKey, config.AppConfig.SymbolList, log)
 
+	// Symbols failing the daily fetch don't keep the others from the intraday one
+	failed := false
 	if err := tsFetcher.FetchDailyData(repo); err != nil {
 		fmt.Println("Failed to fetch latest data: ", err)
-		os.Exit(1)
+		failed = true
 	}
 
 	if err := tsFetcher.FetchIntradayData(repo); err != nil {
 		fmt.Println("Failed to fetch latest data: ", err)
+		failed = true
+	}
+	if failed {
 		os.Exit(1)
 	}
 
 	fmt.Println("Refreshed data in DB.")
 }
 
+// Function to backfill intraday history from an extended history slice
+func backfillIntraday(repo repository.StockRepo, log *logger.Logger, slice string) {
+	fmt.Printf("Backfilling intraday data from slice %s...\n", slice)
+	tsFetcher := timeseries.NewTimeSeriesFetcher(config.AppConfig.TimeSeriesEndpoint, config.AppConfig.AlphaVantageAPIKey, config.AppConfig.SymbolList, log)
+
+	if err := tsFetcher.BackfillIntradayExtended(slice, repo); err != nil {
+		fmt.Println("Failed to backfill intraday data: ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Backfilled intraday data in DB.")
+}
+
+// Function to backfill intraday history of every symbol over a date range
+func backfillAll(repo repository.StockRepo, log *logger.Logger, fromStr, toStr string) {
+	if fromStr == "" {
+		fmt.Println("--backfill-all requires --from=YYYY-MM-DD")
+		os.Exit(1)
+	}
+	from, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		fmt.Println("Invalid --from date: ", err)
+		os.Exit(1)
+	}
+	// --to is inclusive and defaults to yesterday, the last day whose history is complete
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if toStr != "" {
+		toDay, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			fmt.Println("Invalid --to date: ", err)
+			os.Exit(1)
+		}
+		to = toDay.AddDate(0, 0, 1)
+	}
+
+	tsFetcher := timeseries.NewTimeSeriesFetcher(config.AppConfig.TimeSeriesEndpoint, config.AppConfig.AlphaVantageAPIKey, config.AppConfig.SymbolList, log)
+	if err := tsFetcher.BackfillIntradayRange(from, to, repo); err != nil {
+		fmt.Println("Failed to backfill intraday data: ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Backfilled intraday data in DB.")
+}
+
 // Function to build resources
-func createTables(repo repository.StockRepo) {
+func createTables(repo repository.StockRepo, log *logger.Logger) {
 	fmt.Println("Creating tables and indexing...")
 	if err := repo.CreateTables(); err != nil {
 		fmt.Println("Failed to create tables: ", err)
 		os.Exit(1)
 	}
 	fmt.Println("Created tables in DB.")
-	fetchLatestData(repo)
+	fetchLatestData(repo, log)
 }
 
 // Function to clean up resources
@@ -54,18 +106,91 @@ func cleanupCache(cache cache.StockCache) {
 	fmt.Println("Cleaned cache.")
 }
 
+// Function to remove the data of a symbol that is no longer tracked
+func removeSymbol(repo repository.StockRepo, cache cache.StockCache, symbol string) {
+	fmt.Printf("Removing data of %s...\n", symbol)
+	deleted, err := repo.DeleteSymbolData(symbol)
+	if err != nil {
+		fmt.Println("Failed to delete symbol data: ", err)
+		os.Exit(1)
+	}
+	if err := cache.Delete(symbol); err != nil {
+		fmt.Println("Failed to delete cached symbol data: ", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Removed %d rows of %s from DB and its cache entry.\n", deleted, symbol)
+}
+
+// Function to reconcile the latest quotes in cache with DB. It returns an error when either can't be
+// read or a drifted symbol failed to be re-cached.
+func reconcileCache(repo repository.StockRepo, cache cache.StockCache) error {
+	fmt.Println("Reconciling cache with DB...")
+	dbQuotes, err := repo.GetAllLatestData()
+	if err != nil {
+		return fmt.Errorf("failed to get latest data from DB: %w", err)
+	}
+	cachedQuotes, err := cache.GetAllLatest()
+	if err != nil {
+		return fmt.Errorf("failed to get latest data from cache: %w", err)
+	}
+
+	symbols := make([]string, 0, len(dbQuotes))
+	for symbol := range dbQuotes {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	var repaired, newer, failed []string
+	for _, symbol := range symbols {
+		dbQuote := dbQuotes[symbol]
+		cachedQuote, cached := cachedQuotes[symbol]
+		switch {
+		case !cached || cachedQuote.Timestamp.Before(dbQuote.Timestamp):
+			cachedAt := "missing"
+			if cached {
+				cachedAt = cachedQuote.Timestamp.String()
+			}
+			fmt.Printf("Drift for %s: cache %s, DB %v. Re-caching from DB.\n", symbol, cachedAt, dbQuote.Timestamp)
+			if err := cache.SetLatest(symbol, dbQuote, config.CacheTTL(config.CacheTypeLatest, config.AppConfig.CacheLongTTL)); err != nil {
+				fmt.Printf("Failed to re-cache %s: %v\n", symbol, err)
+				failed = append(failed, symbol)
+				continue
+			}
+			repaired = append(repaired, symbol)
+		case cachedQuote.Timestamp.After(dbQuote.Timestamp):
+			// The cache can run ahead of DB between scheduled writes, so this is only reported
+			fmt.Printf("Cache is ahead of DB for %s: cache %v, DB %v.\n", symbol, cachedQuote.Timestamp, dbQuote.Timestamp)
+			newer = append(newer, symbol)
+		}
+	}
+
+	fmt.Printf("Reconciled %d symbols: %d re-cached %v, %d ahead of DB %v, %d failed %v.\n", len(symbols), len(repaired), repaired, len(newer), newer, len(failed), failed)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to re-cache %v", failed)
+	}
+	return nil
+}
+
 func main() {
 	// Define command-line flags
 	createTableFlag := flag.Bool("create-tables", false, "Create tables")
 	refreshFlag := flag.Bool("refresh", false, "Fetch latest data to DB")
 	cleanupFlag := flag.Bool("cleanup", false, "Cleanup cache")
+	reconcileFlag := flag.Bool("reconcile", false, "Compare latest quotes in cache against DB and re-cache drifted symbols")
+	backfillIntradayFlag := flag.Bool("backfill-intraday", false, "Backfill intraday data from an extended history slice")
+	sliceFlag := flag.String("slice", "year1month1", "Extended history slice for --backfill-intraday, year1month1 (most recent) to year2month12")
+	backfillAllFlag := flag.Bool("backfill-all", false, "Backfill intraday data of every configured symbol from --from to --to, skipping symbols already covering the range")
+	fromFlag := flag.String("from", "", "First day (YYYY-MM-DD) of --backfill-all")
+	toFlag := flag.String("to", "", "Last day (YYYY-MM-DD) of --backfill-all, defaults to yesterday")
+	removeSymbolFlag := flag.String("remove-symbol", "", "Delete all DB rows and cached data of a symbol, e.g. --remove-symbol=AAPL")
+	dryRunFlag := flag.Bool("dry-run", false, "Report the rows --refresh, --backfill-intraday or --backfill-all would insert without writing them")
 
 	// Parse the command-line flags
 	flag.Parse()
 
 	// Load configuration
 	config.LoadConfig()
-	log := logger.NewLogger()
+	log := logger.NewLogger(config.AppConfig.LogLevel)
 
 	// Initialize database connection
 	dbConn, err := sql.Open("postgres", config.AppConfig.DatabaseURL)
@@ -79,18 +204,49 @@ func main() {
 	}()
 
 	// Initialize dependencies
-	repo := repository.NewStockRepo(dbConn)
-	cache := cache.NewStockCache(config.AppConfig.CacheClient)
+	repo := repository.NewStockRepo(dbConn, config.AppConfig.PrecomputedChanges, config.AppConfig.LatestQueryStrategy, config.AppConfig.IntradayPrecedence)
+	stockCache := cache.NewStockCache(cache.NewClient())
+
+	// Wait for the database and Redis, which may still be starting alongside this process
+	if err := utils.WaitFor("database", config.AppConfig.StartupTimeout, dbConn.Ping); err != nil {
+		log.Fatal("Failed to connect to the database: ", err)
+	}
+	if err := utils.WaitFor("Redis", config.AppConfig.StartupTimeout, stockCache.Ping); err != nil {
+		log.Fatal("Failed to connect to Redis: ", err)
+	}
 
 	// Check which flag was set and call the corresponding function
-	if *refreshFlag {
-		fetchLatestData(repo)
+	if *refreshFlag && *dryRunFlag {
+		dryRunRepo := repository.NewDryRunRepo(repo)
+		fetchLatestData(dryRunRepo, log)
+		dryRunRepo.Report()
+	} else if *refreshFlag {
+		fetchLatestData(repo, log)
+	} else if *backfillIntradayFlag && *dryRunFlag {
+		dryRunRepo := repository.NewDryRunRepo(repo)
+		backfillIntraday(dryRunRepo, log, *sliceFlag)
+		dryRunRepo.Report()
+	} else if *backfillIntradayFlag {
+		backfillIntraday(repo, log, *sliceFlag)
+	} else if *backfillAllFlag && *dryRunFlag {
+		dryRunRepo := repository.NewDryRunRepo(repo)
+		backfillAll(dryRunRepo, log, *fromFlag, *toFlag)
+		dryRunRepo.Report()
+	} else if *backfillAllFlag {
+		backfillAll(repo, log, *fromFlag, *toFlag)
 	} else if *createTableFlag {
-		createTables(repo)
+		createTables(repo, log)
 	} else if *cleanupFlag {
-		cleanupCache(cache)
+		cleanupCache(stockCache)
+	} else if *reconcileFlag {
+		if err := reconcileCache(repo, stockCache); err != nil {
+			fmt.Println("Failed to reconcile cache: ", err)
+			os.Exit(1)
+		}
+	} else if *removeSymbolFlag != "" {
+		removeSymbol(repo, stockCache, *removeSymbolFlag)
 	} else {
-		fmt.Println("Usage: resource.go --refresh | --create-tables | --cleanup")
+		fmt.Println("Usage: resource.go --refresh [--dry-run] | --backfill-intraday [--slice=year1month1] [--dry-run] | --backfill-all --from=YYYY-MM-DD [--to=YYYY-MM-DD] [--dry-run] | --create-tables | --cleanup | --reconcile | --remove-symbol=SYMBOL")
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"stock-app/internal/cache"
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+)
+
+// latestRepo is a StockRepo serving the latest quotes from memory.
+type latestRepo struct {
+	repository.StockRepo
+	latest map[string]*entity.StockQuote
+}
+
+func (r *latestRepo) GetAllLatestData() (map[string]*entity.StockQuote, error) {
+	return r.latest, nil
+}
+
+// latestCache is a StockCache holding the latest quotes in memory. Caching the symbols in failing fails.
+type latestCache struct {
+	cache.StockCache
+	latest  map[string]*entity.StockQuote
+	failing map[string]bool
+}
+
+func (c *latestCache) GetAllLatest() (map[string]*entity.StockQuote, error) {
+	return c.latest, nil
+}
+
+func (c *latestCache) SetLatest(symbol string, stock *entity.StockQuote, expiration time.Duration) error {
+	if c.failing[symbol] {
+		return errors.New("redis unavailable")
+	}
+	c.latest[symbol] = stock
+	return nil
+}
+
+func TestReconcileCache(t *testing.T) {
+	at := func(min int) time.Time {
+		return time.Date(2025, time.June, 11, 10, min, 0, 0, time.UTC)
+	}
+	quote := func(symbol string, min int) *entity.StockQuote {
+		return &entity.StockQuote{Symbol: symbol, Price: float64(100 + min), Timestamp: at(min)}
+	}
+	repo := &latestRepo{latest: map[string]*entity.StockQuote{
+		"AAPL": quote("AAPL", 5),
+		"MSFT": quote("MSFT", 5),
+		"TSLA": quote("TSLA", 5),
+		"AMZN": quote("AMZN", 5),
+	}}
+
+	t.Run("repairs drift", func(t *testing.T) {
+		stockCache := &latestCache{latest: map[string]*entity.StockQuote{
+			"AAPL": quote("AAPL", 1), // stale
+			"TSLA": quote("TSLA", 9), // ahead of DB
+			"AMZN": quote("AMZN", 5), // in sync
+		}}
+		if err := reconcileCache(repo, stockCache); err != nil {
+			t.Fatalf("reconcileCache() error = %v", err)
+		}
+		want := map[string]*entity.StockQuote{
+			"AAPL": repo.latest["AAPL"],
+			"MSFT": repo.latest["MSFT"],
+			"TSLA": quote("TSLA", 9),
+			"AMZN": quote("AMZN", 5),
+		}
+		if !reflect.DeepEqual(stockCache.latest, want) {
+			t.Errorf("cached quotes after reconciling = %v, want %v", stockCache.latest, want)
+		}
+	})
+
+	t.Run("reports failed repairs", func(t *testing.T) {
+		stockCache := &latestCache{latest: map[string]*entity.StockQuote{}, failing: map[string]bool{"MSFT": true}}
+		if err := reconcileCache(repo, stockCache); err == nil {
+			t.Error("reconcileCache() error = nil when a symbol failed to be re-cached")
+		}
+		if _, cached := stockCache.latest["AAPL"]; !cached {
+			t.Error("reconcileCache() stopped re-caching at the first failure")
+		}
+	})
+}
@@ -1,29 +1,171 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"sync"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"stock-app/internal/api/latestquote"
+	"stock-app/internal/api/profile"
 	"stock-app/internal/api/realtime"
+	"stock-app/internal/api/timeseries"
 	"stock-app/internal/cache"
 	"stock-app/internal/entity"
 	"stock-app/internal/handler"
+	"stock-app/internal/hub"
 	"stock-app/internal/repository"
 	"stock-app/internal/usecase"
 	"stock-app/pkg/config"
+	apperrors "stock-app/pkg/errors"
 	"stock-app/pkg/logger"
+	"stock-app/pkg/utils"
 )
 
+// shutdownTimeout bounds how long in-flight requests get to complete when the servers shut down.
+const shutdownTimeout = 10 * time.Second
+
+// Build metadata, injected at build time via -ldflags "-X main.version=... -X main.commit=... -X main.buildTime=...".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// logBuildInfo logs the build version and Go runtime version.
+func logBuildInfo(log *logger.Logger) {
+	log.WithFields(map[string]interface{}{
+		"version":    version,
+		"commit":     commit,
+		"build_time": buildTime,
+		"go_version": runtime.Version(),
+	}).Info("Starting stock-app server")
+}
+
+// logConfigSummary logs the loaded configuration with secrets masked, along with enabled features.
+func logConfigSummary(log *logger.Logger, cfg config.Config) {
+	log.WithFields(map[string]interface{}{
+		"symbol_count":              len(cfg.SymbolList),
+		"alpha_vantage_api_key":     maskSecret(cfg.AlphaVantageAPIKey),
+		"finnhub_api_key":           maskSecret(cfg.FinnhubAPIKey),
+		"admin_api_key":             maskSecret(cfg.AdminAPIKey),
+		"timeseries_endpoint":       utils.RedactURL(cfg.TimeSeriesEndpoint),
+		"quote_endpoint":            utils.RedactURL(cfg.QuoteEndpoint),
+		"real_time_trades_endpoint": utils.RedactURL(cfg.RealTimeTradesEndpoint),
+		"database_url":              utils.RedactURL(cfg.DatabaseURL),
+		"cache_client":              cfg.CacheClient,
+		"redis_cluster":             cfg.RedisCluster,
+		"redis_addrs":               cfg.RedisAddrs,
+		"alpha_vantage_rate_limit":  cfg.AlphaVantageRateLimit,
+		"scheduled_refresh_period":  cfg.ScheduledRefreshPeriod.String(),
+		"cache_short_ttl":           cfg.CacheShortTTL.String(),
+		"cache_long_ttl":            cfg.CacheLongTTL.String(),
+		"historical_data_duration":  cfg.HistoricalDataDuration.String(),
+		"server_port":               cfg.ServerPort,
+		"log_level":                 cfg.LogLevel,
+	}).Info("Loaded configuration")
+
+	log.WithFields(map[string]interface{}{
+		"anomaly_filter":    cfg.AnomalyThreshold > 0,
+		"block_until_warm":  cfg.BlockUntilWarm,
+		"scheduled_refresh": cfg.ScheduledRefresh,
+	}).Info("Enabled features")
+}
+
+// maskSecret hides all but the last 4 characters of a secret.
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
+// runSelfTest makes one request to AlphaVantage and one to Finnhub, logging whether each is reachable
+// and accepts its API key. It returns an error if a provider rejected its key.
+func runSelfTest(log *logger.Logger, cfg config.Config) error {
+	checks := []struct {
+		provider string
+		check    func(symbol string) error
+	}{
+		{"AlphaVantage", timeseries.NewTimeSeriesFetcher(cfg.TimeSeriesEndpoint, cfg.AlphaVantageAPIKey, nil, log).SelfTest},
+		{"Finnhub", latestquote.NewLatestQuoteFetcher(cfg.QuoteEndpoint, cfg.FinnhubAPIKey, nil).SelfTest},
+	}
+
+	var authErr error
+	for _, c := range checks {
+		err := c.check(cfg.DefaultSymbol)
+		var rejected *apperrors.AuthError
+		switch {
+		case errors.As(err, &rejected):
+			log.WithField("provider", c.provider).Error("Self-test failed: ", err)
+			authErr = err
+		case err != nil:
+			log.WithField("provider", c.provider).Warn("Self-test failed: ", err)
+		default:
+			log.WithField("provider", c.provider).Info("Self-test passed")
+		}
+	}
+	return authErr
+}
+
+// adminRoutes returns the router serving the admin endpoints along with the group to register them
+// on. With cfg.AdminPort set, that is a router of its own, which only accepts clients from the allowed
+// networks and requires the admin API key for every request, including unknown paths, so the admin
+// endpoints aren't reachable on the public listener. Otherwise the group on router requires the key.
+func adminRoutes(router *gin.Engine, log *logger.Logger, cfg config.Config) (*gin.Engine, *gin.RouterGroup) {
+	if cfg.AdminPort == "" {
+		return router, router.Group("/admin", handler.AdminAuth(cfg.AdminAPIKey))
+	}
+	adminRouter := gin.New()
+	adminRouter.Use(gin.Logger(), handler.Recovery(log), handler.AllowNetworks(cfg.AdminAllowedNetworks), handler.BodyLimit(cfg.MaxRequestBodyBytes), handler.AdminAuth(cfg.AdminAPIKey))
+	return adminRouter, adminRouter.Group("/admin")
+}
+
+// newHTTPServer creates a server of routes on the given port with the configured timeouts, so slow
+// clients can't hold connections open indefinitely. Streaming endpoints apply the write timeout to
+// each row instead of the whole response, and WebSocket connections are not subject to it once upgraded.
+func newHTTPServer(port string, routes http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + port,
+		Handler:           routes,
+		ReadTimeout:       config.AppConfig.HTTPReadTimeout,
+		ReadHeaderTimeout: config.AppConfig.HTTPReadHeaderTimeout,
+		WriteTimeout:      config.AppConfig.HTTPWriteTimeout,
+		IdleTimeout:       config.AppConfig.HTTPIdleTimeout,
+	}
+}
+
 func main() {
 	// Load configuration
 	config.LoadConfig()
-	log := logger.NewLogger()
+	log := logger.NewLogger(config.AppConfig.LogLevel)
+	logBuildInfo(log)
+	logConfigSummary(log, config.AppConfig)
+	if err := config.Validate(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if config.AppConfig.SelfTestOnStart {
+		if err := runSelfTest(log, config.AppConfig); err != nil && config.AppConfig.SelfTestFailFast {
+			log.Fatal("Self-test failed: ", err)
+		}
+	}
 
-	// Initialize Gin Router
-	router := gin.Default()
+	// Initialize Gin Router, recovering from panics with a JSON error instead of Gin's plain text one
+	// and rejecting request bodies larger than MAX_REQUEST_BODY_BYTES
+	router := gin.New()
+	router.Use(gin.Logger(), handler.Recovery(log), handler.BodyLimit(config.AppConfig.MaxRequestBodyBytes))
 
 	// Initialize database connection
 	dbConn, err := sql.Open("postgres", config.AppConfig.DatabaseURL)
@@ -37,40 +179,180 @@ func main() {
 	}()
 
 	// Initialize dependencies
-	rtStockData := &entity.LatestQuoteData{
-		StockData: make(map[string]*entity.StockQuote), // Initialize the map
-		Mu:        sync.RWMutex{},                      // Initialize the mutex
+	rtStockData := entity.NewLatestQuoteData()
+	quoteHub := hub.NewHub(config.AppConfig.HubBufferSize)
+
+	repo := repository.NewStockRepo(dbConn, config.AppConfig.PrecomputedChanges, config.AppConfig.LatestQueryStrategy, config.AppConfig.IntradayPrecedence)
+	// One Redis client is shared by the cache, the refresh jobs and the refresh lock
+	redisClient := cache.NewClient()
+	stockCache := cache.NewStockCache(redisClient)
+
+	// Wait for the database and Redis, which may still be starting alongside this process
+	if err := utils.WaitFor("database", config.AppConfig.StartupTimeout, dbConn.Ping); err != nil {
+		log.Fatal("Failed to connect to the database: ", err)
+	}
+	if err := utils.WaitFor("Redis", config.AppConfig.StartupTimeout, stockCache.Ping); err != nil {
+		log.Fatal("Failed to connect to Redis: ", err)
 	}
 
-	repo := repository.NewStockRepo(dbConn)
-	cache := cache.NewStockCache(config.AppConfig.CacheClient)
-	stockServingUseCase := usecase.NewStockServingUseCase(repo, cache, rtStockData)
+	// Bring existing tables up to date, e.g. with the indexes added since they were created
+	if err := repo.Migrate(); err != nil {
+		log.Warn("Failed to migrate the database: ", err)
+	}
 
-	rtFetcher := realtime.NewRealTimeFetcher(config.AppConfig.RealTimeTradesEndpoint, config.AppConfig.FinnhubAPIKey, config.AppConfig.SymbolList)
-	stockFetchingUseCase := usecase.NewStockFetchingUseCase(repo, cache, rtFetcher, rtStockData)
+	// Serve reads from the read replica when one is configured, keeping writes on the primary
+	if config.AppConfig.DatabaseReplicaURL != "" {
+		replicaConn, err := sql.Open("postgres", config.AppConfig.DatabaseReplicaURL)
+		if err != nil {
+			log.Fatal("Failed to connect to the database replica: ", err)
+		}
+		defer func() {
+			if err := replicaConn.Close(); err != nil {
+				log.Fatal("Failed to close the database replica connection: ", err)
+			}
+		}()
+		if err := utils.WaitFor("database replica", config.AppConfig.StartupTimeout, replicaConn.Ping); err != nil {
+			log.Fatal("Failed to connect to the database replica: ", err)
+		}
+		repo = repository.NewReplicaRepo(repo, repository.NewStockRepo(replicaConn, config.AppConfig.PrecomputedChanges, config.AppConfig.LatestQueryStrategy, config.AppConfig.IntradayPrecedence))
+	}
+	companyIndex := entity.NewCompanyIndex()
+	stockServingUseCase := usecase.NewStockServingUseCase(repo, stockCache, rtStockData, companyIndex)
+
+	// Index company names in the background so `name=` lookups resolve once profiles arrive
+	profileFetcher := profile.NewProfileFetcher(config.AppConfig.ProfileEndpoint, config.AppConfig.FinnhubAPIKey, config.AppConfig.SymbolList)
+	go func() {
+		if err := profileFetcher.FetchToIndex(companyIndex); err != nil {
+			log.Warn("Company name lookups may be incomplete: ", err)
+		}
+	}()
+
+	rtFetcher := realtime.NewRealTimeFetcher(config.AppConfig.RealTimeTradesEndpoint, config.AppConfig.FinnhubAPIKey, config.AppConfig.SymbolList, quoteHub, log)
+	stockFetchingUseCase := usecase.NewStockFetchingUseCase(repo, stockCache, rtFetcher, rtStockData)
+
+	healthHandler := handler.NewHealthHandler(stockServingUseCase)
+	router.GET("/readyz", healthHandler.Ready)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/version", handler.NewVersionHandler(version, commit, buildTime).Version)
 
-	// Fetch data in real-time
-	if err := stockFetchingUseCase.FetchRealTimeData(); err != nil {
-		log.Fatal("Failed to fetch initial data: ", err)
+	// Background work, i.e. the real-time updates and the schedulers, runs until ctx is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Fetch data in real-time, either before serving or in the background while /readyz reports 503
+	warmUp := func() {
+		if err := stockFetchingUseCase.FetchRealTimeData(ctx); err != nil {
+			log.Fatal("Failed to fetch initial data: ", err)
+		}
+		healthHandler.SetReady()
+		log.Info("Initial data loaded, server is ready")
+	}
+	if config.AppConfig.BlockUntilWarm {
+		warmUp()
+	} else {
+		go warmUp()
+	}
+
+	adminUseCase := usecase.NewAdminUseCase(stockCache, repo)
+
+	jobStore := cache.NewJobStore(redisClient)
+	locker := cache.NewLocker(redisClient)
+	tsFetcher := timeseries.NewTimeSeriesFetcher(config.AppConfig.TimeSeriesEndpoint, config.AppConfig.AlphaVantageAPIKey, config.AppConfig.SymbolList, log)
+	refreshUseCase := usecase.NewRefreshUseCase(repo, tsFetcher, jobStore, locker)
+
+	// Refresh intraday data in-process instead of through an external cron
+	if config.AppConfig.ScheduledRefresh {
+		go refreshUseCase.ScheduleIntradayRefresh(ctx, config.AppConfig.ScheduledRefreshPeriod)
+	}
+
+	// Refresh daily data once after each US market close, separately from the intraday refresh
+	if config.AppConfig.DailyRefresh {
+		go refreshUseCase.ScheduleDailyRefresh(ctx, config.AppConfig.DailyRefreshDelay)
+	}
+
+	// Keep the newest data timestamp reported by /readyz and the metrics current without a query per probe
+	go stockServingUseCase.TrackGlobalLatestTimestamp(ctx, usecase.LatestTimestampMaxAge)
+
+	// Keep the precomputed change columns in line with late or corrected daily closes
+	if config.AppConfig.PrecomputedChanges {
+		go refreshUseCase.ScheduleChangeRecompute(ctx, config.AppConfig.ChangeRecomputePeriod)
 	}
 
 	stockHandler := handler.NewStockHandler(stockServingUseCase)
+	wsHandler := handler.NewWSHandler(stockServingUseCase, quoteHub)
+	sseHandler := handler.NewSSEHandler(stockServingUseCase, quoteHub)
+	adminHandler := handler.NewAdminHandler(adminUseCase, refreshUseCase)
 
 	// Stock Management endpoints
-    stock := router.Group("/stocks")
+    stock := router.Group("/stocks", handler.SymbolAliases(stockServingUseCase.ResolveSymbol))
     {
-        stock.GET("", stockHandler.GetAllQuotes)
-        stock.GET("/quote", stockHandler.GetQuote) // The handler will receive `symbol` and `start` with `end` as query parameters
+        stock.GET("", handler.AdminAuthIf(config.AppConfig.AdminAPIKey, handler.IsFreshRequest), stockHandler.GetAllQuotes) // `fresh=true` bypasses the cache and requires the admin API key
+        stock.GET("/quote", stockHandler.GetQuote) // The handler will receive `symbol`, `start`, `end` and an optional `resolution` as query parameters
+        stock.GET("/daily", stockHandler.GetDailyData) // `symbol`, `start` and `end` are query parameters
+        stock.GET("/range", stockHandler.GetDataRange) // `symbol` is a query parameter
+        stock.GET("/prevclose", stockHandler.GetPrevClose) // `symbol` and an optional `asOf` are query parameters
+        stock.GET("/stats", stockHandler.GetReturnStats) // `symbol`, `start` and `end` are query parameters
+        stock.GET("/chart", stockHandler.GetChart) // `symbol`, `start`, `end` and an optional `resolution` are query parameters
+        stock.GET("/export", stockHandler.Export) // `symbol` is required, `format` is `ndjson` (default) or `csv`
+        stock.GET("/gaps", stockHandler.GetOpeningGaps) // `min` is the minimum absolute gap in percent
+        stock.GET("/overview", stockHandler.GetOverview) // `symbol`, `daily_from` and `intraday_from` are query parameters
+        stock.GET("/ws", wsHandler.StreamQuotes) // Clients send `{"subscribe": [...]}` / `{"unsubscribe": [...]}` messages
+        stock.GET("/sse", sseHandler.StreamQuotes) // `symbols` is a comma-separated query parameter
         // stock.GET("/trade", stockHandler.GetTrades) // Similar to above, `symbol` and `range` are query parameters
         // stock.GET("/profile", stockHandler.GetCompanyProfile) // `symbol` can be a query parameter
         // stock.GET("/financials", stockHandler.GetFinancials) // `symbol` can be a query parameter
     }
-    
 
-	// Start the server on the configured port
-	port := config.AppConfig.ServerPort
-	log.Printf("Starting HTTP server on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server: ", err)
+	// Versioned stock endpoints whose responses differ from their unversioned counterparts
+	stockV2 := router.Group("/v2/stocks", handler.SymbolAliases(stockServingUseCase.ResolveSymbol))
+	{
+		stockV2.GET("", handler.AdminAuthIf(config.AppConfig.AdminAPIKey, handler.IsFreshRequest), stockHandler.ListQuotes) // `sort`, `order` and `minChange` are query parameters
+	}
+
+	// Admin endpoints, served on their own listener when ADMIN_PORT is set so they can stay internal
+	adminRouter, admin := adminRoutes(router, log, config.AppConfig)
+	{
+		admin.GET("/cache/stats", adminHandler.GetCacheStats)
+		admin.GET("/db/stats", adminHandler.GetRepoStats)
+		admin.GET("/gaps", adminHandler.GetGaps) // `symbol` is required, `day` (YYYY-MM-DD) defaults to today
+		admin.POST("/refresh", adminHandler.StartRefresh) // An optional `Idempotency-Key` header deduplicates retries
+		admin.GET("/refresh/history", adminHandler.GetRefreshHistory) // Optional `status` and `limit` (default 20) query parameters
+		admin.GET("/refresh/:id", adminHandler.GetRefreshJob)
+	}
+
+	// Start the servers on the configured ports
+	servers := []*http.Server{newHTTPServer(config.AppConfig.ServerPort, router)}
+	if config.AppConfig.AdminPort != "" {
+		servers = append(servers, newHTTPServer(config.AppConfig.AdminPort, adminRouter))
 	}
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			log.Printf("Starting HTTP server on %s", srv.Addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal("Failed to start server: ", err)
+			}
+		}(srv)
+	}
+
+	// Shut the servers down gracefully on SIGINT/SIGTERM
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	// Stop the real-time updates and the schedulers first so no refresh starts while requests drain
+	cancel()
+	log.Info("Shutting down HTTP servers...")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error("Failed to shut down server on ", srv.Addr, ": ", err)
+		}
+	}
+	log.Info("HTTP servers shut down")
+
+	// Persist the real-time bars still pending before the DB connection is closed
+	stockFetchingUseCase.Wait()
+	log.Info("Shutdown complete")
 }
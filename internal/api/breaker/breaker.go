@@ -0,0 +1,143 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sony/gobreaker"
+
+	"stock-app/internal/metrics"
+	"stock-app/pkg/config"
+	apperrors "stock-app/pkg/errors"
+	"stock-app/pkg/utils"
+)
+
+// Upstream providers, each sharing one circuit breaker across its fetchers.
+const (
+	ProviderAlphaVantage = "AlphaVantage"
+	ProviderFinnhub      = "Finnhub"
+)
+
+// Client makes HTTP requests to a provider through its circuit breaker. After CIRCUIT_BREAKER_FAILURES
+// consecutive failures, i.e. transport errors or 5xx responses, requests fail fast with a
+// *errors.CircuitOpenError for CIRCUIT_BREAKER_COOLDOWN, after which a single trial request decides
+// whether the provider has recovered. Requests taking longer than UPSTREAM_TIMEOUT fail, so a hanging
+// provider trips the breaker too.
+type Client struct {
+	provider   string
+	cb         *gobreaker.CircuitBreaker
+	httpClient *http.Client
+}
+
+var (
+	mu      sync.Mutex
+	clients = make(map[string]*Client)
+)
+
+// For returns the shared client of the provider, creating it on first use. A failure threshold of zero
+// or less disables the breaker.
+func For(provider string) *Client {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if client, exists := clients[provider]; exists {
+		return client
+	}
+
+	failures := config.AppConfig.CircuitBreakerFailures
+	client := &Client{provider: provider, httpClient: &http.Client{Timeout: config.AppConfig.UpstreamTimeout}}
+	if failures > 0 {
+		client.cb = gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:    provider,
+			Timeout: config.AppConfig.CircuitBreakerCooldown,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= uint32(failures)
+			},
+			OnStateChange: func(name string, from, to gobreaker.State) {
+				fmt.Printf("Circuit breaker of %s changed from %s to %s\n", name, from, to)
+				metrics.CircuitBreakerState.WithLabelValues(name).Set(float64(to))
+			},
+		})
+		metrics.CircuitBreakerState.WithLabelValues(provider).Set(float64(gobreaker.StateClosed))
+	}
+	clients[provider] = client
+	return client
+}
+
+// serverError marks a 5xx response as a failure for the breaker while still returning it.
+type serverError struct {
+	status string
+}
+
+func (e *serverError) Error() string {
+	return fmt.Sprintf("server error from API: %s", e.status)
+}
+
+// Get issues a GET request to url through the breaker. Responses of any status are returned to the
+// caller as usual, so only transport errors and an open breaker are returned as errors.
+func (c *Client) Get(url string) (*http.Response, error) {
+	if c.cb == nil {
+		return c.httpClient.Get(url)
+	}
+
+	result, err := c.cb.Execute(func() (interface{}, error) {
+		resp, err := c.httpClient.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return resp, &serverError{status: resp.Status}
+		}
+		return resp, nil
+	})
+
+	var serverErr *serverError
+	switch {
+	case errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests):
+		return nil, &apperrors.CircuitOpenError{Provider: c.provider}
+	case errors.As(err, &serverErr):
+		return result.(*http.Response), nil
+	case err != nil:
+		return nil, err
+	}
+	return result.(*http.Response), nil
+}
+
+// Bounds of the backoff between GetWithRetry attempts rate limited without a Retry-After header.
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// GetWithRetry issues a GET request to url like Get, retrying up to RATE_LIMIT_RETRIES times while the
+// provider answers 429 Too Many Requests. It waits for the Retry-After header between attempts, or
+// backs off exponentially when the header is missing, and returns an error once the retries run out.
+func (c *Client) GetWithRetry(url string) (*http.Response, error) {
+	delay := minRetryDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := c.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if attempt >= config.AppConfig.RateLimitRetries {
+			return nil, fmt.Errorf("rate limited by %s after %d attempts", c.provider, attempt+1)
+		}
+		wait := delay
+		if header := resp.Header.Get("Retry-After"); header != "" {
+			wait = utils.ParseRetryAfter(header)
+		}
+		fmt.Printf("Rate limited by %s, retrying after %v...\n", c.provider, wait)
+		time.Sleep(wait)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package breaker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stock-app/pkg/config"
+	apperrors "stock-app/pkg/errors"
+)
+
+func TestGet(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.CircuitBreakerFailures = 2
+	config.AppConfig.CircuitBreakerCooldown = time.Minute
+	config.AppConfig.UpstreamTimeout = time.Second
+
+	tests := []struct {
+		name       string
+		statuses   []int
+		wantStatus []int // 0 for a *errors.CircuitOpenError
+	}{
+		{name: "successes", statuses: []int{200, 200, 200}, wantStatus: []int{200, 200, 200}},
+		{name: "client errors leave it closed", statuses: []int{404, 404, 200}, wantStatus: []int{404, 404, 200}},
+		{name: "server errors open it", statuses: []int{500, 503, 200}, wantStatus: []int{500, 503, 0}},
+		{name: "success resets the failures", statuses: []int{500, 200, 500, 200}, wantStatus: []int{500, 200, 500, 200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			client := For("TestGet " + tt.name)
+			for i, want := range tt.wantStatus {
+				resp, err := client.Get(server.URL)
+				if want == 0 {
+					var openErr *apperrors.CircuitOpenError
+					if !errors.As(err, &openErr) {
+						t.Errorf("request %d: error = %v, want a CircuitOpenError", i, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("request %d: error = %v", i, err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != want {
+					t.Errorf("request %d: status = %d, want %d", i, resp.StatusCode, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetWithRetry(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.CircuitBreakerFailures = 0
+	config.AppConfig.UpstreamTimeout = time.Second
+	config.AppConfig.RateLimitRetries = 2
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   int
+		wantErr      bool
+		wantRequests int
+	}{
+		{name: "not rate limited", statuses: []int{200}, wantStatus: 200, wantRequests: 1},
+		{name: "rate limited once", statuses: []int{429, 200}, wantStatus: 200, wantRequests: 2},
+		{name: "other errors not retried", statuses: []int{500, 200}, wantStatus: 500, wantRequests: 1},
+		{name: "retries run out", statuses: []int{429, 429, 429, 200}, wantErr: true, wantRequests: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(tt.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			resp, err := For("TestGetWithRetry " + tt.name).GetWithRetry(server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+				}
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -3,13 +3,17 @@ package latestquote
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"sync"
-	"time"
 
+	"stock-app/internal/api/breaker"
 	"stock-app/internal/cache"
 	"stock-app/internal/entity"
 	"stock-app/pkg/config"
+	"stock-app/pkg/errors"
+	"stock-app/pkg/utils"
 )
 
 // LatestQuoteFetcher manages real-time data from WebSocket API and external APIs.
@@ -22,10 +26,29 @@ type LatestQuoteFetcher struct {
 func NewLatestQuoteFetcher(url string, apiToken string, symbols []string) *LatestQuoteFetcher {
 	return &LatestQuoteFetcher{
 		url:     url + "?token=" + apiToken,
-		symbols: symbols,
+		symbols: utils.FilterValidSymbols(symbols),
 	}
 }
 
+// SelfTest makes a single quote request to check that the API is reachable and accepts the configured
+// API key. A rejected key is returned as *errors.AuthError.
+func (qf *LatestQuoteFetcher) SelfTest(symbol string) error {
+	resp, err := breaker.For(breaker.ProviderFinnhub).Get(fmt.Sprintf("%s&symbol=%s", qf.url, symbol))
+	if err != nil {
+		return fmt.Errorf("failed to reach the quote API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &errors.AuthError{Provider: "Finnhub", Message: fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body)))}
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("non-OK HTTP status from the quote API: %s", resp.Status)
+	}
+	return nil
+}
+
 // FetchToCache fetches latest quote data from the external API and updates the cache.
 func (qf *LatestQuoteFetcher) FetchToCache(stockCache cache.StockCache) error {
 	var wg sync.WaitGroup
@@ -34,55 +57,18 @@ func (qf *LatestQuoteFetcher) FetchToCache(stockCache cache.StockCache) error {
 
 	fetchData := func(symbol string) {
 		defer wg.Done()
-		url := fmt.Sprintf("%s&symbol=%s", qf.url, symbol)
-
-		for {
-			fmt.Printf("Fetching data for symbol %s from URL: %s\n", symbol, url)
-
-			resp, err := http.Get(url)
-			if err != nil {
-				errorChannel <- fmt.Errorf("failed to fetch data for symbol %s: %w", symbol, err)
-				return
-			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode == http.StatusTooManyRequests {
-				retryAfter := resp.Header.Get("Retry-After")
-				if retryAfter != "" {
-					duration, err := time.ParseDuration(retryAfter + "s")
-					if err != nil {
-						duration = time.Minute
-					}
-					fmt.Printf("Rate limit exceeded for symbol %s. Retrying after %v...\n", symbol, duration)
-					time.Sleep(duration)
-					continue
-				} else {
-					fmt.Printf("Rate limit exceeded for symbol %s. Retrying after 1 minute...\n", symbol)
-					time.Sleep(time.Minute)
-					continue
-				}
-			}
-
-			if resp.StatusCode != http.StatusOK {
-				errorChannel <- fmt.Errorf("non-OK HTTP status for symbol %s: %s", symbol, resp.Status)
-				return
-			}
-
-			var stockQuote entity.StockQuote
-			if err := json.NewDecoder(resp.Body).Decode(&stockQuote); err != nil {
-				errorChannel <- fmt.Errorf("failed to decode data for symbol %s: %w", symbol, err)
-				return
-			}
-			stockQuote.Symbol = symbol
-
-			fmt.Printf("Fetched data for symbol %s: %+v\n", symbol, stockQuote)
-
-			mu.Lock()
-			stockCache.SetLatest(symbol, &stockQuote, config.AppConfig.CacheShortTTL)
-			mu.Unlock()
-
-			break
+
+		stockQuote, err := qf.fetchQuote(symbol)
+		if err != nil {
+			errorChannel <- err
+			return
 		}
+
+		fmt.Printf("Fetched data for symbol %s: %+v\n", symbol, stockQuote)
+
+		mu.Lock()
+		stockCache.SetLatest(symbol, stockQuote, config.CacheTTL(config.CacheTypeLatest, config.AppConfig.CacheShortTTL))
+		mu.Unlock()
 	}
 
 	for _, symbol := range qf.symbols {
@@ -112,3 +98,27 @@ func (qf *LatestQuoteFetcher) FetchToCache(stockCache cache.StockCache) error {
 	fmt.Println("Successfully fetched and updated stock data")
 	return nil
 }
+
+// fetchQuote fetches the latest quote of a symbol, retrying a bounded number of times while the API
+// answers 429.
+func (qf *LatestQuoteFetcher) fetchQuote(symbol string) (*entity.StockQuote, error) {
+	url := fmt.Sprintf("%s&symbol=%s", qf.url, symbol)
+	fmt.Printf("Fetching data for symbol %s from URL: %s\n", symbol, utils.RedactURL(url))
+
+	resp, err := breaker.For(breaker.ProviderFinnhub).GetWithRetry(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data for symbol %s: %w", symbol, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-OK HTTP status for symbol %s: %s", symbol, resp.Status)
+	}
+
+	var stockQuote entity.StockQuote
+	if err := json.NewDecoder(resp.Body).Decode(&stockQuote); err != nil {
+		return nil, fmt.Errorf("failed to decode data for symbol %s: %w", symbol, err)
+	}
+	stockQuote.Symbol = symbol
+	return &stockQuote, nil
+}
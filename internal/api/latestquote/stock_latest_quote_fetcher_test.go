@@ -0,0 +1,54 @@
+package latestquote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"stock-app/pkg/config"
+)
+
+func TestFetchQuote(t *testing.T) {
+	config.AppConfig.RateLimitRetries = 2
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantErr      bool
+		wantRequests int
+	}{
+		{name: "ok", statuses: []int{http.StatusOK}, wantRequests: 1},
+		{name: "rate limited once", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, wantRequests: 2},
+		{name: "rate limited past the retries", statuses: []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK}, wantErr: true, wantRequests: 3},
+		{name: "server error", statuses: []int{http.StatusInternalServerError}, wantErr: true, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[requests]
+				requests++
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					w.Write([]byte(`{"c": 190.5}`))
+				}
+			}))
+			defer server.Close()
+
+			qf := NewLatestQuoteFetcher(server.URL, "token", []string{"AAPL"})
+			quote, err := qf.fetchQuote("AAPL")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchQuote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", requests, tt.wantRequests)
+			}
+			if !tt.wantErr && (quote.Symbol != "AAPL" || quote.Price != 190.5) {
+				t.Errorf("fetchQuote() = %+v, want AAPL at 190.5", quote)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"stock-app/internal/api/breaker"
+	"stock-app/internal/entity"
+	"stock-app/pkg/utils"
+)
+
+// ProfileFetcher fetches company profiles from the Finnhub API.
+type ProfileFetcher struct {
+	url     string
+	symbols []string
+}
+
+// NewProfileFetcher creates a new instance of ProfileFetcher.
+func NewProfileFetcher(url string, apiToken string, symbols []string) *ProfileFetcher {
+	return &ProfileFetcher{
+		url:     url + "?token=" + apiToken,
+		symbols: utils.FilterValidSymbols(symbols),
+	}
+}
+
+// FetchToIndex fetches the profile of every symbol and adds it to the company index. Symbols whose
+// profile can't be fetched are skipped, so the index holds whatever could be resolved.
+func (pf *ProfileFetcher) FetchToIndex(companyIndex *entity.CompanyIndex) error {
+	failed := 0
+	for _, symbol := range pf.symbols {
+		profile, err := pf.fetchProfile(symbol)
+		if err != nil {
+			fmt.Printf("Failed to fetch company profile for symbol %s: %v\n", symbol, err)
+			failed++
+			continue
+		}
+		companyIndex.Set(profile)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to fetch %d of %d company profiles", failed, len(pf.symbols))
+	}
+	fmt.Println("Successfully fetched company profiles")
+	return nil
+}
+
+// fetchProfile fetches the profile of a symbol, waiting out a bounded number of rate limits.
+func (pf *ProfileFetcher) fetchProfile(symbol string) (*entity.CompanyProfile, error) {
+	url := fmt.Sprintf("%s&symbol=%s", pf.url, symbol)
+	resp, err := breaker.For(breaker.ProviderFinnhub).GetWithRetry(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch profile: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-OK HTTP status: %s", resp.Status)
+	}
+
+	var data struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	if data.Name == "" {
+		return nil, fmt.Errorf("no profile available")
+	}
+	return &entity.CompanyProfile{Symbol: symbol, Name: data.Name}, nil
+}
@@ -0,0 +1,51 @@
+package profile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"stock-app/internal/entity"
+	"stock-app/pkg/config"
+)
+
+func TestFetchToIndex(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("symbol") {
+		case "TSLA":
+			// Rate limited once before answering
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte(`{"name": "Tesla Inc"}`))
+		case "LIMIT":
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	appConfig := config.AppConfig
+	defer func() { config.AppConfig = appConfig }()
+	config.AppConfig.UpstreamTimeout = time.Second
+	config.AppConfig.RateLimitRetries = 2
+
+	companyIndex := entity.NewCompanyIndex()
+	pf := NewProfileFetcher(server.URL, "token", []string{"TSLA", "LIMIT", "NONE"})
+	if err := pf.FetchToIndex(companyIndex); err == nil {
+		t.Error("FetchToIndex succeeded, want an error for the rate limited and unknown symbols")
+	}
+	if matches := companyIndex.Resolve("Tesla"); len(matches) != 1 || matches[0].Symbol != "TSLA" {
+		t.Errorf("Resolve(Tesla) = %v, want TSLA", matches)
+	}
+	if matches := companyIndex.Resolve("limit"); len(matches) != 0 {
+		t.Errorf("Resolve(limit) = %v, want no match", matches)
+	}
+}
@@ -0,0 +1,93 @@
+package realtime
+
+import (
+	"time"
+
+	"stock-app/internal/entity"
+	"stock-app/pkg/utils"
+)
+
+// When the running high and low of real-time quotes start over.
+const (
+	// HighLowResetDay resets them on the first trade of a new day in the market's time zone.
+	HighLowResetDay = "day"
+	// HighLowResetSession also resets them whenever the regular session starts, even if the
+	// previous quote is already dated today.
+	HighLowResetSession = "session"
+)
+
+// startNewDay returns the quote a new trading day starts from: the last regular price becomes the
+// previous close, and the open, high, low and volume are cleared until the first regular trade.
+func startNewDay(prevQuote *entity.StockQuote) *entity.StockQuote {
+	prevClose := prevQuote.PrevClose
+	if prevQuote.Price != 0 {
+		prevClose = prevQuote.Price
+	}
+	return &entity.StockQuote{
+		Symbol:    prevQuote.Symbol,
+		Price:     prevQuote.Price,
+		PrevClose: prevClose,
+		Timestamp: prevQuote.Timestamp,
+	}
+}
+
+// applyTrade returns the quote that results from applying a trade to the symbol's previous quote.
+// Trades during the regular session update the regular fields; pre-market and after-hours trades
+// only update the extended hours fields, keeping the regular fields frozen at the last close.
+// The first trade of a new day in the market's time zone resets the accumulated volume and the
+// day's open, high and low. With HighLowResetSession, the open, high and low are also reset by the
+// first trade of each regular session. Quotes are timestamped with the exchange's wall clock time,
+// like the stored intraday data they are pre-populated from.
+func applyTrade(prevQuote *entity.StockQuote, price, volume float64, tradeTime time.Time, highLowReset string) *entity.StockQuote {
+	calendar := utils.CalendarForSymbol(prevQuote.Symbol)
+	session := calendar.Session(tradeTime)
+	wallClock := calendar.WallClock(tradeTime)
+
+	hasPrev := !prevQuote.Timestamp.IsZero()
+	if hasPrev && !sameDate(prevQuote.Timestamp, wallClock) {
+		prevQuote = startNewDay(prevQuote)
+	}
+
+	switch session {
+	case utils.SessionPreMarket, utils.SessionAfterHours:
+		stockQuote := *prevQuote
+		stockQuote.ExtendedHoursPrice = price
+		stockQuote.ExtendedHoursChange = price - prevQuote.Price
+		stockQuote.Timestamp = wallClock
+		return &stockQuote
+	}
+
+	// Calculate changes based on historical data
+	change := price - prevQuote.PrevClose
+	changePercentage := 0.0
+	if prevQuote.PrevClose != 0 {
+		changePercentage = (change / prevQuote.PrevClose) * 100
+	}
+
+	// The first regular trade of the day, or of the session when configured, opens it
+	sessionStarted := hasPrev && calendar.SessionAtWallClock(prevQuote.Timestamp) != utils.SessionRegular
+	openPrice, highPrice, lowPrice := prevQuote.OpenPrice, prevQuote.HighPrice, prevQuote.LowPrice
+	if openPrice == 0 || (highLowReset == HighLowResetSession && sessionStarted) {
+		openPrice, highPrice, lowPrice = price, price, price
+	}
+
+	return &entity.StockQuote{
+		Symbol:           prevQuote.Symbol,
+		Price:            price,
+		Change:           change,
+		ChangePercentage: changePercentage,
+		HighPrice:        utils.Max(price, highPrice),
+		LowPrice:         utils.Min(price, lowPrice),
+		OpenPrice:        openPrice,
+		PrevClose:        prevQuote.PrevClose,
+		Volume:           prevQuote.Volume + volume,
+		Timestamp:        wallClock,
+	}
+}
+
+// sameDate reports whether a and b, both wall clock times of the same market, fall on the same date.
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
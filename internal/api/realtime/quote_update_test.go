@@ -0,0 +1,141 @@
+package realtime
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"stock-app/internal/entity"
+)
+
+func TestApplyTrade(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	et := func(day, hour, min int) time.Time {
+		return time.Date(2025, time.June, day, hour, min, 0, 0, newYork)
+	}
+	// Quote timestamps are ET wall clock times stored as UTC
+	wallClock := func(day, hour, min int) time.Time {
+		return time.Date(2025, time.June, day, hour, min, 0, 0, time.UTC)
+	}
+	percent := func(change, prevClose float64) float64 {
+		return change / prevClose * 100
+	}
+	trading := &entity.StockQuote{Symbol: "AAPL", Price: 101, OpenPrice: 100, HighPrice: 102, LowPrice: 99, PrevClose: 98, Volume: 1000, Timestamp: wallClock(11, 10, 0)}
+	preMarket := &entity.StockQuote{Symbol: "AAPL", Price: 101, OpenPrice: 100, HighPrice: 102, LowPrice: 99, PrevClose: 98, Volume: 1000, Timestamp: wallClock(11, 9, 0)}
+
+	tests := []struct {
+		name         string
+		prev         *entity.StockQuote
+		price        float64
+		volume       float64
+		tradeTime    time.Time
+		highLowReset string
+		want         entity.StockQuote
+	}{
+		{
+			name:  "regular trade",
+			prev:  trading,
+			price: 103, volume: 10, tradeTime: et(11, 10, 1), highLowReset: HighLowResetDay,
+			want: entity.StockQuote{Price: 103, Change: 5, ChangePercentage: percent(5, 98), OpenPrice: 100, HighPrice: 103, LowPrice: 99, PrevClose: 98, Volume: 1010, Timestamp: wallClock(11, 10, 1)},
+		},
+		{
+			name:  "after-hours trade",
+			prev:  trading,
+			price: 97, volume: 10, tradeTime: et(11, 17, 0), highLowReset: HighLowResetDay,
+			want: entity.StockQuote{Price: 101, OpenPrice: 100, HighPrice: 102, LowPrice: 99, PrevClose: 98, Volume: 1000, ExtendedHoursPrice: 97, ExtendedHoursChange: -4, Timestamp: wallClock(11, 17, 0)},
+		},
+		{
+			name:  "first trade of a new day",
+			prev:  trading,
+			price: 105, volume: 10, tradeTime: et(12, 9, 30), highLowReset: HighLowResetDay,
+			want: entity.StockQuote{Price: 105, Change: 4, ChangePercentage: percent(4, 101), OpenPrice: 105, HighPrice: 105, LowPrice: 105, PrevClose: 101, Volume: 10, Timestamp: wallClock(12, 9, 30)},
+		},
+		{
+			name:  "session start keeps the day's high and low",
+			prev:  preMarket,
+			price: 103, volume: 10, tradeTime: et(11, 9, 30), highLowReset: HighLowResetDay,
+			want: entity.StockQuote{Price: 103, Change: 5, ChangePercentage: percent(5, 98), OpenPrice: 100, HighPrice: 103, LowPrice: 99, PrevClose: 98, Volume: 1010, Timestamp: wallClock(11, 9, 30)},
+		},
+		{
+			name:  "session start resets the high and low",
+			prev:  preMarket,
+			price: 103, volume: 10, tradeTime: et(11, 9, 30), highLowReset: HighLowResetSession,
+			want: entity.StockQuote{Price: 103, Change: 5, ChangePercentage: percent(5, 98), OpenPrice: 103, HighPrice: 103, LowPrice: 103, PrevClose: 98, Volume: 1010, Timestamp: wallClock(11, 9, 30)},
+		},
+		{
+			name:  "first trade ever",
+			prev:  &entity.StockQuote{Symbol: "AAPL", PrevClose: 100},
+			price: 101, volume: 10, tradeTime: et(11, 10, 0), highLowReset: HighLowResetDay,
+			want: entity.StockQuote{Price: 101, Change: 1, ChangePercentage: percent(1, 100), OpenPrice: 101, HighPrice: 101, LowPrice: 101, PrevClose: 100, Volume: 10, Timestamp: wallClock(11, 10, 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyTrade(tt.prev, tt.price, tt.volume, tt.tradeTime, tt.highLowReset)
+			tt.want.Symbol = "AAPL"
+			if *got != tt.want {
+				t.Errorf("applyTrade() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTradeNewDay(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	et := func(day, hour, min int) time.Time {
+		return time.Date(2025, time.June, day, hour, min, 0, 0, newYork)
+	}
+
+	// Trades from Wednesday's open to Thursday's, including Wednesday evening's after-hours trade
+	quote := &entity.StockQuote{Symbol: "AAPL", PrevClose: 100}
+	trades := []struct {
+		price, volume float64
+		tradeTime     time.Time
+	}{
+		{101, 10, et(11, 9, 30)},
+		{104, 20, et(11, 12, 0)},
+		{99, 30, et(11, 15, 59)},
+		{98, 40, et(11, 17, 0)},
+		{102, 5, et(12, 9, 30)},
+		{103, 7, et(12, 9, 31)},
+	}
+	var volumes []float64
+	for _, trade := range trades {
+		quote = applyTrade(quote, trade.price, trade.volume, trade.tradeTime, HighLowResetDay)
+		volumes = append(volumes, quote.Volume)
+	}
+
+	if want := []float64{10, 30, 60, 60, 5, 12}; !reflect.DeepEqual(volumes, want) {
+		t.Errorf("volumes = %v, want %v", volumes, want)
+	}
+	want := entity.StockQuote{Symbol: "AAPL", Price: 103, Change: 4, ChangePercentage: 4.0 / 99 * 100, OpenPrice: 102, HighPrice: 103, LowPrice: 102, PrevClose: 99, Volume: 12, Timestamp: time.Date(2025, time.June, 12, 9, 31, 0, 0, time.UTC)}
+	if *quote != want {
+		t.Errorf("quote after Thursday's first trades = %+v, want %+v", *quote, want)
+	}
+}
+
+func TestSameDate(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b time.Time
+		want bool
+	}{
+		{name: "same date", a: time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC), b: time.Date(2025, time.June, 11, 23, 59, 0, 0, time.UTC), want: true},
+		{name: "next date", a: time.Date(2025, time.June, 11, 23, 59, 0, 0, time.UTC), b: time.Date(2025, time.June, 12, 0, 0, 0, 0, time.UTC), want: false},
+		{name: "same day of another month", a: time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC), b: time.Date(2025, time.July, 11, 10, 0, 0, 0, time.UTC), want: false},
+		{name: "same day of another year", a: time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC), b: time.Date(2024, time.June, 11, 10, 0, 0, 0, time.UTC), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameDate(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameDate(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
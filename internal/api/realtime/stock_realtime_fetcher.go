@@ -1,127 +1,323 @@
 package realtime
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/gorilla/websocket"
 
 	"stock-app/internal/entity"
+	"stock-app/internal/hub"
+	"stock-app/pkg/config"
+	"stock-app/pkg/logger"
 	"stock-app/pkg/utils"
 )
 
+// emaSmoothing is the weight given to the newest trade price when updating a symbol's EMA.
+const emaSmoothing = 0.1
+
+// A symbol's EMA is re-seeded from the trade price after this many consecutive rejected trades,
+// or when no trade was accepted for emaStaleAfter, so a genuine gap (an overnight move, a split or
+// a halt) is accepted instead of freezing the symbol.
+const (
+	maxConsecutiveAnomalies = 5
+	emaStaleAfter           = 15 * time.Minute
+)
+
+// Bounds of the exponential backoff between reconnection attempts.
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
 // RealTimeFetcher manages real-time data from WebSocket API.
 type RealTimeFetcher struct {
-	wsURL   string
-	symbols []string
+	wsURL            string
+	symbols          []string
+	ema              map[string]float64
+	emaUpdated       map[string]time.Time
+	rejections       map[string]int
+	anomalyThreshold float64
+	bars             map[string]*entity.StockQuote
+	quoteHub         *hub.Hub
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+	highLowReset     string
+	log              *logger.Logger
 }
 
 // NewRealTimeFetcher creates a new instance of the real-time RealTimeFetcher.
-func NewRealTimeFetcher(wsURL, apiToken string, symbols []string) *RealTimeFetcher {
+// Every quote update is published to quoteHub for streaming clients. Messages and trades are only
+// logged at debug level since they arrive many times per second.
+func NewRealTimeFetcher(wsURL, apiToken string, symbols []string, quoteHub *hub.Hub, log *logger.Logger) *RealTimeFetcher {
 	return &RealTimeFetcher{
-		wsURL:   wsURL + "?token=" + apiToken,
-		symbols: symbols}
+		wsURL:            wsURL + "?token=" + apiToken,
+		symbols:          utils.FilterValidSymbols(symbols),
+		ema:              make(map[string]float64),
+		emaUpdated:       make(map[string]time.Time),
+		rejections:       make(map[string]int),
+		anomalyThreshold: config.AppConfig.AnomalyThreshold,
+		bars:             make(map[string]*entity.StockQuote),
+		quoteHub:         quoteHub,
+		readTimeout:      config.AppConfig.RealTimeReadTimeout,
+		writeTimeout:     config.AppConfig.RealTimeWriteTimeout,
+		highLowReset:     config.AppConfig.HighLowReset,
+		log:              log,
+	}
 }
 
-// StartRealTimeUpdates starts fetching real-time updates and updating the in-memory storage.
-func (h *RealTimeFetcher) StartRealTimeUpdates(latestQuoteData *entity.LatestQuoteData) {
-	go func() {
-		// Connect to WebSocket
-		fmt.Printf("Connecting to WebSocket at URL: %s\n", h.wsURL)
-		conn, _, err := websocket.DefaultDialer.Dial(h.wsURL, nil)
-		if err != nil {
-			fmt.Printf("Failed to connect to WebSocket: %v\n", err)
-			return
+// isAnomalous reports whether price deviates from the symbol's EMA by more than the
+// configured threshold (in percent). The EMA is seeded with seed on first use and only
+// accepted prices are folded into it, so a bad tick cannot drag the average along. The EMA is
+// re-seeded with price once it is stale or has rejected maxConsecutiveAnomalies trades in a row.
+func (h *RealTimeFetcher) isAnomalous(symbol string, price, seed float64, tradeTime time.Time) bool {
+	ema, exists := h.ema[symbol]
+	if !exists || ema <= 0 {
+		ema = seed
+	}
+	if updated, ok := h.emaUpdated[symbol]; ok && tradeTime.Sub(updated) > emaStaleAfter {
+		ema = price
+	}
+
+	if h.anomalyThreshold > 0 && ema > 0 {
+		deviation := math.Abs(price-ema) / ema * 100
+		if deviation > h.anomalyThreshold {
+			h.rejections[symbol]++
+			if h.rejections[symbol] < maxConsecutiveAnomalies {
+				return true
+			}
+			fmt.Printf("Re-seeding EMA for symbol %s after %d consecutive anomalous trades\n", symbol, h.rejections[symbol])
+			ema = price
 		}
-		defer conn.Close()
-		fmt.Println("WebSocket connection established.")
-
-		// Subscribe to stock symbols
-		for _, symbol := range h.symbols {
-			msg := map[string]interface{}{"type": "subscribe", "symbol": symbol}
-			fmt.Printf("Subscribing to symbol: %s\n", symbol)
-			if err := conn.WriteJSON(msg); err != nil {
-				fmt.Printf("Failed to send subscription message for %s: %v\n", symbol, err)
+	}
+	delete(h.rejections, symbol)
+	h.emaUpdated[symbol] = tradeTime
+
+	if ema <= 0 {
+		h.ema[symbol] = price
+	} else {
+		h.ema[symbol] = emaSmoothing*price + (1-emaSmoothing)*ema
+	}
+	return false
+}
+
+// updateBar folds a trade into the symbol's current 1-minute bar. When the trade starts a new
+// minute, the previous bar is complete and is returned; otherwise nil is returned.
+func (h *RealTimeFetcher) updateBar(symbol string, price, volume, prevClose float64, tradeTime time.Time) *entity.StockQuote {
+	minute := tradeTime.Truncate(time.Minute)
+	bar, exists := h.bars[symbol]
+	if exists && bar.Timestamp.Equal(minute) {
+		bar.Price = price
+		bar.HighPrice = utils.Max(bar.HighPrice, price)
+		bar.LowPrice = utils.Min(bar.LowPrice, price)
+		bar.Volume += volume
+		return nil
+	}
+
+	h.bars[symbol] = &entity.StockQuote{
+		Symbol:    symbol,
+		Price:     price,
+		HighPrice: price,
+		LowPrice:  price,
+		OpenPrice: price,
+		PrevClose: prevClose,
+		Volume:    volume,
+		Timestamp: minute,
+	}
+	if exists && bar.Timestamp.Before(minute) {
+		return bar
+	}
+	return nil
+}
+
+// StartRealTimeUpdates starts fetching real-time updates and updating the in-memory storage until ctx
+// is cancelled. Completed 1-minute bars are sent to bars for persistence. Whenever the connection
+// fails, including when no message or pong arrives within the read timeout, it reconnects with
+// exponential backoff. Once ctx is cancelled, the bars still in progress are sent and bars is closed.
+func (h *RealTimeFetcher) StartRealTimeUpdates(ctx context.Context, latestQuoteData *entity.LatestQuoteData, bars chan<- *entity.StockQuote) {
+	go func() {
+		defer close(bars)
+		defer h.flushOpenBars(bars)
+
+		delay := minReconnectDelay
+		for {
+			connected, err := h.consume(ctx, latestQuoteData, bars)
+			if ctx.Err() != nil {
+				fmt.Println("Real-time updates stopped.")
+				return
+			}
+			if connected {
+				delay = minReconnectDelay
+			}
+			fmt.Printf("WebSocket connection lost: %v, reconnecting in %v\n", err, delay)
+			select {
+			case <-ctx.Done():
+				fmt.Println("Real-time updates stopped.")
 				return
+			case <-time.After(delay):
 			}
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		}
+	}()
+}
+
+// flushOpenBars sends the bars still in progress, which no later trade will complete.
+func (h *RealTimeFetcher) flushOpenBars(bars chan<- *entity.StockQuote) {
+	for symbol, bar := range h.bars {
+		bars <- bar
+		delete(h.bars, symbol)
+	}
+}
+
+// readDeadline returns the deadline for the next read, or the zero time, meaning none, when the read
+// timeout is not positive.
+func (h *RealTimeFetcher) readDeadline() time.Time {
+	if h.readTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(h.readTimeout)
+}
+
+// consume connects to the WebSocket, subscribes to the symbols and processes messages until the
+// connection fails or ctx is cancelled. It reports whether the connection was established along with
+// the error that ended it.
+func (h *RealTimeFetcher) consume(ctx context.Context, latestQuoteData *entity.LatestQuoteData, bars chan<- *entity.StockQuote) (bool, error) {
+	// Connect to WebSocket
+	fmt.Printf("Connecting to WebSocket at URL: %s\n", utils.RedactURL(h.wsURL))
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, h.wsURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to WebSocket: %w", err)
+	}
+	defer conn.Close()
+	fmt.Println("WebSocket connection established.")
+
+	// A half-open connection never errors on its own, so every read must complete before the read
+	// deadline, which is pushed back on each message and pong
+	if err := conn.SetReadDeadline(h.readDeadline()); err != nil {
+		return true, fmt.Errorf("failed to set read deadline: %w", err)
+	}
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(h.readDeadline())
+	})
+
+	// Subscribe to stock symbols
+	for _, symbol := range h.symbols {
+		msg := map[string]interface{}{"type": "subscribe", "symbol": symbol}
+		fmt.Printf("Subscribing to symbol: %s\n", symbol)
+		if err := conn.SetWriteDeadline(time.Now().Add(h.writeTimeout)); err != nil {
+			return true, fmt.Errorf("failed to set write deadline: %w", err)
 		}
+		if err := conn.WriteJSON(msg); err != nil {
+			return true, fmt.Errorf("failed to send subscription message for %s: %w", symbol, err)
+		}
+	}
 
+	// Ping the server so quiet periods without trades still produce pongs to read, and close the
+	// connection once ctx is cancelled to unblock the pending read
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// A nil channel never fires, leaving the pings disabled along with the read timeout
+		var heartbeat <-chan time.Time
+		if h.readTimeout > 0 {
+			ticker := time.NewTicker(h.readTimeout / 2)
+			defer ticker.Stop()
+			heartbeat = ticker.C
+		}
 		for {
-			var response map[string]interface{}
-			err := conn.ReadJSON(&response)
-			if err != nil {
-				fmt.Printf("Error reading WebSocket data: %v\n", err)
-				continue
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-heartbeat:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.writeTimeout)); err != nil {
+					fmt.Printf("Failed to ping WebSocket: %v\n", err)
+					return
+				}
 			}
+		}
+	}()
+
+	for {
+		var response map[string]interface{}
+		if err := conn.ReadJSON(&response); err != nil {
+			return true, fmt.Errorf("error reading WebSocket data: %w", err)
+		}
+		if err := conn.SetReadDeadline(h.readDeadline()); err != nil {
+			return true, fmt.Errorf("failed to set read deadline: %w", err)
+		}
 
-			fmt.Printf("Received response from WebSocket: %v\n", response)
+		h.log.Debugf("Received response from WebSocket: %v", response)
 
-			if response["type"] == "trade" {
-				trades, ok := response["data"].([]interface{})
+		// Finnhub reports rejected subscriptions, e.g. past the plan's symbol limit, as error messages
+		if response["type"] == "error" {
+			fmt.Printf("Warning: WebSocket error, subscriptions may have been rejected (check MAX_SYMBOLS against your Finnhub plan): %v\n", response["msg"])
+			continue
+		}
+
+		if response["type"] == "trade" {
+			trades, ok := response["data"].([]interface{})
+			if !ok {
+				fmt.Printf("Unexpected data format: %v\n", response["data"])
+				continue
+			}
+
+			for _, trade := range trades {
+				tradeData, ok := trade.(map[string]interface{})
 				if !ok {
-					fmt.Printf("Unexpected data format: %v\n", response["data"])
+					fmt.Printf("Unexpected trade format: %v\n", trade)
 					continue
 				}
-
-				fmt.Printf("Processing trades: %v\n", trades)
-
-				for _, trade := range trades {
-					tradeData, ok := trade.(map[string]interface{})
-					if !ok {
-						fmt.Printf("Unexpected trade format: %v\n", trade)
-						continue
-					}
-
-					symbol := tradeData["s"].(string)
-					price := tradeData["p"].(float64)
-					timestamp := int64(tradeData["t"].(float64))
-					volume := tradeData["v"].(float64)
-
-					fmt.Printf("Trade received for symbol %s: Price = %.2f, Volume = %.2f, Timestamp = %d\n", symbol, price, volume, timestamp)
-
-					// Fetch historical data for calculations
-					latestQuoteData.Mu.RLock()
-					prevQuote, exists := latestQuoteData.StockData[symbol]
-					latestQuoteData.Mu.RUnlock()
-
-					if !exists {
-						fmt.Printf("No previous data for symbol %s\n", symbol)
-						continue // Skip updating this symbol as historical data is missing
-					}
-
-					fmt.Printf("Previous data for %s: %+v\n", symbol, prevQuote)
-
-					// Calculate changes based on historical data
-					change := price - prevQuote.PrevClose
-					changePercentage := (change / prevQuote.PrevClose) * 100
-					highPrice := utils.Max(price, prevQuote.HighPrice)
-					lowPrice := utils.Min(price, prevQuote.LowPrice)
-					currentVolume := prevQuote.Volume + volume
-
-					// Create StockQuote with updated values
-					stockQuote := &entity.StockQuote{
-						Symbol:           symbol,
-						Price:            price,
-						Change:           change,
-						ChangePercentage: changePercentage,
-						HighPrice:        highPrice,
-						LowPrice:         lowPrice,
-						OpenPrice:        prevQuote.OpenPrice,
-						PrevClose:        prevQuote.PrevClose,
-						Volume:           currentVolume,
-						Timestamp:        time.Unix(0, timestamp*int64(time.Millisecond)),
-					}
-
-					fmt.Printf("Updated stock data for %s: %+v\n", symbol, stockQuote)
-
-					// Update real-time data in-memory
-					latestQuoteData.Mu.Lock()
-					latestQuoteData.StockData[symbol] = stockQuote
-					latestQuoteData.Mu.Unlock()
-
-					fmt.Printf("Real-time data updated for symbol %s\n", symbol)
-				}
+				h.handleTrade(tradeData, latestQuoteData, bars)
 			}
 		}
-	}()
+	}
+}
+
+// handleTrade applies a single trade message to the in-memory storage and the symbol's current bar.
+func (h *RealTimeFetcher) handleTrade(tradeData map[string]interface{}, latestQuoteData *entity.LatestQuoteData, bars chan<- *entity.StockQuote) {
+	symbol := utils.NormalizeSymbol(tradeData["s"].(string))
+	price := tradeData["p"].(float64)
+	timestamp := int64(tradeData["t"].(float64))
+	volume := tradeData["v"].(float64)
+
+	h.log.Debugf("Trade received for symbol %s: Price = %.2f, Volume = %.2f, Timestamp = %d", symbol, price, volume, timestamp)
+
+	// Fetch historical data for calculations
+	prevQuote, exists := latestQuoteData.Get(symbol)
+
+	if !exists {
+		h.log.Debugf("No previous data for symbol %s", symbol)
+		return // Skip updating this symbol as historical data is missing
+	}
+
+	tradeTime := time.Unix(0, timestamp*int64(time.Millisecond))
+	if h.isAnomalous(symbol, price, prevQuote.Price, tradeTime) {
+		fmt.Printf("Anomalous trade rejected for symbol %s: Price = %.2f, EMA = %.2f, Threshold = %.2f%%\n", symbol, price, h.ema[symbol], h.anomalyThreshold)
+		return
+	}
+
+	stockQuote := applyTrade(prevQuote, price, volume, tradeTime, h.highLowReset)
+
+	h.log.Debugf("Updated stock data for %s: %+v", symbol, stockQuote)
+
+	// Update real-time data in-memory
+	latestQuoteData.Set(symbol, stockQuote)
+	h.quoteHub.Publish(stockQuote)
+
+	// Emit the previous bar once a trade opens a new minute. Bars are stored at the wall clock time
+	// of the symbol's exchange, like the intraday data of the refresh.
+	if bar := h.updateBar(symbol, price, volume, prevQuote.PrevClose, utils.CalendarForSymbol(symbol).WallClock(tradeTime)); bar != nil {
+		select {
+		case bars <- bar:
+		default:
+			fmt.Printf("Bar buffer full, dropping bar for symbol %s at %v\n", symbol, bar.Timestamp)
+		}
+	}
 }
@@ -0,0 +1,172 @@
+package realtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"stock-app/internal/entity"
+)
+
+func TestIsAnomalous(t *testing.T) {
+	start := time.Date(2025, time.June, 11, 14, 0, 0, 0, time.UTC)
+	type trade struct {
+		price float64
+		after time.Duration
+	}
+
+	tests := []struct {
+		name   string
+		trades []trade
+		want   []bool
+	}{
+		{name: "within the threshold of the seed", trades: []trade{{price: 104}}, want: []bool{false}},
+		{name: "beyond the threshold of the seed", trades: []trade{{price: 106}}, want: []bool{true}},
+		{
+			name:   "10x spike in a normal series",
+			trades: []trade{{price: 100}, {price: 101, after: time.Second}, {price: 99, after: 2 * time.Second}, {price: 1000, after: 3 * time.Second}, {price: 100, after: 4 * time.Second}},
+			want:   []bool{false, false, false, true, false},
+		},
+		{name: "bad tick kept out of the EMA", trades: []trade{{price: 200}, {price: 101, after: time.Second}}, want: []bool{true, false}},
+		{
+			name:   "re-seeded after consecutive anomalies",
+			trades: []trade{{price: 200}, {price: 200}, {price: 200}, {price: 200}, {price: 200}, {price: 201}},
+			want:   []bool{true, true, true, true, false, false},
+		},
+		{name: "re-seeded once stale", trades: []trade{{price: 100}, {price: 150, after: emaStaleAfter + time.Minute}}, want: []bool{false, false}},
+		{name: "not yet stale", trades: []trade{{price: 100}, {price: 150, after: emaStaleAfter}}, want: []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &RealTimeFetcher{
+				ema:              make(map[string]float64),
+				emaUpdated:       make(map[string]time.Time),
+				rejections:       make(map[string]int),
+				anomalyThreshold: 5,
+			}
+			for i, trade := range tt.trades {
+				if got := h.isAnomalous("AAPL", trade.price, 100, start.Add(trade.after)); got != tt.want[i] {
+					t.Errorf("trade %d at %v: isAnomalous() = %v, want %v", i, trade.price, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateBar(t *testing.T) {
+	at := func(min, sec int) time.Time {
+		return time.Date(2025, time.June, 11, 10, min, sec, 0, time.UTC)
+	}
+	h := &RealTimeFetcher{bars: make(map[string]*entity.StockQuote)}
+
+	trades := []struct {
+		price, volume float64
+		time          time.Time
+	}{
+		{100, 10, at(0, 5)},
+		{102, 5, at(0, 30)},
+		{99, 1, at(0, 59)},
+	}
+	for _, trade := range trades {
+		if bar := h.updateBar("AAPL", trade.price, trade.volume, 98, trade.time); bar != nil {
+			t.Fatalf("updateBar() completed a bar within its minute: %+v", bar)
+		}
+	}
+
+	// The first trade of the next minute completes the previous bar
+	bar := h.updateBar("AAPL", 101, 2, 98, at(1, 0))
+	if bar == nil {
+		t.Fatal("updateBar() did not complete the bar when a new minute started")
+	}
+	want := entity.StockQuote{Symbol: "AAPL", OpenPrice: 100, HighPrice: 102, LowPrice: 99, Price: 99, PrevClose: 98, Volume: 16, Timestamp: at(0, 0)}
+	if *bar != want {
+		t.Errorf("completed bar = %+v, want %+v", *bar, want)
+	}
+
+	// A late trade of an earlier minute doesn't complete the current bar
+	if bar := h.updateBar("AAPL", 100, 1, 98, at(0, 59)); bar != nil {
+		t.Errorf("updateBar() completed a bar on a late trade: %+v", bar)
+	}
+}
+
+func TestReadDeadlineReconnects(t *testing.T) {
+	// The server accepts every connection and then goes silent, never reading the client's pings
+	// nor answering them, like a half-open connection behind a load balancer
+	connections := make(chan struct{}, 2)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		select {
+		case connections <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	h := &RealTimeFetcher{
+		wsURL:        "ws" + strings.TrimPrefix(server.URL, "http"),
+		symbols:      []string{"AAPL"},
+		bars:         make(map[string]*entity.StockQuote),
+		readTimeout:  100 * time.Millisecond,
+		writeTimeout: 100 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.StartRealTimeUpdates(ctx, entity.NewLatestQuoteData(), make(chan *entity.StockQuote, 1))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-connections:
+		case <-time.After(minReconnectDelay + 2*time.Second):
+			t.Fatalf("got %d connections, want a reconnect once the read deadline fired", i)
+		}
+	}
+}
+
+func TestStopFlushesOpenBars(t *testing.T) {
+	// Nothing listens on the port, so the fetcher waits to reconnect until ctx is cancelled
+	server := httptest.NewServer(http.NotFoundHandler())
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	server.Close()
+
+	open := &entity.StockQuote{Symbol: "AAPL", Price: 201, Timestamp: time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)}
+	h := &RealTimeFetcher{
+		wsURL:        wsURL,
+		symbols:      []string{"AAPL"},
+		bars:         map[string]*entity.StockQuote{"AAPL": open},
+		writeTimeout: 100 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	bars := make(chan *entity.StockQuote, 1)
+	h.StartRealTimeUpdates(ctx, entity.NewLatestQuoteData(), bars)
+	cancel()
+
+	var flushed []*entity.StockQuote
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case bar, ok := <-bars:
+			if ok {
+				flushed = append(flushed, bar)
+				continue
+			}
+			if len(flushed) != 1 || flushed[0] != open {
+				t.Errorf("bars sent on stop = %v, want the open AAPL bar", flushed)
+			}
+			return
+		case <-timeout:
+			t.Fatal("bars was not closed after ctx was cancelled")
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+	apperrors "stock-app/pkg/errors"
+	"stock-app/pkg/utils"
+)
+
+// sliceLength is the span of history covered by each extended history slice, year1month1 being the
+// most recent 30 days.
+const sliceLength = 30 * 24 * time.Hour
+
+// maxSlices is the number of extended history slices, year1month1 to year2month12.
+const maxSlices = 24
+
+// sliceName returns the name of the nth extended history slice, counting from 1 for year1month1.
+func sliceName(n int) string {
+	return fmt.Sprintf("year%dmonth%d", (n-1)/12+1, (n-1)%12+1)
+}
+
+// slicesForRange returns the extended history slices overlapping from up to, but excluding, to, as of
+// now, newest first. Parts of the range older than the last slice can't be fetched and are left out.
+func slicesForRange(from, to, now time.Time) []string {
+	var slices []string
+	for n := 1; n <= maxSlices; n++ {
+		sliceEnd := now.Add(-time.Duration(n-1) * sliceLength)
+		sliceStart := sliceEnd.Add(-sliceLength)
+		if sliceStart.Before(to) && sliceEnd.After(from) {
+			slices = append(slices, sliceName(n))
+		}
+	}
+	return slices
+}
+
+// backfillCovered reports whether the stored intraday bars of symbol, counted per YYYY-MM-DD date,
+// already cover every trading day from up to, but excluding, to, so a resumed backfill can skip the
+// symbol. A day is covered once it holds at least a bar per minute of the regular session, so days
+// missing in the middle of the range or cut short by an interrupted backfill are fetched again.
+func backfillCovered(symbol string, counts map[string]int, from, to time.Time) bool {
+	calendar := utils.CalendarForSymbol(symbol)
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !calendar.IsTradingDay(calendar.FromWallClock(day)) {
+			continue
+		}
+		if counts[day.Format("2006-01-02")] < calendar.RegularMinutes() {
+			return false
+		}
+	}
+	return true
+}
+
+// barsInRange returns the bars from `from` up to, but excluding, `to`. A zero from or to leaves that
+// side unbounded.
+func barsInRange(bars []*entity.StockQuote, from, to time.Time) []*entity.StockQuote {
+	if from.IsZero() && to.IsZero() {
+		return bars
+	}
+	kept := bars[:0]
+	for _, bar := range bars {
+		if (!from.IsZero() && bar.Timestamp.Before(from)) || (!to.IsZero() && !bar.Timestamp.Before(to)) {
+			continue
+		}
+		kept = append(kept, bar)
+	}
+	return kept
+}
+
+// BackfillIntradayRange backfills the intraday history from up to, but excluding, to for every symbol,
+// fetching the extended history slices overlapping the range one symbol at a time through the rate
+// limiter. Symbols whose stored intraday data already covers the range are skipped, so an interrupted
+// backfill can be resumed by running it again. Progress is printed after each symbol.
+func (tf *TimeSeriesFetcher) BackfillIntradayRange(from, to time.Time, stockRepo repository.StockRepo) error {
+	if !from.Before(to) {
+		return fmt.Errorf("invalid range: from %s is not before to %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	slices := slicesForRange(from, to, time.Now())
+	if len(slices) == 0 {
+		return fmt.Errorf("range %s to %s is older than the extended history", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	fmt.Printf("Backfilling %d symbols from %s to %s using slices %v\n", len(tf.symbols), from.Format("2006-01-02"), to.Format("2006-01-02"), slices)
+
+	var skipped, failed []string
+	inserted := 0
+	for i, symbol := range tf.symbols {
+		progress := fmt.Sprintf("[%d/%d] %s", i+1, len(tf.symbols), symbol)
+
+		counts, err := stockRepo.GetIntradayDayCounts(symbol, from, to)
+		if err != nil {
+			fmt.Printf("%s: failed to check stored data: %v\n", progress, err)
+			failed = append(failed, symbol)
+			continue
+		}
+		if backfillCovered(symbol, counts, from, to) {
+			fmt.Printf("%s: stored data already covers the range, skipping\n", progress)
+			skipped = append(skipped, symbol)
+			continue
+		}
+
+		symbolInserted := 0
+		for _, slice := range slices {
+			n, err := tf.fetchIntradayExtended(symbol, slice, from, to, stockRepo)
+			symbolInserted += n
+			if err != nil {
+				// A premium endpoint fails the same way for every symbol, so stop hammering it
+				var premium *apperrors.PremiumEndpointError
+				if errors.As(err, &premium) {
+					return err
+				}
+				fmt.Printf("%s: error backfilling %s: %v\n", progress, slice, err)
+				failed = append(failed, symbol)
+				break
+			}
+		}
+		inserted += symbolInserted
+		fmt.Printf("%s: %d rows inserted (%d in total)\n", progress, symbolInserted, inserted)
+	}
+
+	fmt.Printf("Backfilled %d of %d symbols, %d skipped, %d failed, %d rows inserted.\n",
+		len(tf.symbols)-len(skipped)-len(failed), len(tf.symbols), len(skipped), len(failed), inserted)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to backfill symbols: %v", failed)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package timeseries
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackfillCovered(t *testing.T) {
+	// Wednesday to the following Tuesday, with a weekend in between
+	from := time.Date(2025, time.March, 12, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, time.March, 19, 0, 0, 0, 0, time.UTC)
+	full := func(days ...string) map[string]int {
+		counts := make(map[string]int, len(days))
+		for _, day := range days {
+			counts[day] = 390
+		}
+		return counts
+	}
+	tradingDays := []string{"2025-03-12", "2025-03-13", "2025-03-14", "2025-03-17", "2025-03-18"}
+
+	tests := []struct {
+		name   string
+		counts map[string]int
+		from   time.Time
+		to     time.Time
+		want   bool
+	}{
+		{name: "every trading day full", counts: full(tradingDays...), from: from, to: to, want: true},
+		{name: "nothing stored", counts: map[string]int{}, from: from, to: to, want: false},
+		{name: "hole in the middle", counts: full("2025-03-12", "2025-03-13", "2025-03-17", "2025-03-18"), from: from, to: to, want: false},
+		{
+			name:   "day cut short",
+			counts: func() map[string]int { c := full(tradingDays...); c["2025-03-14"] = 120; return c }(),
+			from:   from,
+			to:     to,
+			want:   false,
+		},
+		{name: "weekend only", counts: map[string]int{}, from: time.Date(2025, time.March, 15, 0, 0, 0, 0, time.UTC), to: time.Date(2025, time.March, 17, 0, 0, 0, 0, time.UTC), want: true},
+		{name: "holiday skipped", counts: full("2025-04-17"), from: time.Date(2025, time.April, 17, 0, 0, 0, 0, time.UTC), to: time.Date(2025, time.April, 19, 0, 0, 0, 0, time.UTC), want: true},
+		{name: "end is exclusive", counts: full("2025-03-12"), from: from, to: from.AddDate(0, 0, 1), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backfillCovered("AAPL", tt.counts, tt.from, tt.to); got != tt.want {
+				t.Errorf("backfillCovered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package timeseries
+
+import (
+	"stock-app/pkg/logger"
+)
+
+// insertProgress logs the rows inserted for a symbol, sampling so large fetches and backfills
+// don't flood the logs: each row is only logged at debug level, and a summary is logged at info
+// level every `every` rows and once the fetch completes.
+type insertProgress struct {
+	log      *logger.Logger
+	dataType string
+	symbol   string
+	every    int
+	inserted int
+	skipped  int
+}
+
+// newInsertProgress creates an insertProgress for the rows of a symbol and data type, summarizing
+// every `every` rows, or only at the end if it is not positive.
+func newInsertProgress(log *logger.Logger, dataType, symbol string, every int) *insertProgress {
+	return &insertProgress{log: log, dataType: dataType, symbol: symbol, every: every}
+}
+
+// fields returns the log fields of the progress so far.
+func (p *insertProgress) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"type":     p.dataType,
+		"symbol":   p.symbol,
+		"inserted": p.inserted,
+		"skipped":  p.skipped,
+	}
+}
+
+// insert records a row inserted at the given timestamp or date.
+func (p *insertProgress) insert(at string) {
+	p.log.Debugf("Inserted %s data for symbol: %s, at: %s", p.dataType, p.symbol, at)
+	p.inserted++
+	if p.every > 0 && p.inserted%p.every == 0 {
+		p.log.WithFields(p.fields()).Info("Insert progress")
+	}
+}
+
+// skip records a row skipped because it is not newer than the stored data.
+func (p *insertProgress) skip(at string) {
+	p.log.Debugf("Skipping %s data for symbol: %s, at: %s as it is before or equal to the latest in DB", p.dataType, p.symbol, at)
+	p.skipped++
+}
+
+// keep records a row skipped because the stored row is of a preferred source.
+func (p *insertProgress) keep(at string) {
+	p.log.Debugf("Keeping stored %s data for symbol: %s, at: %s as its source is preferred", p.dataType, p.symbol, at)
+	p.skipped++
+}
+
+// done logs the final summary.
+func (p *insertProgress) done() {
+	p.log.WithFields(p.fields()).Info("Insert completed")
+}
@@ -0,0 +1,53 @@
+package timeseries
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"stock-app/pkg/logger"
+)
+
+func TestInsertProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		every     int
+		inserts   int
+		wantInfo  int
+		wantDebug int
+	}{
+		{name: "summary every 1000 rows", level: "info", every: 1000, inserts: 2500, wantInfo: 2},
+		{name: "summary at a multiple of the cadence", level: "info", every: 1000, inserts: 3000, wantInfo: 3},
+		{name: "fewer rows than the cadence", level: "info", every: 1000, inserts: 999},
+		{name: "summary only at the end", level: "info", every: 0, inserts: 2500},
+		{name: "rows at debug level", level: "debug", every: 2, inserts: 5, wantInfo: 2, wantDebug: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			log := logger.NewLogger(tt.level)
+			log.SetOutput(&out)
+
+			progress := newInsertProgress(log, "intraday", "AAPL", tt.every)
+			for i := 0; i < tt.inserts; i++ {
+				progress.insert(fmt.Sprintf("row %d", i))
+			}
+			progress.skip("old row")
+			progress.done()
+
+			logs := out.String()
+			if got := strings.Count(logs, `msg="Insert progress"`); got != tt.wantInfo {
+				t.Errorf("logged %d progress summaries, want %d", got, tt.wantInfo)
+			}
+			if got := strings.Count(logs, "level=debug"); got != tt.wantDebug {
+				t.Errorf("logged %d debug lines, want %d", got, tt.wantDebug)
+			}
+			want := fmt.Sprintf("inserted=%d skipped=1 symbol=AAPL type=intraday", tt.inserts)
+			if !strings.Contains(logs, `msg="Insert completed"`) || !strings.Contains(logs, want) {
+				t.Errorf("logs = %q, want a completion summary with %s", logs, want)
+			}
+		})
+	}
+}
@@ -1,154 +1,533 @@
 package timeseries
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/go-playground/validator/v10"
+
+	"stock-app/internal/api/breaker"
 	"stock-app/internal/entity"
+	"stock-app/internal/metrics"
 	"stock-app/internal/repository"
+	"stock-app/pkg/config"
+	apperrors "stock-app/pkg/errors"
+	"stock-app/pkg/logger"
+	"stock-app/pkg/utils"
 )
 
+// validate checks decoded API responses against their `validate` struct tags.
+var validate = validator.New()
+
 // TimeSeriesFetcher manages real-time data from WebSocket API and external APIs.
 type TimeSeriesFetcher struct {
-	url     string
-	symbols []string
+	endpoint string
+	apiToken string
+	symbols  []string
+	limiter  *rateLimiter
+	log      *logger.Logger
 }
 
-// NewTimeSeriesFetcher creates a new instance of TimeSeriesFetcher.
-func NewTimeSeriesFetcher(url string, apiToken string, symbols []string) *TimeSeriesFetcher {
+// NewTimeSeriesFetcher creates a new instance of TimeSeriesFetcher logging to the shared log.
+func NewTimeSeriesFetcher(endpoint string, apiToken string, symbols []string, log *logger.Logger) *TimeSeriesFetcher {
 	return &TimeSeriesFetcher{
-		url:     url + "&apikey=" + apiToken,
-		symbols: symbols,
+		endpoint: endpoint,
+		apiToken: apiToken,
+		symbols:  utils.FilterValidSymbols(symbols),
+		limiter:  sharedLimiter(),
+		log:      log,
+	}
+}
+
+// requestURL builds the request URL from the configured endpoint, keeping the query parameters
+// it already carries (e.g. outputsize) and adding the API key and the given parameters.
+func (tf *TimeSeriesFetcher) requestURL(params url.Values) (string, error) {
+	u, err := url.Parse(tf.endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid time series endpoint %q: %w", tf.endpoint, err)
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	query.Set("apikey", tf.apiToken)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// rateLimiter spaces out requests so that at most a given number are made per minute.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// The AlphaVantage quota is per API key, so every fetcher of the process shares one limiter.
+var (
+	limiterOnce sync.Once
+	limiter     *rateLimiter
+)
+
+// sharedLimiter returns the rate limiter shared by every TimeSeriesFetcher, allowing
+// ALPHA_VANTAGE_REQUESTS_PER_MINUTE requests per minute.
+func sharedLimiter() *rateLimiter {
+	limiterOnce.Do(func() {
+		limiter = newRateLimiter(config.AppConfig.AlphaVantageRateLimit)
+	})
+	return limiter
+}
+
+// newRateLimiter creates a rateLimiter allowing requestsPerMinute requests per minute, or unlimited if not positive.
+func newRateLimiter(requestsPerMinute int) *rateLimiter {
+	if requestsPerMinute <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Minute / time.Duration(requestsPerMinute)}
+}
+
+// wait blocks until the next request slot is available.
+func (rl *rateLimiter) wait() {
+	if rl.interval == 0 {
+		return
+	}
+
+	rl.mu.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	slot := rl.next
+	rl.next = rl.next.Add(rl.interval)
+	rl.mu.Unlock()
+
+	time.Sleep(time.Until(slot))
+}
+
+// maxFetchAttempts is the number of times a time series request is tried before giving up.
+const maxFetchAttempts = 3
+
+// apiMessage holds the messages AlphaVantage returns, with a 200 status, instead of data.
+type apiMessage struct {
+	Information  string `json:"Information"`
+	Note         string `json:"Note"`
+	ErrorMessage string `json:"Error Message"`
+}
+
+// fetchJSON requests the URL of the given API function and decodes the response into v, retrying
+// failed attempts. Premium endpoint messages and invalid API keys are returned as
+// *errors.PremiumEndpointError and *errors.AuthError and are not retried, since the request can't
+// succeed with the configured API key. Neither are requests rejected by an open circuit breaker.
+func (tf *TimeSeriesFetcher) fetchJSON(function, requestURL string, v interface{}) error {
+	var err error
+	for attempt := 1; attempt <= maxFetchAttempts; attempt++ {
+		if attempt > 1 {
+			tf.limiter.wait()
+		}
+
+		err = fetchJSONOnce(function, requestURL, v)
+		var premium *apperrors.PremiumEndpointError
+		var auth *apperrors.AuthError
+		var circuitOpen *apperrors.CircuitOpenError
+		if err == nil || errors.As(err, &premium) || errors.As(err, &auth) || errors.As(err, &circuitOpen) {
+			return err
+		}
+		fmt.Printf("Attempt %d/%d of %s failed: %v\n", attempt, maxFetchAttempts, function, err)
+	}
+	return err
+}
+
+// fetchJSONOnce requests the URL and decodes the response into v, turning API messages into errors.
+func fetchJSONOnce(function, requestURL string, v interface{}) error {
+	response, err := breaker.For(breaker.ProviderAlphaVantage).Get(requestURL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("error response from API: %s", response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	if err := checkAPIMessage(function, body); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error decoding JSON: %w", err)
+	}
+	return nil
+}
+
+// checkAPIMessage returns an error if body is an API message rather than data.
+func checkAPIMessage(function string, body []byte) error {
+	var message apiMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil // Not a JSON object, e.g. CSV data
+	}
+
+	switch {
+	case strings.Contains(strings.ToLower(message.Information), "premium"):
+		return &apperrors.PremiumEndpointError{Function: function, Message: message.Information}
+	case strings.Contains(strings.ToLower(message.ErrorMessage), "apikey"):
+		return &apperrors.AuthError{Provider: "AlphaVantage", Message: message.ErrorMessage}
+	case message.ErrorMessage != "":
+		return fmt.Errorf("API error: %s", message.ErrorMessage)
+	case message.Note != "":
+		return fmt.Errorf("API note: %s", message.Note)
+	case message.Information != "":
+		return fmt.Errorf("API information: %s", message.Information)
+	}
+	return nil
+}
+
+// SelfTest makes a single lightweight request to check that the API is reachable and accepts the
+// configured API key. A rejected key is returned as *errors.AuthError. The request waits for a slot of
+// the rate limiter shared with the refreshes, so it can't push them over the quota, and fails after
+// UPSTREAM_TIMEOUT.
+func (tf *TimeSeriesFetcher) SelfTest(symbol string) error {
+	requestURL, err := tf.requestURL(url.Values{
+		"function": {"GLOBAL_QUOTE"},
+		"symbol":   {symbol},
+	})
+	if err != nil {
+		return err
 	}
+
+	var response map[string]interface{}
+	tf.limiter.wait()
+	return fetchJSONOnce("GLOBAL_QUOTE", requestURL, &response)
 }
 
-// FetchIntradayDataToDb fetches intraday data from the API and updates to DB
+// FetchIntradayDataToDb fetches intraday data from the API and updates to DB. It returns an error
+// listing the symbols that failed, and only marks the refresh successful when none did.
 func (tf *TimeSeriesFetcher) FetchIntradayData(stockRepo repository.StockRepo) error {
+	return fetchAll(metrics.DataTypeIntraday, tf.symbols, func(symbol string) error {
+		return tf.fetchIntradayData(symbol, stockRepo)
+	})
+}
+
+// fetchAll runs fetch for every symbol concurrently. It returns an error listing the symbols whose
+// fetch failed, and records a successful refresh of the data type only when none did.
+func fetchAll(dataType string, symbols []string, fetch func(symbol string) error) error {
 	var wg sync.WaitGroup
-	for _, symbol := range tf.symbols {
+	var mu sync.Mutex
+	var failed []string
+	for _, symbol := range symbols {
 		wg.Add(1)
-		go tf.fetchIntradayData(symbol, stockRepo, &wg)
+		go func(symbol string) {
+			defer wg.Done()
+			if err := fetch(symbol); err != nil {
+				fmt.Println(err)
+				mu.Lock()
+				failed = append(failed, symbol)
+				mu.Unlock()
+			}
+		}(symbol)
 	}
 	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to fetch %s data for %d of %d symbols: %v", dataType, len(failed), len(symbols), failed)
+	}
+	metrics.RecordRefresh(dataType)
 	return nil
 }
 
 // fetchIntradayData fetches intraday data for a single symbol and updates to DB
-func (tf *TimeSeriesFetcher) fetchIntradayData(symbol string, stockRepo repository.StockRepo, wg *sync.WaitGroup) {
-	defer wg.Done()
+func (tf *TimeSeriesFetcher) fetchIntradayData(symbol string, stockRepo repository.StockRepo) error {
 	fmt.Printf("Starting fetchIntradayData for symbol: %s\n", symbol)
-	response, err := http.Get(tf.url + "&function=TIME_SERIES_INTRADAY&symbol=" + symbol + "&interval=1min")
+	tf.limiter.wait()
+	requestURL, err := tf.requestURL(url.Values{
+		"function": {"TIME_SERIES_INTRADAY"},
+		"symbol":   {symbol},
+		"interval": {"1min"},
+	})
 	if err != nil {
-		fmt.Printf("Error fetching intraday data for %s: %v\n", symbol, err)
-		return
-	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		fmt.Printf("Error response from API for %s: %s\n", symbol, response.Status)
-		return
+		return fmt.Errorf("Error building intraday request for %s: %w", symbol, err)
 	}
 	var apiResponse entity.TSIntradayResponse
-	if err := json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
-		fmt.Printf("Error decoding JSON for %s: %v\n", symbol, err)
-		return
+	if err := tf.fetchJSON("TIME_SERIES_INTRADAY", requestURL, &apiResponse); err != nil {
+		return fmt.Errorf("Error fetching intraday data for %s: %w", symbol, err)
+	}
+	if err := validate.Struct(apiResponse); err != nil {
+		return fmt.Errorf("Invalid intraday response for %s, skipping: %w", symbol, err)
 	}
 
 	fmt.Printf("Fetched data for symbol: %s, LastRefreshed: %s\n", symbol, apiResponse.MetaData.LastRefreshed)
 
 	// Check if the latest timestamp matches the last refresh time
 	lastRefresh := apiResponse.MetaData.LastRefreshed
+	var notFound *apperrors.NotFoundError
 	latestTimestamp, err := stockRepo.GetLatestIntradayDataTimestamp(symbol)
-	if err != nil {
-		fmt.Printf("Error fetching latest timestamp for %s: %v\n", symbol, err)
-		return
+	if err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("Error fetching latest timestamp for %s: %w", symbol, err)
 	}
 
 	fmt.Printf("Latest timestamp for symbol %s: %s\n", symbol, latestTimestamp)
 
 	if (latestTimestamp != "" && latestTimestamp >= lastRefresh) {
 		fmt.Printf("No new data for %s. Latest timestamp matches last refresh time.\n", symbol)
-		return
+		return nil
 	}
 
 	// Iterate over Time Series and prepare data for insertion
+	progress := newInsertProgress(tf.log, metrics.DataTypeIntraday, symbol, config.AppConfig.LogProgressEvery)
+	var insertErr error
 	for timestamp, data := range apiResponse.TimeSeries {
 		if timestamp <= latestTimestamp {
-			fmt.Printf("Skipping data for symbol: %s, Timestamp: %s as it is before or equal to the latest timestamp from DB\n", symbol, timestamp)
+			progress.skip(timestamp)
 			continue
 		}
-		fmt.Printf("Inserting data for symbol: %s, Timestamp: %s\n", symbol, timestamp)
-		err = stockRepo.InsertIntradayData(symbol, timestamp, data.Open, data.High, data.Low, data.Close, data.Volume)
+		written, err := stockRepo.InsertIntradayData(symbol, timestamp, data.Open, data.High, data.Low, data.Close, data.Volume)
 		if err != nil {
 			fmt.Printf("Error inserting intraday data for %s: %v\n", symbol, err)
+			insertErr = err
+			continue
 		}
+		if written == 0 {
+			progress.keep(timestamp)
+			continue
+		}
+		progress.insert(timestamp)
+	}
+	progress.done()
+	metrics.RecordInserted(metrics.DataTypeIntraday, progress.inserted)
+	if insertErr != nil {
+		return fmt.Errorf("Error inserting intraday data for %s: %w", symbol, insertErr)
 	}
 	fmt.Printf("Completed fetchIntradayData for symbol: %s\n", symbol)
+	return nil
 }
 
-// FetchDailyDataToDB fetches historical data from the API and updates to DB
+// FetchDailyDataToDB fetches historical data from the API and updates to DB. It returns an error
+// listing the symbols that failed, and only marks the refresh successful when none did.
 func (tf *TimeSeriesFetcher) FetchDailyData(stockRepo repository.StockRepo) error {
-	var wg sync.WaitGroup
-	for _, symbol := range tf.symbols {
-		wg.Add(1)
-		go tf.fetchDailyData(symbol, stockRepo, &wg)
-	}
-	wg.Wait()
-	return nil
+	return fetchAll(metrics.DataTypeDaily, tf.symbols, func(symbol string) error {
+		return tf.fetchDailyData(symbol, stockRepo)
+	})
 }
 
 // fetchDailyData fetches daily data for a single symbol and updates to DB
-func (tf *TimeSeriesFetcher) fetchDailyData(symbol string, stockRepo repository.StockRepo, wg *sync.WaitGroup) {
-	defer wg.Done()
+func (tf *TimeSeriesFetcher) fetchDailyData(symbol string, stockRepo repository.StockRepo) error {
 	fmt.Printf("Starting fetchDailyData for symbol: %s\n", symbol)
-	response, err := http.Get(tf.url + "&function=TIME_SERIES_DAILY&symbol=" + symbol)
+	tf.limiter.wait()
+	requestURL, err := tf.requestURL(url.Values{
+		"function": {"TIME_SERIES_DAILY"},
+		"symbol":   {symbol},
+	})
 	if err != nil {
-		fmt.Printf("Error fetching daily data for %s: %v\n", symbol, err)
-		return
+		return fmt.Errorf("Error building daily request for %s: %w", symbol, err)
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		fmt.Printf("Error response from API for %s: %s\n", symbol, response.Status)
-		return
-	}
-
 	var apiResponse entity.TSDailyResponse
-	if err := json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
-		fmt.Printf("Error decoding JSON for %s: %v\n", symbol, err)
-		return
+	if err := tf.fetchJSON("TIME_SERIES_DAILY", requestURL, &apiResponse); err != nil {
+		return fmt.Errorf("Error fetching daily data for %s: %w", symbol, err)
+	}
+	if err := validate.Struct(apiResponse); err != nil {
+		return fmt.Errorf("Invalid daily response for %s, skipping: %w", symbol, err)
 	}
 
 	fmt.Printf("Fetched data for symbol: %s, LastRefreshed: %s\n", symbol, apiResponse.MetaData.LastRefreshed)
 
 	// Check if the latest date matches the last refresh date
 	lastRefresh := apiResponse.MetaData.LastRefreshed
+	var notFound *apperrors.NotFoundError
 	latestDate, err := stockRepo.GetLatestDailyDataDate(symbol)
-	if err != nil {
-		fmt.Printf("Error fetching latest date for %s: %v\n", symbol, err)
-		return
+	if err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("Error fetching latest date for %s: %w", symbol, err)
 	}
 
 	fmt.Printf("Latest date for symbol %s: %s\n", symbol, latestDate)
 
 	if (latestDate != "" && latestDate >= lastRefresh) {
 		fmt.Printf("No new data for %s. Latest date matches last refresh date.\n", symbol)
-		return
+		return nil
 	}
 
 	// Iterate over Time Series and prepare data for insertion
+	progress := newInsertProgress(tf.log, metrics.DataTypeDaily, symbol, config.AppConfig.LogProgressEvery)
+	var insertErr error
 	for date, data := range apiResponse.TimeSeries {
 		if date <= latestDate {
-			fmt.Printf("Skipping data for symbol: %s, Date: %s as it is before or equal to the latest date from DB\n", symbol, date)
+			progress.skip(date)
 			continue
 		}
-		fmt.Printf("Inserting data for symbol: %s, Date: %s\n", symbol, date)
 		err = stockRepo.InsertDailyData(symbol, date, data.Open, data.High, data.Low, data.Close, data.Volume)
 		if err != nil {
 			fmt.Printf("Error inserting daily data for %s: %v\n", symbol, err)
+			insertErr = err
+			continue
 		}
+		progress.insert(date)
+	}
+	progress.done()
+	metrics.RecordInserted(metrics.DataTypeDaily, progress.inserted)
+	if insertErr != nil {
+		return fmt.Errorf("Error inserting daily data for %s: %w", symbol, insertErr)
 	}
 	fmt.Printf("Completed fetchDailyData for symbol: %s\n", symbol)
+	return nil
+}
+
+// extendedBatchSize is the number of bars inserted per transaction when backfilling a slice.
+const extendedBatchSize = 1000
+
+// slicePattern matches the AlphaVantage extended history slices, year1month1 to year2month12.
+var slicePattern = regexp.MustCompile(`^year[12]month([1-9]|1[0-2])$`)
+
+// BackfillIntradayExtended fetches the given extended history slice for every symbol and inserts it into DB.
+func (tf *TimeSeriesFetcher) BackfillIntradayExtended(slice string, stockRepo repository.StockRepo) error {
+	var failed []string
+	for _, symbol := range tf.symbols {
+		if err := tf.FetchIntradayExtended(symbol, slice, stockRepo); err != nil {
+			// A premium endpoint fails the same way for every symbol, so stop hammering it
+			var premium *apperrors.PremiumEndpointError
+			if errors.As(err, &premium) {
+				return err
+			}
+			fmt.Printf("Error backfilling %s for %s: %v\n", slice, symbol, err)
+			failed = append(failed, symbol)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to backfill %s for symbols: %v", slice, failed)
+	}
+	return nil
+}
+
+// FetchIntradayExtended fetches a month of 1-minute intraday history from the CSV slice endpoint,
+// which reaches further back than the intraday JSON endpoint, and batch-inserts it into DB.
+func (tf *TimeSeriesFetcher) FetchIntradayExtended(symbol, slice string, stockRepo repository.StockRepo) error {
+	_, err := tf.fetchIntradayExtended(symbol, slice, time.Time{}, time.Time{}, stockRepo)
+	return err
+}
+
+// fetchIntradayExtended fetches an extended history slice like FetchIntradayExtended, only inserting
+// the bars from `from` up to, but excluding, `to`. A zero from or to leaves that side unbounded.
+// It returns the number of bars inserted.
+func (tf *TimeSeriesFetcher) fetchIntradayExtended(symbol, slice string, from, to time.Time, stockRepo repository.StockRepo) (int, error) {
+	if !slicePattern.MatchString(slice) {
+		return 0, fmt.Errorf("invalid slice %q: expected year1month1 to year2month12", slice)
+	}
+
+	fmt.Printf("Starting FetchIntradayExtended for symbol: %s, slice: %s\n", symbol, slice)
+	tf.limiter.wait()
+	requestURL, err := tf.requestURL(url.Values{
+		"function": {"TIME_SERIES_INTRADAY_EXTENDED"},
+		"symbol":   {symbol},
+		"interval": {"1min"},
+		"slice":    {slice},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error building extended intraday request: %w", err)
+	}
+	response, err := breaker.For(breaker.ProviderAlphaVantage).Get(requestURL)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching extended intraday data: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error response from API: %s", response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, fmt.Errorf("error reading extended intraday response: %w", err)
+	}
+	if err := checkAPIMessage("TIME_SERIES_INTRADAY_EXTENDED", body); err != nil {
+		return 0, err
+	}
+
+	bars, err := parseIntradayExtendedCSV(symbol, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	bars = barsInRange(bars, from, to)
+
+	for start := 0; start < len(bars); start += extendedBatchSize {
+		end := start + extendedBatchSize
+		if end > len(bars) {
+			end = len(bars)
+		}
+		written, err := stockRepo.InsertIntradayBars(bars[start:end], repository.SourceAPI)
+		if err != nil {
+			return start, fmt.Errorf("error inserting extended intraday data: %w", err)
+		}
+		metrics.RecordInserted(metrics.DataTypeIntraday, int(written))
+		tf.log.WithFields(map[string]interface{}{
+			"type":     metrics.DataTypeIntraday,
+			"symbol":   symbol,
+			"slice":    slice,
+			"inserted": end,
+			"total":    len(bars),
+		}).Info("Backfill progress")
+	}
+	fmt.Printf("Completed FetchIntradayExtended for symbol: %s, slice: %s, %d bars\n", symbol, slice, len(bars))
+	return len(bars), nil
+}
+
+// parseIntradayExtendedCSV parses an extended history slice with the header
+// `time,open,high,low,close,volume`. Error messages, which the API returns as JSON with a
+// 200 status, are rejected since they lack the header.
+func parseIntradayExtendedCSV(symbol string, r io.Reader) ([]*entity.StockQuote, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 6
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+	if header[0] != "time" && header[0] != "timestamp" {
+		return nil, fmt.Errorf("unexpected CSV header: %v", header)
+	}
+
+	var bars []*entity.StockQuote
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV record: %w", err)
+		}
+
+		timestamp, err := time.Parse("2006-01-02 15:04:05", record[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q: %w", record[0], err)
+		}
+		values := make([]float64, 5)
+		for i, field := range record[1:] {
+			if values[i], err = strconv.ParseFloat(field, 64); err != nil {
+				return nil, fmt.Errorf("invalid value %q at %s: %w", field, record[0], err)
+			}
+		}
+
+		bars = append(bars, &entity.StockQuote{
+			Symbol:    symbol,
+			OpenPrice: values[0],
+			HighPrice: values[1],
+			LowPrice:  values[2],
+			Price:     values[3],
+			Volume:    values[4],
+			Timestamp: timestamp,
+		})
+	}
+	return bars, nil
 }
@@ -0,0 +1,259 @@
+package timeseries
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"stock-app/internal/entity"
+	"stock-app/internal/metrics"
+	"stock-app/internal/repository"
+	"stock-app/pkg/config"
+	apperrors "stock-app/pkg/errors"
+	"stock-app/pkg/logger"
+)
+
+// recordingRepo records the intraday inserts and reports no stored data.
+type recordingRepo struct {
+	repository.StockRepo
+	mu       sync.Mutex
+	inserted []string
+}
+
+func (r *recordingRepo) GetLatestIntradayDataTimestamp(symbol string) (string, error) {
+	return "", nil
+}
+
+func (r *recordingRepo) InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inserted = append(r.inserted, timestamp)
+	return 1, nil
+}
+
+const intradayMetaData = `"Meta Data": {
+	"1. Information": "Intraday (1min) open, high, low, close prices and volume",
+	"2. Symbol": "AAPL",
+	"3. Last Refreshed": "2025-06-09 09:31:00",
+	"4. Interval": "1min",
+	"5. Output Size": "Compact",
+	"6. Time Zone": "US/Eastern"
+}`
+
+const intradayTimeSeries = `"Time Series (1min)": {
+	"2025-06-09 09:31:00": {"1. open": "200.1", "2. high": "200.5", "3. low": "199.9", "4. close": "200.2", "5. volume": "1000"},
+	"2025-06-09 09:30:00": {"1. open": "200.0", "2. high": "200.2", "3. low": "199.8", "4. close": "200.1", "5. volume": "1200"}
+}`
+
+func TestFetchIntradayDataValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantInserted int
+		wantErr      bool
+	}{
+		{name: "complete response", body: "{" + intradayMetaData + "," + intradayTimeSeries + "}", wantInserted: 2},
+		{name: "missing Meta Data", body: "{" + intradayTimeSeries + "}", wantErr: true},
+		{name: "missing time series", body: "{" + intradayMetaData + "}", wantErr: true},
+		{name: "bar missing its close", body: "{" + intradayMetaData + `, "Time Series (1min)": {"2025-06-09 09:30:00": {"1. open": "200.0", "2. high": "200.2", "3. low": "199.8", "5. volume": "1200"}}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			config.AppConfig.AlphaVantageRateLimit = 0
+			repo := &recordingRepo{}
+			if err := NewTimeSeriesFetcher(server.URL+"/query", "key", []string{"AAPL"}, logger.NewLogger("error")).FetchIntradayData(repo); (err != nil) != tt.wantErr {
+				t.Fatalf("FetchIntradayData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(repo.inserted) != tt.wantInserted {
+				t.Errorf("inserted %d bars (%v), want %d", len(repo.inserted), repo.inserted, tt.wantInserted)
+			}
+		})
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	params := url.Values{"function": {"TIME_SERIES_DAILY"}, "symbol": {"BRK.B"}}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		want     string
+	}{
+		{name: "bare host", endpoint: "https://www.alphavantage.co/query", want: "https://www.alphavantage.co/query?apikey=k%26ey&function=TIME_SERIES_DAILY&symbol=BRK.B"},
+		{name: "trailing question mark", endpoint: "https://www.alphavantage.co/query?", want: "https://www.alphavantage.co/query?apikey=k%26ey&function=TIME_SERIES_DAILY&symbol=BRK.B"},
+		{name: "existing parameters kept", endpoint: "https://www.alphavantage.co/query?outputsize=full", want: "https://www.alphavantage.co/query?apikey=k%26ey&function=TIME_SERIES_DAILY&outputsize=full&symbol=BRK.B"},
+		{name: "parameters overridden", endpoint: "http://127.0.0.1:8080/proxy?symbol=MSFT&apikey=old", want: "http://127.0.0.1:8080/proxy?apikey=k%26ey&function=TIME_SERIES_DAILY&symbol=BRK.B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewTimeSeriesFetcher(tt.endpoint, "k&ey", nil, logger.NewLogger("error")).requestURL(params)
+			if err != nil {
+				t.Fatalf("requestURL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("requestURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewTimeSeriesFetcher("http://[::1", "key", nil, logger.NewLogger("error")).requestURL(params); err == nil {
+		t.Error("requestURL() with an invalid endpoint succeeded, want an error")
+	}
+}
+
+func TestFetchDailyDataRequest(t *testing.T) {
+	var got url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config.AppConfig.AlphaVantageRateLimit = 0
+	if err := NewTimeSeriesFetcher(server.URL, "key", []string{"AAPL"}, logger.NewLogger("error")).FetchDailyData(&recordingRepo{}); err == nil {
+		t.Error("FetchDailyData() error = nil for a 503 response")
+	}
+	want := url.Values{"apikey": {"key"}, "function": {"TIME_SERIES_DAILY"}, "symbol": {"AAPL"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("request query = %v, want %v", got, want)
+	}
+}
+
+func TestFetchJSONPremium(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantPremium  bool
+		wantRequests int32
+	}{
+		{name: "premium endpoint", body: `{"Information": "Thank you for using Alpha Vantage! This is a premium endpoint."}`, wantPremium: true, wantRequests: 1},
+		{name: "rate limit note", body: `{"Note": "Thank you for using Alpha Vantage! Our standard API call frequency is 5 calls per minute."}`, wantRequests: maxFetchAttempts},
+		{name: "error message", body: `{"Error Message": "Invalid API call."}`, wantRequests: maxFetchAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			config.AppConfig.AlphaVantageRateLimit = 0
+			var v entity.TSDailyResponse
+			err := NewTimeSeriesFetcher(server.URL, "key", nil, logger.NewLogger("error")).fetchJSON("TIME_SERIES_DAILY_ADJUSTED", server.URL, &v)
+			if err == nil {
+				t.Fatal("fetchJSON() error = nil for an API message")
+			}
+			var premium *apperrors.PremiumEndpointError
+			if errors.As(err, &premium) != tt.wantPremium {
+				t.Errorf("fetchJSON() error = %v, want a *errors.PremiumEndpointError: %v", err, tt.wantPremium)
+			}
+			if tt.wantPremium && premium.Function != "TIME_SERIES_DAILY_ADJUSTED" {
+				t.Errorf("premium endpoint error function = %q, want TIME_SERIES_DAILY_ADJUSTED", premium.Function)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestFetchRecordsRefresh(t *testing.T) {
+	var fail atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() && r.URL.Query().Get("symbol") == "MSFT" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{" + intradayMetaData + "," + intradayTimeSeries + "}"))
+	}))
+	defer server.Close()
+
+	config.AppConfig.AlphaVantageRateLimit = 0
+	fetcher := NewTimeSeriesFetcher(server.URL+"/query", "key", []string{"AAPL", "MSFT"}, logger.NewLogger("error"))
+	gauge := metrics.LastSuccessfulRefresh.WithLabelValues(metrics.DataTypeIntraday)
+	counter := metrics.DataPointsInserted.WithLabelValues(metrics.DataTypeIntraday)
+	gauge.Set(0)
+	insertedBefore := testutil.ToFloat64(counter)
+
+	before := time.Now().Unix()
+	if err := fetcher.FetchIntradayData(&recordingRepo{}); err != nil {
+		t.Fatalf("FetchIntradayData() error = %v", err)
+	}
+	refreshed := testutil.ToFloat64(gauge)
+	if refreshed < float64(before) {
+		t.Errorf("last successful refresh = %v after a successful fetch, want at least %d", refreshed, before)
+	}
+	if inserted := testutil.ToFloat64(counter) - insertedBefore; inserted != 4 {
+		t.Errorf("data points inserted = %v, want 4", inserted)
+	}
+
+	// A fetch in which a symbol failed leaves the last successful refresh as it was
+	gauge.Set(1)
+	fail.Store(true)
+	if err := fetcher.FetchIntradayData(&recordingRepo{}); err == nil {
+		t.Fatal("FetchIntradayData() error = nil when MSFT failed")
+	}
+	if got := testutil.ToFloat64(gauge); got != 1 {
+		t.Errorf("last successful refresh = %v after a failed fetch, want it unchanged", got)
+	}
+}
+
+func TestParseIntradayExtendedCSV(t *testing.T) {
+	minute := func(min int) time.Time {
+		return time.Date(2025, time.May, 30, 15, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		want    []*entity.StockQuote
+		wantErr bool
+	}{
+		{
+			name: "sample slice",
+			body: "time,open,high,low,close,volume\r\n" +
+				"2025-05-30 15:59:00,200.5,200.75,200.25,200.6,12345\r\n" +
+				"2025-05-30 15:58:00, 200.1,\"200.5\",200,200.5,\"9876\"\r\n",
+			want: []*entity.StockQuote{
+				{Symbol: "AAPL", OpenPrice: 200.5, HighPrice: 200.75, LowPrice: 200.25, Price: 200.6, Volume: 12345, Timestamp: minute(59)},
+				{Symbol: "AAPL", OpenPrice: 200.1, HighPrice: 200.5, LowPrice: 200, Price: 200.5, Volume: 9876, Timestamp: minute(58)},
+			},
+		},
+		{name: "timestamp header", body: "timestamp,open,high,low,close,volume\n2025-05-30 15:59:00,1,1,1,1,1\n", want: []*entity.StockQuote{
+			{Symbol: "AAPL", OpenPrice: 1, HighPrice: 1, LowPrice: 1, Price: 1, Volume: 1, Timestamp: minute(59)},
+		}},
+		{name: "header only", body: "time,open,high,low,close,volume\n"},
+		{name: "error message", body: `{"Error Message": "Invalid API call."}`, wantErr: true},
+		{name: "empty body", body: "", wantErr: true},
+		{name: "missing field", body: "time,open,high,low,close,volume\n2025-05-30 15:59:00,1,1,1,1\n", wantErr: true},
+		{name: "invalid price", body: "time,open,high,low,close,volume\n2025-05-30 15:59:00,1,one,1,1,1\n", wantErr: true},
+		{name: "invalid timestamp", body: "time,open,high,low,close,volume\n2025-05-30T15:59:00Z,1,1,1,1,1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIntradayExtendedCSV("AAPL", strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIntradayExtendedCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIntradayExtendedCSV() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
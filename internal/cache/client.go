@@ -0,0 +1,20 @@
+package cache
+
+import (
+    "github.com/go-redis/redis/v8"
+    "stock-app/pkg/config"
+)
+
+// NewClient creates the Redis client shared by the stock cache, the job store and the refresh lock. It
+// connects to the cluster of REDIS_ADDRS when REDIS_CLUSTER is set, and to REDIS_HOST:REDIS_PORT
+// otherwise.
+func NewClient() redis.UniversalClient {
+    if config.AppConfig.RedisCluster {
+        return redis.NewClusterClient(&redis.ClusterOptions{
+            Addrs: config.AppConfig.RedisAddrs,
+        })
+    }
+    return redis.NewClient(&redis.Options{
+        Addr: config.AppConfig.CacheClient,
+    })
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+    "testing"
+
+    "github.com/go-redis/redis/v8"
+
+    "stock-app/pkg/config"
+)
+
+func TestNewClient(t *testing.T) {
+    saved := config.AppConfig
+    defer func() { config.AppConfig = saved }()
+
+    config.AppConfig.RedisCluster = false
+    config.AppConfig.CacheClient = "localhost:6379"
+    client := NewClient()
+    defer client.Close()
+    if _, ok := client.(*redis.Client); !ok {
+        t.Errorf("NewClient() without REDIS_CLUSTER = %T, want *redis.Client", client)
+    }
+
+    config.AppConfig.RedisCluster = true
+    config.AppConfig.RedisAddrs = []string{"localhost:7000", "localhost:7001"}
+    cluster := NewClient()
+    defer cluster.Close()
+    if _, ok := cluster.(*redis.ClusterClient); !ok {
+        t.Errorf("NewClient() with REDIS_CLUSTER = %T, want *redis.ClusterClient", cluster)
+    }
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+    "stock-app/internal/entity"
+    "stock-app/pkg/errors"
+)
+
+// JobStore defines the interface for sharing refresh jobs and their idempotency keys between
+// server instances.
+type JobStore interface {
+    ClaimIdempotencyKey(key, jobID string, expiration time.Duration) (string, bool, error)
+    ReleaseIdempotencyKey(key, jobID string) error
+    SaveJob(job *entity.RefreshJob, expiration time.Duration) error
+    GetJob(id string) (*entity.RefreshJob, error)
+    AppendHistory(job *entity.RefreshJob, maxLen int) error
+    GetHistory() ([]*entity.RefreshJob, error)
+}
+
+// refreshHistoryKey is the Redis list of finished refresh jobs, newest first.
+const refreshHistoryKey = "refresh:history"
+
+// RedisJobStore is a Redis-backed store for refresh jobs.
+type RedisJobStore struct {
+    client redis.UniversalClient
+}
+
+// NewJobStore creates a new RedisJobStore instance on the shared Redis client.
+func NewJobStore(client redis.UniversalClient) JobStore {
+    return &RedisJobStore{client: client}
+}
+
+// ClaimIdempotencyKey atomically maps key to jobID unless the key is already mapped. It returns
+// the job ID the key maps to and whether the claim succeeded.
+func (s *RedisJobStore) ClaimIdempotencyKey(key, jobID string, expiration time.Duration) (string, bool, error) {
+    redisKey := fmt.Sprintf("refresh:idempotency:%s", key)
+    claimed, err := s.client.SetNX(ctx, redisKey, jobID, expiration).Result()
+    if err != nil {
+        return "", false, fmt.Errorf("failed to claim idempotency key: %w", err)
+    }
+    if claimed {
+        return jobID, true, nil
+    }
+
+    existingID, err := s.client.Get(ctx, redisKey).Result()
+    if err == redis.Nil {
+        // The key expired between SETNX and GET, so try once more
+        return s.ClaimIdempotencyKey(key, jobID, expiration)
+    }
+    if err != nil {
+        return "", false, fmt.Errorf("failed to get idempotency key: %w", err)
+    }
+    return existingID, false, nil
+}
+
+// ReleaseIdempotencyKey removes key if it still maps to jobID, so a retry with the key can start a new
+// job after the job it was claimed for failed to start.
+func (s *RedisJobStore) ReleaseIdempotencyKey(key, jobID string) error {
+    redisKey := fmt.Sprintf("refresh:idempotency:%s", key)
+    if err := releaseScript.Run(ctx, s.client, []string{redisKey}, jobID).Err(); err != nil {
+        return fmt.Errorf("failed to release idempotency key: %w", err)
+    }
+    return nil
+}
+
+// SaveJob stores the job with an optional expiration time.
+func (s *RedisJobStore) SaveJob(job *entity.RefreshJob, expiration time.Duration) error {
+    jobJSON, err := json.Marshal(job)
+    if err != nil {
+        return fmt.Errorf("failed to marshal refresh job: %w", err)
+    }
+
+    if err := s.client.Set(ctx, fmt.Sprintf("refresh:job:%s", job.ID), jobJSON, expiration).Err(); err != nil {
+        return fmt.Errorf("failed to save refresh job %s: %w", job.ID, err)
+    }
+    return nil
+}
+
+// GetJob retrieves a job by ID, returning a NotFoundError when it does not exist or has expired.
+func (s *RedisJobStore) GetJob(id string) (*entity.RefreshJob, error) {
+    jobJSON, err := s.client.Get(ctx, fmt.Sprintf("refresh:job:%s", id)).Bytes()
+    if err == redis.Nil {
+        return nil, &errors.NotFoundError{Resource: fmt.Sprintf("refresh job %s", id)}
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get refresh job %s: %w", id, err)
+    }
+
+    var job entity.RefreshJob
+    if err := json.Unmarshal(jobJSON, &job); err != nil {
+        return nil, fmt.Errorf("failed to unmarshal refresh job %s: %w", id, err)
+    }
+    return &job, nil
+}
+
+// AppendHistory prepends the finished job to the refresh history, trimming it to its maxLen newest
+// jobs. The history has no expiration so it survives restarts.
+func (s *RedisJobStore) AppendHistory(job *entity.RefreshJob, maxLen int) error {
+    jobJSON, err := json.Marshal(job)
+    if err != nil {
+        return fmt.Errorf("failed to marshal refresh job: %w", err)
+    }
+
+    _, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+        pipe.LPush(ctx, refreshHistoryKey, jobJSON)
+        if maxLen > 0 {
+            pipe.LTrim(ctx, refreshHistoryKey, 0, int64(maxLen-1))
+        }
+        return nil
+    })
+    if err != nil {
+        return fmt.Errorf("failed to append refresh job %s to history: %w", job.ID, err)
+    }
+    return nil
+}
+
+// GetHistory retrieves the finished refresh jobs, newest first.
+func (s *RedisJobStore) GetHistory() ([]*entity.RefreshJob, error) {
+    values, err := s.client.LRange(ctx, refreshHistoryKey, 0, -1).Result()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get refresh history: %w", err)
+    }
+
+    jobs := make([]*entity.RefreshJob, 0, len(values))
+    for _, value := range values {
+        var job entity.RefreshJob
+        if err := json.Unmarshal([]byte(value), &job); err != nil {
+            fmt.Printf("Skipping malformed refresh history entry: %v\n", err)
+            continue
+        }
+        jobs = append(jobs, &job)
+    }
+    return jobs, nil
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// releaseScript deletes a key only if it still holds the caller's value, so a lock or idempotency key
+// claimed by another holder since is kept.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// extendScript resets the TTL of a key only if it still holds the caller's value, so a holder can't
+// extend a lock that expired and was acquired by another instance.
+var extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// Locker defines the interface for distributed locks shared between server instances.
+type Locker interface {
+    Acquire(name string, ttl time.Duration) (string, bool, error)
+    Extend(name, token string, ttl time.Duration) (bool, error)
+    Release(name, token string) error
+}
+
+// RedisLocker is a Redis-backed Locker.
+type RedisLocker struct {
+    client redis.UniversalClient
+}
+
+// NewLocker creates a new RedisLocker instance on the shared Redis client.
+func NewLocker(client redis.UniversalClient) Locker {
+    return &RedisLocker{client: client}
+}
+
+// Acquire takes the named lock for ttl unless another holder has it. It returns the ownership token
+// to pass to Release and whether the lock was acquired. The lock expires after ttl, so a holder that
+// crashes can't block others forever.
+func (l *RedisLocker) Acquire(name string, ttl time.Duration) (string, bool, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", false, fmt.Errorf("failed to generate lock token: %w", err)
+    }
+    token := hex.EncodeToString(b)
+
+    acquired, err := l.client.SetNX(ctx, fmt.Sprintf("lock:%s", name), token, ttl).Result()
+    if err != nil {
+        return "", false, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+    }
+    if !acquired {
+        return "", false, nil
+    }
+    return token, true, nil
+}
+
+// Extend resets the named lock to expire after ttl if it is still held with token. It returns false
+// when the lock was lost, e.g. because it expired before being extended.
+func (l *RedisLocker) Extend(name, token string, ttl time.Duration) (bool, error) {
+    extended, err := extendScript.Run(ctx, l.client, []string{fmt.Sprintf("lock:%s", name)}, token, ttl.Milliseconds()).Int()
+    if err != nil {
+        return false, fmt.Errorf("failed to extend lock %s: %w", name, err)
+    }
+    return extended == 1, nil
+}
+
+// Release releases the named lock if it is still held with token.
+func (l *RedisLocker) Release(name, token string) error {
+    if err := releaseScript.Run(ctx, l.client, []string{fmt.Sprintf("lock:%s", name)}, token).Err(); err != nil {
+        return fmt.Errorf("failed to release lock %s: %w", name, err)
+    }
+    return nil
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/alicebob/miniredis/v2"
+    "github.com/go-redis/redis/v8"
+)
+
+func TestRedisLocker(t *testing.T) {
+    server, err := miniredis.Run()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer server.Close()
+    locker := NewLocker(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+    // Two instances contending for the lock at once: exactly one of them gets it
+    var wg sync.WaitGroup
+    start := make(chan struct{})
+    tokens := make([]string, 2)
+    acquired := make([]bool, 2)
+    for i := range tokens {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            <-start
+            var err error
+            tokens[i], acquired[i], err = locker.Acquire("refresh", time.Minute)
+            if err != nil {
+                t.Errorf("Acquire() error = %v", err)
+            }
+        }(i)
+    }
+    close(start)
+    wg.Wait()
+    if acquired[0] == acquired[1] {
+        t.Fatalf("Acquire() from two goroutines = %v, want exactly one acquired", acquired)
+    }
+    owner := tokens[0]
+    if acquired[1] {
+        owner = tokens[1]
+    }
+
+    // A release by a non-owner is refused and the lock stays held
+    if err := locker.Release("refresh", "not-the-owner"); err != nil {
+        t.Fatalf("Release() by a non-owner error = %v", err)
+    }
+    if got, _ := server.Get("lock:refresh"); got != owner {
+        t.Errorf("lock after a non-owner release = %q, want the owner's token %q", got, owner)
+    }
+    if _, ok, _ := locker.Acquire("refresh", time.Minute); ok {
+        t.Error("Acquire() succeeded after a non-owner release")
+    }
+
+    // Only the owner can extend the lock
+    if extended, err := locker.Extend("refresh", "not-the-owner", time.Hour); err != nil || extended {
+        t.Errorf("Extend() by a non-owner = %v, %v, want refused", extended, err)
+    }
+    if extended, err := locker.Extend("refresh", owner, time.Hour); err != nil || !extended {
+        t.Errorf("Extend() by the owner = %v, %v, want extended", extended, err)
+    }
+    if ttl := server.TTL("lock:refresh"); ttl != time.Hour {
+        t.Errorf("lock TTL after Extend() = %v, want %v", ttl, time.Hour)
+    }
+
+    // The owner's release frees the lock
+    if err := locker.Release("refresh", owner); err != nil {
+        t.Fatalf("Release() by the owner error = %v", err)
+    }
+    token, ok, err := locker.Acquire("refresh", time.Minute)
+    if err != nil || !ok {
+        t.Fatalf("Acquire() after the owner's release = %v, %v, want acquired", ok, err)
+    }
+
+    // An expired lock can be acquired by another holder, and the previous holder can't release it
+    server.FastForward(time.Minute + time.Second)
+    next, ok, err := locker.Acquire("refresh", time.Minute)
+    if err != nil || !ok {
+        t.Fatalf("Acquire() after the TTL = %v, %v, want acquired", ok, err)
+    }
+    if err := locker.Release("refresh", token); err != nil {
+        t.Fatalf("Release() with an expired token error = %v", err)
+    }
+    if got, _ := server.Get("lock:refresh"); got != next {
+        t.Errorf("lock after a release with an expired token = %q, want %q", got, next)
+    }
+}
@@ -4,48 +4,85 @@ import (
     "context"
     "encoding/json"
     "fmt"
+    "strconv"
+    "strings"
     "sync"
     "time"
 
     "github.com/go-redis/redis/v8"
     "stock-app/internal/entity"
+    "stock-app/pkg/config"
+    "stock-app/pkg/utils"
 )
 
 var ctx = context.Background()
 
+// Parts of the keys holding each symbol's data, `stock:<symbol>:history` and `stock:<symbol>:stored_at`.
+const (
+    keyPrefix         = "stock:"
+    historyKeySuffix  = ":history"
+    storedAtKeySuffix = ":stored_at"
+)
+
+// historyKeyPattern matches the sorted set keys holding each symbol's quotes.
+const historyKeyPattern = keyPrefix + "*" + historyKeySuffix
+
 // StockCache defines the interface for caching stock data.
 type StockCache interface {
     Get(symbol string, startTime, endTime time.Time) ([]*entity.StockQuote, bool)
-    GetAll(startTime, endTime time.Time) (map[string][]*entity.StockQuote, bool)
-    GetAllLatest() (map[string]*entity.StockQuote, bool)
+    GetAll(startTime, endTime time.Time, limit int) (map[string][]*entity.StockQuote, bool)
+    GetMany(symbols []string, startTime, endTime time.Time) (map[string][]*entity.StockQuote, error)
+    GetAllLatest() (map[string]*entity.StockQuote, error)
     Set(symbol string, stock []*entity.StockQuote, expiration time.Duration) error
     SetAll(stocks map[string][]*entity.StockQuote, expiration time.Duration) error
-    SetLatest(symbol string, stock *entity.StockQuote, expiration time.Duration)
+    SetLatest(symbol string, stock *entity.StockQuote, expiration time.Duration) error
     SetAllLatest(stocks map[string]*entity.StockQuote, expiration time.Duration) error
+    Delete(symbol string) error
     DeleteAll() error
+    Stats() ([]*entity.CacheStats, error)
+    StoredAt(symbol string) (time.Time, bool)
+    Ping() error
 }
 
 // RedisStockCache is a Redis-backed cache for stock data.
 type RedisStockCache struct {
-    client *redis.Client
+    client          redis.UniversalClient
+    readConcurrency int
+    maxEntries      int
 }
 
-// NewStockCache creates a new RedisStockCache instance.
-func NewStockCache(redisAddr string) StockCache {
-    rdb := redis.NewClient(&redis.Options{
-        Addr: redisAddr,
-    })
-
-    return &RedisStockCache{client: rdb}
+// NewStockCache creates a new RedisStockCache instance on the shared Redis client.
+func NewStockCache(client redis.UniversalClient) StockCache {
+    return &RedisStockCache{client: client, readConcurrency: config.AppConfig.CacheReadConcurrency, maxEntries: config.AppConfig.CacheMaxEntries}
 }
 
 // Get retrieves stock data from the cache by symbol for a given time range.
 func (c *RedisStockCache) Get(symbol string, startTime, endTime time.Time) ([]*entity.StockQuote, bool) {
-    key := fmt.Sprintf("stock:%s:history", symbol)
-    stockData, err := c.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
-        Min: fmt.Sprintf("%d", startTime.Unix()),
-        Max: fmt.Sprintf("%d", endTime.Unix()),
-    }).Result()
+    return c.getRecent(symbol, startTime, endTime, 0)
+}
+
+// getRecent retrieves the most recent limit quotes of a symbol within a time range from the cache,
+// oldest first, or all of them when limit is not positive. Only the limited quotes are read from Redis.
+func (c *RedisStockCache) getRecent(symbol string, startTime, endTime time.Time, limit int) ([]*entity.StockQuote, bool) {
+    key := historyKey(symbol)
+    var stockData []string
+    var err error
+    if limit > 0 {
+        stockData, err = c.client.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+            Min:   fmt.Sprintf("%d", startTime.Unix()),
+            Max:   fmt.Sprintf("%d", endTime.Unix()),
+            Count: int64(limit),
+        }).Result()
+        // Newest first, so restore the ascending order of ZRANGEBYSCORE
+        for i, j := 0, len(stockData)-1; i < j; i, j = i+1, j-1 {
+            stockData[i], stockData[j] = stockData[j], stockData[i]
+        }
+    } else {
+        stockData, err = c.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+            Min: fmt.Sprintf("%d", startTime.Unix()),
+            Max: fmt.Sprintf("%d", endTime.Unix()),
+        }).Result()
+    }
 
     if err != nil || len(stockData) == 0 {
         return nil, false // Cache miss or Redis error
@@ -54,63 +91,114 @@ func (c *RedisStockCache) Get(symbol string, startTime, endTime time.Time) ([]*e
     return c.unmarshalStockQuotes(stockData), true
 }
 
-// GetAll retrieves all stocks from the cache.
-func (c *RedisStockCache) GetAll(startTime, endTime time.Time) (map[string][]*entity.StockQuote, bool) {
+// GetAll retrieves all stocks from the cache, reading up to readConcurrency symbols in parallel. Only
+// the most recent limit quotes of each symbol are read, or all of them when limit is not positive.
+func (c *RedisStockCache) GetAll(startTime, endTime time.Time, limit int) (map[string][]*entity.StockQuote, bool) {
     stocks := make(map[string][]*entity.StockQuote)
-    keys, err := c.client.Keys(ctx, "stock:*:history").Result()
+    keys, err := c.historyKeys()
     if err != nil {
         return nil, false // Redis error
     }
 
+    workers := c.readConcurrency
+    if workers <= 0 {
+        workers = 1
+    }
+
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    symbols := make(chan string)
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for symbol := range symbols {
+                if stockQuotes, found := c.getRecent(symbol, startTime, endTime, limit); found {
+                    mu.Lock()
+                    stocks[symbol] = stockQuotes
+                    mu.Unlock()
+                }
+            }
+        }()
+    }
+
     for _, key := range keys {
-        symbol := key[6 : len(key)-8] // Extract the symbol from the key
-        if stockQuotes, found := c.Get(symbol, startTime, endTime); found {
-            stocks[symbol] = stockQuotes
-        }
+        symbols <- symbolFromHistoryKey(key)
     }
+    close(symbols)
+    wg.Wait()
 
     return stocks, len(stocks) > 0
 }
 
-// GetAllLatest retrieves the latest stock data from the cache.
-func (c *RedisStockCache) GetAllLatest() (map[string]*entity.StockQuote, bool) {
+// GetMany retrieves the cached stock data of the given symbols for a given time range in a single
+// pipeline. Symbols without cached data in the range are left out, and an error is returned when Redis fails.
+func (c *RedisStockCache) GetMany(symbols []string, startTime, endTime time.Time) (map[string][]*entity.StockQuote, error) {
+    cmds := make(map[string]*redis.StringSliceCmd, len(symbols))
+    _, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+        for _, symbol := range symbols {
+            cmds[symbol] = pipe.ZRangeByScore(ctx, historyKey(symbol), &redis.ZRangeBy{
+                Min: fmt.Sprintf("%d", startTime.Unix()),
+                Max: fmt.Sprintf("%d", endTime.Unix()),
+            })
+        }
+        return nil
+    })
+    if err != nil && err != redis.Nil {
+        return nil, fmt.Errorf("failed to get cached stock data: %w", err)
+    }
+
+    stocks := make(map[string][]*entity.StockQuote, len(symbols))
+    for symbol, cmd := range cmds {
+        if stockData := cmd.Val(); len(stockData) > 0 {
+            stocks[symbol] = c.unmarshalStockQuotes(stockData)
+        }
+    }
+    return stocks, nil
+}
+
+// GetAllLatest retrieves the latest stock data from the cache. The map is empty when nothing is cached,
+// and an error is returned when Redis fails.
+func (c *RedisStockCache) GetAllLatest() (map[string]*entity.StockQuote, error) {
     stocks := make(map[string]*entity.StockQuote)
-    keys, err := c.client.Keys(ctx, "stock:*:history").Result()
+    keys, err := c.historyKeys()
     if err != nil {
-        return nil, false // Redis error
+        return nil, fmt.Errorf("failed to list cached symbols: %w", err)
     }
 
     for _, key := range keys {
-        if stockData, err := c.client.ZRevRange(ctx, key, 0, 0).Result(); err == nil && len(stockData) > 0 {
-            var stock entity.StockQuote
-            if err := json.Unmarshal([]byte(stockData[0]), &stock); err == nil {
-                symbol := key[6 : len(key)-8] // Extract the symbol from the key
-                stocks[symbol] = &stock
-            } else {
-                fmt.Printf("Failed to unmarshal stock data: %v\n", err)
-            }
+        stockData, err := c.client.ZRevRange(ctx, key, 0, 0).Result()
+        if err != nil {
+            return nil, fmt.Errorf("failed to get latest cached quote of %s: %w", key, err)
+        }
+        if len(stockData) == 0 {
+            continue
+        }
+        var stock entity.StockQuote
+        if err := json.Unmarshal([]byte(stockData[0]), &stock); err == nil {
+            stocks[symbolFromHistoryKey(key)] = &stock
+        } else {
+            fmt.Printf("Failed to unmarshal stock data: %v\n", err)
         }
     }
 
-    return stocks, len(stocks) > 0
+    return stocks, nil
 }
 
-// Set stores stock data in the cache with an optional expiration time.
+// Set stores stock data in the cache with an optional expiration time. The cached quotes with the same
+// timestamps are replaced in the same transaction, so each timestamp holds a single quote, e.g. after a
+// correction.
 func (c *RedisStockCache) Set(symbol string, stock []*entity.StockQuote, expiration time.Duration) error {
-    key := fmt.Sprintf("stock:%s:history", symbol)
+    key := historyKey(symbol)
     
     // Prepare the []*redis.Z data
     zData := c.prepareZData(stock) 
 
-    if err := c.client.ZAdd(ctx, key, zData...).Err(); err != nil {
+    if err := c.addTrimmed(key, zData, expiration); err != nil {
         fmt.Printf("Failed to cache stock %s: %v\n", symbol, err)
         return err
     }
-
-    // Set expiration for the sorted set if specified
-    if expiration > 0 {
-        c.client.Expire(ctx, key, expiration)
-    }
+    c.markStored(symbol, expiration)
     
     fmt.Printf("Successfully cached all stock data for %s\n", symbol)
     return nil
@@ -132,57 +220,229 @@ func (c *RedisStockCache) SetAll(stocks map[string][]*entity.StockQuote, expirat
 }
 
 // SetLatest stores a single stock in the cache.
-func (c *RedisStockCache) SetLatest(symbol string, stock *entity.StockQuote, expiration time.Duration) {
-    key := fmt.Sprintf("stock:%s:history", symbol)
+func (c *RedisStockCache) SetLatest(symbol string, stock *entity.StockQuote, expiration time.Duration) error {
+    key := historyKey(symbol)
     stockJSON, err := json.Marshal(stock)
     if err != nil {
         fmt.Printf("Failed to marshal stock data for %s: %v\n", symbol, err)
-        return
+        return fmt.Errorf("failed to marshal stock data for %s: %w", symbol, err)
     }
 
-    if err := c.client.ZAdd(ctx, key, &redis.Z{
+    if err := c.addTrimmed(key, []*redis.Z{{
         Score:  float64(stock.Timestamp.Unix()),
         Member: stockJSON,
-    }).Err(); err != nil {
+    }}, expiration); err != nil {
         fmt.Printf("Failed to cache stock %s: %v\n", symbol, err)
-    } else {
-        fmt.Printf("Successfully cached stock %s\n", symbol)
+        return fmt.Errorf("failed to cache stock %s: %w", symbol, err)
     }
+    fmt.Printf("Successfully cached stock %s\n", symbol)
+    c.markStored(symbol, expiration)
+    return nil
+}
 
-    // Set expiration if specified
-    if expiration > 0 {
-        c.client.Expire(ctx, key, expiration)
-    }
+// addTrimmed adds the members to the sorted set at key, replacing the members with the same scores so
+// each timestamp holds a single quote, e.g. after a correction. In the same pipeline it trims the set
+// to the maxEntries most recent members when a cap is configured and sets the expiration if specified.
+func (c *RedisStockCache) addTrimmed(key string, members []*redis.Z, expiration time.Duration) error {
+    _, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+        for _, member := range members {
+            score := strconv.FormatFloat(member.Score, 'f', -1, 64)
+            pipe.ZRemRangeByScore(ctx, key, score, score)
+        }
+        pipe.ZAdd(ctx, key, members...)
+        if c.maxEntries > 0 {
+            // Ranks are ascending by score, i.e. by time, so this drops all but the newest maxEntries
+            pipe.ZRemRangeByRank(ctx, key, 0, int64(-c.maxEntries-1))
+        }
+        if expiration > 0 {
+            pipe.Expire(ctx, key, expiration)
+        }
+        return nil
+    })
+    return err
 }
 
-// SetAllLatest stores multiple stocks in the cache using sorted sets.
+// SetAllLatest stores multiple stocks in the cache using sorted sets. It returns an error counting the
+// stocks that failed to be stored, wrapping the first failure.
 func (c *RedisStockCache) SetAllLatest(stocks map[string]*entity.StockQuote, expiration time.Duration) error {
     var wg sync.WaitGroup
+    var mu sync.Mutex
+    var firstErr error
+    failed := 0
     for symbol, stock := range stocks {
         wg.Add(1)
         go func(symbol string, stock *entity.StockQuote) {
             defer wg.Done()
-            c.SetLatest(symbol, stock, expiration)
+            if err := c.SetLatest(symbol, stock, expiration); err != nil {
+                mu.Lock()
+                defer mu.Unlock()
+                if firstErr == nil {
+                    firstErr = err
+                }
+                failed++
+            }
         }(symbol, stock)
     }
     wg.Wait()
+    if firstErr != nil {
+        return fmt.Errorf("failed to cache %d of %d latest quotes: %w", failed, len(stocks), firstErr)
+    }
     return nil
 }
 
+// Delete deletes the stock data of a symbol from the cache.
+func (c *RedisStockCache) Delete(symbol string) error {
+    if err := c.deleteKeys(historyKey(symbol), storedAtKey(symbol)); err != nil {
+        return fmt.Errorf("failed to delete cached data for %s: %w", symbol, err)
+    }
+    return nil
+}
+
+// Ping checks that Redis is reachable.
+func (c *RedisStockCache) Ping() error {
+    return c.client.Ping(ctx).Err()
+}
+
 // DeleteAll deletes all stock data from the cache.
 func (c *RedisStockCache) DeleteAll() error {
-    keys, err := c.client.Keys(ctx, "stock:*:history").Result()
+    keys, err := c.historyKeys()
     if err != nil {
         return fmt.Errorf("failed to get all keys: %w", err)
     }
 
+    toDelete := make([]string, 0, 2*len(keys))
     for _, key := range keys {
-        if err := c.client.Del(ctx, key).Err(); err != nil {
-            return fmt.Errorf("failed to delete key %s: %w", key, err)
+        toDelete = append(toDelete, key, storedAtKey(symbolFromHistoryKey(key)))
+    }
+    if err := c.deleteKeys(toDelete...); err != nil {
+        return fmt.Errorf("failed to delete all keys: %w", err)
+    }
+    return nil
+}
+
+// deleteKeys deletes the keys with one DEL each, pipelined. A single multi-key DEL fails with
+// CROSSSLOT on a cluster as soon as the keys hash to different slots.
+func (c *RedisStockCache) deleteKeys(keys ...string) error {
+    if len(keys) == 0 {
+        return nil
+    }
+    pipe := c.client.Pipeline()
+    for _, key := range keys {
+        pipe.Del(ctx, key)
+    }
+    _, err := pipe.Exec(ctx)
+    return err
+}
+
+// Stats gathers the member count, memory usage and oldest/newest scores of each cached symbol.
+func (c *RedisStockCache) Stats() ([]*entity.CacheStats, error) {
+    keys, err := c.historyKeys()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get all keys: %w", err)
+    }
+
+    type keyCmds struct {
+        count  *redis.IntCmd
+        memory *redis.IntCmd
+        oldest *redis.ZSliceCmd
+        newest *redis.ZSliceCmd
+    }
+
+    // Queue all commands in a single pipeline to avoid a round-trip per key
+    pipe := c.client.Pipeline()
+    cmds := make([]keyCmds, len(keys))
+    for i, key := range keys {
+        cmds[i] = keyCmds{
+            count:  pipe.ZCard(ctx, key),
+            memory: pipe.MemoryUsage(ctx, key),
+            oldest: pipe.ZRangeWithScores(ctx, key, 0, 0),
+            newest: pipe.ZRevRangeWithScores(ctx, key, 0, 0),
         }
     }
+    if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+        return nil, fmt.Errorf("failed to gather cache stats: %w", err)
+    }
 
-    return nil
+    stats := make([]*entity.CacheStats, 0, len(keys))
+    for i, key := range keys {
+        stat := &entity.CacheStats{
+            Symbol:      symbolFromHistoryKey(key),
+            Count:       cmds[i].count.Val(),
+            MemoryBytes: cmds[i].memory.Val(),
+        }
+        if oldest := cmds[i].oldest.Val(); len(oldest) > 0 {
+            stat.Oldest = time.Unix(int64(oldest[0].Score), 0)
+        }
+        if newest := cmds[i].newest.Val(); len(newest) > 0 {
+            stat.Newest = time.Unix(int64(newest[0].Score), 0)
+        }
+        stats = append(stats, stat)
+    }
+    return stats, nil
+}
+
+// historyKeys lists the history keys of all symbols with SCAN. On a cluster, every master node
+// is scanned since each one only holds the keys of its own hash slots.
+func (c *RedisStockCache) historyKeys() ([]string, error) {
+    cluster, ok := c.client.(*redis.ClusterClient)
+    if !ok {
+        return scanKeys(ctx, c.client, historyKeyPattern)
+    }
+
+    var mu sync.Mutex
+    var keys []string
+    err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+        nodeKeys, err := scanKeys(ctx, node, historyKeyPattern)
+        if err != nil {
+            return err
+        }
+        mu.Lock()
+        keys = append(keys, nodeKeys...)
+        mu.Unlock()
+        return nil
+    })
+    return keys, err
+}
+
+// StoredAt returns when the symbol's quotes were last written to the cache.
+func (c *RedisStockCache) StoredAt(symbol string) (time.Time, bool) {
+    storedAt, err := c.client.Get(ctx, storedAtKey(symbol)).Int64()
+    if err != nil {
+        return time.Time{}, false // Never stored, expired or Redis error
+    }
+    return time.Unix(storedAt, 0), true
+}
+
+// markStored records the time the symbol's quotes were written, expiring along with them.
+func (c *RedisStockCache) markStored(symbol string, expiration time.Duration) {
+    if err := c.client.Set(ctx, storedAtKey(symbol), time.Now().Unix(), expiration).Err(); err != nil {
+        fmt.Printf("Failed to mark stock %s as stored: %v\n", symbol, err)
+    }
+}
+
+// storedAtKey builds the key holding the time a symbol's quotes were last written.
+func storedAtKey(symbol string) string {
+    return keyPrefix + utils.NormalizeSymbol(symbol) + storedAtKeySuffix
+}
+
+// historyKey builds the key of the sorted set holding a symbol's quotes.
+func historyKey(symbol string) string {
+    return keyPrefix + utils.NormalizeSymbol(symbol) + historyKeySuffix
+}
+
+// symbolFromHistoryKey extracts the symbol from the key built by historyKey.
+func symbolFromHistoryKey(key string) string {
+    return strings.TrimSuffix(strings.TrimPrefix(key, keyPrefix), historyKeySuffix)
+}
+
+// scanKeys iterates over the keys matching the pattern without blocking the server like KEYS does.
+func scanKeys(ctx context.Context, client redis.Cmdable, pattern string) ([]string, error) {
+    var keys []string
+    iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+    for iter.Next(ctx) {
+        keys = append(keys, iter.Val())
+    }
+    return keys, iter.Err()
 }
 
 // Helper function to unmarshal stock quotes from JSON data.
@@ -0,0 +1,295 @@
+package cache
+
+import (
+    "fmt"
+    "reflect"
+    "sort"
+    "testing"
+    "time"
+
+    "github.com/alicebob/miniredis/v2"
+    "github.com/go-redis/redis/v8"
+
+    "stock-app/internal/entity"
+)
+
+// newTestCache returns a RedisStockCache backed by an in-memory Redis server.
+func newTestCache(tb testing.TB) (*RedisStockCache, *miniredis.Miniredis) {
+    tb.Helper()
+    server := miniredis.RunT(tb)
+    return NewStockCache(redis.NewClient(&redis.Options{Addr: server.Addr()})).(*RedisStockCache), server
+}
+
+func TestStats(t *testing.T) {
+    c, _ := newTestCache(t)
+    minute := func(m int) time.Time {
+        return time.Date(2025, time.June, 11, 10, m, 0, 0, time.UTC)
+    }
+    if err := c.SetAll(map[string][]*entity.StockQuote{
+        "AAPL": {{Symbol: "AAPL", Price: 1, Timestamp: minute(0)}, {Symbol: "AAPL", Price: 2, Timestamp: minute(1)}, {Symbol: "AAPL", Price: 3, Timestamp: minute(2)}},
+        "MSFT": {{Symbol: "MSFT", Price: 10, Timestamp: minute(5)}},
+    }, time.Hour); err != nil {
+        t.Fatalf("SetAll() error = %v", err)
+    }
+
+    stats, err := c.Stats()
+    if err != nil {
+        t.Fatalf("Stats() error = %v", err)
+    }
+    want := map[string]entity.CacheStats{
+        "AAPL": {Symbol: "AAPL", Count: 3, Oldest: minute(0), Newest: minute(2)},
+        "MSFT": {Symbol: "MSFT", Count: 1, Oldest: minute(5), Newest: minute(5)},
+    }
+    if len(stats) != len(want) {
+        t.Fatalf("Stats() returned %d symbols, want %d", len(stats), len(want))
+    }
+    for _, stat := range stats {
+        w, ok := want[stat.Symbol]
+        if !ok {
+            t.Fatalf("Stats() returned unexpected symbol %q", stat.Symbol)
+        }
+        if stat.Count != w.Count || !stat.Oldest.Equal(w.Oldest) || !stat.Newest.Equal(w.Newest) {
+            t.Errorf("%s stats = %+v, want count %d from %v to %v", stat.Symbol, stat, w.Count, w.Oldest, w.Newest)
+        }
+    }
+}
+
+func TestHistoryKeys(t *testing.T) {
+    c, server := newTestCache(t)
+    for _, symbol := range []string{"AAPL", "MSFT", "TSLA"} {
+        if _, err := server.ZAdd("stock:"+symbol+":history", 1, "{}"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    server.Set("stock:AAPL:latest", "{}")
+
+    keys, err := c.historyKeys()
+    if err != nil {
+        t.Fatalf("historyKeys() error = %v", err)
+    }
+    sort.Strings(keys)
+    want := []string{"stock:AAPL:history", "stock:MSFT:history", "stock:TSLA:history"}
+    if !reflect.DeepEqual(keys, want) {
+        t.Errorf("historyKeys() = %v, want %v", keys, want)
+    }
+}
+
+func TestSymbolCase(t *testing.T) {
+    c, _ := newTestCache(t)
+    at := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)
+    if err := c.Set("aapl", []*entity.StockQuote{{Symbol: "AAPL", Price: 1, Timestamp: at}}, time.Hour); err != nil {
+        t.Fatalf("Set() error = %v", err)
+    }
+    if err := c.SetLatest(" Aapl ", &entity.StockQuote{Symbol: "AAPL", Price: 2, Timestamp: at.Add(time.Minute)}, time.Hour); err != nil {
+        t.Fatalf("SetLatest() error = %v", err)
+    }
+
+    for _, symbol := range []string{"AAPL", "aapl"} {
+        quotes, found := c.Get(symbol, at, at.Add(time.Hour))
+        if !found || len(quotes) != 2 {
+            t.Errorf("Get(%q) = %d quotes, %v, want both quotes", symbol, len(quotes), found)
+        }
+    }
+    latest, err := c.GetAllLatest()
+    if err != nil {
+        t.Fatalf("GetAllLatest() error = %v", err)
+    }
+    if len(latest) != 1 || latest["AAPL"] == nil || latest["AAPL"].Price != 2 {
+        t.Errorf("GetAllLatest() = %v, want only the latest AAPL quote", latest)
+    }
+}
+
+// cacheSymbols fills the cache with ten quotes for each of n symbols.
+func cacheSymbols(tb testing.TB, c *RedisStockCache, n int) {
+    tb.Helper()
+    start := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)
+    stocks := make(map[string][]*entity.StockQuote, n)
+    for i := 0; i < n; i++ {
+        symbol := fmt.Sprintf("S%03d", i)
+        for m := 0; m < 10; m++ {
+            stocks[symbol] = append(stocks[symbol], &entity.StockQuote{Symbol: symbol, Price: float64(i + m), Timestamp: start.Add(time.Duration(m) * time.Minute)})
+        }
+    }
+    if err := c.SetAll(stocks, time.Hour); err != nil {
+        tb.Fatalf("SetAll() error = %v", err)
+    }
+}
+
+func TestGetAllReadConcurrency(t *testing.T) {
+    c, _ := newTestCache(t)
+    cacheSymbols(t, c, 50)
+    start, end := time.Date(2025, time.June, 11, 10, 2, 0, 0, time.UTC), time.Date(2025, time.June, 11, 10, 5, 0, 0, time.UTC)
+
+    c.readConcurrency = 1
+    serial, found := c.GetAll(start, end, 0)
+    if !found || len(serial) != 50 {
+        t.Fatalf("serial GetAll() returned %d symbols (found %v), want 50", len(serial), found)
+    }
+    for _, concurrency := range []int{0, 8, 100} {
+        c.readConcurrency = concurrency
+        parallel, found := c.GetAll(start, end, 0)
+        if !found || !reflect.DeepEqual(parallel, serial) {
+            t.Errorf("GetAll() with a concurrency of %d differs from the serial read", concurrency)
+        }
+    }
+    if quotes := serial["S007"]; len(quotes) != 4 {
+        t.Errorf("S007 has %d quotes in range, want 4", len(quotes))
+    }
+}
+
+func TestGetAllLimit(t *testing.T) {
+    c, _ := newTestCache(t)
+    cacheSymbols(t, c, 3)
+    start, end := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC), time.Date(2025, time.June, 11, 10, 5, 0, 0, time.UTC)
+
+    stocks, found := c.GetAll(start, end, 2)
+    if !found || len(stocks) != 3 {
+        t.Fatalf("GetAll() returned %d symbols (found %v), want 3", len(stocks), found)
+    }
+    // The most recent 2 of the 6 quotes in range, oldest first
+    quotes := stocks["S001"]
+    if len(quotes) != 2 || !quotes[0].Timestamp.Equal(start.Add(4*time.Minute)) || !quotes[1].Timestamp.Equal(end) {
+        t.Errorf("S001 quotes = %v, want those at 10:04 and 10:05", quotes)
+    }
+}
+
+// BenchmarkGetAll compares serial and parallel reads of 200 symbols. The in-memory server adds no
+// network round-trip, which is what the parallel reads save against a real Redis.
+func BenchmarkGetAll(b *testing.B) {
+    c, _ := newTestCache(b)
+    cacheSymbols(b, c, 200)
+    start, end := time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC), time.Date(2025, time.June, 12, 0, 0, 0, 0, time.UTC)
+
+    for _, concurrency := range []int{1, 8, 32} {
+        b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+            c.readConcurrency = concurrency
+            for i := 0; i < b.N; i++ {
+                if stocks, _ := c.GetAll(start, end, 0); len(stocks) != 200 {
+                    b.Fatalf("GetAll() returned %d symbols, want 200", len(stocks))
+                }
+            }
+        })
+    }
+}
+
+func TestSymbolFromHistoryKey(t *testing.T) {
+    tests := []struct {
+        symbol string
+        want   string
+    }{
+        {symbol: "AAPL", want: "AAPL"},
+        {symbol: " msft ", want: "MSFT"},
+        {symbol: "VOD.L", want: "VOD.L"},
+        {symbol: "BRK:B", want: "BRK:B"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.symbol, func(t *testing.T) {
+            if got := symbolFromHistoryKey(historyKey(tt.symbol)); got != tt.want {
+                t.Errorf("symbolFromHistoryKey(historyKey(%q)) = %q, want %q", tt.symbol, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestStoredAt(t *testing.T) {
+    c, server := newTestCache(t)
+    if _, found := c.StoredAt("AAPL"); found {
+        t.Fatal("StoredAt() of a symbol never cached found a time")
+    }
+
+    before := time.Now().Truncate(time.Second)
+    if err := c.SetLatest("aapl", &entity.StockQuote{Symbol: "AAPL", Price: 1, Timestamp: before}, time.Hour); err != nil {
+        t.Fatalf("SetLatest() error = %v", err)
+    }
+    storedAt, found := c.StoredAt("AAPL")
+    if !found || storedAt.Before(before) || storedAt.After(time.Now()) {
+        t.Errorf("StoredAt() = %v, %v, want the time SetLatest ran", storedAt, found)
+    }
+
+    // The marker expires along with the quotes it describes
+    server.FastForward(time.Hour)
+    if _, found := c.StoredAt("AAPL"); found {
+        t.Error("StoredAt() found a time after the quotes expired")
+    }
+}
+
+func TestDelete(t *testing.T) {
+    c, server := newTestCache(t)
+    start := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)
+    for _, symbol := range []string{"AAPL", "MSFT"} {
+        if err := c.Set(symbol, []*entity.StockQuote{{Symbol: symbol, Price: 1, Timestamp: start}}, time.Hour); err != nil {
+            t.Fatalf("Set(%s) error = %v", symbol, err)
+        }
+    }
+
+    if err := c.Delete("AAPL"); err != nil {
+        t.Fatalf("Delete(AAPL) error = %v", err)
+    }
+    if quotes, found := c.Get("AAPL", start, start.Add(time.Minute)); found || len(quotes) > 0 {
+        t.Errorf("Get(AAPL) after Delete = %v, %v, want nothing cached", quotes, found)
+    }
+    if _, found := c.StoredAt("AAPL"); found {
+        t.Error("StoredAt(AAPL) after Delete found a store time")
+    }
+    if quotes, found := c.Get("MSFT", start, start.Add(time.Minute)); !found || len(quotes) != 1 {
+        t.Errorf("Get(MSFT) after deleting AAPL = %v, %v, want its quote", quotes, found)
+    }
+    if server.Exists(historyKey("AAPL")) {
+        t.Errorf("%s still exists after Delete", historyKey("AAPL"))
+    }
+}
+
+func TestSetReplacesQuoteAtTimestamp(t *testing.T) {
+    c, _ := newTestCache(t)
+    start := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)
+    if err := c.Set("AAPL", []*entity.StockQuote{{Symbol: "AAPL", Price: 1, Timestamp: start}, {Symbol: "AAPL", Price: 2, Timestamp: start.Add(time.Minute)}}, time.Hour); err != nil {
+        t.Fatalf("Set() error = %v", err)
+    }
+    if err := c.Set("AAPL", []*entity.StockQuote{{Symbol: "AAPL", Price: 1.5, Timestamp: start}}, time.Hour); err != nil {
+        t.Fatalf("Set() of a correction error = %v", err)
+    }
+
+    cached, err := c.GetMany([]string{"AAPL", "MSFT"}, start, start.Add(time.Minute))
+    if err != nil {
+        t.Fatalf("GetMany() error = %v", err)
+    }
+    if _, found := cached["MSFT"]; found {
+        t.Errorf("GetMany() returned MSFT, which isn't cached")
+    }
+    if got := cached["AAPL"]; len(got) != 2 || got[0].Price != 1.5 || got[1].Price != 2 {
+        t.Errorf("GetMany() AAPL = %v, want the corrected quote and the untouched one", got)
+    }
+}
+
+func TestSetTrimsToMaxEntries(t *testing.T) {
+    c, server := newTestCache(t)
+    c.maxEntries = 3
+    start := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)
+    quotes := make([]*entity.StockQuote, 4)
+    for i := range quotes {
+        quotes[i] = &entity.StockQuote{Symbol: "AAPL", Price: float64(i), Timestamp: start.Add(time.Duration(i) * time.Minute)}
+    }
+
+    if err := c.Set("AAPL", quotes, time.Hour); err != nil {
+        t.Fatalf("Set() error = %v", err)
+    }
+    if err := c.SetLatest("AAPL", &entity.StockQuote{Symbol: "AAPL", Price: 4, Timestamp: start.Add(4 * time.Minute)}, time.Hour); err != nil {
+        t.Fatalf("SetLatest() error = %v", err)
+    }
+
+    // Only the 3 most recent of the 5 quotes are left
+    members, err := server.ZMembers(historyKey("AAPL"))
+    if err != nil {
+        t.Fatalf("ZMembers() error = %v", err)
+    }
+    if len(members) != 3 {
+        t.Fatalf("sorted set holds %d members, want 3", len(members))
+    }
+    cached, found := c.Get("AAPL", start, start.Add(4*time.Minute))
+    if !found || len(cached) != 3 || cached[0].Price != 2 || cached[2].Price != 4 {
+        t.Errorf("Get() = %v, want the quotes at 10:02 to 10:04", cached)
+    }
+    if ttl := server.TTL(historyKey("AAPL")); ttl != time.Hour {
+        t.Errorf("TTL = %v, want %v", ttl, time.Hour)
+    }
+}
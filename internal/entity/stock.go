@@ -1,8 +1,11 @@
 package entity
 
 import (
+    "sort"
+    "strings"
     "sync"
     "time"
+    "unicode"
 )
 
 // AlphaVantage
@@ -27,7 +30,7 @@ type MetaDataIntraday struct {
 
 
 type TSIntradayResponse struct {
-    MetaData   MetaDataIntraday          `json:"Meta Data" validate:"required,dive"`
+    MetaData   MetaDataIntraday          `json:"Meta Data" validate:"required"`
     TimeSeries map[string]TimeSeriesData `json:"Time Series (1min)" validate:"required,dive"`
 }
 
@@ -40,7 +43,7 @@ type MetaDataDaily struct {
 }
 
 type TSDailyResponse struct {
-    MetaData   MetaDataDaily             `json:"Meta Data" validate:"required,dive"`
+    MetaData   MetaDataDaily             `json:"Meta Data" validate:"required"`
     TimeSeries map[string]TimeSeriesData `json:"Time Series (Daily)" validate:"required,dive"`
 }
 
@@ -65,10 +68,215 @@ type StockQuote struct {
     PrevClose        float64 `json:"pc"`
     Volume           float64  `json:"v"`
     Timestamp        time.Time  `json:"t"`
+    PrevCloseMissing bool       `json:"pcMissing,omitempty"`
+    ExtendedHoursPrice  float64 `json:"ec,omitempty"`
+    ExtendedHoursChange float64 `json:"ed,omitempty"`
+}
+
+// DailyBar is a single day of OHLCV data from stock_daily_data.
+type DailyBar struct {
+    Symbol string    `json:"s"`
+    Open   float64   `json:"o"`
+    High   float64   `json:"h"`
+    Low    float64   `json:"l"`
+    Close  float64   `json:"c"`
+    Volume float64   `json:"v"`
+    Date   time.Time `json:"t"`
+}
+
+// OpeningGap is the gap between a symbol's open on its latest trading day and the previous close.
+type OpeningGap struct {
+    Symbol     string    `json:"symbol"`
+    Date       time.Time `json:"date"`
+    Open       float64   `json:"open"`
+    PrevClose  float64   `json:"prevClose"`
+    GapPercent float64   `json:"gapPercent"`
+}
+
+// ReturnStats summarizes the daily log returns of a symbol over a date range.
+type ReturnStats struct {
+    Symbol     string    `json:"symbol"`
+    Start      time.Time `json:"start"`
+    End        time.Time `json:"end"`
+    Count      int       `json:"count"`
+    Mean       float64   `json:"mean"`
+    Volatility float64   `json:"volatility"`
+    Min        float64   `json:"min"`
+    Max        float64   `json:"max"`
+}
+
+// Gap is a stretch of consecutive regular-session minutes with no intraday bar.
+// Start is the first missing minute and End the last one.
+type Gap struct {
+    Start   time.Time `json:"start"`
+    End     time.Time `json:"end"`
+    Minutes int       `json:"minutes"`
+}
+
+// TableStats describes the size and time range of a database table.
+type TableStats struct {
+    Table         string     `json:"table"`
+    EstimatedRows int64      `json:"estimatedRows"`
+    TotalBytes    int64      `json:"totalBytes"`
+    Earliest      *time.Time `json:"earliest"`
+    Latest        *time.Time `json:"latest"`
+}
+
+// RepoStats describes the stored stock data.
+type RepoStats struct {
+    Tables          []*TableStats `json:"tables"`
+    DistinctSymbols int64         `json:"distinctSymbols"`
+}
+
+// CacheStats describes the cached sorted set of a symbol.
+type CacheStats struct {
+    Symbol      string    `json:"symbol"`
+    Count       int64     `json:"count"`
+    MemoryBytes int64     `json:"memoryBytes"`
+    Oldest      time.Time `json:"oldest"`
+    Newest      time.Time `json:"newest"`
+}
+
+// Refresh job statuses.
+const (
+    RefreshPending   = "pending"
+    RefreshRunning   = "running"
+    RefreshSucceeded = "succeeded"
+    RefreshFailed    = "failed"
+)
+
+// Refresh job types.
+const (
+    RefreshTypeManual   = "manual"
+    RefreshTypeIntraday = "intraday"
+    RefreshTypeDaily    = "daily"
+)
+
+// RefreshJob tracks a refresh of the stored data, either triggered through the admin API or scheduled.
+type RefreshJob struct {
+    ID           string     `json:"id"`
+    Type         string     `json:"type"`
+    Status       string     `json:"status"`
+    Error        string     `json:"error,omitempty"`
+    RowsInserted int64      `json:"rowsInserted"`
+    CreatedAt    time.Time  `json:"createdAt"`
+    StartedAt    *time.Time `json:"startedAt,omitempty"`
+    FinishedAt   *time.Time `json:"finishedAt,omitempty"`
 }
 
 // LatestQuoteData holds real-time stock data in memory.
 type LatestQuoteData struct {
-    StockData map[string]*StockQuote `json:"StockData"`
-    Mu        sync.RWMutex           `json:"Mu"`
-}
\ No newline at end of file
+    stockData map[string]*StockQuote
+    mu        sync.RWMutex
+}
+
+// NewLatestQuoteData creates an empty LatestQuoteData.
+func NewLatestQuoteData() *LatestQuoteData {
+    return &LatestQuoteData{
+        stockData: make(map[string]*StockQuote),
+    }
+}
+
+// Get returns the latest quote for a symbol.
+func (d *LatestQuoteData) Get(symbol string) (*StockQuote, bool) {
+    d.mu.RLock()
+    defer d.mu.RUnlock()
+    quote, exists := d.stockData[symbol]
+    return quote, exists
+}
+
+// Set stores the latest quote for a symbol.
+func (d *LatestQuoteData) Set(symbol string, quote *StockQuote) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    d.stockData[symbol] = quote
+}
+
+// Snapshot returns a copy of the symbol to quote map that is safe to iterate without holding the lock.
+func (d *LatestQuoteData) Snapshot() map[string]*StockQuote {
+    d.mu.RLock()
+    defer d.mu.RUnlock()
+    snapshot := make(map[string]*StockQuote, len(d.stockData))
+    for symbol, quote := range d.stockData {
+        snapshot[symbol] = quote
+    }
+    return snapshot
+}
+
+// CompanyProfile holds the descriptive data of a listed company.
+type CompanyProfile struct {
+    Symbol string `json:"symbol"`
+    Name   string `json:"name"`
+}
+
+// companySuffixes are legal-form words ignored when matching company names.
+var companySuffixes = map[string]bool{
+    "inc": true, "incorporated": true, "corp": true, "corporation": true, "co": true,
+    "company": true, "ltd": true, "limited": true, "plc": true, "holdings": true, "class": true,
+}
+
+// normalizeCompanyName lowercases a company name, drops punctuation and trailing legal-form words,
+// so "Tesla, Inc." and "tesla" compare equal.
+func normalizeCompanyName(name string) string {
+    words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+    for len(words) > 1 && companySuffixes[words[len(words)-1]] {
+        words = words[:len(words)-1]
+    }
+    return strings.Join(words, " ")
+}
+
+// CompanyIndex holds company profiles in memory by symbol, resolving them by company name. Share
+// classes such as GOOG and GOOGL have the same name and are kept apart.
+type CompanyIndex struct {
+    profiles map[string]*CompanyProfile
+    mu       sync.RWMutex
+}
+
+// NewCompanyIndex creates an empty CompanyIndex.
+func NewCompanyIndex() *CompanyIndex {
+    return &CompanyIndex{
+        profiles: make(map[string]*CompanyProfile),
+    }
+}
+
+// Set indexes a company profile by its symbol, replacing the symbol's previous profile.
+func (idx *CompanyIndex) Set(profile *CompanyProfile) {
+    if normalizeCompanyName(profile.Name) == "" {
+        return
+    }
+    idx.mu.Lock()
+    defer idx.mu.Unlock()
+    idx.profiles[profile.Symbol] = profile
+}
+
+// Resolve returns the profiles matching a company name, sorted by symbol. Exact matches of the
+// normalized name win, e.g. both share classes of a company; otherwise every profile whose name
+// starts with it matches.
+func (idx *CompanyIndex) Resolve(name string) []*CompanyProfile {
+    key := normalizeCompanyName(name)
+    if key == "" {
+        return nil
+    }
+
+    idx.mu.RLock()
+    defer idx.mu.RUnlock()
+    var exact, matches []*CompanyProfile
+    for _, profile := range idx.profiles {
+        indexed := normalizeCompanyName(profile.Name)
+        switch {
+        case indexed == key:
+            exact = append(exact, profile)
+        case strings.HasPrefix(indexed, key):
+            matches = append(matches, profile)
+        }
+    }
+    if len(exact) > 0 {
+        matches = exact
+    }
+    sort.Slice(matches, func(i, j int) bool {
+        return matches[i].Symbol < matches[j].Symbol
+    })
+    return matches
+}
@@ -0,0 +1,88 @@
+package entity
+
+import (
+    "strings"
+    "sync"
+    "testing"
+)
+
+// TestLatestQuoteDataConcurrency hammers Get, Set and Snapshot from many goroutines; run it with
+// -race to catch unsynchronized access.
+func TestLatestQuoteDataConcurrency(t *testing.T) {
+    data := NewLatestQuoteData()
+    symbols := []string{"AAPL", "MSFT", "GOOG", "AMZN"}
+
+    var wg sync.WaitGroup
+    for w := 0; w < 8; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            for i := 0; i < 1000; i++ {
+                symbol := symbols[(w+i)%len(symbols)]
+                switch i % 3 {
+                case 0:
+                    data.Set(symbol, &StockQuote{Symbol: symbol, Price: float64(i)})
+                case 1:
+                    if quote, ok := data.Get(symbol); ok && quote.Symbol != symbol {
+                        t.Errorf("Get(%s) returned a quote of %s", symbol, quote.Symbol)
+                    }
+                default:
+                    for s, quote := range data.Snapshot() {
+                        if quote.Symbol != s {
+                            t.Errorf("snapshot maps %s to a quote of %s", s, quote.Symbol)
+                        }
+                    }
+                }
+            }
+        }(w)
+    }
+    wg.Wait()
+
+    snapshot := data.Snapshot()
+    if len(snapshot) != len(symbols) {
+        t.Fatalf("snapshot has %d symbols, want %d", len(snapshot), len(symbols))
+    }
+    // The snapshot is a copy: writing it leaves the data untouched.
+    delete(snapshot, "AAPL")
+    if _, ok := data.Get("AAPL"); !ok {
+        t.Error("deleting from a snapshot removed AAPL from the data")
+    }
+}
+
+func TestCompanyIndexResolve(t *testing.T) {
+    idx := NewCompanyIndex()
+    for _, profile := range []*CompanyProfile{
+        {Symbol: "TSLA", Name: "Tesla Inc"},
+        {Symbol: "GOOGL", Name: "Alphabet Inc"},
+        {Symbol: "GOOG", Name: "Alphabet Inc"},
+        {Symbol: "AAPL", Name: "Apple Inc"},
+        {Symbol: "APLE", Name: "Apple Hospitality REIT Inc"},
+    } {
+        idx.Set(profile)
+    }
+
+    tests := []struct {
+        name string
+        want []string
+    }{
+        {name: "Tesla, Inc.", want: []string{"TSLA"}},
+        {name: "tesla", want: []string{"TSLA"}},
+        {name: "tes", want: []string{"TSLA"}},
+        {name: "Alphabet", want: []string{"GOOG", "GOOGL"}},
+        {name: "Apple", want: []string{"AAPL"}},
+        {name: "app", want: []string{"AAPL", "APLE"}},
+        {name: "Microsoft", want: nil},
+        {name: "", want: nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var got []string
+            for _, profile := range idx.Resolve(tt.name) {
+                got = append(got, profile.Symbol)
+            }
+            if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+                t.Errorf("Resolve(%q) = %v, want %v", tt.name, got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"stock-app/internal/entity"
+	"stock-app/internal/usecase"
+	"stock-app/pkg/utils"
+)
+
+// AdminHandler exposes operational endpoints for administrators.
+type AdminHandler struct {
+	adminUseCase   *usecase.AdminUseCase
+	refreshUseCase *usecase.RefreshUseCase
+}
+
+// NewAdminHandler creates a new instance of AdminHandler.
+func NewAdminHandler(adminUseCase *usecase.AdminUseCase, refreshUseCase *usecase.RefreshUseCase) *AdminHandler {
+	return &AdminHandler{
+		adminUseCase:   adminUseCase,
+		refreshUseCase: refreshUseCase,
+	}
+}
+
+// GetCacheStats handles GET requests to retrieve per-symbol cache statistics.
+func (ah *AdminHandler) GetCacheStats(c *gin.Context) {
+	stats, err := ah.adminUseCase.GetCacheStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get cache stats: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetRepoStats handles GET requests to retrieve the row counts, sizes and time ranges of the database tables.
+func (ah *AdminHandler) GetRepoStats(c *gin.Context) {
+	stats, err := ah.adminUseCase.GetRepoStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get repository stats: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetGaps handles GET requests to list the regular-session minutes of a day with no intraday bar
+// for a symbol. `day` is a YYYY-MM-DD date and defaults to today.
+func (ah *AdminHandler) GetGaps(c *gin.Context) {
+	symbol := utils.NormalizeSymbol(c.Query("symbol"))
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is a required query parameter"})
+		return
+	}
+	if err := utils.ValidateSymbol(symbol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	day := time.Now()
+	if value := c.Query("day"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid day format, expected YYYY-MM-DD"})
+			return
+		}
+		day = parsed
+	}
+
+	gaps, err := ah.adminUseCase.DetectGaps(symbol, day)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to detect gaps: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"symbol": symbol, "day": day.Format("2006-01-02"), "gaps": gaps})
+}
+
+// StartRefresh handles POST requests to start a data refresh. Retries carrying the same
+// Idempotency-Key header get the job started by the first request instead of a new one.
+func (ah *AdminHandler) StartRefresh(c *gin.Context) {
+	job, created, err := ah.refreshUseCase.StartRefresh(c.GetHeader("Idempotency-Key"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to start refresh: %v", err)})
+		return
+	}
+
+	if !created {
+		c.JSON(http.StatusOK, job)
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetRefreshJob handles GET requests to retrieve the status of a refresh job.
+func (ah *AdminHandler) GetRefreshJob(c *gin.Context) {
+	job, err := ah.refreshUseCase.GetRefreshJob(c.Param("id"))
+	if err != nil {
+		respondError(c, err, "failed to get refresh job")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// defaultRefreshHistoryLimit is the number of jobs GetRefreshHistory returns without a `limit`.
+const defaultRefreshHistoryLimit = 20
+
+// finishedRefreshStatuses are the statuses of the jobs in the refresh history, which GetRefreshHistory
+// can filter by.
+var finishedRefreshStatuses = map[string]bool{
+	entity.RefreshSucceeded: true,
+	entity.RefreshFailed:    true,
+}
+
+// GetRefreshHistory handles GET requests to list the most recently finished refresh jobs, newest
+// first, optionally filtered by `status`.
+func (ah *AdminHandler) GetRefreshHistory(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && !finishedRefreshStatuses[status] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid status: %s", status)})
+		return
+	}
+
+	limit := defaultRefreshHistoryLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+
+	jobs, err := ah.refreshUseCase.GetRefreshHistory(status, limit)
+	if err != nil {
+		respondError(c, err, "failed to get refresh history")
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
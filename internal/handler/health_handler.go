@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"stock-app/internal/usecase"
+)
+
+// HealthHandler exposes the readiness of the server.
+type HealthHandler struct {
+	ready        atomic.Bool
+	stockUseCase *usecase.StockServingUseCase
+}
+
+// NewHealthHandler creates a new instance of HealthHandler, initially not ready.
+func NewHealthHandler(stockUseCase *usecase.StockServingUseCase) *HealthHandler {
+	return &HealthHandler{stockUseCase: stockUseCase}
+}
+
+// SetReady marks the server as ready to serve traffic.
+func (hh *HealthHandler) SetReady() {
+	hh.ready.Store(true)
+}
+
+// Ready handles GET requests to check whether the initial data has been loaded. Once ready, the
+// response also reports the newest intraday timestamp across all symbols as `latestData`, omitted
+// when the DB holds no intraday data or can't be queried.
+func (hh *HealthHandler) Ready(c *gin.Context) {
+	if !hh.ready.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "warming up"})
+		return
+	}
+
+	response := gin.H{"status": "ready"}
+	latest, err := hh.stockUseCase.GetGlobalLatestTimestamp()
+	if err != nil {
+		fmt.Printf("Failed to get global latest timestamp: %v\n", err)
+	} else {
+		response["latestData"] = latest
+	}
+	c.JSON(http.StatusOK, response)
+}
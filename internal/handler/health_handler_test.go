@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+	"stock-app/internal/usecase"
+	apperrors "stock-app/pkg/errors"
+)
+
+// freshnessRepo serves a fixed global latest timestamp, or err.
+type freshnessRepo struct {
+	repository.StockRepo
+	latest time.Time
+	err    error
+}
+
+func (r *freshnessRepo) GetGlobalLatestTimestamp() (time.Time, error) {
+	return r.latest, r.err
+}
+
+func TestReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	latest := time.Date(2025, time.June, 10, 10, 15, 0, 0, time.UTC)
+	ready := func(hh *HealthHandler) (int, map[string]interface{}) {
+		router := gin.New()
+		router.GET("/readyz", hh.Ready)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid JSON response %q: %v", w.Body, err)
+		}
+		return w.Code, body
+	}
+	newHandler := func(repo repository.StockRepo) *HealthHandler {
+		return NewHealthHandler(usecase.NewStockServingUseCase(repo, nil, entity.NewLatestQuoteData(), nil))
+	}
+
+	hh := newHandler(&freshnessRepo{latest: latest})
+	if code, _ := ready(hh); code != http.StatusServiceUnavailable {
+		t.Errorf("status while warming up = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	hh.SetReady()
+	code, body := ready(hh)
+	if code != http.StatusOK {
+		t.Errorf("status after warmup = %d, want %d", code, http.StatusOK)
+	}
+	if body["latestData"] != latest.Format(time.RFC3339) {
+		t.Errorf("latestData = %v, want %v", body["latestData"], latest.Format(time.RFC3339))
+	}
+
+	hh = newHandler(&freshnessRepo{err: &apperrors.NotFoundError{Resource: "intraday data"}})
+	hh.SetReady()
+	code, body = ready(hh)
+	if _, ok := body["latestData"]; code != http.StatusOK || ok {
+		t.Errorf("response without intraday data = %d %v, want 200 without latestData", code, body)
+	}
+}
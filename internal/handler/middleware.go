@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"stock-app/pkg/logger"
+)
+
+// Recovery recovers from panics in later handlers, logging them with their stack trace and
+// answering 500 with the usual `{"error": ...}` body instead of Gin's plain text one. If the
+// response was already started, it is only aborted. http.ErrAbortHandler is re-panicked so the
+// server resets the connection of a truncated response.
+func Recovery(log *logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				log.WithFields(map[string]interface{}{
+					"method": c.Request.Method,
+					"path":   c.Request.URL.Path,
+					"panic":  fmt.Sprint(r),
+					"stack":  string(debug.Stack()),
+				}).Error("Recovered from panic in handler")
+
+				if c.Writer.Written() {
+					c.Abort()
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			}
+		}()
+		c.Next()
+	}
+}
+
+// AdminAuth rejects requests that don't carry the admin API key, either as a
+// `Bearer` token or in the `X-API-Key` header. All requests are rejected when no key is configured.
+func AdminAuth(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := c.GetHeader("X-API-Key")
+		if provided == "" {
+			provided = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+
+		if apiKey == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// BodyLimit caps request bodies at maxBytes, answering 413 to larger ones. Requests announcing a larger
+// Content-Length are rejected up front. Other bodies, e.g. chunked ones, are read before the handler
+// runs, so they are rejected even when the handler never reads its body. A limit of zero or less
+// disables the check.
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 {
+			c.Next()
+			return
+		}
+
+		tooLarge := func() {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body exceeds %d bytes", maxBytes)})
+		}
+		if c.Request.ContentLength > maxBytes {
+			tooLarge()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+		c.Request.Body.Close()
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			tooLarge()
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to read request body: %v", err)})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+// SymbolAliases marks responses to requests whose `symbol` query parameter names a renamed ticker,
+// e.g. FB, with `Deprecation: true` and the symbol served, e.g. META, in `X-Symbol-Alias`. resolve
+// maps a symbol to the one served, like the use case does when reading data.
+func SymbolAliases(resolve func(symbol string) (string, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if symbol, aliased := resolve(c.Query("symbol")); aliased {
+			c.Header("Deprecation", "true")
+			c.Header("X-Symbol-Alias", symbol)
+		}
+		c.Next()
+	}
+}
+
+// AllowNetworks rejects requests whose peer address is outside the given CIDR networks with 403.
+// The peer address is used rather than forwarding headers, which clients can set. Invalid networks are
+// ignored.
+func AllowNetworks(networks []string) gin.HandlerFunc {
+	var allowed []*net.IPNet
+	for _, network := range networks {
+		if _, ipNet, err := net.ParseCIDR(network); err == nil {
+			allowed = append(allowed, ipNet)
+		}
+	}
+	return func(c *gin.Context) {
+		if ip := net.ParseIP(c.RemoteIP()); ip != nil {
+			for _, ipNet := range allowed {
+				if ipNet.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	}
+}
+
+// AdminAuthIf applies AdminAuth only to requests matching cond, e.g. those asking for an
+// expensive variant of an otherwise public endpoint.
+func AdminAuthIf(apiKey string, cond func(c *gin.Context) bool) gin.HandlerFunc {
+	auth := AdminAuth(apiKey)
+	return func(c *gin.Context) {
+		if cond(c) {
+			auth(c)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"stock-app/pkg/logger"
+)
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{name: "X-API-Key", apiKey: "secret", header: "X-API-Key", value: "secret", wantStatus: http.StatusOK},
+		{name: "bearer token", apiKey: "secret", header: "Authorization", value: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "wrong key", apiKey: "secret", header: "X-API-Key", value: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "missing key", apiKey: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "no key configured", apiKey: "", header: "X-API-Key", value: "", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/admin", AdminAuth(tt.apiKey), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAdminAuthIf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		query      string
+		key        string
+		wantStatus int
+	}{
+		{name: "cached read without key", query: "", wantStatus: http.StatusOK},
+		{name: "fresh read without key", query: "?fresh=true", wantStatus: http.StatusUnauthorized},
+		{name: "fresh read with wrong key", query: "?fresh=true", key: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "fresh read with key", query: "?fresh=true", key: "secret", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/stocks", AdminAuthIf("secret", IsFreshRequest), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/stocks"+tt.query, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		maxBytes      int64
+		body          string
+		contentLength int64 // -1 sends the body chunked
+		readBody      bool
+		wantStatus    int
+	}{
+		{name: "within the limit", maxBytes: 10, body: "12345", contentLength: 5, readBody: true, wantStatus: http.StatusOK},
+		{name: "announced too large", maxBytes: 10, body: "12345678901", contentLength: 11, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked too large and never read", maxBytes: 10, body: "12345678901", contentLength: -1, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked within the limit", maxBytes: 10, body: "1234567890", contentLength: -1, readBody: true, wantStatus: http.StatusOK},
+		{name: "disabled", maxBytes: 0, body: "12345678901", contentLength: -1, readBody: true, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(BodyLimit(tt.maxBytes))
+			var read string
+			router.POST("/", func(c *gin.Context) {
+				if tt.readBody {
+					body, err := io.ReadAll(c.Request.Body)
+					if err != nil {
+						t.Errorf("failed to read body: %v", err)
+					}
+					read = string(body)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.readBody && tt.wantStatus == http.StatusOK && read != tt.body {
+				t.Errorf("handler read %q, want %q", read, tt.body)
+			}
+		})
+	}
+}
+
+func TestSymbolAliases(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resolve := func(symbol string) (string, bool) {
+		if strings.ToUpper(symbol) == "FB" {
+			return "META", true
+		}
+		return symbol, false
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		wantDeprecation string
+		wantAlias       string
+	}{
+		{name: "alias", query: "?symbol=FB", wantDeprecation: "true", wantAlias: "META"},
+		{name: "lowercase alias", query: "?symbol=fb", wantDeprecation: "true", wantAlias: "META"},
+		{name: "current symbol", query: "?symbol=META"},
+		{name: "no symbol", query: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(SymbolAliases(resolve))
+			router.GET("/", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+
+			if got := w.Header().Get("Deprecation"); got != tt.wantDeprecation {
+				t.Errorf("Deprecation = %q, want %q", got, tt.wantDeprecation)
+			}
+			if got := w.Header().Get("X-Symbol-Alias"); got != tt.wantAlias {
+				t.Errorf("X-Symbol-Alias = %q, want %q", got, tt.wantAlias)
+			}
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		panicValue interface{}
+		write      bool
+		wantStatus int
+		wantBody   string
+		wantPanic  bool
+	}{
+		{name: "panic before writing", panicValue: "boom", wantStatus: http.StatusInternalServerError, wantBody: `{"error":"internal server error"}`},
+		{name: "panic after writing", panicValue: "boom", write: true, wantStatus: http.StatusOK, wantBody: "partial"},
+		{name: "aborted response", panicValue: http.ErrAbortHandler, write: true, wantPanic: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(Recovery(logger.NewLogger("error")))
+			router.GET("/", func(c *gin.Context) {
+				if tt.write {
+					c.String(http.StatusOK, "partial")
+				}
+				panic(tt.panicValue)
+			})
+
+			w := httptest.NewRecorder()
+			defer func() {
+				r := recover()
+				if (r != nil) != tt.wantPanic {
+					t.Fatalf("recovered %v, wantPanic %v", r, tt.wantPanic)
+				}
+				if tt.wantPanic {
+					return
+				}
+				if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+					t.Errorf("response = %d %q, want %d %q", w.Code, w.Body, tt.wantStatus, tt.wantBody)
+				}
+			}()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	}
+}
+
+func TestAllowNetworks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	networks := []string{"127.0.0.0/8", "10.0.0.0/8", "::1/128", "not-a-network"}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		wantStatus   int
+	}{
+		{name: "loopback", remoteAddr: "127.0.0.1:1234", wantStatus: http.StatusOK},
+		{name: "private network", remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK},
+		{name: "IPv6 loopback", remoteAddr: "[::1]:1234", wantStatus: http.StatusOK},
+		{name: "public address", remoteAddr: "203.0.113.7:1234", wantStatus: http.StatusForbidden},
+		{name: "forged forwarding header", remoteAddr: "203.0.113.7:1234", forwardedFor: "127.0.0.1", wantStatus: http.StatusForbidden},
+		{name: "unparsable address", remoteAddr: "pipe", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(AllowNetworks(networks))
+			router.GET("/", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
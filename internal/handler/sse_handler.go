@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"stock-app/internal/hub"
+	"stock-app/internal/usecase"
+	"stock-app/pkg/config"
+	"stock-app/pkg/utils"
+)
+
+// SSEHandler pushes real-time quotes to Server-Sent Events clients.
+type SSEHandler struct {
+	stockUseCase      *usecase.StockServingUseCase
+	quoteHub          *hub.Hub
+	keepAliveInterval time.Duration
+}
+
+// NewSSEHandler creates a new instance of SSEHandler, streaming the quotes published to quoteHub.
+func NewSSEHandler(stockUseCase *usecase.StockServingUseCase, quoteHub *hub.Hub) *SSEHandler {
+	return &SSEHandler{
+		stockUseCase:      stockUseCase,
+		quoteHub:          quoteHub,
+		keepAliveInterval: config.AppConfig.SSEKeepAliveInterval,
+	}
+}
+
+// StreamQuotes handles GET requests for an event stream of the quotes of the comma-separated
+// `symbols` query parameter. The current quote of each symbol is sent first, then every new one as a
+// `quote` event. Clients falling more than the hub buffer behind are disconnected. A `:keepalive`
+// comment is sent every keep-alive interval so proxies keep quiet streams open and dead clients are
+// detected by the failed write.
+func (sh *SSEHandler) StreamQuotes(c *gin.Context) {
+	var symbols []string
+	for _, symbol := range strings.Split(c.Query("symbols"), ",") {
+		if symbol = utils.NormalizeSymbol(symbol); symbol == "" {
+			continue
+		}
+		if err := utils.ValidateSymbol(symbol); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		symbol, _ = sh.stockUseCase.ResolveSymbol(symbol)
+		symbols = append(symbols, symbol)
+	}
+	if len(symbols) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbols is required"})
+		return
+	}
+
+	// Subscribe before reading the current quotes so no update is missed in between
+	subscriber := sh.quoteHub.Subscribe(symbols...)
+	defer sh.quoteHub.Unsubscribe(subscriber)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // Keep reverse proxies from buffering the stream
+	c.Status(http.StatusOK)
+
+	for _, symbol := range symbols {
+		if quote, exists := sh.stockUseCase.GetRealTimeQuote(symbol); exists {
+			if err := writeEvent(c, "quote", toQuoteResponse(quote, defaultPrecision)); err != nil {
+				fmt.Printf("Dropping SSE client: %v\n", err)
+				return
+			}
+		}
+	}
+	c.Writer.Flush()
+
+	// A nil channel never fires, leaving the keep-alive disabled
+	var keepAlive <-chan time.Time
+	if sh.keepAliveInterval > 0 {
+		ticker := time.NewTicker(sh.keepAliveInterval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive:
+			extendWriteDeadline(c)
+			if _, err := fmt.Fprint(c.Writer, ":keepalive\n\n"); err != nil {
+				fmt.Printf("Dropping SSE client: %v\n", err)
+				return
+			}
+			c.Writer.Flush()
+		case quote, ok := <-subscriber.Updates():
+			if !ok {
+				fmt.Println("Dropping SSE client: it fell behind the quote updates")
+				return
+			}
+			if err := writeEvent(c, "quote", toQuoteResponse(quote, defaultPrecision)); err != nil {
+				fmt.Printf("Dropping SSE client: %v\n", err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeEvent writes v as the JSON data of an event, within the HTTP write timeout.
+func writeEvent(c *gin.Context, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	extendWriteDeadline(c)
+	_, err = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,383 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"stock-app/internal/entity"
+	"stock-app/pkg/config"
+	"stock-app/pkg/utils"
+)
+
+// Quote directions derived from the change percentage.
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+	DirectionFlat = "flat"
+)
+
+// QuoteResponse is the API representation of a stock quote.
+type QuoteResponse struct {
+	Symbol           string    `json:"s"`
+	Price            float64   `json:"c"`
+	Change           float64   `json:"d"`
+	ChangePercentage float64   `json:"dp"`
+	ChangeBps        int64     `json:"bps"`
+	Direction        string    `json:"dir"`
+	HighPrice        float64   `json:"h"`
+	LowPrice         float64   `json:"l"`
+	OpenPrice        float64   `json:"o"`
+	PrevClose        *float64  `json:"pc"`
+	Volume           float64   `json:"v"`
+	Timestamp        time.Time `json:"t"`
+	PrevCloseMissing bool      `json:"pcMissing,omitempty"`
+	// Extended hours fields are only set for trades received during pre-market or after-hours sessions
+	ExtendedHoursPrice  float64 `json:"ec,omitempty"`
+	ExtendedHoursChange float64 `json:"ed,omitempty"`
+	// Daily is the bar of the quote's trading day, only set with `include=daily`
+	Daily *entity.DailyBar `json:"daily,omitempty"`
+}
+
+// Change baselines selectable with the `baseline` query parameter.
+const (
+	BaselinePrevClose = "prevclose"
+	BaselineOpen      = "open"
+)
+
+// Response shapes of GET /stocks selectable with the `shape` query parameter.
+const (
+	ShapeMap   = "map"
+	ShapeArray = "array"
+)
+
+// Envelope wraps response data with metadata about it, returned with `envelope=true`.
+type Envelope struct {
+	Data interface{} `json:"data"`
+	Meta Meta        `json:"meta"`
+}
+
+// Meta describes the data of an enveloped response.
+type Meta struct {
+	Count       int        `json:"count"`
+	Symbol      string     `json:"symbol,omitempty"`
+	Range       *TimeRange `json:"range,omitempty"`
+	GeneratedAt time.Time  `json:"generatedAt"`
+	Source      string     `json:"source,omitempty"`
+}
+
+// TimeRange is the requested time range of an enveloped response.
+type TimeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// respondData writes data as JSON, wrapped in an Envelope with meta when `envelope=true` so that
+// existing consumers keep getting the bare data.
+func respondData(c *gin.Context, data interface{}, meta Meta) {
+	if c.Query("envelope") != "true" {
+		render(c, http.StatusOK, data)
+		return
+	}
+	meta.GeneratedAt = time.Now()
+	render(c, http.StatusOK, Envelope{Data: data, Meta: meta})
+}
+
+// msgpackContentType is the media type clients send in the Accept header to get MessagePack.
+const msgpackContentType = "application/msgpack"
+
+// render writes data as MessagePack when the Accept header asks for it and as JSON otherwise.
+// MessagePack uses the same field names as the JSON tags.
+func render(c *gin.Context, status int, data interface{}) {
+	if !strings.Contains(c.GetHeader("Accept"), msgpackContentType) {
+		c.JSON(status, data)
+		return
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to encode response: %v", err)})
+		return
+	}
+	c.Data(status, msgpackContentType, buf.Bytes())
+}
+
+// setStaleHeaders sets `X-Data-Stale: true` and `X-Data-Age` (in seconds) when the oldest of the
+// served latest quotes is older than the configured threshold while its market is trading, e.g. when
+// the cache keeps serving during a provider outage. Quotes of closed markets can't be newer, so they
+// are never reported as stale.
+func setStaleHeaders(c *gin.Context, quotes ...*entity.StockQuote) {
+	setStaleHeadersAt(c, time.Now(), quotes...)
+}
+
+// setStaleHeadersAt sets the stale headers of the served latest quotes as of now.
+func setStaleHeadersAt(c *gin.Context, now time.Time, quotes ...*entity.StockQuote) {
+	threshold := config.AppConfig.StaleDataThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	if maxAge := oldestTradingAge(now, quotes...); maxAge > threshold {
+		c.Header("X-Data-Stale", "true")
+		c.Header("X-Data-Age", strconv.Itoa(int(maxAge.Seconds())))
+	}
+}
+
+// oldestTradingAge returns the age at now of the oldest quote whose market is trading. Quote timestamps
+// are wall clock times of the symbol's exchange, so their age is measured against the exchange's wall
+// clock at now.
+func oldestTradingAge(now time.Time, quotes ...*entity.StockQuote) time.Duration {
+	var maxAge time.Duration
+	for _, quote := range quotes {
+		calendar := utils.CalendarForSymbol(quote.Symbol)
+		if calendar.Session(now) == utils.SessionClosed {
+			continue
+		}
+		if age := calendar.WallClock(now).Sub(quote.Timestamp); age > maxAge {
+			maxAge = age
+		}
+	}
+	return maxAge
+}
+
+// toQuoteResponse maps a stock quote to its API representation. NaN and Inf values, which
+// encoding/json cannot marshal, are replaced with 0.
+func toQuoteResponse(quote *entity.StockQuote, precision int) *QuoteResponse {
+	price := func(v float64) float64 {
+		return roundPrice(finite(v), precision)
+	}
+	changePercentage := finite(quote.ChangePercentage)
+	return &QuoteResponse{
+		Symbol:              quote.Symbol,
+		Price:               price(quote.Price),
+		Change:              price(quote.Change),
+		ChangePercentage:    changePercentage,
+		ChangeBps:           int64(math.Round(changePercentage * 100)),
+		Direction:           direction(changePercentage, config.AppConfig.FlatThreshold),
+		HighPrice:           price(quote.HighPrice),
+		LowPrice:            price(quote.LowPrice),
+		OpenPrice:           price(quote.OpenPrice),
+		PrevClose:           prevClose(quote, precision),
+		Volume:              finite(quote.Volume),
+		Timestamp:           quote.Timestamp,
+		PrevCloseMissing:    quote.PrevCloseMissing,
+		ExtendedHoursPrice:  price(quote.ExtendedHoursPrice),
+		ExtendedHoursChange: price(quote.ExtendedHoursChange),
+	}
+}
+
+// toQuoteResponses maps a list of stock quotes to their API representation.
+func toQuoteResponses(quotes []*entity.StockQuote, precision int) []*QuoteResponse {
+	responses := make([]*QuoteResponse, 0, len(quotes))
+	for _, quote := range quotes {
+		responses = append(responses, toQuoteResponse(quote, precision))
+	}
+	return responses
+}
+
+// ChartPoint is a candle in the shape charting libraries expect, timed in Unix seconds.
+type ChartPoint struct {
+	Time   int64   `json:"time"`
+	Open   float64 `json:"open"`
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Close  float64 `json:"close"`
+	Volume float64 `json:"volume"`
+}
+
+// toChartPoints maps candles to chart points in ascending time order. Candles sharing a second keep
+// only the last one, since charting libraries reject duplicate times.
+func toChartPoints(quotes []*entity.StockQuote) []*ChartPoint {
+	points := make([]*ChartPoint, 0, len(quotes))
+	for _, quote := range quotes {
+		points = append(points, &ChartPoint{
+			Time:   quote.Timestamp.Unix(),
+			Open:   quote.OpenPrice,
+			High:   quote.HighPrice,
+			Low:    quote.LowPrice,
+			Close:  quote.Price,
+			Volume: quote.Volume,
+		})
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time < points[j].Time
+	})
+
+	deduped := points[:0]
+	for _, point := range points {
+		if n := len(deduped); n > 0 && deduped[n-1].Time == point.Time {
+			deduped[n-1] = point
+			continue
+		}
+		deduped = append(deduped, point)
+	}
+	return deduped
+}
+
+// toQuoteResponseMap maps a symbol to stock quote map to their API representation.
+func toQuoteResponseMap(quotes map[string]*entity.StockQuote, precision int) map[string]*QuoteResponse {
+	responses := make(map[string]*QuoteResponse, len(quotes))
+	for symbol, quote := range quotes {
+		responses[symbol] = toQuoteResponse(quote, precision)
+	}
+	return responses
+}
+
+// parseBaseline parses the `baseline` query parameter, defaulting to BaselinePrevClose.
+func parseBaseline(c *gin.Context) (string, error) {
+	switch baseline := c.DefaultQuery("baseline", BaselinePrevClose); baseline {
+	case BaselinePrevClose, BaselineOpen:
+		return baseline, nil
+	default:
+		return "", fmt.Errorf("invalid baseline: %s", baseline)
+	}
+}
+
+// parseShape parses the `shape` query parameter, defaulting to ShapeMap.
+func parseShape(c *gin.Context) (string, error) {
+	switch shape := c.DefaultQuery("shape", ShapeMap); shape {
+	case ShapeMap, ShapeArray:
+		return shape, nil
+	default:
+		return "", fmt.Errorf("invalid shape: %s", shape)
+	}
+}
+
+// parseSession parses the optional `session` query parameter (`pre`, `regular` or `after`), returning
+// an empty session when it is not set.
+func parseSession(c *gin.Context) (utils.MarketSession, error) {
+	if c.Query("session") == "" {
+		return "", nil
+	}
+	return utils.ParseSession(c.Query("session"))
+}
+
+// sortedBySymbol returns the quotes of a symbol to stock quote map as a slice ordered by symbol.
+func sortedBySymbol(quotes map[string]*entity.StockQuote) []*entity.StockQuote {
+	list := make([]*entity.StockQuote, 0, len(quotes))
+	for _, quote := range quotes {
+		list = append(list, quote)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Symbol < list[j].Symbol
+	})
+	return list
+}
+
+// Bounds of the `precision` query parameter, the number of decimals price fields are rounded to.
+const (
+	defaultPrecision = 4
+	maxPrecision     = 6
+)
+
+// parsePrecision parses the `precision` query parameter, defaulting to defaultPrecision.
+func parsePrecision(c *gin.Context) (int, error) {
+	value := c.Query("precision")
+	if value == "" {
+		return defaultPrecision, nil
+	}
+	precision, err := strconv.Atoi(value)
+	if err != nil || precision < 0 || precision > maxPrecision {
+		return 0, fmt.Errorf("precision must be between 0 and %d", maxPrecision)
+	}
+	return precision, nil
+}
+
+// roundPrice rounds v to the given number of decimals, half away from zero, e.g. 1.125 and -1.125
+// at precision 2 give 1.13 and -1.13.
+func roundPrice(v float64, precision int) float64 {
+	scale := math.Pow(10, float64(precision))
+	return math.Round(v*scale) / scale
+}
+
+// parseIncludeDaily parses the `include` query parameter, reporting whether `daily` was requested.
+func parseIncludeDaily(c *gin.Context) (bool, error) {
+	switch include := c.Query("include"); include {
+	case "":
+		return false, nil
+	case "daily":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid include: %s", include)
+	}
+}
+
+// rebase returns the quote with its change computed against the given baseline. Quotes are stored
+// with the change against the previous close, so only BaselineOpen requires a copy.
+func rebase(quote *entity.StockQuote, baseline string) *entity.StockQuote {
+	if baseline != BaselineOpen {
+		return quote
+	}
+
+	rebased := *quote
+	rebased.Change = quote.Price - quote.OpenPrice
+	rebased.ChangePercentage = 0
+	if quote.OpenPrice != 0 {
+		rebased.ChangePercentage = rebased.Change / quote.OpenPrice * 100
+	}
+	return &rebased
+}
+
+// rebaseQuotes applies rebase to a list of stock quotes.
+func rebaseQuotes(quotes []*entity.StockQuote, baseline string) []*entity.StockQuote {
+	if baseline != BaselineOpen {
+		return quotes
+	}
+	rebased := make([]*entity.StockQuote, 0, len(quotes))
+	for _, quote := range quotes {
+		rebased = append(rebased, rebase(quote, baseline))
+	}
+	return rebased
+}
+
+// rebaseQuoteMap applies rebase to a symbol to stock quote map.
+func rebaseQuoteMap(quotes map[string]*entity.StockQuote, baseline string) map[string]*entity.StockQuote {
+	if baseline != BaselineOpen {
+		return quotes
+	}
+	rebased := make(map[string]*entity.StockQuote, len(quotes))
+	for symbol, quote := range quotes {
+		rebased[symbol] = rebase(quote, baseline)
+	}
+	return rebased
+}
+
+// prevClose returns the previous close of a quote, or nil when the symbol has no daily history.
+func prevClose(quote *entity.StockQuote, precision int) *float64 {
+	if quote.PrevCloseMissing {
+		return nil
+	}
+	value := roundPrice(finite(quote.PrevClose), precision)
+	return &value
+}
+
+// finite returns v, or 0 if v is NaN or ±Inf.
+func finite(v float64) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// direction classifies a change percentage as up, down or flat, where changes within
+// ±flatThreshold percent are considered flat.
+func direction(changePercentage, flatThreshold float64) string {
+	switch {
+	case changePercentage > flatThreshold:
+		return DirectionUp
+	case changePercentage < -flatThreshold:
+		return DirectionDown
+	default:
+		return DirectionFlat
+	}
+}
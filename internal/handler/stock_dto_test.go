@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"stock-app/internal/entity"
+	"stock-app/internal/usecase"
+	"stock-app/pkg/config"
+)
+
+func TestDirection(t *testing.T) {
+	tests := []struct {
+		name             string
+		changePercentage float64
+		flatThreshold    float64
+		want             string
+	}{
+		{name: "zero change", changePercentage: 0, flatThreshold: 0.01, want: DirectionFlat},
+		{name: "zero change without threshold", changePercentage: 0, flatThreshold: 0, want: DirectionFlat},
+		{name: "up", changePercentage: 1.5, flatThreshold: 0.01, want: DirectionUp},
+		{name: "down", changePercentage: -1.5, flatThreshold: 0.01, want: DirectionDown},
+		{name: "exactly at the threshold", changePercentage: 0.01, flatThreshold: 0.01, want: DirectionFlat},
+		{name: "exactly at the negative threshold", changePercentage: -0.01, flatThreshold: 0.01, want: DirectionFlat},
+		{name: "just above the threshold", changePercentage: 0.0101, flatThreshold: 0.01, want: DirectionUp},
+		{name: "just below the negative threshold", changePercentage: -0.0101, flatThreshold: 0.01, want: DirectionDown},
+		{name: "near zero without threshold", changePercentage: 1e-9, flatThreshold: 0, want: DirectionUp},
+		{name: "near zero negative without threshold", changePercentage: -1e-9, flatThreshold: 0, want: DirectionDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := direction(tt.changePercentage, tt.flatThreshold); got != tt.want {
+				t.Errorf("direction(%v, %v) = %q, want %q", tt.changePercentage, tt.flatThreshold, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToQuoteResponseBps(t *testing.T) {
+	tests := []struct {
+		changePercentage float64
+		want             int64
+	}{
+		{changePercentage: 1.2345, want: 123},
+		{changePercentage: -0.005, want: -1},
+		{changePercentage: 0.004, want: 0},
+		{changePercentage: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := toQuoteResponse(&entity.StockQuote{ChangePercentage: tt.changePercentage}, defaultPrecision).ChangeBps; got != tt.want {
+			t.Errorf("bps of %v%% = %d, want %d", tt.changePercentage, got, tt.want)
+		}
+	}
+}
+
+func TestRoundPrice(t *testing.T) {
+	tests := []struct {
+		v         float64
+		precision int
+		want      float64
+	}{
+		{v: 201.23456, precision: 2, want: 201.23},
+		{v: 1.125, precision: 2, want: 1.13},
+		{v: -1.125, precision: 2, want: -1.13},
+		{v: -201.23456, precision: 4, want: -201.2346},
+		{v: 201.5, precision: 0, want: 202},
+		{v: 201.49, precision: 0, want: 201},
+		{v: -201.5, precision: 0, want: -202},
+		{v: -0.4, precision: 0, want: 0},
+		{v: 0.1234567, precision: 6, want: 0.123457},
+	}
+	for _, tt := range tests {
+		if got := roundPrice(tt.v, tt.precision); got != tt.want {
+			t.Errorf("roundPrice(%v, %d) = %v, want %v", tt.v, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestToQuoteResponsePrecision(t *testing.T) {
+	quote := &entity.StockQuote{Symbol: "AAPL", Price: 201.123456, Change: -1.125, OpenPrice: 202.98765, PrevClose: 202.248456}
+
+	got := toQuoteResponse(quote, 2)
+	if got.Price != 201.12 || got.Change != -1.13 || got.OpenPrice != 202.99 || *got.PrevClose != 202.25 {
+		t.Errorf("quote at precision 2 = %+v, want prices rounded to 2 decimals", got)
+	}
+	got = toQuoteResponse(quote, defaultPrecision)
+	if got.Price != 201.1235 || got.Change != -1.125 || got.OpenPrice != 202.9877 || *got.PrevClose != 202.2485 {
+		t.Errorf("quote at the default precision = %+v, want prices rounded to 4 decimals", got)
+	}
+}
+
+func TestToQuoteResponsePrevCloseMissing(t *testing.T) {
+	if got := toQuoteResponse(&entity.StockQuote{Symbol: "NEWCO", Price: 50, PrevCloseMissing: true}, defaultPrecision); got.PrevClose != nil || !got.PrevCloseMissing {
+		t.Errorf("quote without daily history has previous close %v (missing %v), want nil and true", got.PrevClose, got.PrevCloseMissing)
+	}
+	if got := toQuoteResponse(&entity.StockQuote{Symbol: "AAPL", Price: 210, PrevClose: 200}, defaultPrecision); got.PrevClose == nil || *got.PrevClose != 200 || got.PrevCloseMissing {
+		t.Errorf("quote with daily history has previous close %v (missing %v), want 200 and false", got.PrevClose, got.PrevCloseMissing)
+	}
+}
+
+func TestQuoteResponseNonFinite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &latestRepo{quotes: map[string]*entity.StockQuote{
+		"ZERO": {Symbol: "ZERO", Price: 5, Change: 5, ChangePercentage: math.Inf(1), PrevClose: math.NaN(), Volume: math.Inf(-1)},
+	}}
+	sh := NewStockHandler(usecase.NewStockServingUseCase(repo, nil, entity.NewLatestQuoteData(), nil))
+	router := gin.New()
+	router.GET("/stocks/quote", sh.GetQuote)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote?symbol=ZERO&range=latest", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var quotes []*QuoteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+		t.Fatalf("invalid JSON response %s: %v", w.Body, err)
+	}
+	if len(quotes) != 1 {
+		t.Fatalf("response = %s, want one quote", w.Body)
+	}
+	got := quotes[0]
+	if got.Price != 5 || got.ChangePercentage != 0 || got.ChangeBps != 0 || got.Direction != DirectionFlat || got.Volume != 0 || got.PrevClose == nil || *got.PrevClose != 0 {
+		t.Errorf("response = %s, want the non-finite values replaced with 0", w.Body)
+	}
+}
+
+func TestOldestTradingAge(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10:30 ET on a trading day, when New York is 4 hours behind UTC
+	trading := time.Date(2025, time.June, 11, 10, 30, 0, 0, newYork)
+	// Quote timestamps are ET wall clock times stored as UTC
+	wallClock := func(hour, min int) time.Time {
+		return time.Date(2025, time.June, 11, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		quotes []*entity.StockQuote
+		want   time.Duration
+	}{
+		{
+			name:   "fresh quote",
+			now:    trading,
+			quotes: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: wallClock(10, 29)}},
+			want:   time.Minute,
+		},
+		{
+			name:   "now in UTC",
+			now:    trading.UTC(),
+			quotes: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: wallClock(10, 29)}},
+			want:   time.Minute,
+		},
+		{
+			name:   "now in another zone",
+			now:    trading.In(tokyo),
+			quotes: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: wallClock(10, 29)}},
+			want:   time.Minute,
+		},
+		{
+			name: "oldest quote",
+			now:  trading,
+			quotes: []*entity.StockQuote{
+				{Symbol: "AAPL", Timestamp: wallClock(10, 29)},
+				{Symbol: "MSFT", Timestamp: wallClock(10, 0)},
+			},
+			want: 30 * time.Minute,
+		},
+		{
+			name:   "closed market",
+			now:    time.Date(2025, time.June, 14, 10, 30, 0, 0, newYork), // Saturday
+			quotes: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: wallClock(16, 0)}},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := oldestTradingAge(tt.now, tt.quotes...); got != tt.want {
+				t.Errorf("oldestTradingAge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetStaleHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.StaleDataThreshold = 5 * time.Minute
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trading := time.Date(2025, time.June, 11, 10, 30, 0, 0, newYork)
+	// Quote timestamps are ET wall clock times stored as UTC
+	wallClock := func(hour, min int) time.Time {
+		return time.Date(2025, time.June, 11, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		quotes    []*entity.StockQuote
+		threshold time.Duration
+		wantStale bool
+		wantAge   string
+	}{
+		{name: "fresh", now: trading, quotes: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: wallClock(10, 29)}}},
+		{name: "stale", now: trading, quotes: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: wallClock(10, 20)}}, wantStale: true, wantAge: "600"},
+		{name: "one stale quote", now: trading, quotes: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: wallClock(10, 29)}, {Symbol: "MSFT", Timestamp: wallClock(10, 0)}}, wantStale: true, wantAge: "1800"},
+		{name: "closed market", now: time.Date(2025, time.June, 14, 10, 30, 0, 0, newYork), quotes: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: wallClock(16, 0)}}},
+		{name: "disabled", now: trading, quotes: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: wallClock(10, 0)}}, threshold: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig.StaleDataThreshold = 5 * time.Minute
+			if tt.threshold != 0 {
+				config.AppConfig.StaleDataThreshold = tt.threshold
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			setStaleHeadersAt(c, tt.now, tt.quotes...)
+
+			if got := w.Header().Get("X-Data-Stale"); (got == "true") != tt.wantStale {
+				t.Errorf("X-Data-Stale = %q, want stale %v", got, tt.wantStale)
+			}
+			if got := w.Header().Get("X-Data-Age"); got != tt.wantAge {
+				t.Errorf("X-Data-Age = %q, want %q", got, tt.wantAge)
+			}
+		})
+	}
+}
+
+func TestRenderMsgpack(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	latest := entity.NewLatestQuoteData()
+	latest.Set("AAPL", &entity.StockQuote{Symbol: "AAPL", Price: 201.5, Change: 1.5, ChangePercentage: 0.75, PrevClose: 200, Timestamp: time.Date(2025, time.June, 11, 14, 30, 0, 0, time.UTC)})
+	sh := NewStockHandler(usecase.NewStockServingUseCase(nil, nil, latest, nil))
+	router := gin.New()
+	router.GET("/stocks/quote", sh.GetQuote)
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/stocks/quote?symbol=AAPL&range=latest", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status with Accept %q = %d, want 200: %s", accept, w.Code, w.Body)
+		}
+		return w
+	}
+
+	jsonResponse := get("")
+	if got := jsonResponse.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+		t.Errorf("Content-Type without Accept = %q, want JSON", got)
+	}
+	var fromJSON []QuoteResponse
+	if err := json.Unmarshal(jsonResponse.Body.Bytes(), &fromJSON); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	msgpackResponse := get("application/msgpack, application/json;q=0.5")
+	if got := msgpackResponse.Header().Get("Content-Type"); got != msgpackContentType {
+		t.Errorf("Content-Type with Accept msgpack = %q, want %q", got, msgpackContentType)
+	}
+	var fromMsgpack []QuoteResponse
+	dec := msgpack.NewDecoder(bytes.NewReader(msgpackResponse.Body.Bytes()))
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(&fromMsgpack); err != nil {
+		t.Fatalf("invalid MessagePack response: %v", err)
+	}
+
+	// Both encodings carry the same quote under the same field names
+	if len(fromJSON) != 1 || len(fromMsgpack) != 1 {
+		t.Fatalf("JSON returned %d quotes and MessagePack %d, want 1", len(fromJSON), len(fromMsgpack))
+	}
+	want, got := fromJSON[0], fromMsgpack[0]
+	if want.Symbol != "AAPL" || want.Price != 201.5 || want.PrevClose == nil {
+		t.Fatalf("JSON quote = %+v, want the AAPL quote", want)
+	}
+	if got.PrevClose == nil || *got.PrevClose != *want.PrevClose || !got.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("MessagePack quote = %+v, want %+v", got, want)
+	}
+	got.PrevClose, want.PrevClose = nil, nil
+	got.Timestamp, want.Timestamp = time.Time{}, time.Time{}
+	if got != want {
+		t.Errorf("MessagePack quote = %+v, want %+v", got, want)
+	}
+}
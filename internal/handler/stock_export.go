@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"stock-app/internal/entity"
+	"stock-app/pkg/utils"
+)
+
+// exportFlushEvery is the number of rows written between flushes of an export, bounding how much of
+// it is buffered before reaching the client.
+const exportFlushEvery = 500
+
+// exportHeader is the header row of CSV exports.
+var exportHeader = []string{"symbol", "timestamp", "open", "high", "low", "close", "volume", "change", "change_percentage", "prev_close"}
+
+// commaDecimalLanguages are the languages of the locales writing decimals with a comma.
+var commaDecimalLanguages = map[string]bool{
+	"de": true, "fr": true, "es": true, "it": true, "nl": true, "pt": true, "pl": true, "cs": true,
+	"da": true, "fi": true, "sv": true, "nb": true, "no": true, "ru": true, "tr": true, "el": true,
+}
+
+// parseCSVDecimal returns whether CSV numbers are written with a comma decimal separator, from
+// `decimal` (`period` or `comma`) or else from the language of `locale` (e.g. `de-DE`), defaulting
+// to US formatting with a period.
+func parseCSVDecimal(c *gin.Context) (bool, error) {
+	switch decimal := c.Query("decimal"); decimal {
+	case "period":
+		return false, nil
+	case "comma":
+		return true, nil
+	case "":
+	default:
+		return false, fmt.Errorf("invalid decimal: %s", decimal)
+	}
+
+	language := strings.ToLower(c.Query("locale"))
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	return commaDecimalLanguages[language], nil
+}
+
+// Export handles GET requests to stream the full intraday history of a symbol, one row at a time as
+// it is read from the DB, as NDJSON (`format=ndjson`, the default) or CSV (`format=csv`). CSV numbers
+// use a comma decimal separator and a semicolon delimiter when `decimal=comma` or a `locale` writing
+// decimals with a comma is requested.
+func (sh *StockHandler) Export(c *gin.Context) {
+	symbol := c.Query("symbol")
+	if err := utils.ValidateSymbol(symbol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	symbol = utils.NormalizeSymbol(symbol)
+
+	precision, err := parsePrecision(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.DefaultQuery("format", "ndjson")
+	var contentType string
+	var csvWriter *csv.Writer
+	commaDecimal := false
+	switch format {
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	case "csv":
+		if commaDecimal, err = parseCSVDecimal(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		contentType = "text/csv; charset=utf-8"
+		csvWriter = csv.NewWriter(c.Writer)
+		if commaDecimal {
+			// Keep the delimiter from clashing with the decimal separator
+			csvWriter.Comma = ';'
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid format: %s", format)})
+		return
+	}
+	encoder := json.NewEncoder(c.Writer)
+
+	// As with streamQuotes, the response is only started once the first row arrives so that errors
+	// raised before that are still reported with a proper status.
+	started := false
+	begin := func() error {
+		started = true
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, symbol, format))
+		c.Status(http.StatusOK)
+		if csvWriter != nil {
+			return csvWriter.Write(exportHeader)
+		}
+		return nil
+	}
+	flush := func() error {
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	rows := 0
+	err = sh.stockUseCase.StreamQuotes(symbol, time.Unix(0, 0), time.Now(), func(quote *entity.StockQuote) error {
+		extendWriteDeadline(c)
+		if !started {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if csvWriter != nil {
+			err = csvWriter.Write(exportRecord(quote, precision, commaDecimal))
+		} else {
+			err = encoder.Encode(toQuoteResponse(quote, precision))
+		}
+		if err != nil {
+			return err
+		}
+
+		if rows++; rows%exportFlushEvery == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			respondError(c, err, "failed to export stock data by symbol")
+			return
+		}
+		// The status is already sent, so reset the connection for the client to see a truncated export
+		fmt.Printf("Error exporting quotes for symbol %s: %v\n", symbol, err)
+		resetConnection(c)
+		return
+	}
+
+	if !started {
+		if err := begin(); err != nil {
+			return
+		}
+	}
+	_ = flush()
+}
+
+// exportRecord formats a quote as a CSV export row in the order of exportHeader, rounding prices to
+// precision decimals and writing decimals with a comma when commaDecimal is set.
+func exportRecord(quote *entity.StockQuote, precision int, commaDecimal bool) []string {
+	formatFloat := func(v float64) string {
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if commaDecimal {
+			s = strings.Replace(s, ".", ",", 1)
+		}
+		return s
+	}
+	formatPrice := func(v float64) string {
+		return formatFloat(roundPrice(v, precision))
+	}
+	return []string{
+		quote.Symbol,
+		quote.Timestamp.UTC().Format(time.RFC3339),
+		formatPrice(quote.OpenPrice),
+		formatPrice(quote.HighPrice),
+		formatPrice(quote.LowPrice),
+		formatPrice(quote.Price),
+		formatFloat(quote.Volume),
+		formatPrice(quote.Change),
+		formatFloat(quote.ChangePercentage),
+		formatPrice(quote.PrevClose),
+	}
+}
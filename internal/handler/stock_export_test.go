@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+	"stock-app/internal/usecase"
+)
+
+// failingStreamRepo streams count quotes like streamRepo, then fails.
+type failingStreamRepo struct {
+	streamRepo
+}
+
+func (r *failingStreamRepo) StreamHistoricalData(symbol string, start, end time.Time, fn func(*entity.StockQuote) error) error {
+	if err := r.streamRepo.StreamHistoricalData(symbol, start, end, fn); err != nil {
+		return err
+	}
+	return errors.New("connection lost")
+}
+
+func TestExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const count = 1200
+	newRouter := func(repo repository.StockRepo) *gin.Engine {
+		router := gin.New()
+		router.GET("/stocks/export", NewStockHandler(usecase.NewStockServingUseCase(repo, nil, entity.NewLatestQuoteData(), nil)).Export)
+		return router
+	}
+
+	t.Run("ndjson", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newRouter(&streamRepo{count: count}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/export?symbol=AAPL", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/x-ndjson" {
+			t.Errorf("Content-Type = %q, want application/x-ndjson", got)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="AAPL.ndjson"` {
+			t.Errorf("Content-Disposition = %q, want the AAPL.ndjson attachment", got)
+		}
+		scanner := bufio.NewScanner(w.Body)
+		lines := 0
+		for ; scanner.Scan(); lines++ {
+			var quote QuoteResponse
+			if err := json.Unmarshal(scanner.Bytes(), &quote); err != nil {
+				t.Fatalf("line %d is not a JSON object: %v", lines, err)
+			}
+			if quote.Symbol != "AAPL" || quote.Price != float64(lines) {
+				t.Fatalf("line %d = %+v, want the %dth quote", lines, quote, lines)
+			}
+		}
+		if lines != count {
+			t.Errorf("exported %d lines, want %d", lines, count)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newRouter(&streamRepo{count: 3}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/export?symbol=AAPL&format=csv", nil))
+
+		if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+			t.Errorf("Content-Type = %q, want text/csv", got)
+		}
+		records, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid CSV response: %v", err)
+		}
+		if len(records) != 4 || strings.Join(records[0], ",") != strings.Join(exportHeader, ",") {
+			t.Fatalf("records = %v, want the header and 3 rows", records)
+		}
+		if records[3][0] != "AAPL" || records[3][1] != "1970-01-01T00:02:00Z" || records[3][5] != "2" {
+			t.Errorf("last row = %v, want the third quote", records[3])
+		}
+	})
+
+	t.Run("csv for a European locale", func(t *testing.T) {
+		for _, query := range []string{"locale=de-DE", "decimal=comma", "locale=en-US&decimal=comma"} {
+			w := httptest.NewRecorder()
+			newRouter(&streamRepo{count: 2}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/export?symbol=AAPL&format=csv&"+query, nil))
+
+			reader := csv.NewReader(w.Body)
+			reader.Comma = ';'
+			records, err := reader.ReadAll()
+			if err != nil {
+				t.Fatalf("%s: invalid semicolon-delimited CSV response: %v", query, err)
+			}
+			if len(records) != 3 || len(records[0]) != len(exportHeader) {
+				t.Errorf("%s: records = %v, want the header and 2 rows split on semicolons", query, records)
+			}
+		}
+	})
+
+	t.Run("invalid decimal", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newRouter(&streamRepo{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/export?symbol=AAPL&format=csv&decimal=dot", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("empty history", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newRouter(&streamRepo{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/export?symbol=AAPL&format=csv", nil))
+		if w.Code != http.StatusOK || w.Body.String() != strings.Join(exportHeader, ",")+"\n" {
+			t.Errorf("response = %d %q, want 200 with only the header", w.Code, w.Body)
+		}
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newRouter(&streamRepo{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/export?symbol=AAPL&format=xml", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("failure after the first row", func(t *testing.T) {
+		server := httptest.NewServer(newRouter(&failingStreamRepo{streamRepo{count: 3}}))
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/stocks/export?symbol=AAPL")
+		if err != nil {
+			t.Fatalf("failed to request the export: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err == nil {
+			t.Errorf("reading the export succeeded with %q, want the truncation reported", body)
+		}
+		if lines := strings.Count(string(body), "\n"); lines != 3 {
+			t.Errorf("read %d lines before the reset, want 3", lines)
+		}
+	})
+}
+
+func TestExportRecord(t *testing.T) {
+	quote := &entity.StockQuote{
+		Symbol: "SAP", Timestamp: time.Date(2025, time.June, 11, 9, 30, 0, 0, time.UTC),
+		OpenPrice: 251.25, HighPrice: 252, LowPrice: 250.5, Price: 251.75, Volume: 1200,
+		Change: -0.5, ChangePercentage: -0.198, PrevClose: 252.25,
+	}
+	tests := []struct {
+		name         string
+		precision    int
+		commaDecimal bool
+		want         []string
+	}{
+		{name: "period", precision: defaultPrecision, want: []string{"SAP", "2025-06-11T09:30:00Z", "251.25", "252", "250.5", "251.75", "1200", "-0.5", "-0.198", "252.25"}},
+		{name: "comma", precision: defaultPrecision, commaDecimal: true, want: []string{"SAP", "2025-06-11T09:30:00Z", "251,25", "252", "250,5", "251,75", "1200", "-0,5", "-0,198", "252,25"}},
+		{name: "comma at precision 1", precision: 1, commaDecimal: true, want: []string{"SAP", "2025-06-11T09:30:00Z", "251,3", "252", "250,5", "251,8", "1200", "-0,5", "-0,198", "252,3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exportRecord(quote, tt.precision, tt.commaDecimal); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("exportRecord() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,21 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"stock-app/internal/entity"
 	"stock-app/internal/usecase"
+	"stock-app/pkg/config"
+	apperrors "stock-app/pkg/errors"
+	"stock-app/pkg/utils"
 )
 
 // StockHandler defines the business logic related to stock data.
@@ -23,13 +31,113 @@ func NewStockHandler(stockUseCase *usecase.StockServingUseCase) *StockHandler {
 }
 
 // GetAllQuotes handles GET requests to retrieve all stock data.
+// With `fresh=true`, the cache is bypassed and repopulated from the DB. With an RFC3339 `asOf`, the
+// most recent quote of each symbol at or before that time is read from the DB instead. Quotes are
+// keyed by symbol, or listed in symbol order with `shape=array`.
 func (sh *StockHandler) GetAllQuotes(c *gin.Context) {
-	stockList, err := sh.stockUseCase.GetAllQuotes() 
+	baseline, err := parseBaseline(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get list of stocks: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, stockList)
+	shape, err := parseShape(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	precision, err := parsePrecision(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var stockList map[string]*entity.StockQuote
+	var source string
+	if c.Query("asOf") != "" {
+		asOf, err := parseTimeParam(c, "asOf", time.Time{})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if stockList, err = sh.stockUseCase.GetAllQuotesAsOf(asOf); err != nil {
+			respondError(c, err, "failed to get list of stocks")
+			return
+		}
+		source = usecase.SourceDB
+	} else if stockList, source, err = sh.stockUseCase.GetAllQuotes(IsFreshRequest(c)); err != nil {
+		respondError(c, err, "failed to get list of stocks")
+		return
+	}
+	// Point-in-time quotes are old by design, so only the current ones are checked for staleness
+	if c.Query("asOf") == "" {
+		quotes := make([]*entity.StockQuote, 0, len(stockList))
+		for _, quote := range stockList {
+			quotes = append(quotes, quote)
+		}
+		setStaleHeaders(c, quotes...)
+	}
+	setDegradedHeader(c, source)
+	meta := Meta{Count: len(stockList), Source: source}
+	if shape == ShapeArray {
+		respondData(c, toQuoteResponses(rebaseQuotes(sortedBySymbol(stockList), baseline), precision), meta)
+		return
+	}
+	respondData(c, toQuoteResponseMap(rebaseQuoteMap(stockList, baseline), precision), meta)
+}
+
+// ListQuotes handles GET requests to retrieve the latest quote of every symbol as an array, sorted by
+// `sort` (`symbol`, the default, `price`, `change` or `changePercent`) in `order` (`asc`, the default,
+// or `desc`), keeping only quotes whose change is at least `minChange` when it is set.
+func (sh *StockHandler) ListQuotes(c *gin.Context) {
+	precision, err := parsePrecision(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := usecase.QuoteListOptions{SortBy: c.DefaultQuery("sort", usecase.QuoteSortSymbol)}
+	if !usecase.IsQuoteSortField(opts.SortBy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid sort: %s", opts.SortBy)})
+		return
+	}
+	switch order := c.DefaultQuery("order", "asc"); order {
+	case "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid order: %s", order)})
+		return
+	}
+	if minChangeStr := c.Query("minChange"); minChangeStr != "" {
+		minChange, err := strconv.ParseFloat(minChangeStr, 64)
+		if err != nil || math.IsNaN(minChange) || math.IsInf(minChange, 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid minChange: %s", minChangeStr)})
+			return
+		}
+		opts.MinChange = &minChange
+	}
+
+	quotes, source, err := sh.stockUseCase.ListQuotes(IsFreshRequest(c), opts)
+	if err != nil {
+		respondError(c, err, "failed to get list of stocks")
+		return
+	}
+	setStaleHeaders(c, quotes...)
+	setDegradedHeader(c, source)
+	respondData(c, toQuoteResponses(quotes, precision), Meta{Count: len(quotes), Source: source})
+}
+
+// IsFreshRequest reports whether the request asks to bypass the cache with `fresh=true`.
+func IsFreshRequest(c *gin.Context) bool {
+	return c.Query("fresh") == "true"
+}
+
+// setDegradedHeader sets `X-Degraded: true` when the data was served from the cache because the DB
+// failed, so it may be stale or partial.
+func setDegradedHeader(c *gin.Context, source string) {
+	if source == usecase.SourceDegraded {
+		c.Header("X-Degraded", "true")
+	}
 }
 
 // Request model for getting stock by symbol
@@ -37,50 +145,497 @@ type GetQuoteRequest struct {
 	Symbol string `uri:"symbol" binding:"required,alpha"`
 }
 
+// maxRecentQuotes bounds the `last` query parameter of GetQuote.
+const maxRecentQuotes = 1000
+
 // GetQuote handles GET requests to retrieve stock data by symbol.
+// Without a symbol, the latest quote of the configured default symbol is served unless `strict=true`.
 func (sh *StockHandler) GetQuote(c *gin.Context) {
-	symbol := c.Query("symbol")
+	baseline, err := parseBaseline(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	precision, err := parsePrecision(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	includeDaily, err := parseIncludeDaily(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	symbol := utils.NormalizeSymbol(c.Query("symbol"))
+	if name := c.Query("name"); symbol == "" && name != "" {
+		var resolved bool
+		if symbol, resolved = sh.resolveCompanyName(c, name); !resolved {
+			return
+		}
+	}
 	if symbol == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is a required query parameter"})
-        return
-    }
+		if c.Query("strict") == "true" || config.AppConfig.DefaultSymbol == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is a required query parameter"})
+			return
+		}
+		sh.serveLatestQuote(c, config.AppConfig.DefaultSymbol, baseline, precision, includeDaily)
+		return
+	}
+	if err := utils.ValidateSymbol(symbol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// `range` takes precedence over `start`/`end`; `start=latest` is only honored without `end`
+	switch rangeStr := c.Query("range"); {
+	case rangeStr == "latest":
+		sh.serveLatestQuote(c, symbol, baseline, precision, includeDaily)
+		return
+	case rangeStr != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid range: %s", rangeStr)})
+		return
+	case c.Query("start") == "latest":
+		if c.Query("end") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start=latest cannot be combined with end"})
+			return
+		}
+		sh.serveLatestQuote(c, symbol, baseline, precision, includeDaily)
+		return
+	}
+
+	if lastStr := c.Query("last"); lastStr != "" {
+		n, err := strconv.Atoi(lastStr)
+		if err != nil || n <= 0 || n > maxRecentQuotes {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("last must be between 1 and %d", maxRecentQuotes)})
+			return
+		}
+		sh.serveRecentQuotes(c, symbol, n, baseline, precision)
+		return
+	}
 
-	startTimeStr := c.Query("start")
-	endTimeStr := c.Query("end")
+	startTime, endTime, err := parseTimeRange(c, time.Now().AddDate(0, 0, -1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	var startTime, endTime time.Time
-	var err error
+	resolutionStr := c.DefaultQuery("resolution", "1m")
+	resolution, err := utils.ParseResolution(resolutionStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid resolution: %s", resolutionStr)})
+		return
+	}
 
-	if startTimeStr == "" {
-		startTime = time.Now().AddDate(0, 0, -1)
-	} else {
-		startTime, err = time.Parse(time.RFC3339, startTimeStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start time format"})
+	session, err := parseSession(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("stream") == "true" {
+		sh.streamQuotes(c, symbol, startTime, endTime, resolution, session, baseline, precision)
+		return
+	}
+
+	stock, source, err := sh.stockUseCase.GetCandles(symbol, startTime, endTime, resolution, session)
+	if err != nil {
+		respondError(c, err, "failed to get stock data by symbol")
+		return
+	}
+	setDegradedHeader(c, source)
+	respondData(c, toQuoteResponses(rebaseQuotes(stock, baseline), precision), Meta{
+		Count:  len(stock),
+		Symbol: symbol,
+		Range:  &TimeRange{Start: startTime, End: endTime},
+		Source: source,
+	})
+}
+
+// extendWriteDeadline gives a streaming response, which legitimately takes longer than the server's
+// write timeout to write in full, another write timeout from now. Streams call it before each chunk so
+// that a client too slow to take a chunk within the timeout fails the write, ending the stream and
+// releasing its DB connection. Failures are only logged since the chunk can still be written before
+// the current deadline.
+func extendWriteDeadline(c *gin.Context) {
+	var deadline time.Time
+	if timeout := config.AppConfig.HTTPWriteTimeout; timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline)
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		fmt.Printf("Failed to extend write deadline: %v\n", err)
+	}
+}
+
+// streamQuotes writes the quotes, resampled to resolution and filtered to session like the buffered
+// response, as a JSON array, encoding each one as it is read from the DB. The response is only
+// started once the first quote arrives, so errors raised before that, such as an overloaded server,
+// are still reported with a proper status.
+func (sh *StockHandler) streamQuotes(c *gin.Context, symbol string, start, end time.Time, resolution time.Duration, session utils.MarketSession, baseline string, precision int) {
+	w := c.Writer
+	encoder := json.NewEncoder(w)
+	started := false
+	begin := func() error {
+		started = true
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		_, err := w.WriteString("[")
+		return err
+	}
+
+	err := sh.stockUseCase.StreamCandles(symbol, start, end, resolution, session, func(quote *entity.StockQuote) error {
+		extendWriteDeadline(c)
+		if !started {
+			if err := begin(); err != nil {
+				return err
+			}
+		} else if _, err := w.WriteString(","); err != nil {
+			return err
+		}
+		return encoder.Encode(toQuoteResponse(rebase(quote, baseline), precision))
+	})
+	if err != nil {
+		if !started {
+			respondError(c, err, "failed to stream stock data by symbol")
+			return
+		}
+		// The status is already sent, so reset the connection for the client to see a truncated response
+		fmt.Printf("Error streaming quotes for symbol %s: %v\n", symbol, err)
+		resetConnection(c)
+		return
+	}
+
+	if !started {
+		if err := begin(); err != nil {
 			return
 		}
 	}
+	_, _ = w.WriteString("]")
+}
+
+// serveRecentQuotes serves the n most recent quotes of a symbol in chronological order.
+func (sh *StockHandler) serveRecentQuotes(c *gin.Context, symbol string, n int, baseline string, precision int) {
+	quotes, err := sh.stockUseCase.GetRecentQuotes(symbol, n)
+	if err != nil {
+		respondError(c, err, "failed to get recent quotes by symbol")
+		return
+	}
+	respondData(c, toQuoteResponses(rebaseQuotes(quotes, baseline), precision), Meta{Count: len(quotes), Symbol: symbol, Source: usecase.SourceDB})
+}
 
-	if endTimeStr == "" {
-		endTime = time.Now()
-	} else {
-		endTime, err = time.Parse(time.RFC3339, endTimeStr)
+// serveLatestQuote serves the latest quote of a symbol as a single-element list, with the daily bar
+// of its trading day attached when includeDaily is set and that bar exists.
+func (sh *StockHandler) serveLatestQuote(c *gin.Context, symbol, baseline string, precision int, includeDaily bool) {
+	if !includeDaily {
+		quote, source, err := sh.stockUseCase.GetLatestQuote(symbol)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end time format"})
+			respondError(c, err, "failed to get latest quote by symbol")
+			return
+		}
+		setStaleHeaders(c, quote)
+		respondData(c, []*QuoteResponse{toQuoteResponse(rebase(quote, baseline), precision)}, Meta{Count: 1, Symbol: symbol, Source: source})
+		return
+	}
+
+	quote, dailyBar, source, err := sh.stockUseCase.GetLatestQuoteWithDaily(symbol)
+	if err != nil {
+		respondError(c, err, "failed to get latest quote by symbol")
+		return
+	}
+	response := toQuoteResponse(rebase(quote, baseline), precision)
+	response.Daily = dailyBar
+	setStaleHeaders(c, quote)
+	respondData(c, []*QuoteResponse{response}, Meta{Count: 1, Symbol: symbol, Source: source})
+}
+
+// GetChart handles GET requests to retrieve the candles of a symbol as chart points, taking
+// `symbol`, `start`, `end` and optional `resolution` (default 1m) and `session` query parameters.
+func (sh *StockHandler) GetChart(c *gin.Context) {
+	symbol := utils.NormalizeSymbol(c.Query("symbol"))
+	if err := utils.ValidateSymbol(symbol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	startTime, endTime, err := parseTimeRange(c, time.Now().AddDate(0, 0, -1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resolutionStr := c.DefaultQuery("resolution", "1m")
+	resolution, err := utils.ParseResolution(resolutionStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid resolution: %s", resolutionStr)})
+		return
+	}
+
+	session, err := parseSession(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	candles, _, err := sh.stockUseCase.GetCandles(symbol, startTime, endTime, resolution, session)
+	if err != nil {
+		respondError(c, err, "failed to get chart data by symbol")
+		return
+	}
+	render(c, http.StatusOK, toChartPoints(candles))
+}
+
+// GetDailyData handles GET requests to retrieve the daily series by symbol.
+func (sh *StockHandler) GetDailyData(c *gin.Context) {
+	symbol := utils.NormalizeSymbol(c.Query("symbol"))
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is a required query parameter"})
+		return
+	}
+	if err := utils.ValidateSymbol(symbol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	startTime, endTime, err := parseTimeRange(c, time.Now().AddDate(0, -1, 0))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dailyBars, err := sh.stockUseCase.GetDailyData(symbol, startTime, endTime)
+	if err != nil {
+		respondError(c, err, "failed to get daily data by symbol")
+		return
+	}
+	respondData(c, dailyBars, Meta{
+		Count:  len(dailyBars),
+		Symbol: symbol,
+		Range:  &TimeRange{Start: startTime, End: endTime},
+		Source: usecase.SourceDB,
+	})
+}
+
+// GetOpeningGaps handles GET requests to list the symbols whose latest open gapped up or down from
+// the previous close by more than `min` percent (default 0).
+func (sh *StockHandler) GetOpeningGaps(c *gin.Context) {
+	minPercent := 0.0
+	if minStr := c.Query("min"); minStr != "" {
+		v, err := strconv.ParseFloat(minStr, 64)
+		if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min must be a non-negative number"})
 			return
 		}
+		minPercent = v
+	}
+
+	gaps, err := sh.stockUseCase.GetOpeningGaps(minPercent)
+	if err != nil {
+		respondError(c, err, "failed to get opening gaps")
+		return
+	}
+	render(c, http.StatusOK, gaps)
+}
+
+// GetOverview handles GET requests to retrieve both the daily series and the intraday quotes of a
+// symbol in one round trip, from `daily_from` and `intraday_from` respectively up to now.
+func (sh *StockHandler) GetOverview(c *gin.Context) {
+	precision, err := parsePrecision(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	symbol := utils.NormalizeSymbol(c.Query("symbol"))
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is a required query parameter"})
+		return
+	}
+	if err := utils.ValidateSymbol(symbol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	dailyFrom, err := parseTimeParam(c, "daily_from", now.AddDate(0, -1, 0))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	intradayFrom, err := parseTimeParam(c, "intraday_from", now.AddDate(0, 0, -1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if dailyFrom.After(now) || intradayFrom.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "daily_from and intraday_from must not be in the future"})
+		return
+	}
+
+	dailyBars, err := sh.stockUseCase.GetDailyData(symbol, dailyFrom, now)
+	if err != nil {
+		respondError(c, err, "failed to get daily data by symbol")
+		return
+	}
+	intraday, _, err := sh.stockUseCase.GetQuote(symbol, intradayFrom, now)
+	if err != nil {
+		respondError(c, err, "failed to get intraday data by symbol")
+		return
+	}
+
+	render(c, http.StatusOK, gin.H{"daily": dailyBars, "intraday": toQuoteResponses(intraday, precision)})
+}
+
+// GetReturnStats handles GET requests to retrieve the daily return statistics of a symbol.
+func (sh *StockHandler) GetReturnStats(c *gin.Context) {
+	symbol := utils.NormalizeSymbol(c.Query("symbol"))
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is a required query parameter"})
+		return
+	}
+	if err := utils.ValidateSymbol(symbol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	startTime, endTime, err := parseTimeRange(c, time.Now().AddDate(-1, 0, 0))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stats, err := sh.stockUseCase.GetReturnStats(symbol, startTime, endTime)
+	if err != nil {
+		respondError(c, err, "failed to get return stats by symbol")
+		return
+	}
+	render(c, http.StatusOK, stats)
+}
+
+// GetDataRange handles GET requests to retrieve the earliest and latest available data of a symbol.
+func (sh *StockHandler) GetDataRange(c *gin.Context) {
+	symbol := utils.NormalizeSymbol(c.Query("symbol"))
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is a required query parameter"})
+		return
+	}
+	if err := utils.ValidateSymbol(symbol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	earliest, latest, err := sh.stockUseCase.GetDataRange(symbol)
+	if err != nil {
+		respondError(c, err, "failed to get data range by symbol")
+		return
+	}
+	render(c, http.StatusOK, gin.H{"symbol": symbol, "earliest": earliest, "latest": latest})
+}
+
+// GetPrevClose handles GET requests to retrieve the close of the last trading day before `asOf`
+// (RFC3339, default now) by symbol.
+func (sh *StockHandler) GetPrevClose(c *gin.Context) {
+	symbol := utils.NormalizeSymbol(c.Query("symbol"))
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is a required query parameter"})
+		return
+	}
+	if err := utils.ValidateSymbol(symbol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	stock, err := sh.stockUseCase.GetQuote(symbol, startTime, endTime)
+	asOf, err := parseTimeParam(c, "asOf", time.Now())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get stock data by symbol: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if stock == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("stock not found for symbol: %s", symbol)})
+
+	prevClose, date, err := sh.stockUseCase.GetPrevClose(symbol, asOf)
+	if err != nil {
+		respondError(c, err, "failed to get previous close by symbol")
 		return
 	}
-	c.JSON(http.StatusOK, stock)
+	render(c, http.StatusOK, gin.H{"symbol": symbol, "prevClose": prevClose, "date": date.Format("2006-01-02")})
+}
+
+// resolveCompanyName resolves a company name to its symbol. When the name is unknown or matches
+// several companies, it responds with a 404 or a 300 listing the candidates and reports false.
+func (sh *StockHandler) resolveCompanyName(c *gin.Context, name string) (string, bool) {
+	matches, err := sh.stockUseCase.ResolveCompanyName(name)
+	if err != nil {
+		respondError(c, err, "failed to resolve company name")
+		return "", false
+	}
+	if len(matches) > 1 {
+		c.JSON(http.StatusMultipleChoices, gin.H{"error": fmt.Sprintf("%q matches several companies, pass one of their symbols instead", name), "matches": matches})
+		return "", false
+	}
+	return matches[0].Symbol, true
+}
+
+// respondError writes err as a JSON error, with 404 for not-found errors, 503 for overload errors
+// and 500 otherwise.
+func respondError(c *gin.Context, err error, message string) {
+	var notFound *apperrors.NotFoundError
+	if errors.As(err, &notFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound.Error()})
+		return
+	}
+	var overloaded *apperrors.OverloadedError
+	if errors.As(err, &overloaded) {
+		c.Header("Retry-After", strconv.Itoa(int(overloaded.RetryAfter.Seconds())))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": overloaded.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %v", message, err)})
+}
+
+// resetConnection closes the client connection without ending the response, for handlers failing
+// after the status was sent: a client would otherwise read the partial body as a complete one. When
+// the connection can't be taken over, e.g. over HTTP/2, the response is only aborted.
+func resetConnection(c *gin.Context) {
+	c.Abort()
+	// Send what was written so far, then close without the final chunk
+	c.Writer.Flush()
+	conn, buffered, err := c.Writer.Hijack()
+	if err != nil {
+		return
+	}
+	buffered.Flush()
+	conn.Close()
+}
+
+// parseTimeRange parses the `start` and `end` RFC3339 query parameters, defaulting to
+// defaultStart and now respectively, and checks that start is not after end.
+func parseTimeRange(c *gin.Context, defaultStart time.Time) (time.Time, time.Time, error) {
+	startTime, err := parseTimeParam(c, "start", defaultStart)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	endTime, err := parseTimeParam(c, "end", time.Now())
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if startTime.After(endTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start time must not be after end time")
+	}
+	return startTime, endTime, nil
+}
+
+// parseTimeParam parses an RFC3339 query parameter, defaulting to defaultValue when it is absent.
+func parseTimeParam(c *gin.Context, param string, defaultValue time.Time) (time.Time, error) {
+	value := c.Query(param)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s time format", param)
+	}
+	return t, nil
 }
 
 // func (h *StockHandler) GetTrades(c *gin.Context) {
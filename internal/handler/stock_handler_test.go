@@ -0,0 +1,927 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"stock-app/internal/cache"
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+	"stock-app/internal/usecase"
+	"stock-app/pkg/config"
+	apperrors "stock-app/pkg/errors"
+)
+
+func TestGetQuoteDefaultSymbol(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	latest := entity.NewLatestQuoteData()
+	latest.Set("AAPL", &entity.StockQuote{Symbol: "AAPL", Price: 201.5})
+	sh := NewStockHandler(usecase.NewStockServingUseCase(nil, nil, latest, nil))
+	router := gin.New()
+	router.GET("/stocks/quote", sh.GetQuote)
+
+	defaultSymbol := config.AppConfig.DefaultSymbol
+	defer func() { config.AppConfig.DefaultSymbol = defaultSymbol }()
+
+	tests := []struct {
+		name          string
+		defaultSymbol string
+		query         string
+		wantStatus    int
+	}{
+		{name: "default symbol served", defaultSymbol: "AAPL", query: "", wantStatus: http.StatusOK},
+		{name: "strict", defaultSymbol: "AAPL", query: "?strict=true", wantStatus: http.StatusBadRequest},
+		{name: "no default symbol", defaultSymbol: "", query: "", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig.DefaultSymbol = tt.defaultSymbol
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var quotes []*entity.StockQuote
+			if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if len(quotes) != 1 || quotes[0].Symbol != "AAPL" || quotes[0].Price != 201.5 {
+				t.Errorf("response = %s, want the latest AAPL quote", w.Body)
+			}
+		})
+	}
+}
+
+func TestSymbolValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// A nil use case makes any request that gets past validation panic
+	sh := NewStockHandler(nil)
+	router := gin.New()
+	router.GET("/stocks/quote", sh.GetQuote)
+	router.GET("/stocks/daily", sh.GetDailyData)
+
+	for _, path := range []string{"/stocks/quote", "/stocks/daily"} {
+		for _, symbol := range []string{"AAPL%3BDROP%20TABLE%20stock_daily_data", "%3Cscript%3E", "AAPL'--", "..%2F..%2Fetc"} {
+			t.Run(path+" "+symbol, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?symbol="+symbol, nil))
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+				}
+			})
+		}
+	}
+}
+
+// latestRepo serves only the latest quote of each symbol, counting the lookups. It fails every
+// lookup with err when set.
+type latestRepo struct {
+	repository.StockRepo
+	quotes  map[string]*entity.StockQuote
+	err     error
+	lookups int
+}
+
+func (r *latestRepo) GetLatestData(symbol string) (*entity.StockQuote, error) {
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	quote, ok := r.quotes[symbol]
+	if !ok {
+		return nil, &apperrors.NotFoundError{Resource: "latest data for " + symbol}
+	}
+	return quote, nil
+}
+
+func TestGetQuoteLatestRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "range=latest", query: "symbol=MSFT&range=latest", wantStatus: http.StatusOK},
+		{name: "range takes precedence over start and end", query: "symbol=MSFT&range=latest&start=2025-06-01&end=2025-06-02", wantStatus: http.StatusOK},
+		{name: "start=latest", query: "symbol=MSFT&start=latest", wantStatus: http.StatusOK},
+		{name: "lowercase symbol", query: "symbol=%20msft&range=latest", wantStatus: http.StatusOK},
+		{name: "start=latest with end", query: "symbol=MSFT&start=latest&end=2025-06-02", wantStatus: http.StatusBadRequest},
+		{name: "unknown range", query: "symbol=MSFT&range=week", wantStatus: http.StatusBadRequest},
+		{name: "symbol without quotes", query: "symbol=IBM&range=latest", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The repository only serves latest quotes, so the ranged path would panic
+			repo := &latestRepo{quotes: map[string]*entity.StockQuote{"MSFT": {Symbol: "MSFT", Price: 415.2}}}
+			sh := NewStockHandler(usecase.NewStockServingUseCase(repo, nil, entity.NewLatestQuoteData(), nil))
+			router := gin.New()
+			router.GET("/stocks/quote", sh.GetQuote)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote?"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var quotes []*entity.StockQuote
+			if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if len(quotes) != 1 || quotes[0].Symbol != "MSFT" || quotes[0].Price != 415.2 {
+				t.Errorf("response = %s, want only the latest MSFT quote", w.Body)
+			}
+			if repo.lookups != 1 {
+				t.Errorf("latest quote looked up %d times, want once", repo.lookups)
+			}
+		})
+	}
+}
+
+func TestGetQuoteErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{name: "no data", wantStatus: http.StatusNotFound},
+		{name: "wrapped not found", err: fmt.Errorf("querying: %w", &apperrors.NotFoundError{Resource: "latest data for IBM"}), wantStatus: http.StatusNotFound},
+		{name: "database down", err: errors.New("dial tcp: connection refused"), wantStatus: http.StatusInternalServerError},
+		{name: "overloaded", err: &apperrors.OverloadedError{RetryAfter: 2 * time.Second}, wantStatus: http.StatusServiceUnavailable, wantRetryAfter: "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &latestRepo{err: tt.err}
+			sh := NewStockHandler(usecase.NewStockServingUseCase(repo, nil, entity.NewLatestQuoteData(), nil))
+			router := gin.New()
+			router.GET("/stocks/quote", sh.GetQuote)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote?symbol=IBM&range=latest", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+// streamRepo streams count generated quotes a minute apart without holding them, calling done, if
+// set, once the last one has been handled.
+type streamRepo struct {
+	repository.StockRepo
+	count int
+	done  func()
+}
+
+func (r *streamRepo) StreamHistoricalData(symbol string, start, end time.Time, fn func(*entity.StockQuote) error) error {
+	for i := 0; i < r.count; i++ {
+		quote := &entity.StockQuote{Symbol: symbol, Price: float64(i), Timestamp: start.Add(time.Duration(i) * time.Minute)}
+		if err := fn(quote); err != nil {
+			return err
+		}
+	}
+	if r.done != nil {
+		r.done()
+	}
+	return nil
+}
+
+// discardWriter is a gin.ResponseWriter dropping the body, so only the handler's own memory is measured.
+type discardWriter struct {
+	gin.ResponseWriter
+	written int
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	w.written += len(b)
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteString(s string) (int, error) {
+	w.written += len(s)
+	return len(s), nil
+}
+
+func TestStreamQuotes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	start := time.Date(2025, time.June, 9, 13, 30, 0, 0, time.UTC)
+	newHandler := func(repo *streamRepo) *StockHandler {
+		return NewStockHandler(usecase.NewStockServingUseCase(repo, nil, entity.NewLatestQuoteData(), nil))
+	}
+
+	t.Run("valid JSON", func(t *testing.T) {
+		const count = 20000
+		router := gin.New()
+		router.GET("/stocks/quote", newHandler(&streamRepo{count: count}).GetQuote)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote?symbol=AAPL&stream=true&start=2025-06-09T13:30:00Z&end=2025-06-30T00:00:00Z", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		var quotes []*QuoteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+			t.Fatalf("invalid JSON response: %v", err)
+		}
+		if len(quotes) != count {
+			t.Fatalf("streamed %d quotes, want %d", len(quotes), count)
+		}
+		for i, quote := range quotes {
+			if quote.Symbol != "AAPL" || quote.Price != float64(i) || !quote.Timestamp.Equal(start.Add(time.Duration(i)*time.Minute)) {
+				t.Fatalf("quote %d = %+v, want the %dth quote in time order", i, quote, i)
+			}
+		}
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		router := gin.New()
+		router.GET("/stocks/quote", newHandler(&streamRepo{}).GetQuote)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote?symbol=AAPL&stream=true", nil))
+		if w.Code != http.StatusOK || w.Body.String() != "[]" {
+			t.Errorf("response = %d %q, want 200 []", w.Code, w.Body)
+		}
+	})
+
+	t.Run("bounded memory", func(t *testing.T) {
+		// Holding the 200k quotes and their responses would take tens of MB
+		const count = 200000
+		var before, end runtime.MemStats
+		// Measured once every quote has been written, while the handler would still hold them if it built the result
+		sh := newHandler(&streamRepo{count: count, done: func() {
+			runtime.GC()
+			runtime.ReadMemStats(&end)
+		}})
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/stocks/quote", nil)
+		w := &discardWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		sh.streamQuotes(c, "AAPL", start, start.Add(time.Duration(count)*time.Minute), time.Minute, "", BaselinePrevClose, defaultPrecision)
+
+		if w.written < count*50 {
+			t.Fatalf("wrote %d bytes for %d quotes", w.written, count)
+		}
+		if grown := int64(end.HeapAlloc) - int64(before.HeapAlloc); grown > 1<<20 {
+			t.Errorf("heap grew by %d bytes while streaming, want the streamed quotes released", grown)
+		}
+	})
+}
+
+// overviewRepo serves the daily bars and intraday quotes within the requested ranges.
+type overviewRepo struct {
+	repository.StockRepo
+	daily    []*entity.DailyBar
+	intraday []*entity.StockQuote
+}
+
+func (r *overviewRepo) GetDailyData(symbol string, start, end time.Time) ([]*entity.DailyBar, error) {
+	var bars []*entity.DailyBar
+	for _, bar := range r.daily {
+		if !bar.Date.Before(start) && !bar.Date.After(end) {
+			bars = append(bars, bar)
+		}
+	}
+	return bars, nil
+}
+
+func (r *overviewRepo) GetHistoricalData(symbol string, start, end time.Time) ([]*entity.StockQuote, error) {
+	var quotes []*entity.StockQuote
+	for _, quote := range r.intraday {
+		if !quote.Timestamp.Before(start) && !quote.Timestamp.After(end) {
+			quotes = append(quotes, quote)
+		}
+	}
+	return quotes, nil
+}
+
+// missCache is a StockCache that never holds any quotes.
+type missCache struct {
+	cache.StockCache
+}
+
+func (missCache) Get(symbol string, start, end time.Time) ([]*entity.StockQuote, bool) {
+	return nil, false
+}
+
+func (missCache) Set(symbol string, stock []*entity.StockQuote, expiration time.Duration) error {
+	return nil
+}
+
+func TestGetOverview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	repo := &overviewRepo{}
+	for days := 1; days <= 10; days++ {
+		repo.daily = append(repo.daily, &entity.DailyBar{Symbol: "AAPL", Close: float64(days), Date: now.AddDate(0, 0, -days)})
+	}
+	for hours := 1; hours <= 10; hours++ {
+		repo.intraday = append(repo.intraday, &entity.StockQuote{Symbol: "AAPL", Price: float64(hours), Timestamp: now.Add(-time.Duration(hours) * time.Hour)})
+	}
+	sh := NewStockHandler(usecase.NewStockServingUseCase(repo, missCache{}, entity.NewLatestQuoteData(), nil))
+	router := gin.New()
+	router.GET("/stocks/overview", sh.GetOverview)
+
+	param := func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	}
+	tests := []struct {
+		name         string
+		query        string
+		wantDaily    int
+		wantIntraday int
+		wantStatus   int
+	}{
+		{name: "defaults", query: "symbol=AAPL", wantDaily: 10, wantIntraday: 10, wantStatus: http.StatusOK},
+		{name: "daily range only", query: "symbol=AAPL&daily_from=" + param(now.AddDate(0, 0, -3)), wantDaily: 3, wantIntraday: 10, wantStatus: http.StatusOK},
+		{name: "intraday range only", query: "symbol=AAPL&intraday_from=" + param(now.Add(-2*time.Hour)), wantDaily: 10, wantIntraday: 2, wantStatus: http.StatusOK},
+		{
+			name:      "both ranges",
+			query:     "symbol=AAPL&daily_from=" + param(now.AddDate(0, 0, -5)) + "&intraday_from=" + param(now.Add(-4*time.Hour)),
+			wantDaily: 5, wantIntraday: 4, wantStatus: http.StatusOK,
+		},
+		{name: "missing symbol", query: "", wantStatus: http.StatusBadRequest},
+		{name: "invalid daily_from", query: "symbol=AAPL&daily_from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "future intraday_from", query: "symbol=AAPL&intraday_from=" + param(now.Add(2*time.Hour)), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/overview?"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Daily    []*entity.DailyBar `json:"daily"`
+				Intraday []*QuoteResponse   `json:"intraday"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if len(body.Daily) != tt.wantDaily || len(body.Intraday) != tt.wantIntraday {
+				t.Errorf("overview has %d daily bars and %d intraday quotes, want %d and %d", len(body.Daily), len(body.Intraday), tt.wantDaily, tt.wantIntraday)
+			}
+		})
+	}
+}
+
+func TestGetQuoteEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	start := time.Date(2025, time.June, 11, 13, 30, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	repo := &overviewRepo{intraday: []*entity.StockQuote{
+		{Symbol: "AAPL", Price: 201, Timestamp: start.Add(time.Minute)},
+		{Symbol: "AAPL", Price: 202, Timestamp: start.Add(2 * time.Minute)},
+	}}
+	sh := NewStockHandler(usecase.NewStockServingUseCase(repo, missCache{}, entity.NewLatestQuoteData(), nil))
+	router := gin.New()
+	router.GET("/stocks/quote", sh.GetQuote)
+	query := "/stocks/quote?symbol=aapl&start=" + start.Format(time.RFC3339) + "&end=" + end.Format(time.RFC3339)
+
+	t.Run("enveloped", func(t *testing.T) {
+		before := time.Now()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, query+"&envelope=true", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		var body struct {
+			Data []*QuoteResponse `json:"data"`
+			Meta Meta             `json:"meta"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if len(body.Data) != 2 || body.Meta.Count != 2 {
+			t.Errorf("envelope holds %d quotes with count %d, want 2", len(body.Data), body.Meta.Count)
+		}
+		if body.Meta.Symbol != "AAPL" {
+			t.Errorf("meta.symbol = %q, want %q", body.Meta.Symbol, "AAPL")
+		}
+		if body.Meta.Range == nil || !body.Meta.Range.Start.Equal(start) || !body.Meta.Range.End.Equal(end) {
+			t.Errorf("meta.range = %+v, want %v to %v", body.Meta.Range, start, end)
+		}
+		if body.Meta.Source != usecase.SourceDB {
+			t.Errorf("meta.source = %q, want %q", body.Meta.Source, usecase.SourceDB)
+		}
+		if body.Meta.GeneratedAt.Before(before.Truncate(time.Second)) {
+			t.Errorf("meta.generatedAt = %v, want the time of the request", body.Meta.GeneratedAt)
+		}
+	})
+
+	t.Run("bare by default", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, query, nil))
+		var quotes []*QuoteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+			t.Fatalf("response is not a bare array: %v: %s", err, w.Body)
+		}
+		if len(quotes) != 2 {
+			t.Errorf("response has %d quotes, want 2", len(quotes))
+		}
+	})
+}
+
+func TestGetQuoteBaseline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	latest := entity.NewLatestQuoteData()
+	latest.Set("AAPL", &entity.StockQuote{Symbol: "AAPL", Price: 105, OpenPrice: 100, PrevClose: 104, Change: 1, ChangePercentage: 100.0 / 104})
+	latest.Set("NEWCO", &entity.StockQuote{Symbol: "NEWCO", Price: 50, Change: 50, ChangePercentage: 0})
+	sh := NewStockHandler(usecase.NewStockServingUseCase(nil, nil, latest, nil))
+	router := gin.New()
+	router.GET("/stocks/quote", sh.GetQuote)
+
+	tests := []struct {
+		name              string
+		query             string
+		wantStatus        int
+		wantChange        float64
+		wantChangePercent float64
+	}{
+		{name: "default", query: "symbol=AAPL&range=latest", wantStatus: http.StatusOK, wantChange: 1, wantChangePercent: 0.9615},
+		{name: "previous close", query: "symbol=AAPL&range=latest&baseline=prevclose", wantStatus: http.StatusOK, wantChange: 1, wantChangePercent: 0.9615},
+		{name: "open", query: "symbol=AAPL&range=latest&baseline=open", wantStatus: http.StatusOK, wantChange: 5, wantChangePercent: 5},
+		{name: "open without an open price", query: "symbol=NEWCO&range=latest&baseline=open", wantStatus: http.StatusOK, wantChange: 50, wantChangePercent: 0},
+		{name: "unknown baseline", query: "symbol=AAPL&range=latest&baseline=close", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote?"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var quotes []*QuoteResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if len(quotes) != 1 {
+				t.Fatalf("response = %s, want a single quote", w.Body)
+			}
+			if quotes[0].Change != tt.wantChange || math.Abs(quotes[0].ChangePercentage-tt.wantChangePercent) > 1e-4 {
+				t.Errorf("change = %v (%v%%), want %v (%v%%)", quotes[0].Change, quotes[0].ChangePercentage, tt.wantChange, tt.wantChangePercent)
+			}
+		})
+	}
+}
+
+// recentRepo serves the n most recent of its quotes, which are in chronological order.
+type recentRepo struct {
+	repository.StockRepo
+	quotes []*entity.StockQuote
+}
+
+func (r *recentRepo) GetRecentQuotes(symbol string, n int) ([]*entity.StockQuote, error) {
+	if n > len(r.quotes) {
+		n = len(r.quotes)
+	}
+	return r.quotes[len(r.quotes)-n:], nil
+}
+
+func TestGetQuoteLast(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	start := time.Date(2025, time.June, 11, 13, 30, 0, 0, time.UTC)
+	repo := &recentRepo{}
+	for i := 0; i < 50; i++ {
+		repo.quotes = append(repo.quotes, &entity.StockQuote{Symbol: "AAPL", Price: float64(200 + i), Timestamp: start.Add(time.Duration(i) * time.Minute)})
+	}
+	sh := NewStockHandler(usecase.NewStockServingUseCase(repo, nil, entity.NewLatestQuoteData(), nil))
+	router := gin.New()
+	router.GET("/stocks/quote", sh.GetQuote)
+
+	tests := []struct {
+		name       string
+		last       string
+		wantStatus int
+		wantCount  int
+	}{
+		{name: "sparkline", last: "30", wantStatus: http.StatusOK, wantCount: 30},
+		{name: "more than available", last: "1000", wantStatus: http.StatusOK, wantCount: 50},
+		{name: "zero", last: "0", wantStatus: http.StatusBadRequest},
+		{name: "above the max", last: "1001", wantStatus: http.StatusBadRequest},
+		{name: "not a number", last: "ten", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote?symbol=AAPL&last="+tt.last, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var quotes []*QuoteResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if len(quotes) != tt.wantCount {
+				t.Fatalf("response has %d quotes, want %d", len(quotes), tt.wantCount)
+			}
+			for i := 1; i < len(quotes); i++ {
+				if !quotes[i].Timestamp.After(quotes[i-1].Timestamp) {
+					t.Fatalf("quotes %d and %d are not in chronological order", i-1, i)
+				}
+			}
+			if last := quotes[len(quotes)-1]; last.Price != 249 {
+				t.Errorf("last quote price = %v, want the most recent 249", last.Price)
+			}
+		})
+	}
+}
+
+func TestGetQuoteByName(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	latest := entity.NewLatestQuoteData()
+	latest.Set("TSLA", &entity.StockQuote{Symbol: "TSLA", Price: 250})
+	companies := entity.NewCompanyIndex()
+	companies.Set(&entity.CompanyProfile{Symbol: "TSLA", Name: "Tesla Inc"})
+	companies.Set(&entity.CompanyProfile{Symbol: "GOOG", Name: "Alphabet Inc"})
+	companies.Set(&entity.CompanyProfile{Symbol: "GOOGL", Name: "Alphabet Inc"})
+	sh := NewStockHandler(usecase.NewStockServingUseCase(nil, nil, latest, companies))
+	router := gin.New()
+	router.GET("/stocks/quote", sh.GetQuote)
+
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantSymbols []string
+	}{
+		{name: "exact", query: "?name=Tesla&range=latest", wantStatus: http.StatusOK, wantSymbols: []string{"TSLA"}},
+		{name: "prefix", query: "?name=tes&range=latest", wantStatus: http.StatusOK, wantSymbols: []string{"TSLA"}},
+		{name: "ambiguous", query: "?name=Alphabet&range=latest", wantStatus: http.StatusMultipleChoices, wantSymbols: []string{"GOOG", "GOOGL"}},
+		{name: "unknown", query: "?name=Microsoft&range=latest", wantStatus: http.StatusNotFound},
+		{name: "symbol wins", query: "?symbol=TSLA&name=Alphabet&range=latest", wantStatus: http.StatusOK, wantSymbols: []string{"TSLA"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var symbols []string
+			switch tt.wantStatus {
+			case http.StatusOK:
+				var quotes []*entity.StockQuote
+				if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+					t.Fatalf("invalid JSON response: %v", err)
+				}
+				for _, quote := range quotes {
+					symbols = append(symbols, quote.Symbol)
+				}
+			case http.StatusMultipleChoices:
+				var body struct {
+					Matches []*entity.CompanyProfile `json:"matches"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("invalid JSON response: %v", err)
+				}
+				for _, match := range body.Matches {
+					symbols = append(symbols, match.Symbol)
+				}
+			}
+			if fmt.Sprint(symbols) != fmt.Sprint(tt.wantSymbols) {
+				t.Errorf("symbols = %v, want %v: %s", symbols, tt.wantSymbols, w.Body)
+			}
+		})
+	}
+}
+
+func TestGetQuoteIncludeDaily(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tradingDay := time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)
+	dayBar := &entity.DailyBar{Symbol: "AAPL", Open: 200, High: 205, Low: 198, Close: 204, Volume: 1000, Date: tradingDay}
+	previousBar := &entity.DailyBar{Symbol: "AAPL", Open: 195, High: 201, Low: 194, Close: 199, Volume: 900, Date: tradingDay.AddDate(0, 0, -1)}
+
+	tests := []struct {
+		name       string
+		query      string
+		daily      []*entity.DailyBar
+		wantStatus int
+		wantDaily  *entity.DailyBar
+	}{
+		{name: "daily bar attached", query: "&include=daily", daily: []*entity.DailyBar{previousBar, dayBar}, wantStatus: http.StatusOK, wantDaily: dayBar},
+		{name: "no daily bar for the day", query: "&include=daily", daily: []*entity.DailyBar{previousBar}, wantStatus: http.StatusOK},
+		{name: "not requested", query: "", daily: []*entity.DailyBar{dayBar}, wantStatus: http.StatusOK},
+		{name: "invalid include", query: "&include=weekly", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latest := entity.NewLatestQuoteData()
+			latest.Set("AAPL", &entity.StockQuote{Symbol: "AAPL", Price: 203.5, Timestamp: tradingDay.Add(14*time.Hour + 30*time.Minute)})
+			sh := NewStockHandler(usecase.NewStockServingUseCase(&overviewRepo{daily: tt.daily}, missCache{}, latest, nil))
+			router := gin.New()
+			router.GET("/stocks/quote", sh.GetQuote)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote?symbol=AAPL&range=latest"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var quotes []map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil || len(quotes) != 1 {
+				t.Fatalf("response = %s, want a single quote", w.Body)
+			}
+			raw, attached := quotes[0]["daily"]
+			if tt.wantDaily == nil {
+				if attached {
+					t.Errorf("daily = %s, want the section omitted", raw)
+				}
+				return
+			}
+			var daily entity.DailyBar
+			if err := json.Unmarshal(raw, &daily); err != nil {
+				t.Fatalf("invalid daily section %s: %v", raw, err)
+			}
+			if daily != *tt.wantDaily {
+				t.Errorf("daily = %+v, want %+v", daily, *tt.wantDaily)
+			}
+		})
+	}
+}
+
+func TestGetChart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	start := time.Date(2025, time.June, 9, 14, 0, 0, 0, time.UTC)
+	// A quote a minute from 14:00 to 14:11, stored newest first
+	repo := &overviewRepo{}
+	for i := 11; i >= 0; i-- {
+		price := float64(100 + i)
+		repo.intraday = append(repo.intraday, &entity.StockQuote{
+			Symbol: "AAPL", OpenPrice: price, HighPrice: price + 1, LowPrice: price - 1, Price: price, Volume: 10,
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	newRouter := func(repo *overviewRepo) *gin.Engine {
+		router := gin.New()
+		router.GET("/stocks/chart", NewStockHandler(usecase.NewStockServingUseCase(repo, missCache{}, entity.NewLatestQuoteData(), nil)).GetChart)
+		return router
+	}
+	router := newRouter(repo)
+	get := func(t *testing.T, router *gin.Engine, query string) []map[string]float64 {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/chart?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+		var points []map[string]float64
+		if err := json.Unmarshal(w.Body.Bytes(), &points); err != nil {
+			t.Fatalf("invalid JSON response: %v", err)
+		}
+		return points
+	}
+	const window = "&start=2025-06-09T14:00:00Z&end=2025-06-09T14:30:00Z"
+
+	t.Run("5m candles", func(t *testing.T) {
+		points := get(t, router, "symbol=aapl&resolution=5m"+window)
+		want := []map[string]float64{
+			{"time": float64(start.Unix()), "open": 100, "high": 105, "low": 99, "close": 104, "volume": 50},
+			{"time": float64(start.Add(5 * time.Minute).Unix()), "open": 105, "high": 110, "low": 104, "close": 109, "volume": 50},
+			{"time": float64(start.Add(10 * time.Minute).Unix()), "open": 110, "high": 112, "low": 109, "close": 111, "volume": 20},
+		}
+		if !reflect.DeepEqual(points, want) {
+			t.Errorf("points = %v, want %v", points, want)
+		}
+	})
+
+	t.Run("1m points without duplicate times", func(t *testing.T) {
+		// A correction of the 14:11 quote sharing its time
+		corrected := &overviewRepo{intraday: append(repo.intraday, &entity.StockQuote{
+			Symbol: "AAPL", OpenPrice: 111, HighPrice: 120, LowPrice: 110, Price: 115, Volume: 10,
+			Timestamp: start.Add(11 * time.Minute),
+		})}
+		points := get(t, newRouter(corrected), "symbol=AAPL&resolution=1m"+window)
+		if len(points) != 12 {
+			t.Fatalf("got %d points, want 12", len(points))
+		}
+		for i, point := range points {
+			if point["time"] != float64(start.Add(time.Duration(i)*time.Minute).Unix()) {
+				t.Fatalf("point %d at %v, want minute %d in ascending order", i, point["time"], i)
+			}
+		}
+		if last := points[11]; last["close"] != 115 {
+			t.Errorf("last point = %v, want the correction of the 14:11 quote", last)
+		}
+	})
+
+	t.Run("invalid resolution", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/chart?symbol=AAPL&resolution=7m"+window, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestGetQuoteSymbolAlias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.SymbolAliases = map[string]string{"FB": "META"}
+
+	latest := entity.NewLatestQuoteData()
+	latest.Set("META", &entity.StockQuote{Symbol: "META", Price: 500})
+	latest.Set("AAPL", &entity.StockQuote{Symbol: "AAPL", Price: 200})
+	uc := usecase.NewStockServingUseCase(nil, nil, latest, nil)
+	router := gin.New()
+	router.GET("/stocks/quote", SymbolAliases(uc.ResolveSymbol), NewStockHandler(uc).GetQuote)
+
+	tests := []struct {
+		name        string
+		symbol      string
+		wantSymbol  string
+		wantPrice   float64
+		wantAliased bool
+	}{
+		{name: "old ticker", symbol: "FB", wantSymbol: "META", wantPrice: 500, wantAliased: true},
+		{name: "new ticker", symbol: "META", wantSymbol: "META", wantPrice: 500},
+		{name: "symbol without alias", symbol: "AAPL", wantSymbol: "AAPL", wantPrice: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks/quote?range=latest&symbol="+tt.symbol, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			var quotes []*QuoteResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if len(quotes) != 1 || quotes[0].Symbol != tt.wantSymbol || quotes[0].Price != tt.wantPrice {
+				t.Errorf("response = %s, want the %s quote", w.Body, tt.wantSymbol)
+			}
+			if aliased := w.Header().Get("Deprecation") == "true"; aliased != tt.wantAliased {
+				t.Errorf("Deprecation = %q, want aliased %v", w.Header().Get("Deprecation"), tt.wantAliased)
+			}
+		})
+	}
+}
+
+func TestListQuotesValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v2/stocks", NewStockHandler(usecase.NewStockServingUseCase(nil, nil, entity.NewLatestQuoteData(), nil)).ListQuotes)
+
+	for _, query := range []string{"sort=volume", "sort=change&order=down", "minChange=abc", "minChange=NaN", "precision=-1"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/stocks?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET /v2/stocks?%s status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// deadRepo is a StockRepo whose database is unreachable.
+type deadRepo struct {
+	repository.StockRepo
+}
+
+func (deadRepo) GetAllLatestData() (map[string]*entity.StockQuote, error) {
+	return nil, errors.New("connection refused")
+}
+
+// staleCache is a StockCache holding latest quotes too old to be served while the DB is up.
+type staleCache struct {
+	missCache
+	latest map[string]*entity.StockQuote
+}
+
+func (c staleCache) GetAllLatest() (map[string]*entity.StockQuote, error) {
+	return c.latest, nil
+}
+
+func TestGetAllQuotesDegraded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.CacheQuoteMaxAge = time.Minute
+
+	stale := map[string]*entity.StockQuote{"AAPL": {Symbol: "AAPL", Price: 201, Timestamp: time.Date(2025, time.June, 11, 16, 0, 0, 0, time.UTC)}}
+	router := gin.New()
+	router.GET("/stocks", NewStockHandler(usecase.NewStockServingUseCase(deadRepo{}, staleCache{latest: stale}, entity.NewLatestQuoteData(), nil)).GetAllQuotes)
+
+	t.Run("degraded", func(t *testing.T) {
+		config.AppConfig.DegradeOnDBError = true
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+		if got := w.Header().Get("X-Degraded"); got != "true" {
+			t.Errorf("X-Degraded = %q, want true", got)
+		}
+		var quotes map[string]*QuoteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if quotes["AAPL"] == nil || quotes["AAPL"].Price != 201 {
+			t.Errorf("quotes = %v, want the cached AAPL quote", quotes)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		config.AppConfig.DegradeOnDBError = false
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks", nil))
+		if w.Code != http.StatusInternalServerError || w.Header().Get("X-Degraded") != "" {
+			t.Errorf("status = %d with X-Degraded %q, want 500 without it", w.Code, w.Header().Get("X-Degraded"))
+		}
+	})
+}
+
+func TestGetAllQuotesShape(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.SymbolList = []string{"MSFT", "AAPL", "TSLA"}
+	config.AppConfig.MemoryQuoteMaxAge = 0
+
+	latest := entity.NewLatestQuoteData()
+	for _, symbol := range config.AppConfig.SymbolList {
+		latest.Set(symbol, &entity.StockQuote{Symbol: symbol, Price: 100, Timestamp: time.Date(2025, time.June, 11, 16, 0, 0, 0, time.UTC)})
+	}
+	router := gin.New()
+	router.GET("/stocks", NewStockHandler(usecase.NewStockServingUseCase(nil, missCache{}, latest, nil)).GetAllQuotes)
+
+	t.Run("map by default", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks", nil))
+		var quotes map[string]*QuoteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+			t.Fatalf("invalid JSON: %v: %s", err, w.Body)
+		}
+		if len(quotes) != 3 || quotes["AAPL"] == nil || quotes["AAPL"].Symbol != "AAPL" {
+			t.Errorf("quotes = %v, want the 3 quotes keyed by symbol", quotes)
+		}
+	})
+
+	t.Run("array", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks?shape=array", nil))
+		var quotes []*QuoteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil {
+			t.Fatalf("invalid JSON: %v: %s", err, w.Body)
+		}
+		var symbols []string
+		for _, quote := range quotes {
+			symbols = append(symbols, quote.Symbol)
+		}
+		if strings.Join(symbols, ",") != "AAPL,MSFT,TSLA" {
+			t.Errorf("symbols = %v, want AAPL, MSFT and TSLA in order", symbols)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stocks?shape=list", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"stock-app/internal/entity"
+	"stock-app/internal/hub"
+	"stock-app/internal/usecase"
+)
+
+func TestWSHeartbeat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pingInterval := 20 * time.Millisecond
+	wh := &WSHandler{
+		stockUseCase: usecase.NewStockServingUseCase(nil, nil, entity.NewLatestQuoteData(), nil),
+		quoteHub:     hub.NewHub(16),
+		writeTimeout: time.Second,
+		pingInterval: pingInterval,
+	}
+	router := gin.New()
+	router.GET("/ws", wh.StreamQuotes)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	tests := []struct {
+		name        string
+		answerPings bool
+		wantDropped bool
+	}{
+		{name: "answering pings", answerPings: true},
+		{name: "dead peer", answerPings: false, wantDropped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+			if !tt.answerPings {
+				conn.SetPingHandler(func(string) error { return nil })
+			}
+
+			// Reading handles the pings; it only ends early when the server drops the connection
+			conn.SetReadDeadline(time.Now().Add(10 * pingInterval))
+			_, _, err = conn.ReadMessage()
+			netErr, timedOut := err.(interface{ Timeout() bool })
+			dropped := !(timedOut && netErr.Timeout())
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %v (%v), want %v", dropped, err, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestSSEKeepAlive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		interval      time.Duration
+		wantKeepAlive bool
+	}{
+		{name: "enabled", interval: 10 * time.Millisecond, wantKeepAlive: true},
+		{name: "disabled", interval: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh := &SSEHandler{
+				stockUseCase:      usecase.NewStockServingUseCase(nil, nil, entity.NewLatestQuoteData(), nil),
+				quoteHub:          hub.NewHub(16),
+				keepAliveInterval: tt.interval,
+			}
+			router := gin.New()
+			router.GET("/sse", sh.StreamQuotes)
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			client := &http.Client{Timeout: 100 * time.Millisecond}
+			resp, err := client.Get(server.URL + "/sse?symbols=AAPL")
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer resp.Body.Close()
+
+			gotKeepAlive := false
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				if scanner.Text() == ":keepalive" {
+					gotKeepAlive = true
+					break
+				}
+			}
+			if gotKeepAlive != tt.wantKeepAlive {
+				t.Errorf("received keep-alive = %v, want %v", gotKeepAlive, tt.wantKeepAlive)
+			}
+		})
+	}
+}
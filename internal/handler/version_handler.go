@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// VersionHandler exposes the build metadata of the server.
+type VersionHandler struct {
+	info BuildInfo
+}
+
+// NewVersionHandler creates a new instance of VersionHandler. The Go version is taken from the runtime.
+func NewVersionHandler(version, commit, buildTime string) *VersionHandler {
+	return &VersionHandler{
+		info: BuildInfo{
+			Version:   version,
+			Commit:    commit,
+			BuildTime: buildTime,
+			GoVersion: runtime.Version(),
+		},
+	}
+}
+
+// Version handles GET requests to retrieve the build metadata.
+func (vh *VersionHandler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, vh.info)
+}
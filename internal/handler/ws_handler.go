@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"stock-app/internal/hub"
+	"stock-app/internal/usecase"
+	"stock-app/pkg/config"
+	"stock-app/pkg/utils"
+)
+
+// wsRequest is a message sent by a WebSocket client to change its subscriptions.
+type wsRequest struct {
+	Subscribe   []string `json:"subscribe"`
+	Unsubscribe []string `json:"unsubscribe"`
+}
+
+// WSHandler pushes real-time quotes to WebSocket clients.
+type WSHandler struct {
+	stockUseCase *usecase.StockServingUseCase
+	quoteHub     *hub.Hub
+	upgrader     websocket.Upgrader
+	writeTimeout time.Duration
+	pingInterval time.Duration
+}
+
+// NewWSHandler creates a new instance of WSHandler, streaming the quotes published to quoteHub.
+func NewWSHandler(stockUseCase *usecase.StockServingUseCase, quoteHub *hub.Hub) *WSHandler {
+	return &WSHandler{
+		stockUseCase: stockUseCase,
+		quoteHub:     quoteHub,
+		upgrader:     websocket.Upgrader{CheckOrigin: checkOrigin(config.AppConfig.WSAllowedOrigins)},
+		writeTimeout: config.AppConfig.WSWriteTimeout,
+		pingInterval: config.AppConfig.WSPingInterval,
+	}
+}
+
+// checkOrigin returns the upgrader origin check accepting same-origin requests, requests without an
+// Origin header (non-browser clients) and the allowed origins, where "*" allows any origin.
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, o := range allowed {
+			if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+				return true
+			}
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// StreamQuotes handles GET requests upgraded to a WebSocket. Clients send `{"subscribe": [...]}` and
+// `{"unsubscribe": [...]}` messages, and receive every new quote of their subscribed symbols.
+// Clients that don't accept a message within the write timeout are disconnected. A ping frame is sent
+// every ping interval so proxies don't drop connections idle during quiet market periods, and clients
+// sending neither a pong nor a message for two ping intervals are disconnected as dead peers.
+func (wh *WSHandler) StreamQuotes(c *gin.Context) {
+	conn, err := wh.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		fmt.Printf("Failed to upgrade WebSocket connection: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	// Pongs are handled while the reader below reads, so they keep the connection alive too
+	if err := wh.extendReadDeadline(conn); err != nil {
+		fmt.Printf("Dropping WebSocket client: %v\n", err)
+		return
+	}
+	conn.SetPongHandler(func(string) error {
+		return wh.extendReadDeadline(conn)
+	})
+
+	requests := make(chan wsRequest)
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(done)
+		for {
+			var req wsRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return // Client disconnected, went silent past the read deadline or sent an invalid message
+			}
+			if err := wh.extendReadDeadline(conn); err != nil {
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	subscriber := wh.quoteHub.Subscribe()
+	defer wh.quoteHub.Unsubscribe(subscriber)
+
+	// A nil channel never fires, leaving the heartbeat disabled
+	var heartbeat <-chan time.Time
+	if wh.pingInterval > 0 {
+		ticker := time.NewTicker(wh.pingInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-heartbeat:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wh.writeTimeout)); err != nil {
+				fmt.Printf("Dropping WebSocket client: %v\n", err)
+				return
+			}
+		case req := <-requests:
+			if err := wh.updateSubscriptions(conn, subscriber, req); err != nil {
+				return
+			}
+		case quote, ok := <-subscriber.Updates():
+			if !ok {
+				fmt.Println("Dropping WebSocket client: it fell behind the quote updates")
+				return
+			}
+			// Quotes buffered before an unsubscribe are still delivered by the hub
+			if !subscriber.Watching(quote.Symbol) {
+				continue
+			}
+			if err := wh.write(conn, toQuoteResponse(quote, defaultPrecision)); err != nil {
+				fmt.Printf("Dropping WebSocket client: %v\n", err)
+				return
+			}
+		}
+	}
+}
+
+// updateSubscriptions applies a subscription request, reporting invalid symbols to the client and
+// sending the current quote of newly subscribed symbols.
+func (wh *WSHandler) updateSubscriptions(conn *websocket.Conn, subscriber *hub.Subscriber, req wsRequest) error {
+	for _, symbol := range req.Subscribe {
+		symbol = utils.NormalizeSymbol(symbol)
+		if err := utils.ValidateSymbol(symbol); err != nil {
+			if err := wh.write(conn, gin.H{"error": err.Error(), "symbol": symbol}); err != nil {
+				return err
+			}
+			continue
+		}
+		symbol, _ = wh.stockUseCase.ResolveSymbol(symbol)
+		if subscriber.Watching(symbol) {
+			continue
+		}
+		subscriber.Watch(symbol)
+		if quote, exists := wh.stockUseCase.GetRealTimeQuote(symbol); exists {
+			if err := wh.write(conn, toQuoteResponse(quote, defaultPrecision)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, symbol := range req.Unsubscribe {
+		resolved, _ := wh.stockUseCase.ResolveSymbol(utils.NormalizeSymbol(symbol))
+		subscriber.Unwatch(resolved)
+	}
+	return nil
+}
+
+// extendReadDeadline gives the client two ping intervals to send a pong or a message before the
+// connection is considered dead. It does nothing when the heartbeat is disabled.
+func (wh *WSHandler) extendReadDeadline(conn *websocket.Conn) error {
+	if wh.pingInterval <= 0 {
+		return nil
+	}
+	return conn.SetReadDeadline(time.Now().Add(2 * wh.pingInterval))
+}
+
+// write sends a JSON message, failing if the client doesn't accept it within the write timeout.
+func (wh *WSHandler) write(conn *websocket.Conn, v interface{}) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(wh.writeTimeout)); err != nil {
+		return err
+	}
+	return conn.WriteJSON(v)
+}
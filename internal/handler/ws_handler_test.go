@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"stock-app/internal/entity"
+	"stock-app/internal/hub"
+	"stock-app/internal/usecase"
+)
+
+func TestWSStreamQuotes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	latest := entity.NewLatestQuoteData()
+	start := time.Date(2025, time.June, 11, 14, 0, 0, 0, time.UTC)
+	latest.Set("AAPL", &entity.StockQuote{Symbol: "AAPL", Price: 201, Timestamp: start})
+	quoteHub := hub.NewHub(16)
+	wh := &WSHandler{
+		stockUseCase: usecase.NewStockServingUseCase(nil, nil, latest, nil),
+		quoteHub:     quoteHub,
+		writeTimeout: time.Second,
+	}
+	router := gin.New()
+	router.GET("/ws", wh.StreamQuotes)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	read := func() map[string]interface{} {
+		t.Helper()
+		var msg map[string]interface{}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed to read a message: %v", err)
+		}
+		return msg
+	}
+
+	if err := conn.WriteJSON(wsRequest{Subscribe: []string{"aapl", "bad symbol!"}}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if msg := read(); msg["s"] != "AAPL" || msg["c"] != 201.0 {
+		t.Errorf("first message = %v, want the current AAPL quote", msg)
+	}
+	if msg := read(); msg["symbol"] != "BAD SYMBOL!" || msg["error"] == nil {
+		t.Errorf("second message = %v, want an error for the invalid symbol", msg)
+	}
+
+	quoteHub.Publish(&entity.StockQuote{Symbol: "AAPL", Price: 202, Timestamp: start.Add(time.Minute)})
+	if msg := read(); msg["s"] != "AAPL" || msg["c"] != 202.0 {
+		t.Errorf("message after an update = %v, want the new AAPL quote", msg)
+	}
+
+	// Requests are applied in order, so the error for the invalid symbol confirms the unsubscribe
+	if err := conn.WriteJSON(wsRequest{Unsubscribe: []string{"AAPL"}}); err != nil {
+		t.Fatalf("failed to unsubscribe: %v", err)
+	}
+	if err := conn.WriteJSON(wsRequest{Subscribe: []string{"bad symbol!"}}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if msg := read(); msg["error"] == nil {
+		t.Errorf("message after unsubscribing = %v, want an error for the invalid symbol", msg)
+	}
+	quoteHub.Publish(&entity.StockQuote{Symbol: "AAPL", Price: 203, Timestamp: start.Add(2 * time.Minute)})
+	var msg map[string]interface{}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if err := conn.ReadJSON(&msg); err == nil {
+		t.Errorf("message after unsubscribing = %v, want none", msg)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{name: "no origin", origin: "", want: true},
+		{name: "same origin", origin: "http://stocks.example.com", want: true},
+		{name: "cross origin", origin: "https://evil.example.com", want: false},
+		{name: "allowed origin", allowed: []string{"https://app.example.com/"}, origin: "https://app.example.com", want: true},
+		{name: "other origin than allowed", allowed: []string{"https://app.example.com"}, origin: "https://evil.example.com", want: false},
+		{name: "any origin", allowed: []string{"*"}, origin: "https://evil.example.com", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://stocks.example.com/stocks/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := checkOrigin(tt.allowed)(r); got != tt.want {
+				t.Errorf("checkOrigin(%v)(%q) = %v, want %v", tt.allowed, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package hub
+
+import (
+	"fmt"
+	"sync"
+
+	"stock-app/internal/entity"
+)
+
+// Hub fans out real-time quote updates from a single publisher to many subscribers, so that
+// streaming clients don't each poll the shared in-memory data.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+	bufferSize  int
+}
+
+// Subscriber receives the quotes of its watched symbols published to a Hub on a buffered channel.
+type Subscriber struct {
+	updates chan *entity.StockQuote
+	mu      sync.RWMutex
+	symbols map[string]bool
+}
+
+// NewHub creates a new Hub whose subscribers buffer up to bufferSize quotes.
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	return &Hub{
+		subscribers: make(map[*Subscriber]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Updates returns the channel the subscriber receives quotes on. It is closed when the subscriber
+// unsubscribes or is dropped for falling behind.
+func (s *Subscriber) Updates() <-chan *entity.StockQuote {
+	return s.updates
+}
+
+// Watch adds symbols to those the subscriber receives quotes of.
+func (s *Subscriber) Watch(symbols ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, symbol := range symbols {
+		s.symbols[symbol] = true
+	}
+}
+
+// Unwatch removes symbols from those the subscriber receives quotes of. Quotes of those symbols
+// already buffered are still delivered.
+func (s *Subscriber) Unwatch(symbols ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, symbol := range symbols {
+		delete(s.symbols, symbol)
+	}
+}
+
+// Watching reports whether the subscriber receives quotes of the symbol.
+func (s *Subscriber) Watching(symbol string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.symbols[symbol]
+}
+
+// Subscribe registers a new subscriber receiving the quotes of symbols. More symbols can be watched later.
+func (h *Hub) Subscribe(symbols ...string) *Subscriber {
+	s := &Subscriber{
+		updates: make(chan *entity.StockQuote, h.bufferSize),
+		symbols: make(map[string]bool),
+	}
+	s.Watch(symbols...)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes a subscriber and closes its channel. It is a no-op if the subscriber was
+// already removed.
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s)
+}
+
+// Publish sends a quote to every subscriber watching its symbol without blocking. Subscribers whose
+// buffer is full are dropped, so a slow consumer can't hold back ingestion or the other subscribers.
+func (h *Hub) Publish(quote *entity.StockQuote) {
+	var slow []*Subscriber
+	h.mu.RLock()
+	for s := range h.subscribers {
+		if !s.Watching(quote.Symbol) {
+			continue
+		}
+		select {
+		case s.updates <- quote:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	if len(slow) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range slow {
+		if h.remove(s) {
+			fmt.Println("Dropping slow hub subscriber.")
+		}
+	}
+}
+
+// Len returns the number of subscribers.
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribers)
+}
+
+// remove deletes the subscriber and closes its channel, reporting whether it was subscribed.
+// The caller must hold the write lock.
+func (h *Hub) remove(s *Subscriber) bool {
+	if _, exists := h.subscribers[s]; !exists {
+		return false
+	}
+	delete(h.subscribers, s)
+	close(s.updates)
+	return true
+}
@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"testing"
+
+	"stock-app/internal/entity"
+)
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name        string
+		subscribers int
+		bufferSize  int
+		published   int
+		slowIndex   int // Subscriber never read from, -1 for none
+	}{
+		{name: "many subscribers", subscribers: 100, bufferSize: 10, published: 10, slowIndex: -1},
+		{name: "slow subscriber dropped", subscribers: 20, bufferSize: 2, published: 5, slowIndex: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub(tt.bufferSize)
+			subscribers := make([]*Subscriber, tt.subscribers)
+			for i := range subscribers {
+				subscribers[i] = h.Subscribe("AAPL")
+			}
+
+			received := make([]int, tt.subscribers)
+			for n := 0; n < tt.published; n++ {
+				h.Publish(&entity.StockQuote{Symbol: "AAPL", Price: float64(n)})
+				for i, s := range subscribers {
+					if i == tt.slowIndex {
+						continue
+					}
+					quote := <-s.Updates()
+					if quote.Price != float64(n) {
+						t.Fatalf("subscriber %d got price %v, want %v", i, quote.Price, n)
+					}
+					received[i]++
+				}
+			}
+
+			for i, n := range received {
+				if i != tt.slowIndex && n != tt.published {
+					t.Errorf("subscriber %d received %d quotes, want %d", i, n, tt.published)
+				}
+			}
+			want := tt.subscribers
+			if tt.slowIndex >= 0 {
+				want--
+				if _, open := drain(subscribers[tt.slowIndex]); open {
+					t.Error("slow subscriber was not dropped")
+				}
+			}
+			if h.Len() != want {
+				t.Errorf("Len() = %d, want %d", h.Len(), want)
+			}
+		})
+	}
+}
+
+func TestPublishFiltersSymbols(t *testing.T) {
+	tests := []struct {
+		name    string
+		watch   []string
+		unwatch []string
+		publish []string
+		want    []string
+	}{
+		{name: "only watched symbols", watch: []string{"AAPL", "MSFT"}, publish: []string{"AAPL", "TSLA", "MSFT"}, want: []string{"AAPL", "MSFT"}},
+		{name: "unwatched symbol", watch: []string{"AAPL", "MSFT"}, unwatch: []string{"MSFT"}, publish: []string{"AAPL", "MSFT"}, want: []string{"AAPL"}},
+		{name: "nothing watched", publish: []string{"AAPL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub(10)
+			s := h.Subscribe(tt.watch...)
+			s.Unwatch(tt.unwatch...)
+			for _, symbol := range tt.publish {
+				h.Publish(&entity.StockQuote{Symbol: symbol})
+			}
+
+			h.Unsubscribe(s)
+			got, _ := drain(s)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// drain returns the symbols of the quotes buffered by s, and whether its channel is still open.
+func drain(s *Subscriber) ([]string, bool) {
+	var symbols []string
+	for {
+		select {
+		case quote, ok := <-s.Updates():
+			if !ok {
+				return symbols, false
+			}
+			symbols = append(symbols, quote.Symbol)
+		default:
+			return symbols, true
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Data types refreshed from the time series API.
+const (
+	DataTypeIntraday = "intraday"
+	DataTypeDaily    = "daily"
+)
+
+var (
+	// LastSuccessfulRefresh is the Unix time of the last successful fetch of each data type,
+	// to alert on when the refresh stops working.
+	LastSuccessfulRefresh = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "last_successful_refresh_timestamp_seconds",
+		Help: "Unix time of the last successful time series fetch, by data type.",
+	}, []string{"type"})
+
+	// LatestDataTimestamp is the Unix time of the newest intraday data point across all symbols,
+	// reloaded from the DB periodically.
+	LatestDataTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "latest_data_timestamp_seconds",
+		Help: "Unix time of the newest intraday data point in the DB across all symbols.",
+	})
+
+	// CircuitBreakerState is the state of the circuit breaker of each upstream provider:
+	// 0 closed, 1 half-open, 2 open.
+	CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "State of the circuit breaker of each upstream provider: 0 closed, 1 half-open, 2 open.",
+	}, []string{"provider"})
+
+	// DataPointsInserted counts the data points inserted into the DB by the time series fetcher.
+	DataPointsInserted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "data_points_inserted_total",
+		Help: "Number of data points inserted into the DB, by data type.",
+	}, []string{"type"})
+)
+
+// RecordInserted counts the points of the data type inserted by a fetch.
+func RecordInserted(dataType string, inserted int) {
+	DataPointsInserted.WithLabelValues(dataType).Add(float64(inserted))
+}
+
+// RecordRefresh marks a successful fetch of the data type, i.e. one in which no symbol failed.
+func RecordRefresh(dataType string) {
+	LastSuccessfulRefresh.WithLabelValues(dataType).Set(float64(time.Now().Unix()))
+}
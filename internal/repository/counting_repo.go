@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"sync/atomic"
+
+	"stock-app/internal/entity"
+)
+
+// CountingRepo wraps a StockRepo, counting the rows successfully written by its inserts. Intraday
+// minutes kept from a preferred source aren't counted.
+type CountingRepo struct {
+	StockRepo
+	inserted int64
+}
+
+// NewCountingRepo creates a new instance of CountingRepo around the given repository.
+func NewCountingRepo(repo StockRepo) *CountingRepo {
+	return &CountingRepo{StockRepo: repo}
+}
+
+// InsertIntradayData inserts the intraday row and counts it if written.
+func (repo *CountingRepo) InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) (int64, error) {
+	written, err := repo.StockRepo.InsertIntradayData(symbol, timestamp, open, high, low, close, volume)
+	if err != nil {
+		return 0, err
+	}
+	atomic.AddInt64(&repo.inserted, written)
+	return written, nil
+}
+
+// InsertIntradayBars inserts the intraday bars and counts those written.
+func (repo *CountingRepo) InsertIntradayBars(bars []*entity.StockQuote, source string) (int64, error) {
+	written, err := repo.StockRepo.InsertIntradayBars(bars, source)
+	if err != nil {
+		return 0, err
+	}
+	atomic.AddInt64(&repo.inserted, written)
+	return written, nil
+}
+
+// InsertDailyData inserts the daily row and counts it.
+func (repo *CountingRepo) InsertDailyData(symbol, date, open, high, low, close, volume string) error {
+	if err := repo.StockRepo.InsertDailyData(symbol, date, open, high, low, close, volume); err != nil {
+		return err
+	}
+	atomic.AddInt64(&repo.inserted, 1)
+	return nil
+}
+
+// Inserted returns the number of rows inserted so far.
+func (repo *CountingRepo) Inserted() int64 {
+	return atomic.LoadInt64(&repo.inserted)
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"stock-app/internal/entity"
+)
+
+// writingRepo is a StockRepo whose intraday inserts report written rows and fail with err.
+type writingRepo struct {
+	StockRepo
+	written int64
+	err     error
+}
+
+func (repo *writingRepo) InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) (int64, error) {
+	return repo.written, repo.err
+}
+
+func (repo *writingRepo) InsertIntradayBars(bars []*entity.StockQuote, source string) (int64, error) {
+	return repo.written, repo.err
+}
+
+func TestCountingRepo(t *testing.T) {
+	bars := []*entity.StockQuote{{Symbol: "AAPL"}, {Symbol: "AAPL"}, {Symbol: "AAPL"}}
+
+	tests := []struct {
+		name    string
+		insert  func(repo StockRepo) error
+		written int64
+		err     error
+		want    int64
+	}{
+		{name: "bars written", insert: func(repo StockRepo) error { _, err := repo.InsertIntradayBars(bars, SourceAPI); return err }, written: 3, want: 3},
+		{name: "bars partly kept", insert: func(repo StockRepo) error { _, err := repo.InsertIntradayBars(bars, SourceAPI); return err }, written: 2, want: 2},
+		{name: "bars failed", insert: func(repo StockRepo) error { _, err := repo.InsertIntradayBars(bars, SourceAPI); return err }, err: errors.New("boom"), want: 0},
+		{name: "row written", insert: func(repo StockRepo) error {
+			_, err := repo.InsertIntradayData("AAPL", "2025-06-11 10:30:00", "1", "1", "1", "1", "1")
+			return err
+		}, written: 1, want: 1},
+		{name: "row kept from a preferred source", insert: func(repo StockRepo) error {
+			_, err := repo.InsertIntradayData("AAPL", "2025-06-11 10:30:00", "1", "1", "1", "1", "1")
+			return err
+		}, written: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewCountingRepo(&writingRepo{written: tt.written, err: tt.err})
+			if err := tt.insert(repo); err != tt.err {
+				t.Fatalf("insert error = %v, want %v", err, tt.err)
+			}
+			if got := repo.Inserted(); got != tt.want {
+				t.Errorf("Inserted() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
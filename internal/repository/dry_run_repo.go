@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"stock-app/internal/entity"
+)
+
+// DryRunRecord summarizes the rows that would have been inserted for a symbol.
+type DryRunRecord struct {
+	Count int
+	First string
+	Last  string
+}
+
+// DryRunRepo wraps a StockRepo, recording inserts instead of writing them while delegating reads.
+type DryRunRepo struct {
+	StockRepo
+	mu       sync.Mutex
+	intraday map[string]*DryRunRecord
+	daily    map[string]*DryRunRecord
+}
+
+// NewDryRunRepo creates a new instance of DryRunRepo around the given repository.
+func NewDryRunRepo(repo StockRepo) *DryRunRepo {
+	return &DryRunRepo{
+		StockRepo: repo,
+		intraday:  make(map[string]*DryRunRecord),
+		daily:     make(map[string]*DryRunRecord),
+	}
+}
+
+// InsertIntradayData records the intraday row instead of inserting it, counting it as written.
+func (repo *DryRunRepo) InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) (int64, error) {
+	repo.record(repo.intraday, symbol, timestamp)
+	return 1, nil
+}
+
+// InsertIntradayBars records the intraday bars instead of inserting them, counting them as written.
+func (repo *DryRunRepo) InsertIntradayBars(bars []*entity.StockQuote, source string) (int64, error) {
+	for _, bar := range bars {
+		repo.record(repo.intraday, bar.Symbol, bar.Timestamp.Format("2006-01-02 15:04:05"))
+	}
+	return int64(len(bars)), nil
+}
+
+// InsertDailyData validates and records the daily row instead of inserting it.
+func (repo *DryRunRepo) InsertDailyData(symbol, date, open, high, low, close, volume string) error {
+	if _, err := formatOHLCV(symbol, dailyPriceScale, open, high, low, close, volume); err != nil {
+		return fmt.Errorf("invalid daily data for %s on %s: %w", symbol, date, err)
+	}
+	repo.record(repo.daily, symbol, date)
+	return nil
+}
+
+// RecomputeChanges does nothing in dry-run mode.
+func (repo *DryRunRepo) RecomputeChanges(since time.Time) (int64, error) {
+	return 0, nil
+}
+
+// BackfillChanges does nothing in dry-run mode.
+func (repo *DryRunRepo) BackfillChanges() (int64, error) {
+	return 0, nil
+}
+
+// DeleteSymbolData deletes nothing in dry-run mode.
+func (repo *DryRunRepo) DeleteSymbolData(symbol string) (int64, error) {
+	return 0, nil
+}
+
+// CreateTables does nothing in dry-run mode.
+func (repo *DryRunRepo) CreateTables() error {
+	return nil
+}
+
+// Migrate does nothing in dry-run mode.
+func (repo *DryRunRepo) Migrate() error {
+	return nil
+}
+
+// IntradayRecords returns the recorded intraday inserts by symbol.
+func (repo *DryRunRepo) IntradayRecords() map[string]DryRunRecord {
+	return repo.snapshot(repo.intraday)
+}
+
+// DailyRecords returns the recorded daily inserts by symbol.
+func (repo *DryRunRepo) DailyRecords() map[string]DryRunRecord {
+	return repo.snapshot(repo.daily)
+}
+
+// Report prints the per-symbol count and range of the rows that would have been inserted.
+func (repo *DryRunRepo) Report() {
+	printRecords := func(table string, records map[string]DryRunRecord) {
+		symbols := make([]string, 0, len(records))
+		for symbol := range records {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+
+		fmt.Printf("Would insert into %s for %d symbols:\n", table, len(symbols))
+		for _, symbol := range symbols {
+			r := records[symbol]
+			fmt.Printf("  %s: %d rows from %s to %s\n", symbol, r.Count, r.First, r.Last)
+		}
+	}
+	printRecords("stock_daily_data", repo.DailyRecords())
+	printRecords("stock_intraday_data", repo.IntradayRecords())
+}
+
+// record adds a row to the symbol's record, widening its range.
+func (repo *DryRunRepo) record(records map[string]*DryRunRecord, symbol, at string) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	r, exists := records[symbol]
+	if !exists {
+		records[symbol] = &DryRunRecord{Count: 1, First: at, Last: at}
+		return
+	}
+	r.Count++
+	if at < r.First {
+		r.First = at
+	}
+	if at > r.Last {
+		r.Last = at
+	}
+}
+
+// snapshot copies the records so they can be read without holding the lock.
+func (repo *DryRunRepo) snapshot(records map[string]*DryRunRecord) map[string]DryRunRecord {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	copied := make(map[string]DryRunRecord, len(records))
+	for symbol, r := range records {
+		copied[symbol] = *r
+	}
+	return copied
+}
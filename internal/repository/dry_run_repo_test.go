@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-app/internal/entity"
+)
+
+// writeCountingRepo counts the writes that reach it.
+type writeCountingRepo struct {
+	StockRepo
+	writes int
+}
+
+func (r *writeCountingRepo) InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) (int64, error) {
+	r.writes++
+	return 1, nil
+}
+
+func (r *writeCountingRepo) InsertIntradayBars(bars []*entity.StockQuote, source string) (int64, error) {
+	r.writes++
+	return 1, nil
+}
+
+func (r *writeCountingRepo) InsertDailyData(symbol, date, open, high, low, close, volume string) error {
+	r.writes++
+	return nil
+}
+
+func (r *writeCountingRepo) CreateTables() error {
+	r.writes++
+	return nil
+}
+
+func TestDryRunRepo(t *testing.T) {
+	inner := &writeCountingRepo{}
+	repo := NewDryRunRepo(inner)
+
+	for _, date := range []string{"2025-06-06", "2025-06-04", "2025-06-05"} {
+		repo.InsertDailyData("AAPL", date, "1", "1", "1", "1", "1")
+	}
+	repo.InsertDailyData("MSFT", "2025-06-06", "1", "1", "1", "1", "1")
+	repo.InsertIntradayData("AAPL", "2025-06-09 09:31:00", "1", "1", "1", "1", "1")
+	repo.InsertIntradayBars([]*entity.StockQuote{
+		{Symbol: "AAPL", Timestamp: time.Date(2025, time.June, 9, 9, 30, 0, 0, time.UTC)},
+		{Symbol: "MSFT", Timestamp: time.Date(2025, time.June, 9, 9, 30, 0, 0, time.UTC)},
+	}, SourceAPI)
+	repo.CreateTables()
+
+	if inner.writes != 0 {
+		t.Errorf("%d writes reached the wrapped repository, want none", inner.writes)
+	}
+
+	wantDaily := map[string]DryRunRecord{
+		"AAPL": {Count: 3, First: "2025-06-04", Last: "2025-06-06"},
+		"MSFT": {Count: 1, First: "2025-06-06", Last: "2025-06-06"},
+	}
+	wantIntraday := map[string]DryRunRecord{
+		"AAPL": {Count: 2, First: "2025-06-09 09:30:00", Last: "2025-06-09 09:31:00"},
+		"MSFT": {Count: 1, First: "2025-06-09 09:30:00", Last: "2025-06-09 09:30:00"},
+	}
+	for name, tt := range map[string]struct{ got, want map[string]DryRunRecord }{
+		"daily":    {repo.DailyRecords(), wantDaily},
+		"intraday": {repo.IntradayRecords(), wantIntraday},
+	} {
+		if len(tt.got) != len(tt.want) {
+			t.Errorf("%s records = %v, want %v", name, tt.got, tt.want)
+		}
+		for symbol, want := range tt.want {
+			if got := tt.got[symbol]; got != want {
+				t.Errorf("%s record of %s = %+v, want %+v", name, symbol, got, want)
+			}
+		}
+	}
+
+	report := captureStdout(t, repo.Report)
+	for _, line := range []string{
+		"Would insert into stock_daily_data for 2 symbols:",
+		"  AAPL: 3 rows from 2025-06-04 to 2025-06-06",
+		"Would insert into stock_intraday_data for 2 symbols:",
+		"  MSFT: 1 rows from 2025-06-09 09:30:00 to 2025-06-09 09:30:00",
+	} {
+		if !strings.Contains(report, line+"\n") {
+			t.Errorf("report is missing %q:\n%s", line, report)
+		}
+	}
+}
+
+// captureStdout returns what f prints to standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
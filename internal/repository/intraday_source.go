@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"time"
+
+	"stock-app/pkg/utils"
+)
+
+// Sources of intraday rows, stored in the source column of stock_intraday_data.
+const (
+	// SourceAPI marks bars fetched from the time series API.
+	SourceAPI = "api"
+	// SourceRealtime marks bars aggregated from real-time trades.
+	SourceRealtime = "realtime"
+)
+
+// Precedences between the sources writing the same intraday minute, selected by INTRADAY_PRECEDENCE.
+const (
+	// PrecedenceLastWrite lets whichever source writes last overwrite the row.
+	PrecedenceLastWrite = "last"
+	// PrecedenceAPI keeps API rows over real-time ones.
+	PrecedenceAPI = "api"
+	// PrecedenceRealtime keeps real-time rows over API ones.
+	PrecedenceRealtime = "realtime"
+	// PrecedenceMarketHours prefers real-time rows for minutes of the symbol's regular session, when
+	// trades are dense enough to aggregate, and API rows for the extended hours, when they are sparse.
+	PrecedenceMarketHours = "market_hours"
+)
+
+// recordsSource reports whether the precedence decides between sources, so the source of intraday rows
+// has to be recorded.
+func recordsSource(precedence string) bool {
+	switch precedence {
+	case PrecedenceAPI, PrecedenceRealtime, PrecedenceMarketHours:
+		return true
+	default:
+		return false
+	}
+}
+
+// preferredSource returns the source allowed to overwrite an intraday row of symbol at timestamp, an
+// exchange wall clock time, written by another source, or "" when any source may. It only depends on
+// the minute, so the same source keeps it whichever order the sources write in. Rows are always
+// overwritten by their own source.
+func preferredSource(precedence, symbol string, timestamp time.Time) string {
+	switch precedence {
+	case PrecedenceAPI:
+		return SourceAPI
+	case PrecedenceRealtime:
+		return SourceRealtime
+	case PrecedenceMarketHours:
+		if utils.CalendarForSymbol(symbol).SessionAtWallClock(timestamp) == utils.SessionRegular {
+			return SourceRealtime
+		}
+		return SourceAPI
+	default:
+		return ""
+	}
+}
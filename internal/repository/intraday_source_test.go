@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreferredSource(t *testing.T) {
+	// Intraday timestamps are exchange wall clock times stored as UTC
+	minute := func(hour, min int) time.Time {
+		return time.Date(2025, time.June, 11, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		precedence string
+		timestamp  time.Time
+		want       string
+	}{
+		{name: "market hours in the regular session", precedence: PrecedenceMarketHours, timestamp: minute(10, 30), want: SourceRealtime},
+		{name: "market hours at the open", precedence: PrecedenceMarketHours, timestamp: minute(9, 30), want: SourceRealtime},
+		{name: "market hours before the open", precedence: PrecedenceMarketHours, timestamp: minute(9, 29), want: SourceAPI},
+		{name: "market hours at the close", precedence: PrecedenceMarketHours, timestamp: minute(16, 0), want: SourceAPI},
+		{name: "market hours on a weekend", precedence: PrecedenceMarketHours, timestamp: minute(10, 30).AddDate(0, 0, 3), want: SourceAPI},
+		{name: "api", precedence: PrecedenceAPI, timestamp: minute(10, 30), want: SourceAPI},
+		{name: "realtime", precedence: PrecedenceRealtime, timestamp: minute(18, 0), want: SourceRealtime},
+		{name: "last write", precedence: PrecedenceLastWrite, timestamp: minute(10, 30), want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := preferredSource(tt.precedence, "AAPL", tt.timestamp); got != tt.want {
+				t.Errorf("preferredSource(%s, %v) = %q, want %q", tt.precedence, tt.timestamp, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpsertQuery(t *testing.T) {
+	at := time.Date(2025, time.June, 11, 10, 30, 0, 0, time.UTC)
+	values := []interface{}{"1", "2", "0.5", "1.5", "100"}
+
+	tests := []struct {
+		name               string
+		precomputedChanges bool
+		precedence         string
+		wantSource         bool
+		wantArgs           int
+	}{
+		{name: "last write", precedence: PrecedenceLastWrite, wantArgs: 7},
+		{name: "last write with changes", precomputedChanges: true, precedence: PrecedenceLastWrite, wantArgs: 7},
+		{name: "market hours", precedence: PrecedenceMarketHours, wantSource: true, wantArgs: 9},
+		{name: "api with changes", precomputedChanges: true, precedence: PrecedenceAPI, wantSource: true, wantArgs: 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &StockRepoImpl{precomputedChanges: tt.precomputedChanges, intradayPrecedence: tt.precedence}
+			query := repo.upsertQuery()
+			if got := strings.Contains(query, "source"); got != tt.wantSource {
+				t.Errorf("upsertQuery() writes the source column: %v, want %v", got, tt.wantSource)
+			}
+			if got := strings.Contains(query, "change_percentage"); got != tt.precomputedChanges {
+				t.Errorf("upsertQuery() writes the change columns: %v, want %v", got, tt.precomputedChanges)
+			}
+			if got := len(repo.upsertArgs("AAPL", at, values, SourceAPI)); got != tt.wantArgs {
+				t.Errorf("upsertArgs() returned %d arguments, want %d", got, tt.wantArgs)
+			}
+		})
+	}
+}
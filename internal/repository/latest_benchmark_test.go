@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+
+	"stock-app/internal/entity"
+	"stock-app/pkg/config"
+)
+
+// latestStrategies are the GetAllLatestData query strategies compared against each other.
+var latestStrategies = []string{LatestStrategyCTE, LatestStrategyDistinctOn}
+
+// benchmarkRepo connects to the database configured like the server's, skipping unless
+// BENCHMARK_LATEST is set since it needs a populated database.
+func benchmarkRepo(tb testing.TB) *StockRepoImpl {
+	tb.Helper()
+	if os.Getenv("BENCHMARK_LATEST") == "" {
+		tb.Skip("set BENCHMARK_LATEST to run against the configured database")
+	}
+	godotenv.Load("../../.env")
+	config.LoadConfig()
+
+	db, err := sql.Open("postgres", config.AppConfig.DatabaseURL)
+	if err != nil {
+		tb.Fatalf("failed to connect to the database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return &StockRepoImpl{db: db}
+}
+
+// TestLatestStrategiesMatch checks that every strategy returns exactly the same quotes, since only
+// then can one replace the other.
+func TestLatestStrategiesMatch(t *testing.T) {
+	repo := benchmarkRepo(t)
+
+	expected, err := repo.getAllLatestData(latestStrategies[0])
+	if err != nil {
+		t.Fatalf("error running %s strategy: %v", latestStrategies[0], err)
+	}
+	for _, strategy := range latestStrategies[1:] {
+		quotes, err := repo.getAllLatestData(strategy)
+		if err != nil {
+			t.Fatalf("error running %s strategy: %v", strategy, err)
+		}
+		if err := compareLatestQuotes(expected, quotes); err != nil {
+			t.Errorf("%s strategy differs from %s: %v", strategy, latestStrategies[0], err)
+		}
+	}
+}
+
+func BenchmarkGetAllLatestData(b *testing.B) {
+	repo := benchmarkRepo(b)
+
+	for _, strategy := range latestStrategies {
+		b.Run(strategy, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.getAllLatestData(strategy); err != nil {
+					b.Fatalf("error running %s strategy: %v", strategy, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareLatestQuotes(t *testing.T) {
+	at := time.Date(2025, time.June, 11, 10, 30, 0, 0, time.UTC)
+	quotes := func(quotes ...*entity.StockQuote) map[string]*entity.StockQuote {
+		bySymbol := make(map[string]*entity.StockQuote, len(quotes))
+		for _, quote := range quotes {
+			bySymbol[quote.Symbol] = quote
+		}
+		return bySymbol
+	}
+
+	tests := []struct {
+		name     string
+		expected map[string]*entity.StockQuote
+		actual   map[string]*entity.StockQuote
+		wantErr  bool
+	}{
+		{
+			name:     "same quotes",
+			expected: quotes(&entity.StockQuote{Symbol: "AAPL", Price: 1, Timestamp: at}),
+			actual:   quotes(&entity.StockQuote{Symbol: "AAPL", Price: 1, Timestamp: at}),
+		},
+		{
+			name:     "same instant in another location",
+			expected: quotes(&entity.StockQuote{Symbol: "AAPL", Price: 1, Timestamp: at}),
+			actual:   quotes(&entity.StockQuote{Symbol: "AAPL", Price: 1, Timestamp: at.Local()}),
+		},
+		{
+			name:     "missing symbol",
+			expected: quotes(&entity.StockQuote{Symbol: "AAPL", Timestamp: at}),
+			actual:   quotes(&entity.StockQuote{Symbol: "MSFT", Timestamp: at}),
+			wantErr:  true,
+		},
+		{
+			name:     "extra symbol",
+			expected: quotes(&entity.StockQuote{Symbol: "AAPL", Timestamp: at}),
+			actual:   quotes(&entity.StockQuote{Symbol: "AAPL", Timestamp: at}, &entity.StockQuote{Symbol: "MSFT", Timestamp: at}),
+			wantErr:  true,
+		},
+		{
+			name:     "different timestamp",
+			expected: quotes(&entity.StockQuote{Symbol: "AAPL", Timestamp: at}),
+			actual:   quotes(&entity.StockQuote{Symbol: "AAPL", Timestamp: at.Add(time.Minute)}),
+			wantErr:  true,
+		},
+		{
+			name:     "different price",
+			expected: quotes(&entity.StockQuote{Symbol: "AAPL", Price: 1, Timestamp: at}),
+			actual:   quotes(&entity.StockQuote{Symbol: "AAPL", Price: 2, Timestamp: at}),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := compareLatestQuotes(tt.expected, tt.actual); (err != nil) != tt.wantErr {
+				t.Errorf("compareLatestQuotes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// compareLatestQuotes returns an error describing the first quote that differs between two
+// GetAllLatestData results.
+func compareLatestQuotes(expected, actual map[string]*entity.StockQuote) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("got %d symbols, want %d", len(actual), len(expected))
+	}
+	for symbol, want := range expected {
+		got, ok := actual[symbol]
+		if !ok {
+			return fmt.Errorf("missing symbol %s", symbol)
+		}
+		if !got.Timestamp.Equal(want.Timestamp) {
+			return fmt.Errorf("timestamp of %s is %v, want %v", symbol, got.Timestamp, want.Timestamp)
+		}
+		gotCopy, wantCopy := *got, *want
+		gotCopy.Timestamp, wantCopy.Timestamp = time.Time{}, time.Time{}
+		if gotCopy != wantCopy {
+			return fmt.Errorf("quote of %s is %+v, want %+v", symbol, *got, *want)
+		}
+	}
+	return nil
+}
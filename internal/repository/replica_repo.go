@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"time"
+
+	"stock-app/internal/entity"
+)
+
+// ReplicaRepo wraps the StockRepo of the primary database, sending the serving reads to the
+// repository of a read replica instead. Writes, and the reads the fetchers use to decide what to
+// insert next, stay on the primary so replication lag can't cause gaps or duplicate inserts.
+type ReplicaRepo struct {
+	StockRepo
+	replica StockRepo
+}
+
+// NewReplicaRepo creates a new instance of ReplicaRepo around the primary and replica repositories.
+func NewReplicaRepo(primary, replica StockRepo) *ReplicaRepo {
+	return &ReplicaRepo{
+		StockRepo: primary,
+		replica:   replica,
+	}
+}
+
+// GetAllHistoricalData reads from the replica.
+func (repo *ReplicaRepo) GetAllHistoricalData(startTime time.Time, endTime time.Time, maxPoints int) (map[string][]*entity.StockQuote, error) {
+	return repo.replica.GetAllHistoricalData(startTime, endTime, maxPoints)
+}
+
+// GetHistoricalDataForSymbols reads from the replica.
+func (repo *ReplicaRepo) GetHistoricalDataForSymbols(symbols []string, startTime time.Time, endTime time.Time, maxPoints int) (map[string][]*entity.StockQuote, error) {
+	return repo.replica.GetHistoricalDataForSymbols(symbols, startTime, endTime, maxPoints)
+}
+
+// GetHistoricalData reads from the replica.
+func (repo *ReplicaRepo) GetHistoricalData(symbol string, startTime time.Time, endTime time.Time) ([]*entity.StockQuote, error) {
+	return repo.replica.GetHistoricalData(symbol, startTime, endTime)
+}
+
+// StreamHistoricalData reads from the replica.
+func (repo *ReplicaRepo) StreamHistoricalData(symbol string, startTime time.Time, endTime time.Time, fn func(*entity.StockQuote) error) error {
+	return repo.replica.StreamHistoricalData(symbol, startTime, endTime, fn)
+}
+
+// GetRecentQuotes reads from the replica.
+func (repo *ReplicaRepo) GetRecentQuotes(symbol string, n int) ([]*entity.StockQuote, error) {
+	return repo.replica.GetRecentQuotes(symbol, n)
+}
+
+// GetAllLatestData reads from the replica.
+func (repo *ReplicaRepo) GetAllLatestData() (map[string]*entity.StockQuote, error) {
+	return repo.replica.GetAllLatestData()
+}
+
+// GetAllLatestDataAsOf reads from the replica.
+func (repo *ReplicaRepo) GetAllLatestDataAsOf(asOf time.Time) (map[string]*entity.StockQuote, error) {
+	return repo.replica.GetAllLatestDataAsOf(asOf)
+}
+
+// GetLatestData reads from the replica.
+func (repo *ReplicaRepo) GetLatestData(symbol string) (*entity.StockQuote, error) {
+	return repo.replica.GetLatestData(symbol)
+}
+
+// GetLatestDataForSymbols reads from the replica.
+func (repo *ReplicaRepo) GetLatestDataForSymbols(symbols []string) (map[string]*entity.StockQuote, error) {
+	return repo.replica.GetLatestDataForSymbols(symbols)
+}
+
+// GetDailyData reads from the replica.
+func (repo *ReplicaRepo) GetDailyData(symbol string, startTime time.Time, endTime time.Time) ([]*entity.DailyBar, error) {
+	return repo.replica.GetDailyData(symbol, startTime, endTime)
+}
+
+// GetDataRange reads from the replica.
+func (repo *ReplicaRepo) GetDataRange(symbol string) (time.Time, time.Time, error) {
+	return repo.replica.GetDataRange(symbol)
+}
+
+// GetPrevClose reads from the replica.
+func (repo *ReplicaRepo) GetPrevClose(symbol string, asOf time.Time) (float64, time.Time, error) {
+	return repo.replica.GetPrevClose(symbol, asOf)
+}
+
+// GetReturnStats reads from the replica.
+func (repo *ReplicaRepo) GetReturnStats(symbol string, startTime time.Time, endTime time.Time) (*entity.ReturnStats, error) {
+	return repo.replica.GetReturnStats(symbol, startTime, endTime)
+}
+
+// GetOpeningGaps reads from the replica.
+func (repo *ReplicaRepo) GetOpeningGaps() ([]*entity.OpeningGap, error) {
+	return repo.replica.GetOpeningGaps()
+}
+
+// GetIntradayTimestamps reads from the replica.
+func (repo *ReplicaRepo) GetIntradayTimestamps(symbol string, startTime time.Time, endTime time.Time) ([]time.Time, error) {
+	return repo.replica.GetIntradayTimestamps(symbol, startTime, endTime)
+}
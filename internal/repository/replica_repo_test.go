@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"stock-app/internal/entity"
+)
+
+// callRecordingRepo records the names of the methods called on it.
+type callRecordingRepo struct {
+	StockRepo
+	calls []string
+}
+
+func (r *callRecordingRepo) InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) (int64, error) {
+	r.calls = append(r.calls, "InsertIntradayData")
+	return 0, nil
+}
+
+func (r *callRecordingRepo) InsertIntradayBars(bars []*entity.StockQuote, source string) (int64, error) {
+	r.calls = append(r.calls, "InsertIntradayBars")
+	return 0, nil
+}
+
+func (r *callRecordingRepo) InsertDailyData(symbol, date, open, high, low, close, volume string) error {
+	r.calls = append(r.calls, "InsertDailyData")
+	return nil
+}
+
+func (r *callRecordingRepo) GetLatestIntradayDataTimestamp(symbol string) (string, error) {
+	r.calls = append(r.calls, "GetLatestIntradayDataTimestamp")
+	return "", nil
+}
+
+func (r *callRecordingRepo) GetHistoricalData(symbol string, startTime time.Time, endTime time.Time) ([]*entity.StockQuote, error) {
+	r.calls = append(r.calls, "GetHistoricalData")
+	return nil, nil
+}
+
+func (r *callRecordingRepo) GetAllLatestData() (map[string]*entity.StockQuote, error) {
+	r.calls = append(r.calls, "GetAllLatestData")
+	return nil, nil
+}
+
+func (r *callRecordingRepo) GetLatestData(symbol string) (*entity.StockQuote, error) {
+	r.calls = append(r.calls, "GetLatestData")
+	return nil, nil
+}
+
+func TestReplicaRepo(t *testing.T) {
+	primary, replica := &callRecordingRepo{}, &callRecordingRepo{}
+	repo := NewReplicaRepo(primary, replica)
+
+	start := time.Date(2025, time.June, 9, 13, 30, 0, 0, time.UTC)
+	repo.GetHistoricalData("AAPL", start, start.Add(time.Hour))
+	repo.GetAllLatestData()
+	repo.GetLatestData("AAPL")
+	repo.InsertIntradayData("AAPL", "2025-06-09 09:31:00", "1", "1", "1", "1", "1")
+	repo.InsertIntradayBars([]*entity.StockQuote{{Symbol: "AAPL", Timestamp: start}}, SourceRealtime)
+	repo.InsertDailyData("AAPL", "2025-06-06", "1", "1", "1", "1", "1")
+	// Read by the fetchers to decide what to insert next, so it must not lag behind the writes
+	repo.GetLatestIntradayDataTimestamp("AAPL")
+
+	wantReplica := []string{"GetHistoricalData", "GetAllLatestData", "GetLatestData"}
+	wantPrimary := []string{"InsertIntradayData", "InsertIntradayBars", "InsertDailyData", "GetLatestIntradayDataTimestamp"}
+	if !reflect.DeepEqual(replica.calls, wantReplica) {
+		t.Errorf("replica calls = %v, want %v", replica.calls, wantReplica)
+	}
+	if !reflect.DeepEqual(primary.calls, wantPrimary) {
+		t.Errorf("primary calls = %v, want %v", primary.calls, wantPrimary)
+	}
+}
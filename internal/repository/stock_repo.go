@@ -1,55 +1,320 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"github.com/lib/pq"
+	"math"
 	"stock-app/internal/entity"
+	"stock-app/pkg/errors"
+	"stock-app/pkg/utils"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // StockRepo defines the interface for stock data operations.
 type StockRepo interface {
-	InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) error
+	InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) (int64, error)
 	InsertDailyData(symbol, date, open, high, low, close, volume string) error
-	GetAllHistoricalData(startTime time.Time, endTime time.Time) (map[string][]*entity.StockQuote, error)
+	InsertIntradayBars(bars []*entity.StockQuote, source string) (int64, error)
+	GetAllHistoricalData(startTime time.Time, endTime time.Time, maxPoints int) (map[string][]*entity.StockQuote, error)
+	GetHistoricalDataForSymbols(symbols []string, startTime time.Time, endTime time.Time, maxPoints int) (map[string][]*entity.StockQuote, error)
 	GetHistoricalData(symbol string, startTime time.Time, endTime time.Time) ([]*entity.StockQuote, error)
+	StreamHistoricalData(symbol string, startTime time.Time, endTime time.Time, fn func(*entity.StockQuote) error) error
+	GetRecentQuotes(symbol string, n int) ([]*entity.StockQuote, error)
 	GetAllLatestData() (map[string]*entity.StockQuote, error)
+	GetAllLatestDataAsOf(asOf time.Time) (map[string]*entity.StockQuote, error)
+	GetLatestData(symbol string) (*entity.StockQuote, error)
+	GetLatestDataForSymbols(symbols []string) (map[string]*entity.StockQuote, error)
+	GetDailyData(symbol string, startTime time.Time, endTime time.Time) ([]*entity.DailyBar, error)
+	GetDataRange(symbol string) (time.Time, time.Time, error)
+	GetIntradayDayCounts(symbol string, from, to time.Time) (map[string]int, error)
+	GetPrevClose(symbol string, asOf time.Time) (float64, time.Time, error)
+	GetReturnStats(symbol string, startTime time.Time, endTime time.Time) (*entity.ReturnStats, error)
+	GetOpeningGaps() ([]*entity.OpeningGap, error)
+	GetIntradayTimestamps(symbol string, startTime time.Time, endTime time.Time) ([]time.Time, error)
 	GetLatestIntradayDataTimestamp(symbol string) (string, error)
+	GetGlobalLatestTimestamp() (time.Time, error)
 	GetLatestDailyDataDate(symbol string) (string, error)
+	RecomputeChanges(since time.Time) (int64, error)
+	BackfillChanges() (int64, error)
+	DeleteSymbolData(symbol string) (int64, error)
+	Stats() (*entity.RepoStats, error)
 	CreateTables() error
+	Migrate() error
 }
 
+// Decimal scales of the NUMERIC price and volume columns. Volume columns are NUMERIC(20,2) so that
+// high-volume days fit; their values are read into float64, which is exact for integers up to 2^53.
+const (
+	intradayPriceScale = 6
+	dailyPriceScale    = 2
+	volumeScale        = 2
+)
+
 // StockRepoImpl provides methods for accessing and manipulating stock data in the database.
 type StockRepoImpl struct {
-	db *sql.DB
+	db                 *sql.DB
+	precomputedChanges bool
+	latestStrategy     string
+	intradayPrecedence string
 }
 
-// NewStockRepo creates a new instance of StockRepoImpl.
-func NewStockRepo(db *sql.DB) StockRepo {
-	return &StockRepoImpl{db: db}
+// NewStockRepo creates a new instance of StockRepoImpl. When precomputedChanges is true, historical
+// quotes read the change columns persisted on stock_intraday_data instead of joining the previous
+// daily close on every query. latestStrategy selects the GetAllLatestData query, one of
+// LatestStrategyCTE (the default) or LatestStrategyDistinctOn. intradayPrecedence decides which source
+// keeps an intraday minute written by both the API and the real-time writer, one of the Precedence
+// constants.
+func NewStockRepo(db *sql.DB, precomputedChanges bool, latestStrategy string, intradayPrecedence string) StockRepo {
+	return &StockRepoImpl{
+		db:                 db,
+		precomputedChanges: precomputedChanges,
+		latestStrategy:     latestStrategy,
+		intradayPrecedence: intradayPrecedence,
+	}
 }
 
-// InsertIntradayData inserts intraday stock data into the database.
-func (repo *StockRepoImpl) InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) error {
-	query := `
+// WithTx runs fn in a transaction, committing it when fn returns nil and rolling it back when fn
+// returns an error or panics, so multi-statement operations apply all of their changes or none.
+// The error of fn is returned as is.
+func (repo *StockRepoImpl) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			fmt.Printf("Failed to roll back transaction: %v\n", rbErr)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// intradayUpsertQuery inserts or updates an intraday bar without the precomputed change columns, so
+// it works on databases that haven't been migrated to them.
+const intradayUpsertQuery = `
         INSERT INTO stock_intraday_data (symbol, timestamp, open, high, low, close, volume)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        VALUES ($1, $2::timestamp, $3::numeric, $4::numeric, $5::numeric, $6::numeric, $7::numeric)` + intradayUpsertSet + `;`
+
+// precomputedUpsertQuery is intradayUpsertQuery also computing the bar's change against the most
+// recent daily close strictly before the bar's date. The change columns stay NULL until that close
+// exists and are filled in later by RecomputeChanges.
+const precomputedUpsertQuery = `
+        INSERT INTO stock_intraday_data (symbol, timestamp, open, high, low, close, volume, prev_close, change, change_percentage)` +
+	precomputedUpsertSelect + precomputedUpsertFrom + intradayUpsertSet + precomputedUpsertSet + `;`
+
+// sourcedUpsertQuery is intradayUpsertQuery also recording the source of the bar, used when a
+// precedence between sources applies.
+const sourcedUpsertQuery = `
+        INSERT INTO stock_intraday_data (symbol, timestamp, open, high, low, close, volume, source)
+        VALUES ($1, $2::timestamp, $3::numeric, $4::numeric, $5::numeric, $6::numeric, $7::numeric, $8::text)` +
+	intradayUpsertSet + sourceUpsertSet + `;`
+
+// sourcedPrecomputedUpsertQuery is precomputedUpsertQuery also recording the source of the bar.
+const sourcedPrecomputedUpsertQuery = `
+        INSERT INTO stock_intraday_data (symbol, timestamp, open, high, low, close, volume, prev_close, change, change_percentage, source)` +
+	precomputedUpsertSelect + `,
+            $8::text` + precomputedUpsertFrom + intradayUpsertSet + precomputedUpsertSet + sourceUpsertSet + `;`
+
+// precomputedUpsertSelect selects the values of an intraday bar along with its change against the
+// previous daily close of precomputedUpsertFrom.
+const precomputedUpsertSelect = `
+        SELECT $1, $2::timestamp, $3::numeric, $4::numeric, $5::numeric, $6::numeric, $7::numeric,
+            pdd.prev_close,
+            $6::numeric - pdd.prev_close,
+            COALESCE(($6::numeric - pdd.prev_close) / NULLIF(pdd.prev_close, 0) * 100, 0)`
+
+// precomputedUpsertFrom looks up the most recent daily close strictly before the bar's date.
+const precomputedUpsertFrom = `
+        FROM (
+            SELECT (
+                SELECT sdd.close
+                FROM stock_daily_data sdd
+                WHERE sdd.symbol = $1
+                AND sdd.date < DATE($2::timestamp)
+                ORDER BY sdd.date DESC
+                LIMIT 1
+            ) AS prev_close
+        ) pdd`
+
+// intradayUpsertSet overwrites the prices and volume of an existing intraday bar.
+const intradayUpsertSet = `
         ON CONFLICT (symbol, timestamp) DO UPDATE 
         SET open = EXCLUDED.open, 
             high = EXCLUDED.high, 
             low = EXCLUDED.low, 
             close = EXCLUDED.close, 
-            volume = EXCLUDED.volume;`
+            volume = EXCLUDED.volume`
+
+// precomputedUpsertSet also overwrites the change columns.
+const precomputedUpsertSet = `,
+            prev_close = EXCLUDED.prev_close,
+            change = EXCLUDED.change,
+            change_percentage = EXCLUDED.change_percentage`
+
+// sourceUpsertSet also overwrites the source, but only updates a row of another source when the
+// existing source is unrecorded or $9, the source preferred for the bar's minute, is the new one.
+// Rows kept this way aren't counted as written.
+const sourceUpsertSet = `,
+            source = EXCLUDED.source
+        WHERE stock_intraday_data.source IS NULL
+            OR stock_intraday_data.source = EXCLUDED.source
+            OR EXCLUDED.source = $9::text`
+
+// precomputedQuoteColumns selects an intraday row's persisted quote fields in the order scanned into
+// entity.StockQuote, falling back to the live_prev_close of livePrevCloseJoin for rows whose change
+// columns haven't been computed yet.
+const precomputedQuoteColumns = `symbol, close,
+            COALESCE(change, close - live_prev_close),
+            COALESCE(change_percentage, COALESCE((close - live_prev_close) / NULLIF(live_prev_close, 0) * 100, 0)),
+            high, low, open,
+            COALESCE(prev_close, live_prev_close),
+            volume, timestamp`
+
+// livePrevCloseJoin joins the previous daily close of the intraday rows aliased sid as live_prev_close,
+// only looking it up for rows whose persisted prev_close is NULL, e.g. rows written before the change
+// columns were enabled and not yet backfilled.
+const livePrevCloseJoin = `
+        LEFT JOIN LATERAL (
+            SELECT sdd.close AS live_prev_close
+            FROM stock_daily_data sdd
+            WHERE sid.prev_close IS NULL
+            AND sdd.symbol = sid.symbol
+            AND sdd.date < DATE(sid.timestamp)
+            ORDER BY sdd.date DESC
+            LIMIT 1
+        ) lpc ON TRUE`
 
-	_, err := repo.db.Exec(query, symbol, timestamp, open, high, low, close, volume)
+// upsertQuery returns the intraday upsert query, computing the change columns when they are enabled
+// and recording the source of the bar when a precedence between sources applies. Without one, the
+// source column isn't needed, so the upsert works on databases that haven't been migrated to it.
+func (repo *StockRepoImpl) upsertQuery() string {
+	switch {
+	case repo.precomputedChanges && recordsSource(repo.intradayPrecedence):
+		return sourcedPrecomputedUpsertQuery
+	case repo.precomputedChanges:
+		return precomputedUpsertQuery
+	case recordsSource(repo.intradayPrecedence):
+		return sourcedUpsertQuery
+	default:
+		return intradayUpsertQuery
+	}
+}
+
+// upsertArgs returns the arguments of the upsert query for an intraday bar of the given source at the
+// timestamp, given as an exchange wall clock time.
+func (repo *StockRepoImpl) upsertArgs(symbol string, timestamp time.Time, values []interface{}, source string) []interface{} {
+	args := append([]interface{}{symbol, timestamp.Format("2006-01-02 15:04:05")}, values...)
+	if recordsSource(repo.intradayPrecedence) {
+		args = append(args, source, preferredSource(repo.intradayPrecedence, symbol, timestamp))
+	}
+	return args
+}
+
+// InsertIntradayData inserts intraday stock data fetched from the time series API into the database.
+// It returns the number of rows written, which is zero when the minute is kept from a preferred source.
+func (repo *StockRepoImpl) InsertIntradayData(symbol, timestamp, open, high, low, close, volume string) (int64, error) {
+	symbol = utils.NormalizeSymbol(symbol)
+	values, err := formatOHLCV(symbol, intradayPriceScale, open, high, low, close, volume)
 	if err != nil {
-		return fmt.Errorf("error inserting intraday data for %s: %w", symbol, err)
+		return 0, fmt.Errorf("invalid intraday data for %s at %s: %w", symbol, timestamp, err)
 	}
-	return nil
+	at, err := time.Parse("2006-01-02 15:04:05", timestamp)
+	if err != nil {
+		return 0, fmt.Errorf("invalid intraday data for %s at %s: %w", symbol, timestamp, err)
+	}
+
+	result, err := repo.db.Exec(repo.upsertQuery(), repo.upsertArgs(symbol, at, values, SourceAPI)...)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting intraday data for %s: %w", symbol, err)
+	}
+	return result.RowsAffected()
+}
+
+// InsertIntradayBars inserts a batch of intraday bars of the given source into the database in a
+// single transaction. It returns the number of rows written, leaving out the minutes kept from a
+// preferred source.
+func (repo *StockRepoImpl) InsertIntradayBars(bars []*entity.StockQuote, source string) (int64, error) {
+	var written int64
+	err := repo.WithTx(context.Background(), func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(repo.upsertQuery())
+		if err != nil {
+			return fmt.Errorf("error preparing intraday insert: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, bar := range bars {
+			symbol := utils.NormalizeSymbol(bar.Symbol)
+			values := []interface{}{
+				utils.FormatPrice(bar.OpenPrice, intradayPriceScale),
+				utils.FormatPrice(bar.HighPrice, intradayPriceScale),
+				utils.FormatPrice(bar.LowPrice, intradayPriceScale),
+				utils.FormatPrice(bar.Price, intradayPriceScale),
+				utils.FormatPrice(bar.Volume, volumeScale),
+			}
+			result, err := stmt.Exec(repo.upsertArgs(symbol, bar.Timestamp, values, source)...)
+			if err != nil {
+				return fmt.Errorf("error inserting intraday bar for %s: %w", bar.Symbol, err)
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("error counting intraday bars written for %s: %w", bar.Symbol, err)
+			}
+			written += rows
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// ohlcvFields names the values passed to formatOHLCV, in order.
+var ohlcvFields = []string{"open", "high", "low", "close", "volume"}
+
+// formatOHLCV formats the prices to priceScale decimals and the volume to volumeScale decimals.
+// It returns a *errors.ValidationError naming the field and symbol when a price is empty or not a
+// finite number, since the price columns are NOT NULL. An empty volume is stored as NULL.
+func formatOHLCV(symbol string, priceScale int, open, high, low, close, volume string) ([]interface{}, error) {
+	values := make([]interface{}, 0, 5)
+	for i, value := range []string{open, high, low, close, volume} {
+		value = strings.TrimSpace(value)
+		scale := priceScale
+		if i == 4 {
+			if value == "" {
+				values = append(values, nil)
+				continue
+			}
+			scale = volumeScale
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, &errors.ValidationError{Field: fmt.Sprintf("%s of %s (got %q)", ohlcvFields[i], symbol, value)}
+		}
+		values = append(values, utils.FormatPrice(v, scale))
+	}
+	return values, nil
 }
 
 // InsertDailyData inserts daily stock data into the database.
 func (repo *StockRepoImpl) InsertDailyData(symbol, date, open, high, low, close, volume string) error {
+	symbol = utils.NormalizeSymbol(symbol)
 	ts, err := time.Parse("2006-01-02", date)
 	if err != nil {
 		return fmt.Errorf("error parsing date: %w", err)
@@ -65,16 +330,38 @@ func (repo *StockRepoImpl) InsertDailyData(symbol, date, open, high, low, close,
             close = EXCLUDED.close, 
             volume = EXCLUDED.volume;`
 
-	_, err = repo.db.Exec(query, symbol, ts, open, high, low, close, volume)
+	values, err := formatOHLCV(symbol, dailyPriceScale, open, high, low, close, volume)
+	if err != nil {
+		return fmt.Errorf("invalid daily data for %s on %s: %w", symbol, date, err)
+	}
+
+	_, err = repo.db.Exec(query, append([]interface{}{symbol, ts}, values...)...)
 	if err != nil {
 		return fmt.Errorf("error inserting daily data for %s: %w", symbol, err)
 	}
 	return nil
 }
 
-func (repo *StockRepoImpl) GetAllHistoricalData(startTime time.Time, endTime time.Time) (map[string][]*entity.StockQuote, error) {
+// GetAllHistoricalData retrieves the intraday quotes of all symbols within a time range. When
+// maxPoints is positive, only the most recent maxPoints quotes of each symbol are returned.
+func (repo *StockRepoImpl) GetAllHistoricalData(startTime time.Time, endTime time.Time, maxPoints int) (map[string][]*entity.StockQuote, error) {
+	return repo.getHistoricalData(nil, startTime, endTime, maxPoints)
+}
+
+// GetHistoricalDataForSymbols retrieves the intraday quotes of the given symbols within a time range
+// like GetAllHistoricalData, in a single query. Symbols without data in the range are left out.
+func (repo *StockRepoImpl) GetHistoricalDataForSymbols(symbols []string, startTime time.Time, endTime time.Time, maxPoints int) (map[string][]*entity.StockQuote, error) {
+	if len(symbols) == 0 {
+		return map[string][]*entity.StockQuote{}, nil
+	}
+	return repo.getHistoricalData(symbols, startTime, endTime, maxPoints)
+}
+
+// getHistoricalData retrieves the intraday quotes of the given symbols, or of all symbols when symbols
+// is nil, within a time range, capped at the most recent maxPoints quotes of each when positive.
+func (repo *StockRepoImpl) getHistoricalData(symbols []string, startTime time.Time, endTime time.Time, maxPoints int) (map[string][]*entity.StockQuote, error) {
 	query := `
-        WITH intraday_data AS (
+        WITH ranked_data AS (
             SELECT 
                 symbol,
                 timestamp,
@@ -83,23 +370,22 @@ func (repo *StockRepoImpl) GetAllHistoricalData(startTime time.Time, endTime tim
                 low AS low_price,
                 close AS price,
                 volume,
-                DATE(timestamp) AS intraday_date
+                DATE(timestamp) AS intraday_date,
+                ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY timestamp DESC) AS rn
             FROM stock_intraday_data
             WHERE timestamp BETWEEN $1 AND $2
+            AND ($4::text[] IS NULL OR symbol = ANY($4))
         ),
-        previous_day_data AS (
-            SELECT 
-                sdd.symbol,
-                sdd.date AS prev_date,
-                sdd.close AS prev_close
-            FROM stock_daily_data sdd
+        intraday_data AS (
+            SELECT * FROM ranked_data
+            WHERE $3 <= 0 OR rn <= $3
         )
 
         SELECT
             sid.symbol,
             sid.price,
             (sid.price - pdd.prev_close) AS change,
-            ((sid.price - pdd.prev_close) / pdd.prev_close * 100) AS change_percentage,
+            COALESCE((sid.price - pdd.prev_close) / NULLIF(pdd.prev_close, 0) * 100, 0) AS change_percentage,
             sid.high_price,
             sid.low_price,
             sid.open_price,
@@ -107,56 +393,46 @@ func (repo *StockRepoImpl) GetAllHistoricalData(startTime time.Time, endTime tim
             sid.volume,
             sid.timestamp
         FROM intraday_data sid
-        JOIN previous_day_data pdd
-        ON sid.symbol = pdd.symbol 
-        AND pdd.prev_date = sid.intraday_date - INTERVAL '1 day';
+        LEFT JOIN LATERAL (
+            -- Most recent trading day strictly before the intraday date, so weekends and holidays are skipped
+            SELECT sdd.close AS prev_close
+            FROM stock_daily_data sdd
+            WHERE sdd.symbol = sid.symbol
+            AND sdd.date < sid.intraday_date
+            ORDER BY sdd.date DESC
+            LIMIT 1
+        ) pdd ON TRUE;
 
     `
+	if repo.precomputedChanges {
+		query = `
+        SELECT ` + precomputedQuoteColumns + `
+        FROM (
+            SELECT * FROM (
+                SELECT *, ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY timestamp DESC) AS rn
+                FROM stock_intraday_data
+                WHERE timestamp BETWEEN $1 AND $2
+                AND ($4::text[] IS NULL OR symbol = ANY($4))
+            ) ranked_data
+            WHERE $3 <= 0 OR rn <= $3
+        ) sid` + livePrevCloseJoin + `;`
+	}
 
-	rows, err := repo.db.Query(query, startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"))
+	rows, err := repo.db.Query(query, startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"), maxPoints, pq.Array(symbols))
 	if err != nil {
 		return nil, fmt.Errorf("error querying latest intraday data: %w", err)
 	}
 	defer rows.Close()
 
-	// Map to store stock symbol to its list of StockQuote objects
-	stockQuotesMap := make(map[string][]*entity.StockQuote)
-
-	for rows.Next() {
-		var quote entity.StockQuote
-		err := rows.Scan(
-			&quote.Symbol,
-			&quote.Price,
-			&quote.Change,
-			&quote.ChangePercentage,
-			&quote.HighPrice,
-			&quote.LowPrice,
-			&quote.OpenPrice,
-			&quote.PrevClose,
-			&quote.Volume,
-			&quote.Timestamp,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning row: %w", err)
-		}
-
-		// Append the quote to the corresponding symbol in the map
-		stockQuotesMap[quote.Symbol] = append(stockQuotesMap[quote.Symbol], &quote)
-	}
-
-	// Check for errors after the loop
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over rows: %w", err)
-	}
-	// print length of each symbol
-	for k, v := range stockQuotesMap {
-		fmt.Printf("Symbol: %s, Length: %d\n", k, len(v))
+	stockQuotesMap, err := groupQuotes(rows)
+	if err != nil {
+		return nil, err
 	}
 	return stockQuotesMap, nil
 }
 
-func (repo *StockRepoImpl) GetHistoricalData(symbol string, startTime time.Time, endTime time.Time) ([]*entity.StockQuote, error) {
-    query := `
+// historicalDataQuery selects the intraday quotes of a symbol within a time range, ordered by time.
+const historicalDataQuery = `
         WITH intraday_data AS (
             SELECT 
                 symbol,
@@ -170,20 +446,13 @@ func (repo *StockRepoImpl) GetHistoricalData(symbol string, startTime time.Time,
             FROM stock_intraday_data
             WHERE timestamp BETWEEN $1 AND $2
             AND symbol = $3
-        ),
-        previous_day_data AS (
-            SELECT 
-                sdd.symbol,
-                sdd.date AS prev_date,
-                sdd.close AS prev_close
-            FROM stock_daily_data sdd
         )
 
         SELECT
             sid.symbol,
             sid.price,
             (sid.price - pdd.prev_close) AS change,
-            ((sid.price - pdd.prev_close) / pdd.prev_close * 100) AS change_percentage,
+            COALESCE((sid.price - pdd.prev_close) / NULLIF(pdd.prev_close, 0) * 100, 0) AS change_percentage,
             sid.high_price,
             sid.low_price,
             sid.open_price,
@@ -191,52 +460,192 @@ func (repo *StockRepoImpl) GetHistoricalData(symbol string, startTime time.Time,
             sid.volume,
             sid.timestamp
         FROM intraday_data sid
-        JOIN previous_day_data pdd
-        ON pdd.prev_date = sid.intraday_date - INTERVAL '1 day';
+        LEFT JOIN LATERAL (
+            -- Most recent trading day strictly before the intraday date, so weekends and holidays are skipped
+            SELECT sdd.close AS prev_close
+            FROM stock_daily_data sdd
+            WHERE sdd.symbol = sid.symbol
+            AND sdd.date < sid.intraday_date
+            ORDER BY sdd.date DESC
+            LIMIT 1
+        ) pdd ON TRUE
+        ORDER BY sid.timestamp;
     `
 
+// precomputedHistoricalDataQuery is historicalDataQuery reading the persisted change columns.
+const precomputedHistoricalDataQuery = `
+        SELECT ` + precomputedQuoteColumns + `
+        FROM stock_intraday_data sid` + livePrevCloseJoin + `
+        WHERE timestamp BETWEEN $1 AND $2
+        AND symbol = $3
+        ORDER BY timestamp;`
+
+// GetHistoricalData retrieves the intraday quotes of a symbol within a time range.
+// It returns a *errors.NotFoundError if there is no data in the range.
+func (repo *StockRepoImpl) GetHistoricalData(symbol string, startTime time.Time, endTime time.Time) ([]*entity.StockQuote, error) {
+    // Prepare slice to hold results
+    var stockQuotes []*entity.StockQuote
+
+    err := repo.StreamHistoricalData(symbol, startTime, endTime, func(quote *entity.StockQuote) error {
+        stockQuotes = append(stockQuotes, quote)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    if len(stockQuotes) == 0 {
+        return nil, &errors.NotFoundError{Resource: fmt.Sprintf("historical data for %s", symbol)}
+    }
+    return stockQuotes, nil
+}
+
+// StreamHistoricalData scans the intraday quotes of a symbol within a time range in time order,
+// passing each one to fn as it is read so the full result never has to be held in memory.
+// Iteration stops at the first error returned by fn.
+func (repo *StockRepoImpl) StreamHistoricalData(symbol string, startTime time.Time, endTime time.Time, fn func(*entity.StockQuote) error) error {
+    query := historicalDataQuery
+    if repo.precomputedChanges {
+        query = precomputedHistoricalDataQuery
+    }
+
     // Execute the query
     rows, err := repo.db.Query(query, startTime, endTime, symbol)
     if err != nil {
-        return nil, fmt.Errorf("error querying historical intraday data for %s: %w", symbol, err)
+        return fmt.Errorf("error querying historical intraday data for %s: %w", symbol, err)
     }
     defer rows.Close()
 
-    // Prepare slice to hold results
-    var stockQuotes []*entity.StockQuote
-
     // Iterate over rows
     for rows.Next() {
-        var quote entity.StockQuote
-        if err := rows.Scan(
-            &quote.Symbol,
-            &quote.Price,
-            &quote.Change,
-            &quote.ChangePercentage,
-            &quote.HighPrice,
-            &quote.LowPrice,
-            &quote.OpenPrice,
-            &quote.PrevClose,
-            &quote.Volume,
-            &quote.Timestamp,
-        ); err != nil {
-            return nil, fmt.Errorf("error scanning row for symbol %s: %w", symbol, err)
+        quote, err := scanQuote(rows)
+        if err != nil {
+            return fmt.Errorf("error scanning row for symbol %s: %w", symbol, err)
         }
 
-        stockQuotes = append(stockQuotes, &quote)
+        if err := fn(quote); err != nil {
+            return err
+        }
     }
 
     // Check if there was an error during row iteration
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("error iterating over rows for symbol %s: %w", symbol, err)
+    }
+    return nil
+}
+
+// GetRecentQuotes retrieves the n most recent intraday quotes of a symbol in chronological order.
+// It returns a *errors.NotFoundError if the symbol has no data.
+func (repo *StockRepoImpl) GetRecentQuotes(symbol string, n int) ([]*entity.StockQuote, error) {
+    query := `
+        WITH intraday_data AS (
+            SELECT 
+                symbol,
+                timestamp,
+                open AS open_price,
+                high AS high_price,
+                low AS low_price,
+                close AS price,
+                volume,
+                DATE(timestamp) AS intraday_date
+            FROM stock_intraday_data
+            WHERE symbol = $1
+            ORDER BY timestamp DESC
+            LIMIT $2
+        )
+
+        SELECT
+            sid.symbol,
+            sid.price,
+            (sid.price - pdd.prev_close) AS change,
+            COALESCE((sid.price - pdd.prev_close) / NULLIF(pdd.prev_close, 0) * 100, 0) AS change_percentage,
+            sid.high_price,
+            sid.low_price,
+            sid.open_price,
+            pdd.prev_close,
+            sid.volume,
+            sid.timestamp
+        FROM intraday_data sid
+        LEFT JOIN LATERAL (
+            SELECT sdd.close AS prev_close
+            FROM stock_daily_data sdd
+            WHERE sdd.symbol = sid.symbol
+            AND sdd.date < sid.intraday_date
+            ORDER BY sdd.date DESC
+            LIMIT 1
+        ) pdd ON TRUE
+        ORDER BY sid.timestamp DESC;
+    `
+    if repo.precomputedChanges {
+        query = `
+        SELECT ` + precomputedQuoteColumns + `
+        FROM stock_intraday_data sid` + livePrevCloseJoin + `
+        WHERE symbol = $1
+        ORDER BY timestamp DESC
+        LIMIT $2;`
+    }
+
+    rows, err := repo.db.Query(query, symbol, n)
+    if err != nil {
+        return nil, fmt.Errorf("error querying recent intraday data for %s: %w", symbol, err)
+    }
+    defer rows.Close()
+
+    var stockQuotes []*entity.StockQuote
+    for rows.Next() {
+        quote, err := scanQuote(rows)
+        if err != nil {
+            return nil, fmt.Errorf("error scanning row for symbol %s: %w", symbol, err)
+        }
+        stockQuotes = append(stockQuotes, quote)
+    }
     if err := rows.Err(); err != nil {
         return nil, fmt.Errorf("error iterating over rows for symbol %s: %w", symbol, err)
     }
 
-    fmt.Printf("Fetched %d stock quotes for symbol: %s\n", len(stockQuotes), symbol)
+    if len(stockQuotes) == 0 {
+        return nil, &errors.NotFoundError{Resource: fmt.Sprintf("intraday data for %s", symbol)}
+    }
+
+    // Reverse the newest-first rows into chronological order
+    for i, j := 0, len(stockQuotes)-1; i < j; i, j = i+1, j-1 {
+        stockQuotes[i], stockQuotes[j] = stockQuotes[j], stockQuotes[i]
+    }
     return stockQuotes, nil
 }
 
-func (repo *StockRepoImpl) GetAllLatestData() (map[string]*entity.StockQuote, error) {
-	query := `
+// Strategies of the query selecting the latest intraday quote of every symbol, selected by
+// LATEST_QUERY_STRATEGY. Both return the same rows; which is faster depends on the data.
+const (
+	// LatestStrategyCTE matches each symbol's MAX(timestamp) and MAX(date) with grouped subqueries.
+	LatestStrategyCTE = "cte"
+	// LatestStrategyDistinctOn picks the first row of each symbol with DISTINCT ON, which can walk
+	// the (symbol, timestamp) primary key index instead of aggregating.
+	LatestStrategyDistinctOn = "distinct_on"
+)
+
+// allLatestDataColumns selects the latest quotes from the latest_intraday_data and previous_day_data CTEs.
+const allLatestDataColumns = `
+        SELECT
+            lid.symbol,
+            lid.price,
+            (lid.price - pdd.prev_close) AS change,
+            COALESCE((lid.price - pdd.prev_close) / NULLIF(pdd.prev_close, 0) * 100, 0) AS change_percentage,
+            lid.high_price,
+            lid.low_price,
+            lid.open_price,
+            pdd.prev_close,
+            lid.volume,
+            lid.timestamp
+        FROM latest_intraday_data lid
+        LEFT JOIN previous_day_data pdd
+        ON lid.symbol = pdd.symbol;
+`
+
+// allLatestDataQueries holds the latest quotes query of each strategy.
+var allLatestDataQueries = map[string]string{
+	LatestStrategyCTE: `
         WITH latest_intraday_data AS (
             SELECT 
                 symbol,
@@ -268,12 +677,220 @@ func (repo *StockRepoImpl) GetAllLatestData() (map[string]*entity.StockQuote, er
             ) prev_data
             ON sdd.symbol = prev_data.symbol AND sdd.date = prev_data.max_date
         )
+` + allLatestDataColumns,
+	LatestStrategyDistinctOn: `
+        WITH latest_intraday_data AS (
+            SELECT DISTINCT ON (symbol)
+                symbol,
+                timestamp,
+                open AS open_price,
+                high AS high_price,
+                low AS low_price,
+                close AS price,
+                volume
+            FROM stock_intraday_data
+            ORDER BY symbol, timestamp DESC
+        ),
+        previous_day_data AS (
+            SELECT DISTINCT ON (symbol)
+                symbol,
+                close AS prev_close
+            FROM stock_daily_data
+            WHERE date < CURRENT_DATE
+            ORDER BY symbol, date DESC
+        )
+` + allLatestDataColumns,
+}
+
+// allLatestDataAsOfQuery selects the most recent intraday quote of every symbol at or before its cutoff,
+// with its change against the daily close before the quote's own date rather than the current date.
+// The symbols of $2 are cut off at the matching wall clock times of $3, the others at $1.
+const allLatestDataAsOfQuery = `
+        WITH latest_intraday_data AS (
+            SELECT 
+                symbol,
+                timestamp,
+                open AS open_price,
+                high AS high_price,
+                low AS low_price,
+                close AS price,
+                volume
+            FROM stock_intraday_data
+            WHERE (symbol, timestamp) IN (
+                SELECT sid.symbol, MAX(sid.timestamp)
+                FROM stock_intraday_data sid
+                LEFT JOIN UNNEST($2::text[], $3::timestamp[]) AS cutoffs(symbol, cutoff) ON cutoffs.symbol = sid.symbol
+                WHERE sid.timestamp <= COALESCE(cutoffs.cutoff, $1::timestamp)
+                GROUP BY sid.symbol
+            )
+        ),
+        previous_day_data AS (
+            SELECT
+                lid.symbol,
+                (
+                    SELECT sdd.close
+                    FROM stock_daily_data sdd
+                    WHERE sdd.symbol = lid.symbol
+                    AND sdd.date < DATE(lid.timestamp)
+                    ORDER BY sdd.date DESC
+                    LIMIT 1
+                ) AS prev_close
+            FROM latest_intraday_data lid
+        )
+` + allLatestDataColumns
+
+// GetAllLatestData retrieves the latest intraday quote of every symbol with the configured strategy.
+func (repo *StockRepoImpl) GetAllLatestData() (map[string]*entity.StockQuote, error) {
+	return repo.getAllLatestData(repo.latestStrategy)
+}
+
+// GetAllLatestDataAsOf retrieves the most recent intraday quote of every symbol at or before asOf, for
+// point-in-time reads. Symbols without data by then are left out.
+func (repo *StockRepoImpl) GetAllLatestDataAsOf(asOf time.Time) (map[string]*entity.StockQuote, error) {
+	defaultCutoff, symbols, cutoffs := asOfCutoffs(asOf)
+	return repo.queryLatestData(allLatestDataAsOfQuery, defaultCutoff, pq.Array(symbols), pq.Array(cutoffs))
+}
+
+// asOfCutoffs returns asOf as the wall clock time of the exchange of each symbol, since intraday
+// timestamps are stored as exchange wall clock times: the US one for symbols without a configured
+// exchange, followed by the symbols with one and their cutoffs.
+func asOfCutoffs(asOf time.Time) (string, []string, []string) {
+	calendars := utils.SymbolCalendars()
+	symbols := make([]string, 0, len(calendars))
+	cutoffs := make([]string, 0, len(calendars))
+	for symbol, calendar := range calendars {
+		symbols = append(symbols, symbol)
+		cutoffs = append(cutoffs, calendar.WallClock(asOf).Format("2006-01-02 15:04:05"))
+	}
+	return utils.USMarket.WallClock(asOf).Format("2006-01-02 15:04:05"), symbols, cutoffs
+}
+
+// getAllLatestData retrieves the latest intraday quote of every symbol with the given strategy.
+func (repo *StockRepoImpl) getAllLatestData(strategy string) (map[string]*entity.StockQuote, error) {
+	query, ok := allLatestDataQueries[strategy]
+	if !ok {
+		query = allLatestDataQueries[LatestStrategyCTE]
+	}
+	return repo.queryLatestData(query)
+}
+
+// queryLatestData runs a query selecting the quote columns read by scanQuote and returns its quotes by symbol.
+func (repo *StockRepoImpl) queryLatestData(query string, args ...interface{}) (map[string]*entity.StockQuote, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying latest intraday data: %w", err)
+	}
+	defer rows.Close()
+
+	latestQuotesMap := make(map[string]*entity.StockQuote)
+
+	for rows.Next() {
+		quote, err := scanQuote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		latestQuotesMap[quote.Symbol] = quote
+	}
+
+	// Check for errors after the loop
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return latestQuotesMap, nil
+}
+
+// rowScanner is the Scan method shared by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// rowIterator is the part of *sql.Rows that reading a result set needs.
+type rowIterator interface {
+	rowScanner
+	Next() bool
+	Err() error
+}
+
+// groupQuotes scans every row of the quote columns into a new quote, keeping the quotes of each
+// symbol in row order.
+func groupQuotes(rows rowIterator) (map[string][]*entity.StockQuote, error) {
+	// Map to store stock symbol to its list of StockQuote objects
+	stockQuotesMap := make(map[string][]*entity.StockQuote)
+
+	for rows.Next() {
+		// scanQuote allocates every quote, so each appended pointer refers to its own row, never the last one scanned
+		quote, err := scanQuote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		// Append the quote to the corresponding symbol in the map
+		stockQuotesMap[quote.Symbol] = append(stockQuotesMap[quote.Symbol], quote)
+	}
+
+	// Check for errors after the loop
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return stockQuotesMap, nil
+}
+
+// scanQuote scans a row of the quote columns: symbol, price, change, change percentage, high, low,
+// open, previous close, volume and timestamp. Quotes of symbols without daily history have no
+// previous close to compute changes against, so a NULL previous close marks them PrevCloseMissing
+// with zero changes.
+func scanQuote(row rowScanner) (*entity.StockQuote, error) {
+	var quote entity.StockQuote
+	var change, changePercentage, prevClose sql.NullFloat64
+	err := row.Scan(
+		&quote.Symbol,
+		&quote.Price,
+		&change,
+		&changePercentage,
+		&quote.HighPrice,
+		&quote.LowPrice,
+		&quote.OpenPrice,
+		&prevClose,
+		&quote.Volume,
+		&quote.Timestamp,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	quote.PrevCloseMissing = !prevClose.Valid
+	quote.Change = change.Float64
+	quote.ChangePercentage = changePercentage.Float64
+	quote.PrevClose = prevClose.Float64
+	return &quote, nil
+}
+
+// GetLatestData retrieves the most recent intraday quote for a symbol.
+// It returns a *errors.NotFoundError if the symbol has no intraday data.
+func (repo *StockRepoImpl) GetLatestData(symbol string) (*entity.StockQuote, error) {
+	query := `
+        WITH latest_intraday_data AS (
+            SELECT 
+                symbol,
+                timestamp,
+                open AS open_price,
+                high AS high_price,
+                low AS low_price,
+                close AS price,
+                volume,
+                DATE(timestamp) AS intraday_date
+            FROM stock_intraday_data
+            WHERE symbol = $1
+            ORDER BY timestamp DESC
+            LIMIT 1
+        )
 
         SELECT
             lid.symbol,
             lid.price,
             (lid.price - pdd.prev_close) AS change,
-            ((lid.price - pdd.prev_close) / pdd.prev_close * 100) AS change_percentage,
+            COALESCE((lid.price - pdd.prev_close) / NULLIF(pdd.prev_close, 0) * 100, 0) AS change_percentage,
             lid.high_price,
             lid.low_price,
             lid.open_price,
@@ -281,47 +898,326 @@ func (repo *StockRepoImpl) GetAllLatestData() (map[string]*entity.StockQuote, er
             lid.volume,
             lid.timestamp
         FROM latest_intraday_data lid
-        JOIN previous_day_data pdd
-        ON lid.symbol = pdd.symbol;
-`
+        LEFT JOIN LATERAL (
+            SELECT sdd.close AS prev_close
+            FROM stock_daily_data sdd
+            WHERE sdd.symbol = lid.symbol
+            AND sdd.date < lid.intraday_date
+            ORDER BY sdd.date DESC
+            LIMIT 1
+        ) pdd ON TRUE;
+    `
+
+	quote, err := scanQuote(repo.db.QueryRow(query, symbol))
+	if err == sql.ErrNoRows {
+		return nil, &errors.NotFoundError{Resource: fmt.Sprintf("latest data for %s", symbol)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying latest data for %s: %w", symbol, err)
+	}
+	return quote, nil
+}
+
+// latestDataForSymbolsQuery selects the most recent intraday quote of each symbol in $1, like
+// GetLatestData does for one symbol.
+const latestDataForSymbolsQuery = `
+        WITH latest_intraday_data AS (
+            SELECT li.*
+            FROM unnest($1::text[]) AS s(symbol)
+            JOIN LATERAL (
+                SELECT 
+                    symbol,
+                    timestamp,
+                    open AS open_price,
+                    high AS high_price,
+                    low AS low_price,
+                    close AS price,
+                    volume,
+                    DATE(timestamp) AS intraday_date
+                FROM stock_intraday_data sid
+                WHERE sid.symbol = s.symbol
+                ORDER BY timestamp DESC
+                LIMIT 1
+            ) li ON TRUE
+        )
+
+        SELECT
+            lid.symbol,
+            lid.price,
+            (lid.price - pdd.prev_close) AS change,
+            COALESCE((lid.price - pdd.prev_close) / NULLIF(pdd.prev_close, 0) * 100, 0) AS change_percentage,
+            lid.high_price,
+            lid.low_price,
+            lid.open_price,
+            pdd.prev_close,
+            lid.volume,
+            lid.timestamp
+        FROM latest_intraday_data lid
+        LEFT JOIN LATERAL (
+            SELECT sdd.close AS prev_close
+            FROM stock_daily_data sdd
+            WHERE sdd.symbol = lid.symbol
+            AND sdd.date < lid.intraday_date
+            ORDER BY sdd.date DESC
+            LIMIT 1
+        ) pdd ON TRUE;
+    `
+
+// GetLatestDataForSymbols retrieves the most recent intraday quote of each of the given symbols in a
+// single query. Symbols without intraday data are left out.
+func (repo *StockRepoImpl) GetLatestDataForSymbols(symbols []string) (map[string]*entity.StockQuote, error) {
+	if len(symbols) == 0 {
+		return map[string]*entity.StockQuote{}, nil
+	}
+	return repo.queryLatestData(latestDataForSymbolsQuery, pq.Array(symbols))
+}
+
+// GetDailyData retrieves the daily bars for a symbol within a date range, ordered by date ascending.
+func (repo *StockRepoImpl) GetDailyData(symbol string, startTime time.Time, endTime time.Time) ([]*entity.DailyBar, error) {
+	query := `
+        SELECT symbol, open, high, low, close, COALESCE(volume, 0), date
+        FROM stock_daily_data
+        WHERE symbol = $1
+        AND date BETWEEN $2 AND $3
+        ORDER BY date ASC;`
+
+	rows, err := repo.db.Query(query, symbol, startTime.Format("2006-01-02"), endTime.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("error querying daily data for %s: %w", symbol, err)
+	}
+	defer rows.Close()
+
+	var dailyBars []*entity.DailyBar
+	for rows.Next() {
+		var bar entity.DailyBar
+		if err := rows.Scan(
+			&bar.Symbol,
+			&bar.Open,
+			&bar.High,
+			&bar.Low,
+			&bar.Close,
+			&bar.Volume,
+			&bar.Date,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning daily row for symbol %s: %w", symbol, err)
+		}
+		dailyBars = append(dailyBars, &bar)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over daily rows for symbol %s: %w", symbol, err)
+	}
+	return dailyBars, nil
+}
+
+// GetDataRange retrieves the earliest and latest data points of a symbol across the intraday and daily tables.
+// It returns a *errors.NotFoundError if the symbol has no data.
+func (repo *StockRepoImpl) GetDataRange(symbol string) (time.Time, time.Time, error) {
+	query := `
+        SELECT MIN(earliest), MAX(latest)
+        FROM (
+            SELECT MIN(timestamp) AS earliest, MAX(timestamp) AS latest
+            FROM stock_intraday_data
+            WHERE symbol = $1
+            UNION ALL
+            SELECT MIN(date)::timestamp, MAX(date)::timestamp
+            FROM stock_daily_data
+            WHERE symbol = $1
+        ) bounds;`
+
+	var earliest, latest sql.NullTime
+	if err := repo.db.QueryRow(query, symbol).Scan(&earliest, &latest); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("error fetching data range for %s: %w", symbol, err)
+	}
+	if !earliest.Valid || !latest.Valid {
+		return time.Time{}, time.Time{}, &errors.NotFoundError{Resource: fmt.Sprintf("data for %s", symbol)}
+	}
+	return earliest.Time, latest.Time, nil
+}
+
+// GetIntradayDayCounts retrieves the number of intraday bars of a symbol on each day from up to, but
+// excluding, to, keyed by YYYY-MM-DD date. Days without bars are left out.
+func (repo *StockRepoImpl) GetIntradayDayCounts(symbol string, from, to time.Time) (map[string]int, error) {
+	query := `
+        SELECT DATE(timestamp), COUNT(*)
+        FROM stock_intraday_data
+        WHERE symbol = $1
+        AND timestamp >= $2
+        AND timestamp < $3
+        GROUP BY DATE(timestamp);`
+
+	rows, err := repo.db.Query(query, symbol, from.Format("2006-01-02 15:04:05"), to.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching intraday day counts for %s: %w", symbol, err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var day time.Time
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, fmt.Errorf("error scanning intraday day count for %s: %w", symbol, err)
+		}
+		counts[day.Format("2006-01-02")] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating intraday day counts for %s: %w", symbol, err)
+	}
+	return counts, nil
+}
+
+// GetPrevClose retrieves the close of the most recent daily bar of a symbol strictly before the day
+// of asOf in the symbol's market time zone, along with its date, so a Monday returns the Friday close
+// and days after holidays return the last trading day's close. It returns a *errors.NotFoundError if
+// there is no earlier bar.
+func (repo *StockRepoImpl) GetPrevClose(symbol string, asOf time.Time) (float64, time.Time, error) {
+	query := `
+        SELECT close, date
+        FROM stock_daily_data
+        WHERE symbol = $1
+        AND date < $2::date
+        ORDER BY date DESC
+        LIMIT 1;`
+
+	if loc := utils.CalendarForSymbol(symbol).Location(); loc != nil {
+		asOf = asOf.In(loc)
+	}
+
+	var prevClose float64
+	var date time.Time
+	err := repo.db.QueryRow(query, symbol, asOf.Format("2006-01-02")).Scan(&prevClose, &date)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, &errors.NotFoundError{Resource: fmt.Sprintf("previous close for %s", symbol)}
+	}
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("error fetching previous close for %s: %w", symbol, err)
+	}
+	return prevClose, date, nil
+}
+
+// GetReturnStats computes the mean, volatility (sample standard deviation), min and max of the daily
+// log returns of a symbol between two dates. It returns a *errors.NotFoundError if the range holds
+// fewer than 2 closes, since no return can be computed.
+func (repo *StockRepoImpl) GetReturnStats(symbol string, startTime time.Time, endTime time.Time) (*entity.ReturnStats, error) {
+	query := `
+        WITH returns AS (
+            SELECT LN(close / NULLIF(LAG(close) OVER (ORDER BY date), 0)) AS log_return
+            FROM stock_daily_data
+            WHERE symbol = $1
+            AND date BETWEEN $2 AND $3
+            AND close > 0
+        )
+        SELECT
+            COUNT(log_return),
+            COALESCE(AVG(log_return), 0),
+            COALESCE(STDDEV_SAMP(log_return), 0),
+            COALESCE(MIN(log_return), 0),
+            COALESCE(MAX(log_return), 0)
+        FROM returns;`
+
+	stats := &entity.ReturnStats{Symbol: symbol, Start: startTime, End: endTime}
+	err := repo.db.QueryRow(query, symbol, startTime, endTime).Scan(
+		&stats.Count,
+		&stats.Mean,
+		&stats.Volatility,
+		&stats.Min,
+		&stats.Max,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error computing return stats for %s: %w", symbol, err)
+	}
+	if stats.Count == 0 {
+		return nil, &errors.NotFoundError{Resource: fmt.Sprintf("at least 2 daily closes for %s in range", symbol)}
+	}
+	return stats, nil
+}
+
+// GetOpeningGaps retrieves, for each symbol, the gap between the open of its latest daily bar and the
+// close of the bar before it, whatever the date of that bar.
+func (repo *StockRepoImpl) GetOpeningGaps() ([]*entity.OpeningGap, error) {
+	query := `
+        WITH ranked AS (
+            SELECT
+                symbol,
+                date,
+                open,
+                LAG(close) OVER (PARTITION BY symbol ORDER BY date) AS prev_close,
+                ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY date DESC) AS rn
+            FROM stock_daily_data
+        )
+        SELECT symbol, date, open, prev_close, (open - prev_close) / prev_close * 100 AS gap_percent
+        FROM ranked
+        WHERE rn = 1
+        AND prev_close > 0;`
 
 	rows, err := repo.db.Query(query)
 	if err != nil {
-		return nil, fmt.Errorf("error querying latest intraday data: %w", err)
+		return nil, fmt.Errorf("error querying opening gaps: %w", err)
 	}
 	defer rows.Close()
 
-	latestQuotesMap := make(map[string]*entity.StockQuote)
+	gaps := []*entity.OpeningGap{}
+	for rows.Next() {
+		var gap entity.OpeningGap
+		if err := rows.Scan(&gap.Symbol, &gap.Date, &gap.Open, &gap.PrevClose, &gap.GapPercent); err != nil {
+			return nil, fmt.Errorf("error scanning opening gap row: %w", err)
+		}
+		gaps = append(gaps, &gap)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over opening gap rows: %w", err)
+	}
+	return gaps, nil
+}
 
+// GetIntradayTimestamps retrieves the timestamps of the intraday bars of a symbol within a time range,
+// ordered ascending.
+func (repo *StockRepoImpl) GetIntradayTimestamps(symbol string, startTime time.Time, endTime time.Time) ([]time.Time, error) {
+	query := `
+        SELECT timestamp
+        FROM stock_intraday_data
+        WHERE symbol = $1
+        AND timestamp BETWEEN $2 AND $3
+        ORDER BY timestamp ASC;`
+
+	rows, err := repo.db.Query(query, symbol, startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("error querying intraday timestamps for %s: %w", symbol, err)
+	}
+	defer rows.Close()
+
+	var timestamps []time.Time
 	for rows.Next() {
-		var quote entity.StockQuote
-		err := rows.Scan(
-			&quote.Symbol,
-			&quote.Price,
-			&quote.Change,
-			&quote.ChangePercentage,
-			&quote.HighPrice,
-			&quote.LowPrice,
-			&quote.OpenPrice,
-			&quote.PrevClose,
-			&quote.Volume,
-			&quote.Timestamp,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning row: %w", err)
+		var timestamp time.Time
+		if err := rows.Scan(&timestamp); err != nil {
+			return nil, fmt.Errorf("error scanning intraday timestamp for symbol %s: %w", symbol, err)
 		}
-		latestQuotesMap[quote.Symbol] = &quote
+		timestamps = append(timestamps, timestamp)
 	}
 
-	// Check for errors after the loop
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over intraday timestamps for symbol %s: %w", symbol, err)
 	}
+	return timestamps, nil
+}
 
-	return latestQuotesMap, nil
+// GetGlobalLatestTimestamp retrieves the newest intraday timestamp across all symbols. It returns a
+// *errors.NotFoundError if there is no intraday data.
+func (repo *StockRepoImpl) GetGlobalLatestTimestamp() (time.Time, error) {
+	var latest sql.NullTime
+	if err := repo.db.QueryRow(`SELECT MAX(timestamp) FROM stock_intraday_data;`).Scan(&latest); err != nil {
+		return time.Time{}, fmt.Errorf("error fetching global latest timestamp: %w", err)
+	}
+	if !latest.Valid {
+		return time.Time{}, &errors.NotFoundError{Resource: "intraday data"}
+	}
+	return latest.Time, nil
 }
 
 // GetLatestIntradayDataTimestamp retrieves the latest intraday data timestamp for a given symbol.
+// It returns a *errors.NotFoundError if the symbol has no intraday data.
 func (repo *StockRepoImpl) GetLatestIntradayDataTimestamp(symbol string) (string, error) {
 	query := `
         SELECT MAX(timestamp) 
@@ -334,12 +1230,13 @@ func (repo *StockRepoImpl) GetLatestIntradayDataTimestamp(symbol string) (string
 		return "", fmt.Errorf("error fetching latest timestamp for %s: %w", symbol, err)
 	}
 	if !timestamp.Valid {
-		return "", nil
+		return "", &errors.NotFoundError{Resource: fmt.Sprintf("intraday data for %s", symbol)}
 	}
 	return timestamp.Time.Format("2006-01-02 15:04:05"), nil
 }
 
 // GetLatestDailyDataDate retrieves the latest daily data date for a given symbol.
+// It returns a *errors.NotFoundError if the symbol has no daily data.
 func (repo *StockRepoImpl) GetLatestDailyDataDate(symbol string) (string, error) {
 	query := `
         SELECT MAX(date) 
@@ -352,12 +1249,174 @@ func (repo *StockRepoImpl) GetLatestDailyDataDate(symbol string) (string, error)
 		return "", fmt.Errorf("error fetching latest date for %s: %w", symbol, err)
 	}
 	if !date.Valid {
-		return "", nil
+		return "", &errors.NotFoundError{Resource: fmt.Sprintf("daily data for %s", symbol)}
 	}
 	return date.Time.Format("2006-01-02"), nil
 }
 
-// CreateTables creates the stock_intraday_data and stock_daily_data tables if they do not exist.
+// RecomputeChanges recomputes the persisted previous close and change columns of the intraday rows
+// since the given time from the daily closes, picking up daily data that arrived or changed after the
+// rows were inserted. It returns the number of updated rows.
+func (repo *StockRepoImpl) RecomputeChanges(since time.Time) (int64, error) {
+	return repo.recomputeChanges(since, false)
+}
+
+// BackfillChanges computes the persisted previous close and change columns of every intraday row that
+// has none yet, e.g. rows written before the columns were enabled. It returns the number of updated rows.
+func (repo *StockRepoImpl) BackfillChanges() (int64, error) {
+	return repo.recomputeChanges(time.Time{}, true)
+}
+
+// recomputeChanges recomputes the change columns of the intraday rows since the given time, only of
+// the rows without a persisted previous close when onlyMissing is true.
+func (repo *StockRepoImpl) recomputeChanges(since time.Time, onlyMissing bool) (int64, error) {
+	query := `
+        UPDATE stock_intraday_data sid
+        SET prev_close = pdd.prev_close,
+            change = sid.close - pdd.prev_close,
+            change_percentage = COALESCE((sid.close - pdd.prev_close) / NULLIF(pdd.prev_close, 0) * 100, 0)
+        FROM (
+            SELECT
+                i.symbol,
+                i.timestamp,
+                (
+                    SELECT sdd.close
+                    FROM stock_daily_data sdd
+                    WHERE sdd.symbol = i.symbol
+                    AND sdd.date < DATE(i.timestamp)
+                    ORDER BY sdd.date DESC
+                    LIMIT 1
+                ) AS prev_close
+            FROM stock_intraday_data i
+            WHERE i.timestamp >= $1
+            AND (NOT $2 OR i.prev_close IS NULL)
+        ) pdd
+        WHERE sid.symbol = pdd.symbol
+        AND sid.timestamp = pdd.timestamp
+        AND pdd.prev_close IS NOT NULL
+        AND sid.prev_close IS DISTINCT FROM pdd.prev_close;`
+
+	result, err := repo.db.Exec(query, since.Format("2006-01-02 15:04:05"), onlyMissing)
+	if err != nil {
+		return 0, fmt.Errorf("error recomputing intraday changes: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error counting recomputed intraday changes: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteSymbolData deletes every intraday and daily row of a symbol in a single transaction and
+// returns the total number of deleted rows.
+func (repo *StockRepoImpl) DeleteSymbolData(symbol string) (int64, error) {
+	symbol = utils.NormalizeSymbol(symbol)
+
+	var deleted int64
+	err := repo.WithTx(context.Background(), func(tx *sql.Tx) error {
+		for _, table := range []string{"stock_intraday_data", "stock_daily_data"} {
+			result, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE symbol = $1;", table), symbol)
+			if err != nil {
+				return fmt.Errorf("error deleting %s rows for %s: %w", table, symbol, err)
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("error counting deleted %s rows for %s: %w", table, symbol, err)
+			}
+			deleted += rows
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// Stats retrieves the estimated row count, total size on disk and exact time range of the intraday and
+// daily tables, along with the number of distinct symbols across both. Row counts come from the planner
+// statistics in pg_class, which avoids scanning large tables, and are only counted exactly when the
+// table has never been analyzed.
+func (repo *StockRepoImpl) Stats() (*entity.RepoStats, error) {
+	tables := []struct {
+		name   string
+		column string
+	}{
+		{"stock_intraday_data", "timestamp"},
+		{"stock_daily_data", "date::timestamp"},
+	}
+
+	stats := &entity.RepoStats{}
+	for _, table := range tables {
+		tableStats := &entity.TableStats{Table: table.name}
+		sizeQuery := `
+        SELECT c.reltuples::bigint, pg_total_relation_size(c.oid)
+        FROM pg_class c
+        WHERE c.oid = to_regclass($1);`
+		if err := repo.db.QueryRow(sizeQuery, table.name).Scan(&tableStats.EstimatedRows, &tableStats.TotalBytes); err != nil {
+			return nil, fmt.Errorf("error fetching size of %s: %w", table.name, err)
+		}
+		if tableStats.EstimatedRows < 0 {
+			if err := repo.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s;", table.name)).Scan(&tableStats.EstimatedRows); err != nil {
+				return nil, fmt.Errorf("error counting rows of %s: %w", table.name, err)
+			}
+		}
+
+		var earliest, latest sql.NullTime
+		rangeQuery := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s;", table.column, table.column, table.name)
+		if err := repo.db.QueryRow(rangeQuery).Scan(&earliest, &latest); err != nil {
+			return nil, fmt.Errorf("error fetching time range of %s: %w", table.name, err)
+		}
+		if earliest.Valid && latest.Valid {
+			tableStats.Earliest = &earliest.Time
+			tableStats.Latest = &latest.Time
+		}
+		stats.Tables = append(stats.Tables, tableStats)
+	}
+
+	symbolsQuery := `
+        SELECT COUNT(*)
+        FROM (
+            SELECT symbol FROM stock_intraday_data
+            UNION
+            SELECT symbol FROM stock_daily_data
+        ) symbols;`
+	if err := repo.db.QueryRow(symbolsQuery).Scan(&stats.DistinctSymbols); err != nil {
+		return nil, fmt.Errorf("error counting distinct symbols: %w", err)
+	}
+	return stats, nil
+}
+
+// migrations are the schema changes applied to existing tables by Migrate, in order. Each is idempotent
+// and runs outside a transaction so indexes can be built without blocking writes.
+var migrations = []struct {
+	name  string
+	query string
+}{
+	{
+		// Record the source of intraday rows for INTRADAY_PRECEDENCE
+		name:  "stock_intraday_data source column",
+		query: `ALTER TABLE stock_intraday_data ADD COLUMN IF NOT EXISTS source VARCHAR(10);`,
+	},
+	{
+		// Keep MAX(timestamp) across all symbols cheap for freshness checks
+		name:  "stock_intraday_data timestamp index",
+		query: `CREATE INDEX CONCURRENTLY IF NOT EXISTS stock_intraday_data_timestamp_idx ON stock_intraday_data (timestamp);`,
+	},
+}
+
+// Migrate applies the migrations to the existing tables, skipping those already applied.
+func (repo *StockRepoImpl) Migrate() error {
+	for _, migration := range migrations {
+		if _, err := repo.db.Exec(migration.query); err != nil {
+			return fmt.Errorf("error applying migration %s: %w", migration.name, err)
+		}
+	}
+	return nil
+}
+
+// CreateTables creates the stock_intraday_data and stock_daily_data tables if they do not exist, then
+// applies the migrations.
 func (repo *StockRepoImpl) CreateTables() error {
 	intradayTableQuery := `
     CREATE TABLE IF NOT EXISTS stock_intraday_data (
@@ -367,10 +1426,21 @@ func (repo *StockRepoImpl) CreateTables() error {
         high NUMERIC(12,6),
         low NUMERIC(12,6),
         close NUMERIC(12,6),
-        volume NUMERIC(12,2),
+        volume NUMERIC(20,2),
+        prev_close NUMERIC(10,2),
+        change NUMERIC(12,6),
+        change_percentage NUMERIC(12,6),
+        source VARCHAR(10),
         PRIMARY KEY (symbol, timestamp)
     );`
 
+	// Add the precomputed change columns to tables created before they existed
+	intradayChangeColumnsQuery := `
+    ALTER TABLE stock_intraday_data
+        ADD COLUMN IF NOT EXISTS prev_close NUMERIC(10,2),
+        ADD COLUMN IF NOT EXISTS change NUMERIC(12,6),
+        ADD COLUMN IF NOT EXISTS change_percentage NUMERIC(12,6);`
+
 	dailyTableQuery := `
     CREATE TABLE IF NOT EXISTS stock_daily_data (
         symbol VARCHAR(20) NOT NULL,
@@ -379,21 +1449,53 @@ func (repo *StockRepoImpl) CreateTables() error {
         high NUMERIC(10,2) NOT NULL,
         low NUMERIC(10,2) NOT NULL,
         close NUMERIC(10,2) NOT NULL,
-        volume NUMERIC(12,2),
+        volume NUMERIC(20,2),
         PRIMARY KEY (symbol, date)
     );`
 
-	// Execute the intraday table creation query
-	_, err := repo.db.Exec(intradayTableQuery)
-	if err != nil {
-		return fmt.Errorf("error creating stock_intraday_data table: %w", err)
-	}
+	// Widen the volume columns of tables created when they were NUMERIC(12,2), which overflowed on
+	// high-volume days. Only narrower columns are altered since the ALTER locks the table.
+	volumeColumnsQuery := `
+    DO $$
+    BEGIN
+        IF EXISTS (
+            SELECT 1 FROM information_schema.columns
+            WHERE table_name = 'stock_intraday_data' AND column_name = 'volume' AND numeric_precision < 20
+        ) THEN
+            ALTER TABLE stock_intraday_data ALTER COLUMN volume TYPE NUMERIC(20,2);
+        END IF;
+        IF EXISTS (
+            SELECT 1 FROM information_schema.columns
+            WHERE table_name = 'stock_daily_data' AND column_name = 'volume' AND numeric_precision < 20
+        ) THEN
+            ALTER TABLE stock_daily_data ALTER COLUMN volume TYPE NUMERIC(20,2);
+        END IF;
+    END $$;`
+
+	// Postgres DDL is transactional, so a failed step leaves the schema as it was
+	err := repo.WithTx(context.Background(), func(tx *sql.Tx) error {
+		// Execute the intraday table creation query
+		if _, err := tx.Exec(intradayTableQuery); err != nil {
+			return fmt.Errorf("error creating stock_intraday_data table: %w", err)
+		}
 
-	// Execute the daily table creation query
-	_, err = repo.db.Exec(dailyTableQuery)
+		if _, err := tx.Exec(intradayChangeColumnsQuery); err != nil {
+			return fmt.Errorf("error adding change columns to stock_intraday_data: %w", err)
+		}
+
+		// Execute the daily table creation query
+		if _, err := tx.Exec(dailyTableQuery); err != nil {
+			return fmt.Errorf("error creating stock_daily_data table: %w", err)
+		}
+
+		if _, err := tx.Exec(volumeColumnsQuery); err != nil {
+			return fmt.Errorf("error widening volume columns: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("error creating stock_daily_data table: %w", err)
+		return err
 	}
 
-	return nil
+	return repo.Migrate()
 }
@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"stock-app/pkg/errors"
+	"stock-app/pkg/utils"
+)
+
+func TestFormatOHLCV(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    [5]string
+		want      []interface{}
+		wantField string
+	}{
+		{name: "valid", values: [5]string{"1.234", "2", " 0.5 ", "1.5", "1000"}, want: []interface{}{"1.23", "2.00", "0.50", "1.50", "1000.00"}},
+		{name: "empty volume", values: [5]string{"1", "1", "1", "1", ""}, want: []interface{}{"1.00", "1.00", "1.00", "1.00", nil}},
+		{name: "empty open", values: [5]string{"", "1", "1", "1", "1"}, wantField: "open of AAPL"},
+		{name: "blank close", values: [5]string{"1", "1", "1", "  ", "1"}, wantField: "close of AAPL"},
+		{name: "non-numeric high", values: [5]string{"1", "n/a", "1", "1", "1"}, wantField: "high of AAPL"},
+		{name: "NaN low", values: [5]string{"1", "1", "NaN", "1", "1"}, wantField: "low of AAPL"},
+		{name: "non-numeric volume", values: [5]string{"1", "1", "1", "1", "lots"}, wantField: "volume of AAPL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := tt.values
+			got, err := formatOHLCV("AAPL", dailyPriceScale, v[0], v[1], v[2], v[3], v[4])
+			if tt.wantField != "" {
+				var validation *errors.ValidationError
+				if !stderrors.As(err, &validation) || !strings.HasPrefix(validation.Field, tt.wantField) {
+					t.Errorf("formatOHLCV() error = %v, want a *errors.ValidationError for %s", err, tt.wantField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("formatOHLCV() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("formatOHLCV() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("formatOHLCV() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+// fakeRows is a result set of the quote columns, scanning a row of symbol, price and timestamp per
+// quote with a previous close of 100.
+type fakeRows struct {
+	quotes []struct {
+		symbol string
+		price  float64
+		time   time.Time
+	}
+	next int
+	err  error
+}
+
+func (rows *fakeRows) Next() bool {
+	rows.next++
+	return rows.next <= len(rows.quotes)
+}
+
+func (rows *fakeRows) Scan(dest ...interface{}) error {
+	row := rows.quotes[rows.next-1]
+	*dest[0].(*string) = row.symbol
+	*dest[1].(*float64) = row.price
+	for _, i := range []int{2, 3, 7} {
+		if err := dest[i].(*sql.NullFloat64).Scan(100.0); err != nil {
+			return err
+		}
+	}
+	for _, i := range []int{4, 5, 6, 8} {
+		*dest[i].(*float64) = row.price
+	}
+	*dest[9].(*time.Time) = row.time
+	return nil
+}
+
+func (rows *fakeRows) Err() error {
+	return rows.err
+}
+
+func TestGroupQuotes(t *testing.T) {
+	minute := func(m int) time.Time {
+		return time.Date(2025, time.June, 11, 10, m, 0, 0, time.UTC)
+	}
+	type row = struct {
+		symbol string
+		price  float64
+		time   time.Time
+	}
+
+	tests := []struct {
+		name    string
+		rows    []row
+		err     error
+		want    map[string][]float64
+		wantErr bool
+	}{
+		{
+			name: "several rows per symbol",
+			rows: []row{{"AAPL", 1, minute(0)}, {"MSFT", 10, minute(0)}, {"AAPL", 2, minute(1)}, {"AAPL", 3, minute(2)}, {"MSFT", 11, minute(1)}},
+			want: map[string][]float64{"AAPL": {1, 2, 3}, "MSFT": {10, 11}},
+		},
+		{name: "no rows", want: map[string][]float64{}},
+		{name: "iteration error", rows: []row{{"AAPL", 1, minute(0)}}, err: stderrors.New("connection reset"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := groupQuotes(&fakeRows{quotes: tt.rows, err: tt.err})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("groupQuotes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("groupQuotes() returned %d symbols, want %d", len(got), len(tt.want))
+			}
+			for symbol, prices := range tt.want {
+				quotes := got[symbol]
+				if len(quotes) != len(prices) {
+					t.Fatalf("%s has %d quotes, want %d", symbol, len(quotes), len(prices))
+				}
+				for i, quote := range quotes {
+					if quote.Symbol != symbol || quote.Price != prices[i] {
+						t.Errorf("%s quote %d = %s at %v, want %v", symbol, i, quote.Symbol, quote.Price, prices[i])
+					}
+					if i > 0 && (quote == quotes[i-1] || !quote.Timestamp.After(quotes[i-1].Timestamp)) {
+						t.Errorf("%s quote %d shares or precedes quote %d", symbol, i, i-1)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	failure := stderrors.New("insert failed")
+	tests := []struct {
+		name    string
+		fn      func(tx *sql.Tx) error
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "commits when fn succeeds",
+			fn: func(tx *sql.Tx) error {
+				_, err := tx.Exec("DELETE FROM stock_intraday_data WHERE symbol = $1;", "AAPL")
+				return err
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("DELETE FROM stock_intraday_data").WithArgs("AAPL").WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "rolls back when fn fails midway",
+			fn: func(tx *sql.Tx) error {
+				if _, err := tx.Exec("DELETE FROM stock_intraday_data WHERE symbol = $1;", "AAPL"); err != nil {
+					return err
+				}
+				if _, err := tx.Exec("INSERT INTO stock_intraday_data (symbol) VALUES ($1);", "AAPL"); err != nil {
+					return err
+				}
+				return nil
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("DELETE FROM stock_intraday_data").WithArgs("AAPL").WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec("INSERT INTO stock_intraday_data").WithArgs("AAPL").WillReturnError(failure)
+				mock.ExpectRollback()
+			},
+			wantErr: failure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New() error = %v", err)
+			}
+			defer db.Close()
+			tt.expect(mock)
+
+			repo := NewStockRepo(db, false, LatestStrategyCTE, PrecedenceLastWrite).(*StockRepoImpl)
+			err = repo.WithTx(context.Background(), tt.fn)
+			if !stderrors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("WithTx() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	repo := NewStockRepo(db, false, LatestStrategyCTE, PrecedenceLastWrite).(*StockRepoImpl)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithTx() didn't re-panic")
+			}
+		}()
+		_ = repo.WithTx(context.Background(), func(tx *sql.Tx) error {
+			panic("boom")
+		})
+	}()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDeleteSymbolDataRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM stock_intraday_data").WithArgs("AAPL").WillReturnResult(sqlmock.NewResult(0, 390))
+	mock.ExpectExec("DELETE FROM stock_daily_data").WithArgs("AAPL").WillReturnError(stderrors.New("connection reset"))
+	mock.ExpectRollback()
+
+	repo := NewStockRepo(db, false, LatestStrategyCTE, PrecedenceLastWrite)
+	deleted, err := repo.DeleteSymbolData("aapl")
+	if err == nil || deleted != 0 {
+		t.Errorf("DeleteSymbolData() = %d, %v, want 0 and an error", deleted, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestAsOfCutoffs(t *testing.T) {
+	if err := utils.SetSymbolExchanges(map[string]string{"VOD.L": "LSE"}); err != nil {
+		t.Fatal(err)
+	}
+	defer utils.SetSymbolExchanges(nil)
+
+	tests := []struct {
+		name        string
+		asOf        time.Time
+		wantDefault string
+		wantLSE     string
+	}{
+		{name: "summer", asOf: time.Date(2025, time.June, 11, 15, 0, 0, 0, time.UTC), wantDefault: "2025-06-11 11:00:00", wantLSE: "2025-06-11 16:00:00"},
+		{name: "winter", asOf: time.Date(2025, time.January, 15, 15, 0, 0, 0, time.UTC), wantDefault: "2025-01-15 10:00:00", wantLSE: "2025-01-15 15:00:00"},
+		{name: "offset input", asOf: time.Date(2025, time.June, 11, 11, 0, 0, 0, time.FixedZone("EDT", -4*60*60)), wantDefault: "2025-06-11 11:00:00", wantLSE: "2025-06-11 16:00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultCutoff, symbols, cutoffs := asOfCutoffs(tt.asOf)
+			if defaultCutoff != tt.wantDefault {
+				t.Errorf("default cutoff = %s, want %s", defaultCutoff, tt.wantDefault)
+			}
+			if len(symbols) != 1 || symbols[0] != "VOD.L" || cutoffs[0] != tt.wantLSE {
+				t.Errorf("cutoffs = %v %v, want [VOD.L] [%s]", symbols, cutoffs, tt.wantLSE)
+			}
+		})
+	}
+}
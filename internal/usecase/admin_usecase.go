@@ -0,0 +1,113 @@
+package usecase
+
+import (
+	"fmt"
+	"time"
+
+	"stock-app/internal/cache"
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+	"stock-app/pkg/utils"
+)
+
+// AdminUseCase defines the operational business logic exposed to administrators.
+type AdminUseCase struct {
+	stockCache cache.StockCache
+	stockRepo  repository.StockRepo
+	now        func() time.Time
+}
+
+// NewAdminUseCase creates a new instance of AdminUseCase.
+func NewAdminUseCase(stockCache cache.StockCache, stockRepo repository.StockRepo) *AdminUseCase {
+	return &AdminUseCase{
+		stockCache: stockCache,
+		stockRepo:  stockRepo,
+		now:        time.Now,
+	}
+}
+
+// GetCacheStats retrieves the per-symbol cache statistics.
+func (uc *AdminUseCase) GetCacheStats() ([]*entity.CacheStats, error) {
+	stats, err := uc.stockCache.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache stats: %w", err)
+	}
+	return stats, nil
+}
+
+// GetRepoStats retrieves the size and time range statistics of the stored stock data.
+func (uc *AdminUseCase) GetRepoStats() (*entity.RepoStats, error) {
+	stats, err := uc.stockRepo.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository stats: %w", err)
+	}
+	return stats, nil
+}
+
+// DetectGaps finds the regular-session minutes of a trading day that have no intraday bar for a symbol
+// and returns them as ranges of consecutive minutes. Intraday timestamps are stored as wall clock times
+// of the symbol's exchange, so the session minutes are matched against them by wall clock. Days without
+// a regular session, such as weekends and holidays, have no gaps, and for today only the minutes that
+// have already ended are checked.
+func (uc *AdminUseCase) DetectGaps(symbol string, day time.Time) ([]entity.Gap, error) {
+	calendar := utils.CalendarForSymbol(symbol)
+	loc := calendar.Location()
+	if loc == nil {
+		return nil, fmt.Errorf("failed to load time zone %s of the %s market", calendar.TimeZone, calendar.Name)
+	}
+
+	dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	now := uc.now()
+	var sessionMinutes []time.Time
+	for t := dayStart; t.Day() == dayStart.Day() && !t.Add(time.Minute).After(now); t = t.Add(time.Minute) {
+		if calendar.IsOpen(t) {
+			sessionMinutes = append(sessionMinutes, t)
+		}
+	}
+	gaps := []entity.Gap{}
+	if len(sessionMinutes) == 0 {
+		return gaps, nil
+	}
+
+	wallClock := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	}
+	timestamps, err := uc.stockRepo.GetIntradayTimestamps(
+		symbol,
+		wallClock(sessionMinutes[0]),
+		wallClock(sessionMinutes[len(sessionMinutes)-1]).Add(time.Minute-time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get intraday timestamps: %w", err)
+	}
+
+	present := make(map[time.Time]bool, len(timestamps))
+	for _, timestamp := range timestamps {
+		present[wallClock(timestamp)] = true
+	}
+
+	var current *entity.Gap
+	for _, minute := range sessionMinutes {
+		if present[wallClock(minute)] {
+			if current != nil {
+				gaps = append(gaps, *current)
+				current = nil
+			}
+			continue
+		}
+		// Minutes on either side of a break of the session belong to separate gaps
+		if current != nil && !minute.Equal(current.End.Add(time.Minute)) {
+			gaps = append(gaps, *current)
+			current = nil
+		}
+		if current == nil {
+			current = &entity.Gap{Start: minute}
+		}
+		current.End = minute
+		current.Minutes++
+	}
+	if current != nil {
+		gaps = append(gaps, *current)
+	}
+	return gaps, nil
+}
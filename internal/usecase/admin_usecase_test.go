@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+)
+
+// timestampsRepo is a StockRepo holding an intraday bar at each of the given timestamps.
+type timestampsRepo struct {
+	repository.StockRepo
+	timestamps []time.Time
+}
+
+func (repo *timestampsRepo) GetIntradayTimestamps(symbol string, start, end time.Time) ([]time.Time, error) {
+	var found []time.Time
+	for _, timestamp := range repo.timestamps {
+		if !timestamp.Before(start) && !timestamp.After(end) {
+			found = append(found, timestamp)
+		}
+	}
+	return found, nil
+}
+
+func TestDetectGaps(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)
+	// Bars are stored as New York wall clock times in UTC, every regular-session minute but 10:00-10:04
+	var timestamps []time.Time
+	for t := day.Add(9*time.Hour + 30*time.Minute); t.Before(day.Add(16 * time.Hour)); t = t.Add(time.Minute) {
+		if t.Hour() == 10 && t.Minute() < 5 {
+			continue
+		}
+		timestamps = append(timestamps, t)
+	}
+	at := func(hour, min int) time.Time {
+		return time.Date(2025, time.June, 11, hour, min, 0, 0, newYork)
+	}
+
+	tests := []struct {
+		name string
+		day  time.Time
+		now  time.Time
+		want []entity.Gap
+	}{
+		{name: "missing stretch", day: day, now: at(20, 0), want: []entity.Gap{{Start: at(10, 0), End: at(10, 4), Minutes: 5}}},
+		{name: "today up to the current minute", day: day, now: at(10, 2).Add(30 * time.Second), want: []entity.Gap{{Start: at(10, 0), End: at(10, 1), Minutes: 2}}},
+		{name: "weekend", day: time.Date(2025, time.June, 14, 0, 0, 0, 0, time.UTC), now: at(20, 0).AddDate(0, 0, 7), want: []entity.Gap{}},
+		{name: "holiday", day: time.Date(2025, time.June, 19, 0, 0, 0, 0, time.UTC), now: at(20, 0).AddDate(0, 0, 14), want: []entity.Gap{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewAdminUseCase(nil, &timestampsRepo{timestamps: timestamps})
+			uc.now = func() time.Time { return tt.now }
+
+			gaps, err := uc.DetectGaps("AAPL", tt.day)
+			if err != nil {
+				t.Fatalf("DetectGaps() error = %v", err)
+			}
+			if len(gaps) != len(tt.want) {
+				t.Fatalf("DetectGaps() = %+v, want %+v", gaps, tt.want)
+			}
+			for i, gap := range gaps {
+				if !gap.Start.Equal(tt.want[i].Start) || !gap.End.Equal(tt.want[i].End) || gap.Minutes != tt.want[i].Minutes {
+					t.Errorf("gap %d = %+v, want %+v", i, gap, tt.want[i])
+				}
+			}
+		})
+	}
+}
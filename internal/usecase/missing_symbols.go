@@ -0,0 +1,49 @@
+package usecase
+
+import (
+	"sync"
+	"time"
+)
+
+// missingSymbolTTL is how long a symbol the DB had no data for is not looked up again, so that
+// unknown symbols don't cost a query on every request.
+const missingSymbolTTL = time.Minute
+
+// missingSymbols remembers the symbols a lookup found no data for, each for a limited time.
+type missingSymbols struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// newMissingSymbols creates a new instance of missingSymbols remembering symbols for ttl.
+func newMissingSymbols(ttl time.Duration) *missingSymbols {
+	return &missingSymbols{
+		until: make(map[string]time.Time),
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+// add remembers the symbol as missing for the TTL.
+func (m *missingSymbols) add(symbol string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.until[symbol] = m.now().Add(m.ttl)
+}
+
+// contains reports whether the symbol was found missing within the TTL, forgetting it once expired.
+func (m *missingSymbols) contains(symbol string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	until, exists := m.until[symbol]
+	if !exists {
+		return false
+	}
+	if !m.now().Before(until) {
+		delete(m.until, symbol)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMissingSymbols(t *testing.T) {
+	added := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		add     bool
+		elapsed time.Duration
+		want    bool
+	}{
+		{name: "never added", want: false},
+		{name: "within the TTL", add: true, elapsed: 30 * time.Second, want: true},
+		{name: "at the TTL", add: true, elapsed: time.Minute, want: false},
+		{name: "after the TTL", add: true, elapsed: 2 * time.Minute, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing := newMissingSymbols(time.Minute)
+			now := added
+			missing.now = func() time.Time { return now }
+			if tt.add {
+				missing.add("NOPE")
+			}
+			now = added.Add(tt.elapsed)
+			if got := missing.contains("NOPE"); got != tt.want {
+				t.Errorf("contains() = %v, want %v", got, tt.want)
+			}
+			if got := missing.contains("AAPL"); got {
+				t.Error("contains() reported a symbol that was never added")
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"stock-app/internal/api/timeseries"
+	"stock-app/internal/cache"
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+	"stock-app/pkg/config"
+	"stock-app/pkg/errors"
+	"stock-app/pkg/utils"
+)
+
+// refreshLockName is the distributed lock held while a refresh runs, so concurrent instances don't
+// make duplicate calls to the time series API.
+const refreshLockName = "refresh"
+
+// dailyRefreshLockPrefix prefixes the per-day lock marking that the scheduled daily refresh already ran,
+// so restarts and other instances don't repeat it.
+const dailyRefreshLockPrefix = "daily-refresh:"
+
+// RefreshUseCase defines the business logic for refreshing stored data from the time series API.
+type RefreshUseCase struct {
+	stockRepo repository.StockRepo
+	tsFetcher *timeseries.TimeSeriesFetcher
+	jobStore  cache.JobStore
+	locker    cache.Locker
+	clock     Clock
+}
+
+// NewRefreshUseCase creates a new instance of RefreshUseCase.
+func NewRefreshUseCase(stockRepo repository.StockRepo, tsFetcher *timeseries.TimeSeriesFetcher, jobStore cache.JobStore, locker cache.Locker) *RefreshUseCase {
+	return &RefreshUseCase{
+		stockRepo: stockRepo,
+		tsFetcher: tsFetcher,
+		jobStore:  jobStore,
+		locker:    locker,
+		clock:     realClock{},
+	}
+}
+
+// withRefreshLock runs fn while holding the refresh lock. It returns an error without running fn when
+// another instance holds the lock. The lock is extended every third of its TTL while fn runs, so a
+// refresh taking longer than the TTL keeps it, while a crashed holder's lock still expires.
+func (ru *RefreshUseCase) withRefreshLock(fn func() error) error {
+	ttl := config.AppConfig.RefreshLockTTL
+	token, acquired, err := ru.locker.Acquire(refreshLockName, ttl)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return fmt.Errorf("another instance is already running a refresh")
+	}
+
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ru.renewLock(refreshLockName, token, ttl, done)
+	}()
+	defer func() {
+		close(done)
+		<-renewed
+		if err := ru.locker.Release(refreshLockName, token); err != nil {
+			fmt.Printf("Failed to release refresh lock: %v\n", err)
+		}
+	}()
+	return fn()
+}
+
+// renewLock extends the named lock held with token to ttl every third of ttl until done is closed or
+// the lock is lost.
+func (ru *RefreshUseCase) renewLock(name, token string, ttl time.Duration, done <-chan struct{}) {
+	ticker := ru.clock.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			extended, err := ru.locker.Extend(name, token, ttl)
+			if err != nil {
+				fmt.Printf("Failed to extend %s lock: %v\n", name, err)
+				continue
+			}
+			if !extended {
+				fmt.Printf("Lost the %s lock: another instance may start a refresh concurrently\n", name)
+				return
+			}
+		}
+	}
+}
+
+// StartRefresh starts a refresh of the daily and intraday data in the background and returns its job.
+// If idempotencyKey was already used within the TTL, the job it started is returned instead of
+// starting a new one, and created is false.
+func (ru *RefreshUseCase) StartRefresh(idempotencyKey string) (job *entity.RefreshJob, created bool, err error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, false, err
+	}
+	ttl := config.AppConfig.IdempotencyKeyTTL
+
+	if idempotencyKey != "" {
+		existingID, claimed, err := ru.jobStore.ClaimIdempotencyKey(idempotencyKey, id, ttl)
+		if err != nil {
+			return nil, false, err
+		}
+		if !claimed {
+			existing, err := ru.jobStore.GetJob(existingID)
+			var notFound *errors.NotFoundError
+			if stderrors.As(err, &notFound) {
+				// The instance that claimed the key has not saved its job yet
+				return &entity.RefreshJob{ID: existingID, Status: entity.RefreshPending}, false, nil
+			}
+			if err != nil {
+				return nil, false, err
+			}
+			return existing, false, nil
+		}
+	}
+
+	job = &entity.RefreshJob{
+		ID:        id,
+		Type:      entity.RefreshTypeManual,
+		Status:    entity.RefreshPending,
+		CreatedAt: ru.clock.Now(),
+	}
+	if err := ru.jobStore.SaveJob(job, ttl); err != nil {
+		// Without its job, the claimed key would make retries report a job that never existed
+		if idempotencyKey != "" {
+			if releaseErr := ru.jobStore.ReleaseIdempotencyKey(idempotencyKey, id); releaseErr != nil {
+				fmt.Printf("Failed to release idempotency key of refresh job %s: %v\n", id, releaseErr)
+			}
+		}
+		return nil, false, err
+	}
+
+	jobCopy := *job
+	go ru.runRefresh(&jobCopy, ttl)
+	return job, true, nil
+}
+
+// GetRefreshJob retrieves a refresh job by ID.
+func (ru *RefreshUseCase) GetRefreshJob(id string) (*entity.RefreshJob, error) {
+	return ru.jobStore.GetJob(id)
+}
+
+// GetRefreshHistory retrieves up to limit of the most recently finished refresh jobs, newest first,
+// keeping only those with the given status when it is not empty.
+func (ru *RefreshUseCase) GetRefreshHistory(status string, limit int) ([]*entity.RefreshJob, error) {
+	history, err := ru.jobStore.GetHistory()
+	if err != nil {
+		return nil, err
+	}
+	return filterRefreshHistory(history, status, limit), nil
+}
+
+// filterRefreshHistory keeps up to limit jobs of the history with the given status, or of any status
+// when it is empty, preserving their order.
+func filterRefreshHistory(history []*entity.RefreshJob, status string, limit int) []*entity.RefreshJob {
+	jobs := make([]*entity.RefreshJob, 0, limit)
+	for _, job := range history {
+		if len(jobs) == limit {
+			break
+		}
+		if status == "" || job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// runRefresh refreshes the daily and intraday data, recording the progress of the job.
+func (ru *RefreshUseCase) runRefresh(job *entity.RefreshJob, ttl time.Duration) {
+	fmt.Printf("Running refresh job %s...\n", job.ID)
+	err := ru.runJob(job, ttl, func(repo repository.StockRepo) error {
+		return ru.withRefreshLock(func() error {
+			// Symbols failing one fetch don't keep the others from the next
+			dailyErr := ru.tsFetcher.FetchDailyData(repo)
+			return stderrors.Join(dailyErr, ru.tsFetcher.FetchIntradayData(repo))
+		})
+	})
+	if err != nil {
+		fmt.Printf("Refresh job %s failed: %v\n", job.ID, err)
+		return
+	}
+	fmt.Printf("Refresh job %s completed.\n", job.ID)
+}
+
+// runScheduledJob runs fn as a new refresh job of the given type while holding the refresh lock.
+// Unlike admin refreshes, no job is recorded when another instance holds the lock, since every
+// instance runs the same schedule.
+func (ru *RefreshUseCase) runScheduledJob(jobType string, fn func(repository.StockRepo) error) error {
+	return ru.withRefreshLock(func() error {
+		id, err := newJobID()
+		if err != nil {
+			return err
+		}
+		job := &entity.RefreshJob{
+			ID:        id,
+			Type:      jobType,
+			Status:    entity.RefreshPending,
+			CreatedAt: ru.clock.Now(),
+		}
+		return ru.runJob(job, config.AppConfig.IdempotencyKeyTTL, fn)
+	})
+}
+
+// runJob runs fn against a repository counting its inserts, saving the progress of the job with the
+// given TTL and appending it to the refresh history once finished. It returns the error of fn.
+func (ru *RefreshUseCase) runJob(job *entity.RefreshJob, ttl time.Duration, fn func(repository.StockRepo) error) error {
+	startedAt := ru.clock.Now()
+	job.Status = entity.RefreshRunning
+	job.StartedAt = &startedAt
+	if err := ru.jobStore.SaveJob(job, ttl); err != nil {
+		fmt.Printf("Failed to update refresh job %s: %v\n", job.ID, err)
+	}
+
+	repo := repository.NewCountingRepo(ru.stockRepo)
+	err := fn(repo)
+
+	finishedAt := ru.clock.Now()
+	job.FinishedAt = &finishedAt
+	job.RowsInserted = repo.Inserted()
+	if err != nil {
+		job.Status = entity.RefreshFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = entity.RefreshSucceeded
+	}
+	if err := ru.jobStore.SaveJob(job, ttl); err != nil {
+		fmt.Printf("Failed to update refresh job %s: %v\n", job.ID, err)
+	}
+	if err := ru.jobStore.AppendHistory(job, config.AppConfig.RefreshHistorySize); err != nil {
+		fmt.Printf("Failed to record refresh job %s in history: %v\n", job.ID, err)
+	}
+	return err
+}
+
+// newJobID generates a random refresh job ID.
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ScheduleIntradayRefresh refreshes intraday data every interval during the regular market session,
+// until the context is cancelled.
+func (ru *RefreshUseCase) ScheduleIntradayRefresh(ctx context.Context, interval time.Duration) {
+	ticker := ru.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("Scheduled intraday refresh started with interval %v\n", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Scheduled intraday refresh stopped.")
+			return
+		case <-ticker.C():
+			ru.refreshIntradayIfOpen()
+		}
+	}
+}
+
+// refreshIntradayIfOpen refreshes intraday data unless the markets of all configured symbols are
+// outside their regular session.
+func (ru *RefreshUseCase) refreshIntradayIfOpen() {
+	if !utils.AnyMarketOpen(config.AppConfig.SymbolList, ru.clock.Now()) {
+		fmt.Println("All markets are closed. Skipping scheduled intraday refresh.")
+		return
+	}
+
+	fmt.Println("Running scheduled intraday refresh...")
+	err := ru.runScheduledJob(entity.RefreshTypeIntraday, ru.tsFetcher.FetchIntradayData)
+	if err != nil {
+		fmt.Printf("Error during scheduled intraday refresh: %v\n", err)
+		return
+	}
+	fmt.Println("Scheduled intraday refresh completed.")
+}
+
+// ScheduleDailyRefresh refreshes daily data once per trading day, delay after the US market close,
+// until the context is cancelled. Started after today's scheduled time, it first runs today's refresh
+// unless this or another instance already did.
+func (ru *RefreshUseCase) ScheduleDailyRefresh(ctx context.Context, delay time.Duration) {
+	fmt.Printf("Scheduled daily refresh started, %v after market close\n", delay)
+	if missed, ok := missedDailyRefresh(ru.clock.Now(), delay); ok {
+		ru.refreshDailyOnce(missed)
+	}
+	for {
+		next := utils.USMarket.NextAfterClose(ru.clock.Now(), delay)
+		if next.IsZero() {
+			fmt.Println("Scheduled daily refresh stopped: market time zone unavailable.")
+			return
+		}
+
+		timer := ru.clock.NewTimer(next.Sub(ru.clock.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			fmt.Println("Scheduled daily refresh stopped.")
+			return
+		case <-timer.C():
+			ru.refreshDailyOnce(next)
+		}
+	}
+}
+
+// missedDailyRefresh returns the scheduled time of today's daily refresh, delay after the US market
+// close, if it has already passed at now. Today is the trading day of now in the market's time zone.
+func missedDailyRefresh(now time.Time, delay time.Duration) (time.Time, bool) {
+	last := utils.USMarket.LastAfterClose(now, delay)
+	if last.IsZero() {
+		return time.Time{}, false
+	}
+	loc := utils.USMarket.Location()
+	lastClose := last.Add(-delay).In(loc)
+	today := now.In(loc)
+	if lastClose.Year() != today.Year() || lastClose.YearDay() != today.YearDay() {
+		return time.Time{}, false
+	}
+	return last, true
+}
+
+// refreshDailyOnce refreshes daily data for the trading day of scheduledAt, unless this or another
+// instance already did. The day's marker lock is kept after a successful refresh and released after a
+// failed one so the next attempt can retry.
+func (ru *RefreshUseCase) refreshDailyOnce(scheduledAt time.Time) {
+	day := scheduledAt.In(utils.USMarket.Location()).Format("2006-01-02")
+	name := dailyRefreshLockPrefix + day
+
+	token, acquired, err := ru.locker.Acquire(name, 24*time.Hour)
+	if err != nil {
+		fmt.Printf("Error during scheduled daily refresh: %v\n", err)
+		return
+	}
+	if !acquired {
+		fmt.Printf("Daily data for %s was already refreshed. Skipping scheduled daily refresh.\n", day)
+		return
+	}
+
+	fmt.Printf("Running scheduled daily refresh for %s...\n", day)
+	err = ru.runScheduledJob(entity.RefreshTypeDaily, ru.tsFetcher.FetchDailyData)
+	if err != nil {
+		fmt.Printf("Error during scheduled daily refresh: %v\n", err)
+		if err := ru.locker.Release(name, token); err != nil {
+			fmt.Printf("Failed to release daily refresh lock: %v\n", err)
+		}
+		return
+	}
+	fmt.Println("Scheduled daily refresh completed.")
+}
+
+// ScheduleChangeRecompute first backfills the persisted change columns of the intraday rows written
+// before they were enabled, then recomputes those of the intraday data within the historical window
+// every interval, so rows inserted before their previous daily close was available, or whose daily
+// close has since been updated, converge with the live computation.
+func (ru *RefreshUseCase) ScheduleChangeRecompute(ctx context.Context, interval time.Duration) {
+	if backfilled, err := ru.stockRepo.BackfillChanges(); err != nil {
+		fmt.Printf("Error backfilling intraday changes: %v\n", err)
+	} else {
+		fmt.Printf("Backfilled changes of %d intraday rows.\n", backfilled)
+	}
+
+	ticker := ru.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("Scheduled change recompute started with interval %v\n", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Scheduled change recompute stopped.")
+			return
+		case <-ticker.C():
+			since := ru.clock.Now().Add(-config.AppConfig.HistoricalDataDuration)
+			updated, err := ru.stockRepo.RecomputeChanges(since)
+			if err != nil {
+				fmt.Printf("Error during scheduled change recompute: %v\n", err)
+				continue
+			}
+			fmt.Printf("Scheduled change recompute updated %d rows.\n", updated)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"stock-app/internal/api/timeseries"
+	"stock-app/internal/cache"
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+	"stock-app/pkg/config"
+	"stock-app/pkg/logger"
+)
+
+// fakeClock is a Clock whose time is set by the test and whose tickers tick only when the test sends on them.
+// Each read of the time is reported on reads, so the test can wait for a tick to have seen it.
+type fakeClock struct {
+	mu       sync.Mutex
+	now      time.Time
+	ticks    chan time.Time
+	reads    chan struct{}
+	interval time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	now := c.now
+	c.mu.Unlock()
+	c.reads <- struct{}{}
+	return now
+}
+
+func (c *fakeClock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// NewTicker returns a ticker ticking on ticks the first time, for the schedule under test. Later
+// tickers, such as the refresh lock renewal's, never tick.
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.interval != 0 {
+		return fakeTicker{}
+	}
+	c.interval = d
+	return fakeTicker{c.ticks}
+}
+
+type fakeTicker struct {
+	c chan time.Time
+}
+
+func (t fakeTicker) C() <-chan time.Time { return t.c }
+func (t fakeTicker) Stop()               {}
+
+// NewTimer returns a timer that never fires, as fakeClock only drives ticker schedules.
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	return fakeTimer{}
+}
+
+type fakeTimer struct {
+	c chan time.Time
+	d time.Duration
+}
+
+func (t fakeTimer) C() <-chan time.Time { return t.c }
+func (t fakeTimer) Stop() bool          { return true }
+
+// timerClock is a Clock whose time is set by the test and whose timers are sent on timers, for the
+// test to fire them. Its tickers never tick.
+type timerClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers chan fakeTimer
+}
+
+func (c *timerClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *timerClock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func (c *timerClock) NewTicker(d time.Duration) Ticker {
+	return fakeTicker{}
+}
+
+func (c *timerClock) NewTimer(d time.Duration) Timer {
+	timer := fakeTimer{c: make(chan time.Time, 1), d: d}
+	c.timers <- timer
+	return timer
+}
+
+func TestScheduleIntradayRefresh(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := time.Date(2025, time.March, 12, 11, 0, 0, 0, newYork)
+	closed := time.Date(2025, time.March, 15, 11, 0, 0, 0, newYork)
+
+	// Premium endpoint messages aren't retried, so each refresh makes a single request
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"Information": "This is a premium endpoint."}`))
+	}))
+	defer server.Close()
+
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisServer.Close()
+
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.AlphaVantageRateLimit = 0
+	config.AppConfig.SymbolList = []string{"AAPL"}
+	config.AppConfig.RefreshLockTTL = time.Minute
+	clock := &fakeClock{ticks: make(chan time.Time), reads: make(chan struct{})}
+	locker := cache.NewLocker(redis.NewClient(&redis.Options{Addr: redisServer.Addr()}))
+	jobStore := cache.NewJobStore(redis.NewClient(&redis.Options{Addr: redisServer.Addr()}))
+	ru := NewRefreshUseCase(nil, timeseries.NewTimeSeriesFetcher(server.URL+"/query", "key", []string{"AAPL"}, logger.NewLogger("error")), jobStore, locker)
+	ru.clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ru.ScheduleIntradayRefresh(ctx, 5*time.Minute)
+		close(done)
+	}()
+
+	// The ticks are unbuffered, so each send returns only once the previous tick has been handled.
+	// A tick during the session reads the time three more times, when its job is created, started and finished.
+	tick := func(now time.Time) {
+		clock.set(now)
+		clock.ticks <- now
+		reads := 1
+		if now.Equal(open) {
+			reads = 4
+		}
+		for i := 0; i < reads; i++ {
+			<-clock.reads
+		}
+	}
+	tick(open)
+	tick(closed)
+	tick(closed)
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests after an open and two closed ticks = %d, want 1", got)
+	}
+	tick(open)
+	tick(closed)
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("requests after a second open tick = %d, want 2", got)
+	}
+
+	cancel()
+	<-done
+	if clock.interval != 5*time.Minute {
+		t.Errorf("ticker interval = %v, want %v", clock.interval, 5*time.Minute)
+	}
+}
+
+func TestStartRefreshIdempotency(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	config.AppConfig.IdempotencyKeyTTL = time.Minute
+	config.AppConfig.RefreshLockTTL = time.Minute
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	jobStore := cache.NewJobStore(client)
+	ru := NewRefreshUseCase(nil, timeseries.NewTimeSeriesFetcher("http://localhost/query", "key", nil, logger.NewLogger("error")), jobStore, cache.NewLocker(client))
+
+	// start starts a refresh with key and waits for its job to finish, so runs never overlap.
+	start := func(key string) (*entity.RefreshJob, bool) {
+		t.Helper()
+		job, created, err := ru.StartRefresh(key)
+		if err != nil {
+			t.Fatalf("StartRefresh(%q) error = %v", key, err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			stored, err := ru.GetRefreshJob(job.ID)
+			if err == nil && stored.Status == entity.RefreshSucceeded {
+				return job, created
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("refresh job %s did not finish: %+v, %v", job.ID, stored, err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	first, created := start("retry-1")
+	if !created {
+		t.Fatal("StartRefresh() did not create a job for a new key")
+	}
+	repeated, created := start("retry-1")
+	if created || repeated.ID != first.ID {
+		t.Errorf("StartRefresh() within the TTL = job %s, created %v, want job %s, created false", repeated.ID, created, first.ID)
+	}
+	if repeated.Status != entity.RefreshSucceeded {
+		t.Errorf("StartRefresh() within the TTL returned status %q, want the stored %q", repeated.Status, entity.RefreshSucceeded)
+	}
+	if other, created := start("retry-2"); !created || other.ID == first.ID {
+		t.Errorf("StartRefresh() with another key = job %s, created %v, want a new job", other.ID, created)
+	}
+
+	server.FastForward(time.Minute + time.Second)
+	expired, created := start("retry-1")
+	if !created || expired.ID == first.ID {
+		t.Errorf("StartRefresh() after the TTL = job %s, created %v, want a new job", expired.ID, created)
+	}
+
+	if job, _ := start(""); job.ID == expired.ID {
+		t.Errorf("StartRefresh() without a key reused job %s", job.ID)
+	}
+}
+
+// failingSaveStore is a JobStore whose jobs can't be saved.
+type failingSaveStore struct {
+	cache.JobStore
+}
+
+func (failingSaveStore) SaveJob(job *entity.RefreshJob, expiration time.Duration) error {
+	return fmt.Errorf("redis unavailable")
+}
+
+func TestStartRefreshSaveFailure(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	config.AppConfig.IdempotencyKeyTTL = time.Minute
+	jobStore := cache.NewJobStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	ru := NewRefreshUseCase(nil, timeseries.NewTimeSeriesFetcher("http://localhost/query", "key", nil, logger.NewLogger("error")), failingSaveStore{jobStore}, nil)
+
+	if _, _, err := ru.StartRefresh("retry-1"); err == nil {
+		t.Fatal("StartRefresh() error = nil when the job could not be saved")
+	}
+	// The key is released, so a retry can claim it for a new job
+	if _, claimed, err := jobStore.ClaimIdempotencyKey("retry-1", "next", time.Minute); err != nil || !claimed {
+		t.Errorf("ClaimIdempotencyKey() after the failed start = %v, %v, want the key claimed", claimed, err)
+	}
+}
+
+func TestGetRefreshHistory(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	jobStore := cache.NewJobStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	ru := NewRefreshUseCase(nil, nil, jobStore, nil)
+	// Finished oldest to newest; the history keeps the newest 4
+	for _, job := range []*entity.RefreshJob{
+		{ID: "trimmed", Type: entity.RefreshTypeDaily, Status: entity.RefreshFailed},
+		{ID: "1", Type: entity.RefreshTypeManual, Status: entity.RefreshSucceeded},
+		{ID: "2", Type: entity.RefreshTypeIntraday, Status: entity.RefreshFailed, Error: "rate limited"},
+		{ID: "3", Type: entity.RefreshTypeDaily, Status: entity.RefreshSucceeded, RowsInserted: 42},
+		{ID: "4", Type: entity.RefreshTypeIntraday, Status: entity.RefreshFailed},
+	} {
+		if err := jobStore.AppendHistory(job, 4); err != nil {
+			t.Fatalf("AppendHistory(%s) error = %v", job.ID, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		limit  int
+		want   []string
+	}{
+		{name: "newest first", limit: 20, want: []string{"4", "3", "2", "1"}},
+		{name: "limited", limit: 2, want: []string{"4", "3"}},
+		{name: "failed only", status: entity.RefreshFailed, limit: 20, want: []string{"4", "2"}},
+		{name: "failed only, limited", status: entity.RefreshFailed, limit: 1, want: []string{"4"}},
+		{name: "no match", status: entity.RefreshRunning, limit: 20, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, err := ru.GetRefreshHistory(tt.status, tt.limit)
+			if err != nil {
+				t.Fatalf("GetRefreshHistory() error = %v", err)
+			}
+			ids := make([]string, len(jobs))
+			for i, job := range jobs {
+				ids[i] = job.ID
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("GetRefreshHistory(%q, %d) = %v, want %v", tt.status, tt.limit, ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissedDailyRefresh(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	et := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2025, month, day, hour, min, 0, 0, newYork)
+	}
+	delay := 30 * time.Minute
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		wantMissed bool
+		want       time.Time
+	}{
+		{name: "started before today's run", now: et(time.March, 12, 10, 0)},
+		{name: "started after today's run", now: et(time.March, 12, 18, 0), wantMissed: true, want: et(time.March, 12, 16, 30)},
+		{name: "started at today's run", now: et(time.March, 12, 16, 30), wantMissed: true, want: et(time.March, 12, 16, 30)},
+		{name: "started on a weekend", now: et(time.March, 15, 18, 0)},
+		{name: "started on a holiday", now: et(time.April, 18, 18, 0)},
+		{name: "started from another zone", now: et(time.March, 12, 18, 0).UTC(), wantMissed: true, want: et(time.March, 12, 16, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, missed := missedDailyRefresh(tt.now, delay)
+			if missed != tt.wantMissed || !got.Equal(tt.want) {
+				t.Errorf("missedDailyRefresh(%v) = %v, %v, want %v, %v", tt.now, got, missed, tt.want, tt.wantMissed)
+			}
+		})
+	}
+}
+
+// latestDailyRepo is a StockRepo already holding the daily data up to latest.
+type latestDailyRepo struct {
+	repository.StockRepo
+	latest string
+}
+
+func (repo latestDailyRepo) GetLatestDailyDataDate(symbol string) (string, error) {
+	return repo.latest, nil
+}
+
+func TestScheduleDailyRefresh(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	et := func(day, hour, min int) time.Time {
+		return time.Date(2025, time.March, day, hour, min, 0, 0, newYork)
+	}
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{
+			"Meta Data": {"1. Information": "Daily Prices", "2. Symbol": "AAPL", "3. Last Refreshed": "2025-03-14", "4. Output Size": "Compact", "5. Time Zone": "US/Eastern"},
+			"Time Series (Daily)": {"2025-03-14": {"1. open": "211", "2. high": "214", "3. low": "210", "4. close": "213", "5. volume": "1000"}}
+		}`))
+	}))
+	defer server.Close()
+
+	redisServer := miniredis.RunT(t)
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.AlphaVantageRateLimit = 0
+	config.AppConfig.RefreshLockTTL = time.Minute
+	client := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	locker, jobStore := cache.NewLocker(client), cache.NewJobStore(client)
+
+	// start runs the schedule of a new instance from now, returning its clock and a func stopping it
+	start := func(now time.Time) (*timerClock, func()) {
+		clock := &timerClock{now: now, timers: make(chan fakeTimer)}
+		ru := NewRefreshUseCase(latestDailyRepo{latest: "2025-03-14"}, timeseries.NewTimeSeriesFetcher(server.URL+"/query", "key", []string{"AAPL"}, logger.NewLogger("error")), jobStore, locker)
+		ru.clock = clock
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			ru.ScheduleDailyRefresh(ctx, 30*time.Minute)
+			close(done)
+		}()
+		return clock, func() {
+			cancel()
+			<-done
+		}
+	}
+	// nextRun waits for the schedule to set its timer and returns the time it fires at
+	nextRun := func(clock *timerClock) (fakeTimer, time.Time) {
+		t.Helper()
+		select {
+		case timer := <-clock.timers:
+			return timer, clock.Now().Add(timer.d)
+		case <-time.After(time.Second):
+			t.Fatal("the schedule did not set a timer")
+		}
+		return fakeTimer{}, time.Time{}
+	}
+
+	// Friday morning: the refresh runs once, 30 minutes after the close
+	clock, stop := start(et(14, 10, 0))
+	timer, at := nextRun(clock)
+	if !at.Equal(et(14, 16, 30)) {
+		t.Errorf("first run at %v, want Friday 16:30 ET", at)
+	}
+	if got := atomic.LoadInt32(&requests); got != 0 {
+		t.Errorf("requests before the close = %d, want 0", got)
+	}
+	clock.set(at)
+	timer.c <- at
+
+	// The weekend is skipped
+	_, at = nextRun(clock)
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests after the Friday run = %d, want 1", got)
+	}
+	if !at.Equal(et(17, 16, 30)) {
+		t.Errorf("run after Friday at %v, want Monday 16:30 ET", at)
+	}
+	stop()
+
+	// A restart after Friday's run doesn't run it again
+	clock, stop = start(et(14, 17, 0))
+	if _, at = nextRun(clock); !at.Equal(et(17, 16, 30)) {
+		t.Errorf("run after restarting on Friday evening at %v, want Monday 16:30 ET", at)
+	}
+	stop()
+
+	// Nor does a start over the weekend
+	clock, stop = start(et(15, 12, 0))
+	if _, at = nextRun(clock); !at.Equal(et(17, 16, 30)) {
+		t.Errorf("run after starting on Saturday at %v, want Monday 16:30 ET", at)
+	}
+	stop()
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests after the restarts = %d, want 1", got)
+	}
+}
@@ -1,7 +1,10 @@
 package usecase
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"stock-app/internal/api/realtime"
@@ -12,12 +15,20 @@ import (
 	"stock-app/pkg/utils"
 )
 
+// barBufferSize is the capacity of the channel carrying completed real-time bars to the DB writer.
+const barBufferSize = 1000
+
+// maxBarWriteAttempts is how many times in a row a batch of real-time bars is written to the DB before
+// it is dropped, so bars don't pile up in memory while the DB is down.
+const maxBarWriteAttempts = 3
+
 // StockFetchingUseCase defines the business logic related to stock data.
 type StockFetchingUseCase struct {
 	stockRepo       repository.StockRepo
 	stockCache      cache.StockCache
 	rtFetcher       *realtime.RealTimeFetcher
 	latestQuoteData *entity.LatestQuoteData
+	barWriter       sync.WaitGroup
 }
 
 func NewStockFetchingUseCase(
@@ -34,8 +45,9 @@ func NewStockFetchingUseCase(
 	}
 }
 
-// FetchData update initial data to DB as service starts
-func (sf *StockFetchingUseCase) FetchRealTimeData() error {
+// FetchData update initial data to DB as service starts, then starts the real-time updates, which run
+// until ctx is cancelled
+func (sf *StockFetchingUseCase) FetchRealTimeData(ctx context.Context) error {
 	fmt.Println("Fetching historical data ...")
 	historicalData, err := sf.GetAllHistoricalData()
 	if err != nil {
@@ -49,117 +61,272 @@ func (sf *StockFetchingUseCase) FetchRealTimeData() error {
 	}
 	fmt.Println("Successfully fetched and pre-populated latest data to latestQuoteData.")
 
-	// fmt.Println("Starting real-time updates...")
-	// sf.rtFetcher.StartRealTimeUpdates(sf.latestQuoteData)
-	// fmt.Println("Real-time updates started.")
+	if config.AppConfig.RealTimeTradesEndpoint == "" {
+		fmt.Println("REAL_TIME_TRADES_ENDPOINT is not set, skipping real-time updates.")
+		return nil
+	}
+
+	fmt.Println("Starting real-time updates...")
+	bars := make(chan *entity.StockQuote, barBufferSize)
+	sf.barWriter.Add(1)
+	go func() {
+		defer sf.barWriter.Done()
+		sf.WriteBars(bars)
+	}()
+	sf.rtFetcher.StartRealTimeUpdates(ctx, sf.latestQuoteData, bars)
+	fmt.Println("Real-time updates started.")
 
-	// fmt.Println("Start cron-job to Write data by minute...")
-	// go sf.ScheduleDataWrite()
+	fmt.Println("Start cron-job to Write data by minute...")
+	go sf.ScheduleDataWrite(ctx)
 
 	return nil
 }
 
+// Wait blocks until the real-time bars still pending when the updates stopped are written to the DB.
+func (sf *StockFetchingUseCase) Wait() {
+	sf.barWriter.Wait()
+}
+
+// GetAllHistoricalData retrieves the historical data of all configured symbols, capped at the most
+// recent MAX_POINTS_PER_SYMBOL quotes of each. When the cache only holds some of the symbols, only the
+// missing ones are fetched from DB and merged in.
 func (sf *StockFetchingUseCase) GetAllHistoricalData() (map[string][]*entity.StockQuote, error) {
 	startTime := time.Now().Add(-config.AppConfig.HistoricalDataDuration)
 	endTime := time.Now()
-	// Fetch historical data from cache
-	historicalData, found := sf.stockCache.GetAll(startTime, endTime)
+	maxPoints := config.AppConfig.MaxPointsPerSymbol
+	// Fetch historical data from cache, reading only the most recent maxPoints of each symbol
+	historicalData, found := sf.stockCache.GetAll(startTime, endTime, maxPoints)
 	if !found {
 		fmt.Println("Cache is empty. Fetching historical data from DB (may need to refresh)...")
-		historicalData, err := sf.stockRepo.GetAllHistoricalData(startTime, endTime)
+		historicalData, err := sf.stockRepo.GetAllHistoricalData(startTime, endTime, maxPoints)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch historical data from DB: %w", err)
 		}
 		fmt.Printf("Fetched %d historical data from DB\n", len(historicalData))
+		for symbol, quotes := range historicalData {
+			historicalData[symbol] = capPoints(quotes, maxPoints)
+		}
 
 		if err := sf.updateCache(historicalData); err != nil {
 			return nil, err
 		}
 		fmt.Println("Successfully updated cache with historical data from DB.")
-	} else {
+		return historicalData, nil
+	}
+
+	for symbol, quotes := range historicalData {
+		historicalData[symbol] = capPoints(quotes, maxPoints)
+	}
+
+	var missing []string
+	for _, symbol := range config.AppConfig.SymbolList {
+		if _, exists := historicalData[symbol]; !exists {
+			missing = append(missing, symbol)
+		}
+	}
+	if len(missing) == 0 {
 		fmt.Println("Fetched historical data from cache.")
+		return historicalData, nil
+	}
+
+	fmt.Printf("Cache is missing %d symbols %v. Fetching them from DB...\n", len(missing), missing)
+	missingData, err := sf.stockRepo.GetHistoricalDataForSymbols(missing, startTime, endTime, maxPoints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch historical data for %v from DB: %w", missing, err)
 	}
+	for _, symbol := range missing {
+		quotes, exists := missingData[symbol]
+		if !exists {
+			fmt.Printf("No historical data in DB for %s (may need to refresh)\n", symbol)
+			continue
+		}
+		quotes = capPoints(quotes, maxPoints)
+		missingData[symbol] = quotes
+		historicalData[symbol] = quotes
+	}
+
+	if err := sf.updateCache(missingData); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Merged %d symbols from DB into cached historical data.\n", len(missingData))
 	return historicalData, nil
 }
 
+// capPoints sorts the quotes by time and keeps only the most recent maxPoints, or all of them when
+// maxPoints is not positive.
+func capPoints(quotes []*entity.StockQuote, maxPoints int) []*entity.StockQuote {
+	sort.Slice(quotes, func(i, j int) bool {
+		return quotes[i].Timestamp.Before(quotes[j].Timestamp)
+	})
+	if maxPoints > 0 && len(quotes) > maxPoints {
+		return quotes[len(quotes)-maxPoints:]
+	}
+	return quotes
+}
+
 func (sf *StockFetchingUseCase) PrePopulateLatestData(latestData map[string][]*entity.StockQuote) error {
 	// Pre-populate latest data, preparing for real-time updates
 	for symbol, quotes := range latestData {
-		sf.latestQuoteData.Mu.Lock()
 		fmt.Printf("Pre-populating latest data for symbol: %s with data: %v\n", symbol, quotes[len(quotes)-1])
-		sf.latestQuoteData.StockData[symbol] = quotes[len(quotes)-1]
-		sf.latestQuoteData.Mu.Unlock()
+		sf.latestQuoteData.Set(symbol, quotes[len(quotes)-1])
 	}
 
 	return nil
 }
 
+// updateCache adds the quotes that are missing from the cache or differ from the cached quote with the
+// same timestamp, so a refresh only writes new, corrected and backfilled points. The cached quotes of
+// all symbols are read in one round trip. Symbols without such quotes are left untouched.
 func (sf *StockFetchingUseCase) updateCache(latestData map[string][]*entity.StockQuote) error {
 	var ttl time.Duration
-	if utils.IsUSMarketOpen(time.Now()) {
+	if utils.AnyMarketOpen(config.AppConfig.SymbolList, time.Now()) {
 		ttl = config.AppConfig.CacheShortTTL
 	} else {
 		ttl = config.AppConfig.CacheLongTTL
 	}
 
-	if err := sf.stockCache.SetAll(latestData, ttl); err != nil {
+	symbols := make([]string, 0, len(latestData))
+	var oldest, newest time.Time
+	for symbol, quotes := range latestData {
+		symbols = append(symbols, symbol)
+		for _, quote := range quotes {
+			if oldest.IsZero() || quote.Timestamp.Before(oldest) {
+				oldest = quote.Timestamp
+			}
+			if quote.Timestamp.After(newest) {
+				newest = quote.Timestamp
+			}
+		}
+	}
+	cached, err := sf.stockCache.GetMany(symbols, oldest, newest)
+	if err != nil {
+		// Without the cached quotes to compare with, every quote is written
+		fmt.Printf("Failed to read cached quotes, rewriting all of them: %v\n", err)
+		cached = nil
+	}
+
+	delta := make(map[string][]*entity.StockQuote, len(latestData))
+	for symbol, quotes := range latestData {
+		if changed := changedQuotes(cached[symbol], quotes); len(changed) > 0 {
+			delta[symbol] = changed
+		}
+	}
+	if len(delta) == 0 {
+		fmt.Println("Cache is up to date, no new quotes to add.")
+		return nil
+	}
+
+	if err := sf.stockCache.SetAll(delta, config.CacheTTL(config.CacheTypeHistory, ttl)); err != nil {
 		return fmt.Errorf("failed to set all from list in cache: %w", err)
 	}
+	fmt.Printf("Added new quotes of %d symbols to cache.\n", len(delta))
 	return nil
 }
 
-// ScheduleDataWrite schedules data write
-func (sf *StockFetchingUseCase) ScheduleDataWrite() {
-	ticker := time.NewTicker(time.Second * 10)
+// changedQuotes returns the quotes that have no cached quote with the same timestamp, or whose cached
+// quote differs from them.
+func changedQuotes(cached, quotes []*entity.StockQuote) []*entity.StockQuote {
+	byTime := make(map[int64]entity.StockQuote, len(cached))
+	for _, quote := range cached {
+		byTime[quote.Timestamp.Unix()] = *quote
+	}
+
+	var changed []*entity.StockQuote
+	for _, quote := range quotes {
+		cachedQuote, exists := byTime[quote.Timestamp.Unix()]
+		if !exists {
+			changed = append(changed, quote)
+			continue
+		}
+		// Compare everything but the timestamp, whose location doesn't survive the cache
+		current := *quote
+		cachedQuote.Timestamp, current.Timestamp = time.Time{}, time.Time{}
+		if cachedQuote != current {
+			changed = append(changed, quote)
+		}
+	}
+	return changed
+}
+
+// ScheduleDataWrite schedules data write every REALTIME_WRITE_INTERVAL until ctx is cancelled
+func (sf *StockFetchingUseCase) ScheduleDataWrite(ctx context.Context) {
+	ticker := time.NewTicker(config.AppConfig.RealTimeWriteInterval)
 	defer ticker.Stop()
 
-	if utils.IsUSMarketOpen(time.Now()) {
-		fmt.Println("US Market is open. Starting data Write cron-job...")
+	if utils.AnyMarketOpen(config.AppConfig.SymbolList, time.Now()) {
+		fmt.Println("Market is open. Starting data Write cron-job...")
 	} else {
-		fmt.Println("US Market is closed. Exiting data Write cron-job...")
+		fmt.Println("All markets are closed. Exiting data Write cron-job...")
 		return
 	}
 
-	for range ticker.C {
-		if err := sf.writeDataToCache(); err != nil {
-			fmt.Printf("Error during data Write: %v\n", err)
-		}
-		if err := sf.writeDataToDB(); err != nil {
-			fmt.Printf("Error during data Write: %v\n", err)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sf.writeDataToCache(); err != nil {
+				fmt.Printf("Error during data Write: %v\n", err)
+			}
 		}
 	}
 }
 
 func (sf *StockFetchingUseCase) writeDataToCache() error {
-	sf.latestQuoteData.Mu.Lock()
-	defer sf.latestQuoteData.Mu.Unlock()
-
 	// Write data to cache
-	if err := sf.stockCache.SetAllLatest(sf.latestQuoteData.StockData, config.AppConfig.CacheShortTTL); err != nil {
+	if err := sf.stockCache.SetAllLatest(sf.latestQuoteData.Snapshot(), config.CacheTTL(config.CacheTypeLatest, config.AppConfig.CacheShortTTL)); err != nil {
 		return fmt.Errorf("error backing up data to cache: %v", err)
 	}
 	fmt.Printf("Successfully wrote data to cache\n")
 	return nil
 }
 
-func (sf *StockFetchingUseCase) writeDataToDB() error {
-	sf.latestQuoteData.Mu.Lock()
-	defer sf.latestQuoteData.Mu.Unlock()
-
-	for symbol, quote := range sf.latestQuoteData.StockData {
-		timestampStr := quote.Timestamp.Format("2006-01-02 15:04:05")
-		if err := sf.stockRepo.InsertIntradayData(
-			symbol,
-			timestampStr,
-			fmt.Sprintf("%f", quote.OpenPrice),
-			fmt.Sprintf("%f", quote.HighPrice),
-			fmt.Sprintf("%f", quote.LowPrice),
-			fmt.Sprintf("%f", quote.PrevClose),
-			fmt.Sprintf("%f", quote.Volume),
-		); err != nil {
-			return fmt.Errorf("failed to write data for symbol %s: %w", symbol, err)
+// WriteBars consumes completed real-time bars and persists them to the DB in batches, every
+// REALTIME_WRITE_INTERVAL or as soon as REALTIME_WRITE_BATCH_SIZE bars are pending, whichever comes first.
+// Once bars is closed, the pending bars are written and WriteBars returns.
+func (sf *StockFetchingUseCase) WriteBars(bars <-chan *entity.StockQuote) {
+	interval := config.AppConfig.RealTimeWriteInterval
+	maxBatch := config.AppConfig.RealTimeWriteBatchSize
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []*entity.StockQuote
+	failures := 0
+	for {
+		select {
+		case bar, ok := <-bars:
+			if !ok {
+				sf.flushBars(batch, failures)
+				return
+			}
+			batch = append(batch, bar)
+			if maxBatch > 0 && len(batch) >= maxBatch {
+				batch, failures = sf.flushBars(batch, failures)
+				// Count the next interval from this flush
+				ticker.Reset(interval)
+			}
+		case <-ticker.C:
+			batch, failures = sf.flushBars(batch, failures)
 		}
 	}
-	fmt.Printf("Successfully wrote data to db\n")
-	return nil
+}
+
+// flushBars writes the batch to the DB and returns the batch to reuse along with the number of failed
+// writes of the bars it still holds. A batch is kept for the next flush when the write fails, and
+// dropped once it failed maxBarWriteAttempts times in a row.
+func (sf *StockFetchingUseCase) flushBars(batch []*entity.StockQuote, failures int) ([]*entity.StockQuote, int) {
+	if len(batch) == 0 {
+		return batch, 0
+	}
+	if _, err := sf.stockRepo.InsertIntradayBars(batch, repository.SourceRealtime); err != nil {
+		failures++
+		if failures < maxBarWriteAttempts {
+			fmt.Printf("Error writing %d bars to db (attempt %d of %d): %v\n", len(batch), failures, maxBarWriteAttempts, err)
+			return batch, failures
+		}
+		fmt.Printf("Dropping %d bars after %d failed writes to db: %v\n", len(batch), failures, err)
+		return batch[:0], 0
+	}
+	fmt.Printf("Successfully wrote %d bars to db\n", len(batch))
+	return batch[:0], 0
 }
@@ -0,0 +1,385 @@
+package usecase
+
+import (
+	stderrors "errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"stock-app/internal/cache"
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+	"stock-app/pkg/config"
+)
+
+func TestWriteBars(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.RealTimeWriteInterval = time.Hour
+	config.AppConfig.RealTimeWriteBatchSize = 0
+	repo := &stubRepo{}
+	sf := &StockFetchingUseCase{stockRepo: repo}
+	bars := make(chan *entity.StockQuote, barBufferSize)
+	done := make(chan struct{})
+	go func() {
+		sf.WriteBars(bars)
+		close(done)
+	}()
+
+	minute := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)
+	bars <- &entity.StockQuote{Symbol: "AAPL", Price: 101, Timestamp: minute}
+	bars <- &entity.StockQuote{Symbol: "MSFT", Price: 402, Timestamp: minute}
+	close(bars)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("WriteBars() did not return after bars was closed")
+	}
+	if len(repo.quotes) != 2 || repo.quotes[0].Symbol != "AAPL" || repo.quotes[1].Symbol != "MSFT" {
+		t.Errorf("repo received %v, want the AAPL and MSFT bars", repo.quotes)
+	}
+}
+
+// batchRepo reports each batch of bars written to it.
+type batchRepo struct {
+	repository.StockRepo
+	batches chan []*entity.StockQuote
+}
+
+func (repo *batchRepo) InsertIntradayBars(bars []*entity.StockQuote, source string) (int64, error) {
+	repo.batches <- append([]*entity.StockQuote(nil), bars...)
+	return int64(len(bars)), nil
+}
+
+func TestWriteBarsFlushTriggers(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	minute := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		interval  time.Duration
+		batchSize int
+		sent      int
+		want      int
+	}{
+		{name: "batch size reached first", interval: time.Hour, batchSize: 3, sent: 4, want: 3},
+		{name: "interval elapsed first", interval: 50 * time.Millisecond, batchSize: 500, sent: 2, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig.RealTimeWriteInterval = tt.interval
+			config.AppConfig.RealTimeWriteBatchSize = tt.batchSize
+			repo := &batchRepo{batches: make(chan []*entity.StockQuote, 4)}
+			sf := &StockFetchingUseCase{stockRepo: repo}
+			bars := make(chan *entity.StockQuote, barBufferSize)
+			done := make(chan struct{})
+			go func() {
+				sf.WriteBars(bars)
+				close(done)
+			}()
+			defer func() {
+				close(bars)
+				<-done
+			}()
+
+			for i := 0; i < tt.sent; i++ {
+				bars <- &entity.StockQuote{Symbol: "AAPL", Price: float64(i), Timestamp: minute.Add(time.Duration(i) * time.Minute)}
+			}
+			select {
+			case batch := <-repo.batches:
+				if len(batch) != tt.want {
+					t.Errorf("first flush wrote %d bars, want %d", len(batch), tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("WriteBars() did not flush")
+			}
+			select {
+			case batch := <-repo.batches:
+				if tt.want < tt.sent {
+					t.Errorf("remaining %d bars were flushed before the interval elapsed", len(batch))
+				}
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestCapPoints(t *testing.T) {
+	minute := func(m int) time.Time {
+		return time.Date(2025, time.June, 11, 10, m, 0, 0, time.UTC)
+	}
+	quotes := func(minutes ...int) []*entity.StockQuote {
+		quotes := make([]*entity.StockQuote, len(minutes))
+		for i, m := range minutes {
+			quotes[i] = &entity.StockQuote{Symbol: "AAPL", Timestamp: minute(m)}
+		}
+		return quotes
+	}
+
+	tests := []struct {
+		name      string
+		quotes    []*entity.StockQuote
+		maxPoints int
+		want      []int
+	}{
+		{name: "most recent kept", quotes: quotes(0, 1, 2, 3), maxPoints: 2, want: []int{2, 3}},
+		{name: "sorted before capping", quotes: quotes(3, 0, 2, 1), maxPoints: 3, want: []int{1, 2, 3}},
+		{name: "fewer than the cap", quotes: quotes(1, 0), maxPoints: 5, want: []int{0, 1}},
+		{name: "no cap", quotes: quotes(2, 0, 1), maxPoints: 0, want: []int{0, 1, 2}},
+		{name: "empty", quotes: nil, maxPoints: 2, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := capPoints(tt.quotes, tt.maxPoints)
+			if len(got) != len(tt.want) {
+				t.Fatalf("capPoints() returned %d quotes, want %d", len(got), len(tt.want))
+			}
+			for i, quote := range got {
+				if !quote.Timestamp.Equal(minute(tt.want[i])) {
+					t.Errorf("quote %d is at %v, want %v", i, quote.Timestamp, minute(tt.want[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestFlushBars(t *testing.T) {
+	batch := []*entity.StockQuote{{Symbol: "AAPL"}, {Symbol: "MSFT"}}
+
+	tests := []struct {
+		name         string
+		err          error
+		failures     int
+		wantKept     int
+		wantFailures int
+	}{
+		{name: "written", failures: 0, wantKept: 0, wantFailures: 0},
+		{name: "written after failures", failures: maxBarWriteAttempts - 1, wantKept: 0, wantFailures: 0},
+		{name: "first failure kept", err: stderrors.New("connection refused"), failures: 0, wantKept: 2, wantFailures: 1},
+		{name: "last failure dropped", err: stderrors.New("connection refused"), failures: maxBarWriteAttempts - 1, wantKept: 0, wantFailures: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sf := &StockFetchingUseCase{stockRepo: &stubRepo{err: tt.err}}
+			kept, failures := sf.flushBars(append([]*entity.StockQuote(nil), batch...), tt.failures)
+			if len(kept) != tt.wantKept || failures != tt.wantFailures {
+				t.Errorf("flushBars() kept %d bars after %d failures, want %d after %d", len(kept), failures, tt.wantKept, tt.wantFailures)
+			}
+		})
+	}
+}
+
+// historyRepo is a StockRepo serving the intraday quotes of the given symbols, recording the symbols
+// looked up.
+type historyRepo struct {
+	repository.StockRepo
+	history map[string][]*entity.StockQuote
+	lookups [][]string
+}
+
+func (repo *historyRepo) GetHistoricalDataForSymbols(symbols []string, start, end time.Time, maxPoints int) (map[string][]*entity.StockQuote, error) {
+	repo.lookups = append(repo.lookups, symbols)
+	found := make(map[string][]*entity.StockQuote)
+	for _, symbol := range symbols {
+		if quotes, exists := repo.history[symbol]; exists {
+			found[symbol] = quotes
+		}
+	}
+	return found, nil
+}
+
+// historyCache is a StockCache holding the intraday quotes by symbol, recording those cached.
+type historyCache struct {
+	cache.StockCache
+	history map[string][]*entity.StockQuote
+	set     map[string][]*entity.StockQuote
+}
+
+func (c *historyCache) GetAll(start, end time.Time, limit int) (map[string][]*entity.StockQuote, bool) {
+	history := make(map[string][]*entity.StockQuote, len(c.history))
+	for symbol, quotes := range c.history {
+		history[symbol] = quotes
+	}
+	return history, len(history) > 0
+}
+
+func (c *historyCache) SetAll(stocks map[string][]*entity.StockQuote, expiration time.Duration) error {
+	c.set = stocks
+	return nil
+}
+
+func (c *historyCache) GetMany(symbols []string, start, end time.Time) (map[string][]*entity.StockQuote, error) {
+	history := make(map[string][]*entity.StockQuote, len(symbols))
+	for _, symbol := range symbols {
+		if quotes, exists := c.history[symbol]; exists {
+			history[symbol] = quotes
+		}
+	}
+	return history, nil
+}
+
+func TestGetAllHistoricalDataPartialCache(t *testing.T) {
+	symbolList := config.AppConfig.SymbolList
+	defer func() { config.AppConfig.SymbolList = symbolList }()
+	config.AppConfig.SymbolList = []string{"AAPL", "MSFT", "TSLA", "NOPE"}
+
+	quotes := func(symbol string) []*entity.StockQuote {
+		return []*entity.StockQuote{{Symbol: symbol, Price: 100}}
+	}
+	repo := &historyRepo{history: map[string][]*entity.StockQuote{"AAPL": quotes("AAPL"), "MSFT": quotes("MSFT"), "TSLA": quotes("TSLA")}}
+	stockCache := &historyCache{history: map[string][]*entity.StockQuote{"AAPL": quotes("AAPL"), "MSFT": quotes("MSFT")}}
+	sf := &StockFetchingUseCase{stockRepo: repo, stockCache: stockCache}
+
+	history, err := sf.GetAllHistoricalData()
+	if err != nil {
+		t.Fatalf("GetAllHistoricalData() error = %v", err)
+	}
+	if len(repo.lookups) != 1 || !reflect.DeepEqual(repo.lookups[0], []string{"TSLA", "NOPE"}) {
+		t.Errorf("repo looked up %v, want only the symbols missing from the cache [TSLA NOPE]", repo.lookups)
+	}
+	if len(history) != 3 || history["TSLA"] == nil {
+		t.Errorf("GetAllHistoricalData() returned %d symbols, want AAPL, MSFT and TSLA", len(history))
+	}
+	if len(stockCache.set) != 1 || stockCache.set["TSLA"] == nil {
+		t.Errorf("cached %v, want only the TSLA quotes fetched from the DB", stockCache.set)
+	}
+}
+
+func TestGetAllHistoricalDataCap(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.SymbolList = []string{"AAPL", "MSFT"}
+	config.AppConfig.MaxPointsPerSymbol = 2
+
+	start := time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)
+	quotes := func(symbol string, n int) []*entity.StockQuote {
+		quotes := make([]*entity.StockQuote, n)
+		for i := range quotes {
+			// Newest first, as neither source guarantees the order
+			quotes[i] = &entity.StockQuote{Symbol: symbol, Timestamp: start.Add(time.Duration(n-i) * time.Minute)}
+		}
+		return quotes
+	}
+	repo := &historyRepo{history: map[string][]*entity.StockQuote{"MSFT": quotes("MSFT", 5)}}
+	stockCache := &historyCache{history: map[string][]*entity.StockQuote{"AAPL": quotes("AAPL", 4)}}
+	sf := &StockFetchingUseCase{stockRepo: repo, stockCache: stockCache}
+
+	history, err := sf.GetAllHistoricalData()
+	if err != nil {
+		t.Fatalf("GetAllHistoricalData() error = %v", err)
+	}
+	for symbol, n := range map[string]int{"AAPL": 4, "MSFT": 5} {
+		got := history[symbol]
+		if len(got) != 2 || !got[0].Timestamp.Equal(start.Add(time.Duration(n-1)*time.Minute)) || !got[1].Timestamp.Equal(start.Add(time.Duration(n)*time.Minute)) {
+			t.Errorf("%s history = %v, want its 2 most recent quotes in time order", symbol, got)
+		}
+	}
+	if len(stockCache.set["MSFT"]) != 2 {
+		t.Errorf("cached %d MSFT quotes, want the 2 kept", len(stockCache.set["MSFT"]))
+	}
+}
+
+func TestChangedQuotes(t *testing.T) {
+	minute := func(m int) time.Time {
+		return time.Date(2025, time.June, 11, 10, m, 0, 0, time.UTC)
+	}
+	quote := func(m int, price float64) *entity.StockQuote {
+		return &entity.StockQuote{Symbol: "AAPL", Price: price, Timestamp: minute(m)}
+	}
+
+	tests := []struct {
+		name   string
+		cached []*entity.StockQuote
+		quotes []*entity.StockQuote
+		want   []time.Time
+	}{
+		{name: "nothing cached", quotes: []*entity.StockQuote{quote(0, 1), quote(1, 2)}, want: []time.Time{minute(0), minute(1)}},
+		{name: "unchanged", cached: []*entity.StockQuote{quote(0, 1), quote(1, 2)}, quotes: []*entity.StockQuote{quote(0, 1), quote(1, 2)}},
+		{name: "newer quote", cached: []*entity.StockQuote{quote(0, 1)}, quotes: []*entity.StockQuote{quote(0, 1), quote(1, 2)}, want: []time.Time{minute(1)}},
+		{name: "corrected quote", cached: []*entity.StockQuote{quote(0, 1), quote(1, 2)}, quotes: []*entity.StockQuote{quote(0, 1.5), quote(1, 2)}, want: []time.Time{minute(0)}},
+		{name: "backfilled older quote", cached: []*entity.StockQuote{quote(2, 1)}, quotes: []*entity.StockQuote{quote(0, 1), quote(2, 1)}, want: []time.Time{minute(0)}},
+		{
+			name:   "cached timestamp in another location",
+			cached: []*entity.StockQuote{{Symbol: "AAPL", Price: 1, Timestamp: minute(0).Local()}},
+			quotes: []*entity.StockQuote{quote(0, 1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := changedQuotes(tt.cached, tt.quotes)
+			if len(got) != len(tt.want) {
+				t.Fatalf("changedQuotes() returned %d quotes, want %d", len(got), len(tt.want))
+			}
+			for i, quote := range got {
+				if !quote.Timestamp.Equal(tt.want[i]) {
+					t.Errorf("quote %d is at %v, want %v", i, quote.Timestamp, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// recordingCache is a StockCache recording the quotes passed to SetAll before storing them.
+type recordingCache struct {
+	cache.StockCache
+	set map[string][]*entity.StockQuote
+}
+
+func (c *recordingCache) SetAll(stocks map[string][]*entity.StockQuote, expiration time.Duration) error {
+	c.set = stocks
+	return c.StockCache.SetAll(stocks, expiration)
+}
+
+func TestUpdateCacheAddsOnlyNewQuotes(t *testing.T) {
+	server := miniredis.RunT(t)
+	stockCache := &recordingCache{StockCache: cache.NewStockCache(redis.NewClient(&redis.Options{Addr: server.Addr()}))}
+	sf := &StockFetchingUseCase{stockCache: stockCache}
+	minute := func(m int) time.Time {
+		return time.Date(2025, time.June, 11, 10, m, 0, 0, time.UTC)
+	}
+	quote := func(symbol string, m int, price float64) *entity.StockQuote {
+		return &entity.StockQuote{Symbol: symbol, Price: price, Timestamp: minute(m)}
+	}
+
+	if err := sf.updateCache(map[string][]*entity.StockQuote{
+		"AAPL": {quote("AAPL", 0, 1), quote("AAPL", 1, 2)},
+		"MSFT": {quote("MSFT", 0, 10)},
+	}); err != nil {
+		t.Fatalf("first updateCache() error = %v", err)
+	}
+
+	// The refresh returns the cached points again along with a new AAPL point and a corrected MSFT one
+	if err := sf.updateCache(map[string][]*entity.StockQuote{
+		"AAPL": {quote("AAPL", 0, 1), quote("AAPL", 1, 2), quote("AAPL", 2, 3)},
+		"MSFT": {quote("MSFT", 0, 11)},
+		"TSLA": {},
+	}); err != nil {
+		t.Fatalf("second updateCache() error = %v", err)
+	}
+	if len(stockCache.set) != 2 || len(stockCache.set["AAPL"]) != 1 || !stockCache.set["AAPL"][0].Timestamp.Equal(minute(2)) {
+		t.Errorf("second updateCache() wrote %v, want only the new AAPL point and the corrected MSFT one", stockCache.set)
+	}
+	if len(stockCache.set["MSFT"]) != 1 || stockCache.set["MSFT"][0].Price != 11 {
+		t.Errorf("second updateCache() wrote MSFT %v, want the corrected point", stockCache.set["MSFT"])
+	}
+
+	aapl, _ := stockCache.Get("AAPL", minute(0), minute(2))
+	if len(aapl) != 3 {
+		t.Errorf("cached %d AAPL quotes, want 3", len(aapl))
+	}
+	msft, _ := stockCache.Get("MSFT", minute(0), minute(2))
+	if len(msft) != 1 || msft[0].Price != 11 {
+		t.Errorf("cached MSFT quotes %v, want only the corrected one", msft)
+	}
+
+	// Nothing is written when nothing changed
+	stockCache.set = nil
+	if err := sf.updateCache(map[string][]*entity.StockQuote{"AAPL": {quote("AAPL", 1, 2), quote("AAPL", 2, 3)}}); err != nil {
+		t.Fatalf("third updateCache() error = %v", err)
+	}
+	if stockCache.set != nil {
+		t.Errorf("third updateCache() wrote %v, want nothing", stockCache.set)
+	}
+}
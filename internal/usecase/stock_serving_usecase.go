@@ -1,13 +1,33 @@
 package usecase
 
 import (
+	"context"
+	stderrors "errors"
 	"fmt"
+	"math"
+	"sort"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"stock-app/internal/cache"
 	"stock-app/internal/entity"
+	"stock-app/internal/metrics"
 	"stock-app/internal/repository"
 	"stock-app/pkg/config"
+	"stock-app/pkg/errors"
+	"stock-app/pkg/utils"
+)
+
+// Data sources a response can be served from.
+const (
+	SourceCache  = "cache"
+	SourceDB     = "db"
+	SourceMemory = "memory"
+	// SourceDegraded marks data served from whatever the cache holds, possibly stale or partial,
+	// because the DB failed.
+	SourceDegraded = "degraded"
 )
 
 // StockServingUseCase defines the business logic related to stock data.
@@ -15,58 +35,765 @@ type StockServingUseCase struct {
 	stockRepo       repository.StockRepo
 	stockCache      cache.StockCache
 	latestQuoteData *entity.LatestQuoteData
+	companyIndex    *entity.CompanyIndex
+	querySlots      chan struct{}
+	revalidations   singleflight.Group
+	latestLoads     singleflight.Group
+	missingLatest   *missingSymbols
+	now             func() time.Time
+	aliases         map[string]string
+
+	// The newest intraday timestamp across all symbols, reused for LatestTimestampMaxAge
+	latestMu       sync.Mutex
+	latest         time.Time
+	latestLoadedAt time.Time
 }
 
+// LatestTimestampMaxAge is how long the newest intraday timestamp across all symbols is reused before
+// it is read from the DB again, so readiness probes don't each scan for it.
+const LatestTimestampMaxAge = 30 * time.Second
+
 // NewStockServingUseCase creates a new instance of StockServingUseCase.
 func NewStockServingUseCase(
 	stockRepo repository.StockRepo,
 	stockCache cache.StockCache,
 	latestQuoteData *entity.LatestQuoteData,
+	companyIndex *entity.CompanyIndex,
 ) *StockServingUseCase {
+	var querySlots chan struct{}
+	if config.AppConfig.MaxConcurrentQueries > 0 {
+		querySlots = make(chan struct{}, config.AppConfig.MaxConcurrentQueries)
+	}
+
 	return &StockServingUseCase{
 		stockRepo:       stockRepo,
 		stockCache:      stockCache,
 		latestQuoteData: latestQuoteData,
+		companyIndex:    companyIndex,
+		querySlots:      querySlots,
+		missingLatest:   newMissingSymbols(missingSymbolTTL),
+		now:             time.Now,
+		aliases:         config.AppConfig.SymbolAliases,
 	}
 }
 
-// GetLatestQuote retrieves the stock quote by symbol.
-func (uc *StockServingUseCase) GetQuote(symbol string, start, end time.Time) ([]*entity.StockQuote, error) {
+// ResolveSymbol returns the current symbol of a renamed ticker listed in SYMBOL_ALIASES, e.g. META for
+// FB, and whether symbol was such an alias. Every method taking a symbol resolves it, so old tickers
+// serve the new symbol's data.
+func (uc *StockServingUseCase) ResolveSymbol(symbol string) (string, bool) {
+	if resolved, ok := uc.aliases[utils.NormalizeSymbol(symbol)]; ok {
+		return resolved, true
+	}
+	return symbol, false
+}
+
+// acquireQuerySlot reserves one of the slots bounding concurrent historical DB queries, waiting
+// up to the configured queue timeout. The returned function releases the slot.
+func (uc *StockServingUseCase) acquireQuerySlot() (func(), error) {
+	if uc.querySlots == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(config.AppConfig.QueryQueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case uc.querySlots <- struct{}{}:
+		return func() { <-uc.querySlots }, nil
+	case <-timer.C:
+		return nil, &errors.OverloadedError{RetryAfter: time.Second}
+	}
+}
+
+// GetQuote retrieves the stock quotes by symbol and time range, along with the source they were served from.
+func (uc *StockServingUseCase) GetQuote(symbol string, start, end time.Time) ([]*entity.StockQuote, string, error) {
+	symbol, _ = uc.ResolveSymbol(symbol)
 	// Check cache for quotes within the specified time range
 	quotes, found := uc.stockCache.Get(symbol, start, end)
-	if !found || len(quotes) == 0 {
-		// get from stockRepo
+	if found && len(quotes) > 0 {
+		if uc.isStale(symbol) {
+			go uc.revalidate(symbol, start, end)
+		}
+		return quotes, SourceCache, nil
+	}
+
+	release, err := uc.acquireQuerySlot()
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	// get from stockRepo
+	quotes, err = uc.stockRepo.GetHistoricalData(symbol, start, end)
+	if err != nil {
+		if degraded, ok := uc.degradedQuotes(symbol, start, end, err); ok {
+			return degraded, SourceDegraded, nil
+		}
+		return nil, "", fmt.Errorf("failed to get historical data by symbol and range: %w", err)
+	}
+	if err := uc.stockCache.Set(symbol, quotes, config.CacheTTL(config.CacheTypeHistory, config.AppConfig.CacheShortTTL)); err != nil {
+		return nil, "", fmt.Errorf("failed to set historical data in cache: %w", err)
+	}
+	return quotes, SourceDB, nil
+}
+
+// isStale reports whether the cached quotes of a symbol are older than the stale-while-revalidate
+// threshold. It is always false when the threshold is not configured.
+func (uc *StockServingUseCase) isStale(symbol string) bool {
+	staleAfter := config.AppConfig.CacheStaleAfter
+	if staleAfter <= 0 {
+		return false
+	}
+	storedAt, found := uc.stockCache.StoredAt(symbol)
+	return found && time.Since(storedAt) > staleAfter
+}
+
+// revalidate refreshes the cached quotes of a symbol from the DB. Concurrent revalidations of the
+// same symbol are collapsed into one.
+func (uc *StockServingUseCase) revalidate(symbol string, start, end time.Time) {
+	_, err, _ := uc.revalidations.Do(symbol, func() (interface{}, error) {
+		release, err := uc.acquireQuerySlot()
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
 		quotes, err := uc.stockRepo.GetHistoricalData(symbol, start, end)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get historical data by symbol and range: %w", err)
+			return nil, err
 		}
-		if len(quotes) > 0 {
-			if err := uc.stockCache.Set(symbol, quotes, config.AppConfig.CacheShortTTL); err != nil {
-				return nil, fmt.Errorf("failed to set historical data in cache: %w", err)
-			}
+		return nil, uc.stockCache.Set(symbol, quotes, config.CacheTTL(config.CacheTypeHistory, config.AppConfig.CacheShortTTL))
+	})
+	if err != nil {
+		fmt.Printf("Failed to revalidate cached data for %s: %v\n", symbol, err)
+	}
+}
+
+// StreamQuotes passes the stock quotes by symbol and time range to fn as they are read from the DB,
+// bypassing the cache so that large ranges are never held in memory.
+func (uc *StockServingUseCase) StreamQuotes(symbol string, start, end time.Time, fn func(*entity.StockQuote) error) error {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	release, err := uc.acquireQuerySlot()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := uc.stockRepo.StreamHistoricalData(symbol, start, end, fn); err != nil {
+		return fmt.Errorf("failed to stream historical data by symbol and range: %w", err)
+	}
+	return nil
+}
+
+// StreamCandles passes the stock quotes by symbol and time range to fn like StreamQuotes, filtered to
+// session and resampled into buckets of the given resolution like GetCandles. The quotes are read in
+// time order, so each candle is passed on as soon as the first quote of the next bucket is read.
+func (uc *StockServingUseCase) StreamCandles(symbol string, start, end time.Time, resolution time.Duration, session utils.MarketSession, fn func(*entity.StockQuote) error) error {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	calendar := utils.CalendarForSymbol(symbol)
+	var current *entity.StockQuote
+	err := uc.StreamQuotes(symbol, start, end, func(q *entity.StockQuote) error {
+		if session != "" && calendar.SessionAtWallClock(q.Timestamp) != session {
+			return nil
 		}
+		if resolution <= time.Minute {
+			return fn(q)
+		}
+
+		bucketStart := truncateBucket(q.Timestamp, resolution)
+		if current != nil && current.Timestamp.Equal(bucketStart) {
+			addToCandle(current, q)
+			return nil
+		}
+		completed := current
+		current = newCandle(q, bucketStart)
+		addToCandle(current, q)
+		if completed != nil {
+			return fn(completed)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		return fn(current)
+	}
+	return nil
+}
+
+// GetRecentQuotes retrieves the n most recent stock quotes by symbol in chronological order.
+func (uc *StockServingUseCase) GetRecentQuotes(symbol string, n int) ([]*entity.StockQuote, error) {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	release, err := uc.acquireQuerySlot()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	quotes, err := uc.stockRepo.GetRecentQuotes(symbol, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent data by symbol: %w", err)
 	}
 	return quotes, nil
 }
 
-// GetAllQuotes retrieves stock data for all symbols.
-func (uc *StockServingUseCase) GetAllQuotes() (map[string]*entity.StockQuote, error) {
-	// Check cache for latest quotes of all symbols
-	quotes, found := uc.stockCache.GetAllLatest()
-	if !found {
-		// get from stockRepo
-		quotes, err := uc.stockRepo.GetAllLatestData()
+// GetCandles retrieves the stock quotes by symbol and resamples them into buckets of the given resolution.
+// When session is not empty, only the quotes within that trading session of the symbol's market are kept.
+func (uc *StockServingUseCase) GetCandles(symbol string, start, end time.Time, resolution time.Duration, session utils.MarketSession) ([]*entity.StockQuote, string, error) {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	quotes, source, err := uc.GetQuote(symbol, start, end)
+	if err != nil {
+		return nil, "", err
+	}
+	if session != "" {
+		quotes = filterSession(quotes, utils.CalendarForSymbol(symbol), session)
+	}
+	if resolution <= time.Minute {
+		return quotes, source, nil
+	}
+	return aggregateQuotes(quotes, resolution), source, nil
+}
+
+// filterSession returns the quotes whose timestamps fall within the given session of the calendar.
+// Intraday timestamps are stored as wall clock times of the exchange, so they are matched by wall clock.
+func filterSession(quotes []*entity.StockQuote, calendar utils.MarketCalendar, session utils.MarketSession) []*entity.StockQuote {
+	filtered := make([]*entity.StockQuote, 0, len(quotes))
+	for _, quote := range quotes {
+		if calendar.SessionAtWallClock(quote.Timestamp) == session {
+			filtered = append(filtered, quote)
+		}
+	}
+	return filtered
+}
+
+// aggregateQuotes groups the quotes into OHLCV buckets of the given size, ordered by time.
+func aggregateQuotes(quotes []*entity.StockQuote, bucket time.Duration) []*entity.StockQuote {
+	sorted := make([]*entity.StockQuote, len(quotes))
+	copy(sorted, quotes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	var candles []*entity.StockQuote
+	var current *entity.StockQuote
+	for _, q := range sorted {
+		bucketStart := truncateBucket(q.Timestamp, bucket)
+		if current == nil || !current.Timestamp.Equal(bucketStart) {
+			current = newCandle(q, bucketStart)
+			candles = append(candles, current)
+		}
+		addToCandle(current, q)
+	}
+	return candles
+}
+
+// newCandle returns an empty candle of the bucket starting at bucketStart, opened by q.
+func newCandle(q *entity.StockQuote, bucketStart time.Time) *entity.StockQuote {
+	return &entity.StockQuote{
+		Symbol:    q.Symbol,
+		OpenPrice: q.OpenPrice,
+		HighPrice: q.HighPrice,
+		LowPrice:  q.LowPrice,
+		Timestamp: bucketStart,
+	}
+}
+
+// addToCandle folds q, the newest quote of the candle's bucket so far, into the candle.
+func addToCandle(candle, q *entity.StockQuote) {
+	candle.Price = q.Price
+	candle.Change = q.Change
+	candle.ChangePercentage = q.ChangePercentage
+	candle.PrevClose = q.PrevClose
+	candle.HighPrice = utils.Max(candle.HighPrice, q.HighPrice)
+	candle.LowPrice = utils.Min(candle.LowPrice, q.LowPrice)
+	candle.Volume += q.Volume
+}
+
+// truncateBucket returns the start of the bucket of the given size that t falls in. Truncating
+// works on absolute time, i.e. at UTC midnight for daily buckets, so daily buckets instead start at
+// midnight of t's date in its own location. Intraday timestamps are the exchange's wall clock times,
+// so that is the exchange's trading date.
+func truncateBucket(t time.Time, bucket time.Duration) time.Time {
+	if bucket < 24*time.Hour {
+		return t.Truncate(bucket)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// GetDailyData retrieves the daily bars by symbol for a given date range.
+func (uc *StockServingUseCase) GetDailyData(symbol string, start, end time.Time) ([]*entity.DailyBar, error) {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	dailyBars, err := uc.stockRepo.GetDailyData(symbol, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily data by symbol and range: %w", err)
+	}
+	return dailyBars, nil
+}
+
+// GetLatestQuoteWithDaily retrieves the latest stock quote by symbol like GetLatestQuote, along with
+// the daily bar of the quote's trading day. The daily bar is nil when that day has no daily data yet.
+func (uc *StockServingUseCase) GetLatestQuoteWithDaily(symbol string) (*entity.StockQuote, *entity.DailyBar, string, error) {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	quote, source, err := uc.GetLatestQuote(symbol)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	day := time.Date(quote.Timestamp.Year(), quote.Timestamp.Month(), quote.Timestamp.Day(), 0, 0, 0, 0, time.UTC)
+	dailyBars, err := uc.stockRepo.GetDailyData(symbol, day, day)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to get daily data of the quote's trading day: %w", err)
+	}
+	if len(dailyBars) == 0 {
+		return quote, nil, source, nil
+	}
+	return quote, dailyBars[0], source, nil
+}
+
+// GetOpeningGaps retrieves the symbols whose latest open gapped from the previous close by more than
+// minPercent, in either direction, largest gaps first.
+func (uc *StockServingUseCase) GetOpeningGaps(minPercent float64) ([]*entity.OpeningGap, error) {
+	gaps, err := uc.stockRepo.GetOpeningGaps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get opening gaps: %w", err)
+	}
+	return filterOpeningGaps(gaps, minPercent), nil
+}
+
+// filterOpeningGaps keeps the gaps larger than minPercent in absolute value that opened on the latest
+// trading date of their exchange, i.e. the newest date among the gaps of the exchange's symbols, so a
+// symbol that didn't trade that day doesn't report an older gap as current. The gaps are sorted by
+// absolute size, largest first.
+func filterOpeningGaps(gaps []*entity.OpeningGap, minPercent float64) []*entity.OpeningGap {
+	latest := make(map[string]time.Time)
+	for _, gap := range gaps {
+		exchange := utils.CalendarForSymbol(gap.Symbol).Name
+		if gap.Date.After(latest[exchange]) {
+			latest[exchange] = gap.Date
+		}
+	}
+
+	filtered := []*entity.OpeningGap{}
+	for _, gap := range gaps {
+		if !gap.Date.Equal(latest[utils.CalendarForSymbol(gap.Symbol).Name]) {
+			continue
+		}
+		if math.Abs(gap.GapPercent) > minPercent {
+			filtered = append(filtered, gap)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return math.Abs(filtered[i].GapPercent) > math.Abs(filtered[j].GapPercent)
+	})
+	return filtered
+}
+
+// GetReturnStats retrieves the daily log return statistics by symbol for a given date range.
+func (uc *StockServingUseCase) GetReturnStats(symbol string, start, end time.Time) (*entity.ReturnStats, error) {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	stats, err := uc.stockRepo.GetReturnStats(symbol, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get return stats by symbol and range: %w", err)
+	}
+	return stats, nil
+}
+
+// GetDataRange retrieves the earliest and latest available data points by symbol.
+func (uc *StockServingUseCase) GetDataRange(symbol string) (time.Time, time.Time, error) {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	earliest, latest, err := uc.stockRepo.GetDataRange(symbol)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get data range by symbol: %w", err)
+	}
+	return earliest, latest, nil
+}
+
+// GetGlobalLatestTimestamp retrieves the newest intraday timestamp across all symbols, reading it from
+// the DB only when the value loaded last is older than LatestTimestampMaxAge.
+func (uc *StockServingUseCase) GetGlobalLatestTimestamp() (time.Time, error) {
+	uc.latestMu.Lock()
+	defer uc.latestMu.Unlock()
+	if !uc.latestLoadedAt.IsZero() && time.Since(uc.latestLoadedAt) < LatestTimestampMaxAge {
+		return uc.latest, nil
+	}
+	return uc.loadGlobalLatestTimestamp()
+}
+
+// loadGlobalLatestTimestamp reads the newest intraday timestamp across all symbols from the DB, keeps
+// it for GetGlobalLatestTimestamp and records it in the latest data metric. Timestamps are wall clock
+// times of the exchange, so the metric reads them as US market times. uc.latestMu must be held.
+func (uc *StockServingUseCase) loadGlobalLatestTimestamp() (time.Time, error) {
+	latest, err := uc.stockRepo.GetGlobalLatestTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get global latest timestamp: %w", err)
+	}
+	uc.latest, uc.latestLoadedAt = latest, time.Now()
+	metrics.LatestDataTimestamp.Set(float64(utils.USMarket.FromWallClock(latest).Unix()))
+	return latest, nil
+}
+
+// TrackGlobalLatestTimestamp reloads the newest intraday timestamp across all symbols every interval
+// until ctx is cancelled, so the latest data metric keeps moving whether or not readiness is probed.
+func (uc *StockServingUseCase) TrackGlobalLatestTimestamp(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		uc.latestMu.Lock()
+		if _, err := uc.loadGlobalLatestTimestamp(); err != nil {
+			fmt.Printf("Failed to track global latest timestamp: %v\n", err)
+		}
+		uc.latestMu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetPrevClose retrieves the close of the last trading day before asOf by symbol, along with its date.
+func (uc *StockServingUseCase) GetPrevClose(symbol string, asOf time.Time) (float64, time.Time, error) {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	prevClose, date, err := uc.stockRepo.GetPrevClose(symbol, asOf)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get previous close by symbol: %w", err)
+	}
+	return prevClose, date, nil
+}
+
+// GetLatestQuote retrieves the latest stock quote by symbol, preferring the in-memory real-time data,
+// along with the source it was served from. Symbols the DB had no data for are answered as not found
+// without querying it again for missingSymbolTTL.
+func (uc *StockServingUseCase) GetLatestQuote(symbol string) (*entity.StockQuote, string, error) {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	if quote, exists := uc.latestQuoteData.Get(symbol); exists {
+		return quote, SourceMemory, nil
+	}
+	if uc.missingLatest.contains(symbol) {
+		return nil, "", &errors.NotFoundError{Resource: fmt.Sprintf("latest data for %s", symbol)}
+	}
+
+	quote, err := uc.stockRepo.GetLatestData(symbol)
+	var notFound *errors.NotFoundError
+	if stderrors.As(err, &notFound) {
+		uc.missingLatest.add(symbol)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get latest data by symbol: %w", err)
+	}
+	return quote, SourceDB, nil
+}
+
+// mergeMissingLatest completes the cached latest quotes with those of the configured symbols missing
+// from the cache, fetched from the DB in one query and cached in turn. Symbols the DB had no data for
+// are not looked up again for missingSymbolTTL.
+func (uc *StockServingUseCase) mergeMissingLatest(quotes map[string]*entity.StockQuote) (map[string]*entity.StockQuote, string, error) {
+	var missing []string
+	for _, symbol := range config.AppConfig.SymbolList {
+		if _, exists := quotes[symbol]; !exists && !uc.missingLatest.contains(symbol) {
+			missing = append(missing, symbol)
+		}
+	}
+	if len(missing) == 0 {
+		return quotes, SourceCache, nil
+	}
+
+	release, err := uc.acquireQuerySlot()
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	found, err := uc.stockRepo.GetLatestDataForSymbols(missing)
+	if err != nil {
+		if canDegrade(err) {
+			fmt.Printf("Serving cached latest quotes without %v: %v\n", missing, err)
+			return quotes, SourceDegraded, nil
+		}
+		return nil, "", fmt.Errorf("failed to get latest data for %v: %w", missing, err)
+	}
+
+	ttl := uc.latestTTL()
+	for _, symbol := range missing {
+		quote, exists := found[symbol]
+		if !exists {
+			uc.missingLatest.add(symbol)
+			continue
+		}
+		quotes[symbol] = quote
+		if err := uc.stockCache.SetLatest(symbol, quote, ttl); err != nil {
+			fmt.Printf("Failed to cache latest data for %s: %v\n", symbol, err)
+		}
+	}
+	return quotes, SourceDB, nil
+}
+
+// canDegrade reports whether a failed DB read can fall back to serving degraded data from the cache,
+// which DEGRADE_ON_DB_ERROR enables for errors other than missing data.
+func canDegrade(err error) bool {
+	var notFound *errors.NotFoundError
+	return config.AppConfig.DegradeOnDBError && !stderrors.As(err, &notFound)
+}
+
+// degradedQuotes returns whatever quotes of a symbol the cache holds between start and end when the DB
+// read failed with err and degrading is allowed.
+func (uc *StockServingUseCase) degradedQuotes(symbol string, start, end time.Time, err error) ([]*entity.StockQuote, bool) {
+	if !canDegrade(err) {
+		return nil, false
+	}
+	quotes, found := uc.stockCache.Get(symbol, start, end)
+	if !found || len(quotes) == 0 {
+		return nil, false
+	}
+	fmt.Printf("Serving %d cached quotes of %s while the DB is unavailable: %v\n", len(quotes), symbol, err)
+	return quotes, true
+}
+
+// degradedLatestQuotes returns whatever latest quotes the cache, or else memory, holds regardless of
+// their age when the DB read failed with err and degrading is allowed.
+func (uc *StockServingUseCase) degradedLatestQuotes(err error) (map[string]*entity.StockQuote, bool) {
+	if !canDegrade(err) {
+		return nil, false
+	}
+	quotes, cacheErr := uc.stockCache.GetAllLatest()
+	if cacheErr != nil || len(quotes) == 0 {
+		quotes = uc.latestQuoteData.Snapshot()
+	}
+	if len(quotes) == 0 {
+		return nil, false
+	}
+	fmt.Printf("Serving %d cached latest quotes while the DB is unavailable: %v\n", len(quotes), err)
+	return quotes, true
+}
+
+// latestTTL returns the TTL for cached latest quotes: TTL_LATEST when set, otherwise the short TTL,
+// or the long one while every market is closed since the latest quotes can't change.
+func (uc *StockServingUseCase) latestTTL() time.Duration {
+	ttl := config.AppConfig.CacheShortTTL
+	if !anyMarketTrading(uc.now()) {
+		ttl = config.AppConfig.CacheLongTTL
+	}
+	return config.CacheTTL(config.CacheTypeLatest, ttl)
+}
+
+// anyMarketTrading reports whether the market of any configured symbol is in a session, extended
+// hours included, during which its latest quote can still change.
+func anyMarketTrading(now time.Time) bool {
+	for _, symbol := range config.AppConfig.SymbolList {
+		if utils.CalendarForSymbol(symbol).Session(now) != utils.SessionClosed {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAllSymbols reports whether quotes holds a quote for every configured symbol.
+func hasAllSymbols(quotes map[string]*entity.StockQuote) bool {
+	for _, symbol := range config.AppConfig.SymbolList {
+		if _, exists := quotes[symbol]; !exists {
+			return false
+		}
+	}
+	return len(quotes) > 0
+}
+
+// isFresh reports whether every quote is at most maxAge old at now. Quote timestamps are wall clock
+// times of the symbol's exchange, so now is converted to that wall clock before comparing. A
+// non-positive maxAge disables the check, while an empty map is never fresh.
+func isFresh(quotes map[string]*entity.StockQuote, now time.Time, maxAge time.Duration) bool {
+	if len(quotes) == 0 {
+		return false
+	}
+	if maxAge <= 0 {
+		return true
+	}
+	for _, quote := range quotes {
+		if utils.CalendarForSymbol(quote.Symbol).WallClock(now).Sub(quote.Timestamp) > maxAge {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveCompanyName returns the company profiles matching a company name. It returns a
+// *errors.NotFoundError if no company matches.
+func (uc *StockServingUseCase) ResolveCompanyName(name string) ([]*entity.CompanyProfile, error) {
+	matches := uc.companyIndex.Resolve(name)
+	if len(matches) == 0 {
+		return nil, &errors.NotFoundError{Resource: fmt.Sprintf("company named %q", name)}
+	}
+	return matches, nil
+}
+
+// GetRealTimeQuote retrieves the latest in-memory real-time quote by symbol, without falling back to the DB.
+func (uc *StockServingUseCase) GetRealTimeQuote(symbol string) (*entity.StockQuote, bool) {
+	symbol, _ = uc.ResolveSymbol(symbol)
+	return uc.latestQuoteData.Get(symbol)
+}
+
+// GetAllQuotes retrieves stock data for all symbols, along with the source they were served from.
+// Real-time quotes in memory are preferred while they cover every symbol and are fresh, then the cache;
+// otherwise, or when fresh is set, the cache is repopulated from the DB. Concurrent DB reads are
+// collapsed into one, so stale quotes, e.g. while the market is closed, can't stampede the DB. While
+// the market is closed the latest quotes can't change, so they are cached with the long TTL.
+func (uc *StockServingUseCase) GetAllQuotes(fresh bool) (map[string]*entity.StockQuote, string, error) {
+	// Fall back from the real-time quotes in memory to the cache to the DB, skipping any level whose
+	// quotes are missing or too old, unless a fresh read from the DB is requested
+	if !fresh {
+		now := uc.now()
+		if quotes := uc.latestQuoteData.Snapshot(); hasAllSymbols(quotes) && isFresh(quotes, now, config.AppConfig.MemoryQuoteMaxAge) {
+			return quotes, SourceMemory, nil
+		}
+		quotes, err := uc.stockCache.GetAllLatest()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get all latest data: %w", err)
+			fmt.Printf("Failed to get cached latest data, falling back to the DB: %v\n", err)
+		} else if isFresh(quotes, now, config.AppConfig.CacheQuoteMaxAge) {
+			return uc.mergeMissingLatest(quotes)
 		}
-		if err := uc.stockCache.SetAllLatest(quotes, config.AppConfig.CacheShortTTL); err != nil {
-			return nil, fmt.Errorf("failed to set all latest data in cache: %w", err)
+	}
+
+	type loaded struct {
+		quotes map[string]*entity.StockQuote
+		source string
+	}
+	// Fresh reads don't share a load that may degrade to the cache
+	key := "all"
+	if fresh {
+		key = "fresh"
+	}
+	result, err, _ := uc.latestLoads.Do(key, func() (interface{}, error) {
+		quotes, source, err := uc.loadAllLatest(!fresh)
+		return loaded{quotes, source}, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	// Callers sharing a load must not see each other's changes to the map
+	quotes := make(map[string]*entity.StockQuote, len(result.(loaded).quotes))
+	for symbol, quote := range result.(loaded).quotes {
+		quotes[symbol] = quote
+	}
+	return quotes, result.(loaded).source, nil
+}
+
+// loadAllLatest reads the latest quotes of all symbols from the DB and caches them. When degrade is set,
+// it falls back to the cached quotes if the DB fails.
+func (uc *StockServingUseCase) loadAllLatest(degrade bool) (map[string]*entity.StockQuote, string, error) {
+	release, err := uc.acquireQuerySlot()
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	// get from stockRepo
+	quotes, err := uc.stockRepo.GetAllLatestData()
+	if err != nil {
+		if degrade {
+			if degraded, ok := uc.degradedLatestQuotes(err); ok {
+				return degraded, SourceDegraded, nil
+			}
 		}
+		return nil, "", fmt.Errorf("failed to get all latest data: %w", err)
+	}
+
+	ttl := uc.latestTTL()
+	if err := uc.stockCache.SetAllLatest(quotes, ttl); err != nil {
+		return nil, "", fmt.Errorf("failed to set all latest data in cache: %w", err)
+	}
+	return quotes, SourceDB, nil
+}
 
+// GetAllQuotesAsOf retrieves the most recent quote of every symbol at or before asOf from the DB,
+// bypassing the cache and memory, which only hold the current latest quotes.
+func (uc *StockServingUseCase) GetAllQuotesAsOf(asOf time.Time) (map[string]*entity.StockQuote, error) {
+	release, err := uc.acquireQuerySlot()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	quotes, err := uc.stockRepo.GetAllLatestDataAsOf(asOf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest data as of %v: %w", asOf, err)
 	}
 	return quotes, nil
 }
 
+// Fields ListQuotes can sort quotes by.
+const (
+	QuoteSortSymbol        = "symbol"
+	QuoteSortPrice         = "price"
+	QuoteSortChange        = "change"
+	QuoteSortChangePercent = "changePercent"
+)
+
+// quoteSortKeys maps each sort field to a function reporting whether quote a sorts before b in
+// ascending order.
+var quoteSortKeys = map[string]func(a, b *entity.StockQuote) bool{
+	QuoteSortSymbol:        func(a, b *entity.StockQuote) bool { return a.Symbol < b.Symbol },
+	QuoteSortPrice:         func(a, b *entity.StockQuote) bool { return a.Price < b.Price },
+	QuoteSortChange:        func(a, b *entity.StockQuote) bool { return a.Change < b.Change },
+	QuoteSortChangePercent: func(a, b *entity.StockQuote) bool { return a.ChangePercentage < b.ChangePercentage },
+}
+
+// IsQuoteSortField reports whether ListQuotes can sort quotes by field.
+func IsQuoteSortField(field string) bool {
+	_, ok := quoteSortKeys[field]
+	return ok
+}
+
+// QuoteListOptions selects the order and filter of the quotes returned by ListQuotes.
+type QuoteListOptions struct {
+	// SortBy is one of the QuoteSort fields, defaulting to QuoteSortSymbol.
+	SortBy     string
+	Descending bool
+	// MinChange, when set, drops quotes whose change is below it.
+	MinChange *float64
+}
+
+// ListQuotes retrieves the stock data of all symbols like GetAllQuotes, returning it filtered and
+// sorted according to opts instead of keyed by symbol.
+func (uc *StockServingUseCase) ListQuotes(fresh bool, opts QuoteListOptions) ([]*entity.StockQuote, string, error) {
+	quotes, source, err := uc.GetAllQuotes(fresh)
+	if err != nil {
+		return nil, "", err
+	}
+	return sortQuotes(quotes, opts), source, nil
+}
+
+// sortQuotes filters and sorts the quotes according to opts. Ties are broken by symbol so the order
+// is stable across requests.
+func sortQuotes(quotes map[string]*entity.StockQuote, opts QuoteListOptions) []*entity.StockQuote {
+	list := make([]*entity.StockQuote, 0, len(quotes))
+	for _, quote := range quotes {
+		if opts.MinChange != nil && quote.Change < *opts.MinChange {
+			continue
+		}
+		list = append(list, quote)
+	}
+
+	less, ok := quoteSortKeys[opts.SortBy]
+	if !ok {
+		less = quoteSortKeys[QuoteSortSymbol]
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if opts.Descending {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return list[i].Symbol < list[j].Symbol
+	})
+	return list
+}
+
 // func (uc *StockServingUseCase) GetTrades(symbol, timeRange string) ([]*entity.Trade, error) {
 //     // if symbol == "" || timeRange == "" {
 //     //     return nil, fmt.Errorf("symbol and time range are required")
@@ -0,0 +1,935 @@
+package usecase
+
+import (
+	stderrors "errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"stock-app/internal/cache"
+	"stock-app/internal/entity"
+	"stock-app/internal/repository"
+	"stock-app/pkg/config"
+	"stock-app/pkg/errors"
+	"stock-app/pkg/utils"
+)
+
+// cachedQuotes is a StockCache holding the latest quotes, recording the TTL they were cached with.
+type cachedQuotes struct {
+	cache.StockCache
+	latest map[string]*entity.StockQuote
+	ttl    time.Duration
+}
+
+func (c *cachedQuotes) GetAllLatest() (map[string]*entity.StockQuote, error) {
+	return c.latest, nil
+}
+
+func (c *cachedQuotes) SetAllLatest(quotes map[string]*entity.StockQuote, expiration time.Duration) error {
+	c.latest, c.ttl = quotes, expiration
+	return nil
+}
+
+// stubRepo is a StockRepo serving quotes from memory, whose reads and writes fail with err. It counts
+// the latest data reads.
+type stubRepo struct {
+	repository.StockRepo
+	quotes      []*entity.StockQuote
+	err         error
+	latestReads int
+}
+
+func (repo *stubRepo) GetAllLatestData() (map[string]*entity.StockQuote, error) {
+	repo.latestReads++
+	if repo.err != nil {
+		return nil, repo.err
+	}
+	latest := make(map[string]*entity.StockQuote)
+	for _, quote := range repo.quotes {
+		latest[quote.Symbol] = quote
+	}
+	return latest, nil
+}
+
+func (repo *stubRepo) InsertIntradayBars(bars []*entity.StockQuote, source string) (int64, error) {
+	if repo.err != nil {
+		return 0, repo.err
+	}
+	repo.quotes = append(repo.quotes, bars...)
+	return int64(len(bars)), nil
+}
+
+func (repo *stubRepo) StreamHistoricalData(symbol string, start, end time.Time, fn func(*entity.StockQuote) error) error {
+	if repo.err != nil {
+		return repo.err
+	}
+	for _, quote := range repo.quotes {
+		if quote.Symbol != symbol || quote.Timestamp.Before(start) || quote.Timestamp.After(end) {
+			continue
+		}
+		if err := fn(quote); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAggregateQuotes(t *testing.T) {
+	minute := func(m int) time.Time {
+		return time.Date(2025, time.June, 11, 10, m, 0, 0, time.UTC)
+	}
+	quote := func(m int, open, high, low, price, volume float64) *entity.StockQuote {
+		return &entity.StockQuote{Symbol: "AAPL", OpenPrice: open, HighPrice: high, LowPrice: low, Price: price, Volume: volume, Timestamp: minute(m)}
+	}
+	// Out of order on purpose: buckets are built from the quotes sorted by time.
+	quotes := []*entity.StockQuote{
+		quote(5, 103, 106, 103, 105, 50),
+		quote(0, 100, 101, 99, 100, 10),
+		quote(4, 102, 104, 102, 103, 40),
+		quote(1, 100, 102, 100, 101, 20),
+		quote(2, 101, 103, 98, 102, 30),
+	}
+	want := []*entity.StockQuote{
+		{OpenPrice: 100, HighPrice: 104, LowPrice: 98, Price: 103, Volume: 100, Timestamp: minute(0)},
+		{OpenPrice: 103, HighPrice: 106, LowPrice: 103, Price: 105, Volume: 50, Timestamp: minute(5)},
+	}
+
+	got := aggregateQuotes(quotes, 5*time.Minute)
+	if len(got) != len(want) {
+		t.Fatalf("aggregateQuotes() returned %d candles, want %d", len(got), len(want))
+	}
+	for i, candle := range got {
+		w := want[i]
+		if candle.Symbol != "AAPL" || !candle.Timestamp.Equal(w.Timestamp) || candle.OpenPrice != w.OpenPrice || candle.HighPrice != w.HighPrice ||
+			candle.LowPrice != w.LowPrice || candle.Price != w.Price || candle.Volume != w.Volume {
+			t.Errorf("candle %d = %+v, want %+v", i, candle, w)
+		}
+	}
+}
+
+func TestTruncateBucket(t *testing.T) {
+	tests := []struct {
+		name   string
+		time   time.Time
+		bucket time.Duration
+		want   time.Time
+	}{
+		{name: "five minutes", time: time.Date(2025, time.June, 11, 10, 33, 20, 0, time.UTC), bucket: 5 * time.Minute, want: time.Date(2025, time.June, 11, 10, 30, 0, 0, time.UTC)},
+		{name: "hour", time: time.Date(2025, time.June, 11, 10, 33, 0, 0, time.UTC), bucket: time.Hour, want: time.Date(2025, time.June, 11, 10, 0, 0, 0, time.UTC)},
+		{name: "day", time: time.Date(2025, time.June, 11, 19, 59, 0, 0, time.UTC), bucket: 24 * time.Hour, want: time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)},
+		{
+			name:   "day in another location",
+			time:   time.Date(2025, time.June, 11, 1, 0, 0, 0, time.FixedZone("JST", 9*60*60)),
+			bucket: 24 * time.Hour,
+			want:   time.Date(2025, time.June, 11, 0, 0, 0, 0, time.FixedZone("JST", 9*60*60)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateBucket(tt.time, tt.bucket); !got.Equal(tt.want) {
+				t.Errorf("truncateBucket(%v, %v) = %v, want %v", tt.time, tt.bucket, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllQuotesMarketClosed(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.CacheShortTTL = 10 * time.Second
+	config.AppConfig.CacheLongTTL = 72 * time.Hour
+	config.AppConfig.SymbolList = []string{"AAPL"}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fridayClose := &entity.StockQuote{Symbol: "AAPL", Price: 100, Timestamp: time.Date(2025, time.June, 13, 16, 0, 0, 0, time.UTC)}
+	saturday := time.Date(2025, time.June, 14, 12, 0, 0, 0, newYork)
+	wednesday := time.Date(2025, time.June, 11, 10, 30, 0, 0, newYork)
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		cached     map[string]*entity.StockQuote
+		fresh      bool
+		wantSource string
+		wantReads  int
+		wantTTL    time.Duration
+	}{
+		{name: "closed with cached quotes", now: saturday, cached: map[string]*entity.StockQuote{"AAPL": fridayClose}, wantSource: SourceCache, wantReads: 0},
+		{name: "closed with an empty cache", now: saturday, wantSource: SourceDB, wantReads: 1, wantTTL: 72 * time.Hour},
+		{name: "trading with an empty cache", now: wednesday, wantSource: SourceDB, wantReads: 1, wantTTL: 10 * time.Second},
+		{name: "fresh read with cached quotes", now: wednesday, cached: map[string]*entity.StockQuote{"AAPL": fridayClose}, fresh: true, wantSource: SourceDB, wantReads: 1, wantTTL: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &stubRepo{quotes: []*entity.StockQuote{fridayClose}}
+			stockCache := &cachedQuotes{latest: tt.cached}
+			uc := NewStockServingUseCase(repo, stockCache, entity.NewLatestQuoteData(), nil)
+			uc.now = func() time.Time { return tt.now }
+
+			quotes, source, err := uc.GetAllQuotes(tt.fresh)
+			if err != nil {
+				t.Fatalf("GetAllQuotes() error = %v", err)
+			}
+			if source != tt.wantSource {
+				t.Errorf("GetAllQuotes() source = %q, want %q", source, tt.wantSource)
+			}
+			if repo.latestReads != tt.wantReads {
+				t.Errorf("GetAllQuotes() read the DB %d times, want %d", repo.latestReads, tt.wantReads)
+			}
+			if stockCache.ttl != tt.wantTTL {
+				t.Errorf("GetAllQuotes() cached the quotes for %v, want %v", stockCache.ttl, tt.wantTTL)
+			}
+			if _, exists := quotes["AAPL"]; !exists {
+				t.Error("GetAllQuotes() is missing AAPL")
+			}
+		})
+	}
+}
+
+// ttlCache is a StockCache that misses every history read, recording the TTL history and latest
+// quotes are cached with.
+type ttlCache struct {
+	cachedQuotes
+	historyTTL time.Duration
+}
+
+func (c *ttlCache) Get(symbol string, start, end time.Time) ([]*entity.StockQuote, bool) {
+	return nil, false
+}
+
+func (c *ttlCache) Set(symbol string, stock []*entity.StockQuote, expiration time.Duration) error {
+	c.historyTTL = expiration
+	return nil
+}
+
+func (repo *stubRepo) GetHistoricalData(symbol string, start, end time.Time) ([]*entity.StockQuote, error) {
+	var quotes []*entity.StockQuote
+	err := repo.StreamHistoricalData(symbol, start, end, func(quote *entity.StockQuote) error {
+		quotes = append(quotes, quote)
+		return nil
+	})
+	return quotes, err
+}
+
+func TestCacheTTLPerType(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.CacheShortTTL = 10 * time.Second
+	config.AppConfig.CacheLongTTL = 72 * time.Hour
+	config.AppConfig.SymbolList = []string{"AAPL"}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wednesday := time.Date(2025, time.June, 11, 10, 30, 0, 0, newYork)
+	quote := &entity.StockQuote{Symbol: "AAPL", Price: 100, Timestamp: wednesday.Add(-time.Minute)}
+
+	tests := []struct {
+		name           string
+		ttlLatest      time.Duration
+		ttlHistory     time.Duration
+		wantLatestTTL  time.Duration
+		wantHistoryTTL time.Duration
+	}{
+		{name: "fallbacks", wantLatestTTL: 10 * time.Second, wantHistoryTTL: 10 * time.Second},
+		{name: "per type", ttlLatest: 5 * time.Second, ttlHistory: time.Hour, wantLatestTTL: 5 * time.Second, wantHistoryTTL: time.Hour},
+		{name: "latest only", ttlLatest: time.Minute, wantLatestTTL: time.Minute, wantHistoryTTL: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig.TTLLatest = tt.ttlLatest
+			config.AppConfig.TTLHistory = tt.ttlHistory
+			stockCache := &ttlCache{}
+			uc := NewStockServingUseCase(&stubRepo{quotes: []*entity.StockQuote{quote}}, stockCache, entity.NewLatestQuoteData(), nil)
+			uc.now = func() time.Time { return wednesday }
+
+			if _, _, err := uc.GetAllQuotes(false); err != nil {
+				t.Fatalf("GetAllQuotes() error = %v", err)
+			}
+			if _, _, err := uc.GetQuote("AAPL", wednesday.Add(-time.Hour), wednesday); err != nil {
+				t.Fatalf("GetQuote() error = %v", err)
+			}
+			if stockCache.ttl != tt.wantLatestTTL {
+				t.Errorf("latest quotes cached for %v, want %v", stockCache.ttl, tt.wantLatestTTL)
+			}
+			if stockCache.historyTTL != tt.wantHistoryTTL {
+				t.Errorf("history cached for %v, want %v", stockCache.historyTTL, tt.wantHistoryTTL)
+			}
+		})
+	}
+}
+
+func TestGetAllQuotesFallback(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.SymbolList = []string{"AAPL", "MSFT"}
+	config.AppConfig.MemoryQuoteMaxAge = time.Minute
+	config.AppConfig.CacheQuoteMaxAge = 5 * time.Minute
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10:30 ET, when quote timestamps, ET wall clock times stored as UTC, read 10:30 UTC
+	now := time.Date(2025, time.June, 11, 10, 30, 0, 0, newYork)
+	quotes := func(minutesAgo int, symbols ...string) map[string]*entity.StockQuote {
+		quotes := make(map[string]*entity.StockQuote)
+		for _, symbol := range symbols {
+			quotes[symbol] = &entity.StockQuote{Symbol: symbol, Price: 100, Timestamp: time.Date(2025, time.June, 11, 10, 30-minutesAgo, 0, 0, time.UTC)}
+		}
+		return quotes
+	}
+
+	tests := []struct {
+		name       string
+		memory     map[string]*entity.StockQuote
+		cached     map[string]*entity.StockQuote
+		wantSource string
+		wantReads  int
+	}{
+		{name: "fresh memory", memory: quotes(0, "AAPL", "MSFT"), cached: quotes(0, "AAPL", "MSFT"), wantSource: SourceMemory},
+		{name: "stale memory", memory: quotes(2, "AAPL", "MSFT"), cached: quotes(2, "AAPL", "MSFT"), wantSource: SourceCache},
+		{name: "memory missing a symbol", memory: quotes(0, "AAPL"), cached: quotes(0, "AAPL", "MSFT"), wantSource: SourceCache},
+		{name: "empty memory", cached: quotes(0, "AAPL", "MSFT"), wantSource: SourceCache},
+		{name: "stale cache", memory: quotes(10, "AAPL", "MSFT"), cached: quotes(10, "AAPL", "MSFT"), wantSource: SourceDB, wantReads: 1},
+		{name: "empty memory and cache", wantSource: SourceDB, wantReads: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latest := entity.NewLatestQuoteData()
+			for symbol, quote := range tt.memory {
+				latest.Set(symbol, quote)
+			}
+			repo := &stubRepo{quotes: []*entity.StockQuote{quotes(0, "AAPL")["AAPL"], quotes(0, "MSFT")["MSFT"]}}
+			uc := NewStockServingUseCase(repo, &cachedQuotes{latest: tt.cached}, latest, nil)
+			uc.now = func() time.Time { return now }
+
+			got, source, err := uc.GetAllQuotes(false)
+			if err != nil {
+				t.Fatalf("GetAllQuotes() error = %v", err)
+			}
+			if source != tt.wantSource {
+				t.Errorf("GetAllQuotes() source = %q, want %q", source, tt.wantSource)
+			}
+			if repo.latestReads != tt.wantReads {
+				t.Errorf("GetAllQuotes() read the DB %d times, want %d", repo.latestReads, tt.wantReads)
+			}
+			if len(got) != 2 {
+				t.Errorf("GetAllQuotes() = %v, want AAPL and MSFT", got)
+			}
+		})
+	}
+}
+
+func TestIsFresh(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10:30 ET, when quote timestamps, ET wall clock times stored as UTC, read 10:30 UTC
+	now := time.Date(2025, time.June, 11, 10, 30, 0, 0, newYork)
+	quote := func(symbol string, min int) *entity.StockQuote {
+		return &entity.StockQuote{Symbol: symbol, Timestamp: time.Date(2025, time.June, 11, 10, min, 0, 0, time.UTC)}
+	}
+
+	tests := []struct {
+		name   string
+		quotes map[string]*entity.StockQuote
+		maxAge time.Duration
+		want   bool
+	}{
+		{name: "within max age", quotes: map[string]*entity.StockQuote{"AAPL": quote("AAPL", 29)}, maxAge: 5 * time.Minute, want: true},
+		{name: "older than max age", quotes: map[string]*entity.StockQuote{"AAPL": quote("AAPL", 20)}, maxAge: 5 * time.Minute, want: false},
+		{name: "one stale quote", quotes: map[string]*entity.StockQuote{"AAPL": quote("AAPL", 29), "MSFT": quote("MSFT", 0)}, maxAge: 5 * time.Minute, want: false},
+		{name: "check disabled", quotes: map[string]*entity.StockQuote{"AAPL": quote("AAPL", 0)}, maxAge: 0, want: true},
+		{name: "empty", quotes: map[string]*entity.StockQuote{}, maxAge: 5 * time.Minute, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFresh(tt.quotes, now, tt.maxAge); got != tt.want {
+				t.Errorf("isFresh() = %v, want %v", got, tt.want)
+			}
+			if got := isFresh(tt.quotes, now.UTC(), tt.maxAge); got != tt.want {
+				t.Errorf("isFresh() with now in UTC = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamCandles(t *testing.T) {
+	minute := func(hour, min int) time.Time {
+		return time.Date(2025, time.June, 11, hour, min, 0, 0, time.UTC)
+	}
+	bar := func(hour, min int, price, volume float64) *entity.StockQuote {
+		return &entity.StockQuote{Symbol: "AAPL", OpenPrice: price, HighPrice: price, LowPrice: price, Price: price, Volume: volume, Timestamp: minute(hour, min)}
+	}
+	uc := &StockServingUseCase{stockRepo: &stubRepo{quotes: []*entity.StockQuote{
+		bar(9, 29, 99, 5),
+		bar(9, 30, 100, 10),
+		bar(9, 31, 102, 10),
+		bar(9, 34, 101, 10),
+		bar(9, 35, 103, 20),
+		bar(9, 41, 104, 30),
+	}}}
+
+	tests := []struct {
+		name       string
+		resolution time.Duration
+		session    utils.MarketSession
+		want       []entity.StockQuote
+	}{
+		{
+			name:       "five minute candles",
+			resolution: 5 * time.Minute,
+			want: []entity.StockQuote{
+				{OpenPrice: 99, HighPrice: 99, LowPrice: 99, Price: 99, Volume: 5, Timestamp: minute(9, 25)},
+				{OpenPrice: 100, HighPrice: 102, LowPrice: 100, Price: 101, Volume: 30, Timestamp: minute(9, 30)},
+				{OpenPrice: 103, HighPrice: 103, LowPrice: 103, Price: 103, Volume: 20, Timestamp: minute(9, 35)},
+				{OpenPrice: 104, HighPrice: 104, LowPrice: 104, Price: 104, Volume: 30, Timestamp: minute(9, 40)},
+			},
+		},
+		{
+			name:       "raw minutes",
+			resolution: time.Minute,
+			want: []entity.StockQuote{
+				{OpenPrice: 99, HighPrice: 99, LowPrice: 99, Price: 99, Volume: 5, Timestamp: minute(9, 29)},
+				{OpenPrice: 100, HighPrice: 100, LowPrice: 100, Price: 100, Volume: 10, Timestamp: minute(9, 30)},
+				{OpenPrice: 102, HighPrice: 102, LowPrice: 102, Price: 102, Volume: 10, Timestamp: minute(9, 31)},
+				{OpenPrice: 101, HighPrice: 101, LowPrice: 101, Price: 101, Volume: 10, Timestamp: minute(9, 34)},
+				{OpenPrice: 103, HighPrice: 103, LowPrice: 103, Price: 103, Volume: 20, Timestamp: minute(9, 35)},
+				{OpenPrice: 104, HighPrice: 104, LowPrice: 104, Price: 104, Volume: 30, Timestamp: minute(9, 41)},
+			},
+		},
+		{
+			name:       "regular session without the pre-market minute",
+			resolution: 5 * time.Minute,
+			session:    utils.SessionRegular,
+			want: []entity.StockQuote{
+				{OpenPrice: 100, HighPrice: 102, LowPrice: 100, Price: 101, Volume: 30, Timestamp: minute(9, 30)},
+				{OpenPrice: 103, HighPrice: 103, LowPrice: 103, Price: 103, Volume: 20, Timestamp: minute(9, 35)},
+				{OpenPrice: 104, HighPrice: 104, LowPrice: 104, Price: 104, Volume: 30, Timestamp: minute(9, 40)},
+			},
+		},
+		{
+			name:       "pre-market session",
+			resolution: time.Minute,
+			session:    utils.SessionPreMarket,
+			want: []entity.StockQuote{
+				{OpenPrice: 99, HighPrice: 99, LowPrice: 99, Price: 99, Volume: 5, Timestamp: minute(9, 29)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []*entity.StockQuote
+			err := uc.StreamCandles("AAPL", minute(0, 0), minute(23, 59), tt.resolution, tt.session, func(q *entity.StockQuote) error {
+				got = append(got, q)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamCandles() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("StreamCandles() passed %d candles, want %d", len(got), len(tt.want))
+			}
+			for i, candle := range got {
+				want := tt.want[i]
+				if !candle.Timestamp.Equal(want.Timestamp) || candle.OpenPrice != want.OpenPrice || candle.HighPrice != want.HighPrice ||
+					candle.LowPrice != want.LowPrice || candle.Price != want.Price || candle.Volume != want.Volume {
+					t.Errorf("candle %d = %+v, want %+v", i, *candle, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterSession(t *testing.T) {
+	// New York wall clock times of a Wednesday, stored in UTC
+	at := func(hour, min int) *entity.StockQuote {
+		return &entity.StockQuote{Symbol: "AAPL", Timestamp: time.Date(2025, time.June, 11, hour, min, 0, 0, time.UTC)}
+	}
+	quotes := []*entity.StockQuote{at(4, 0), at(9, 29), at(9, 30), at(15, 59), at(16, 0), at(19, 59), at(20, 0)}
+
+	tests := []struct {
+		session utils.MarketSession
+		want    []string
+	}{
+		{session: utils.SessionPreMarket, want: []string{"04:00", "09:29"}},
+		{session: utils.SessionRegular, want: []string{"09:30", "15:59"}},
+		{session: utils.SessionAfterHours, want: []string{"16:00", "19:59"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.session), func(t *testing.T) {
+			var got []string
+			for _, quote := range filterSession(quotes, utils.USMarket, tt.session) {
+				got = append(got, quote.Timestamp.Format("15:04"))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterSession(%s) = %v, want %v", tt.session, got, tt.want)
+			}
+		})
+	}
+}
+
+// blockingRepo holds every historical query open until release is closed, tracking how many run at once.
+type blockingRepo struct {
+	repository.StockRepo
+	started chan struct{}
+	release chan struct{}
+
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (repo *blockingRepo) GetHistoricalData(symbol string, start, end time.Time) ([]*entity.StockQuote, error) {
+	repo.mu.Lock()
+	repo.running++
+	if repo.running > repo.peak {
+		repo.peak = repo.running
+	}
+	repo.mu.Unlock()
+	repo.started <- struct{}{}
+
+	<-repo.release
+	repo.mu.Lock()
+	repo.running--
+	repo.mu.Unlock()
+	return []*entity.StockQuote{{Symbol: symbol, Timestamp: start}}, nil
+}
+
+// rangeCache is a StockCache holding the history of the symbols in hits only.
+type rangeCache struct {
+	cache.StockCache
+	hits map[string]bool
+}
+
+func (c *rangeCache) Get(symbol string, start, end time.Time) ([]*entity.StockQuote, bool) {
+	if !c.hits[symbol] {
+		return nil, false
+	}
+	return []*entity.StockQuote{{Symbol: symbol, Timestamp: start}}, true
+}
+
+func (c *rangeCache) Set(symbol string, stock []*entity.StockQuote, expiration time.Duration) error {
+	return nil
+}
+
+func TestQuerySlots(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.MaxConcurrentQueries = 2
+	config.AppConfig.QueryQueueTimeout = 20 * time.Millisecond
+
+	repo := &blockingRepo{started: make(chan struct{}, 1), release: make(chan struct{})}
+	uc := NewStockServingUseCase(repo, &rangeCache{hits: map[string]bool{"MSFT": true}}, entity.NewLatestQuoteData(), nil)
+	start := time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)
+
+	// Fill both slots with DB queries that stay open
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := uc.GetQuote("AAPL", start, start.Add(time.Hour)); err != nil {
+				t.Errorf("GetQuote() within the limit error = %v", err)
+			}
+		}()
+		<-repo.started
+	}
+
+	var overloaded *errors.OverloadedError
+	if _, _, err := uc.GetQuote("AAPL", start, start.Add(time.Hour)); !stderrors.As(err, &overloaded) {
+		t.Errorf("GetQuote() beyond the limit error = %v, want an *errors.OverloadedError", err)
+	} else if overloaded.RetryAfter <= 0 {
+		t.Errorf("GetQuote() beyond the limit asks to retry after %v", overloaded.RetryAfter)
+	}
+	if err := uc.StreamQuotes("AAPL", start, start.Add(time.Hour), func(*entity.StockQuote) error { return nil }); !stderrors.As(err, &overloaded) {
+		t.Errorf("StreamQuotes() beyond the limit error = %v, want an *errors.OverloadedError", err)
+	}
+	if quotes, _, err := uc.GetQuote("MSFT", start, start.Add(time.Hour)); err != nil || len(quotes) != 1 {
+		t.Errorf("GetQuote() of a cached symbol at the limit = %v, %v, want the cached quote", quotes, err)
+	}
+
+	close(repo.release)
+	wg.Wait()
+	if _, _, err := uc.GetQuote("AAPL", start, start.Add(time.Hour)); err != nil {
+		t.Errorf("GetQuote() after the slots were released error = %v", err)
+	}
+	if repo.peak != 2 {
+		t.Errorf("%d DB queries ran at once, want at most 2", repo.peak)
+	}
+}
+
+// partialRepo is a StockRepo serving the latest quotes of the given symbols, recording the symbols
+// looked up.
+type partialRepo struct {
+	repository.StockRepo
+	latest  map[string]*entity.StockQuote
+	lookups [][]string
+}
+
+func (repo *partialRepo) GetLatestDataForSymbols(symbols []string) (map[string]*entity.StockQuote, error) {
+	repo.lookups = append(repo.lookups, symbols)
+	found := make(map[string]*entity.StockQuote)
+	for _, symbol := range symbols {
+		if quote, exists := repo.latest[symbol]; exists {
+			found[symbol] = quote
+		}
+	}
+	return found, nil
+}
+
+// latestCache is a StockCache holding the latest quotes by symbol.
+type latestCache struct {
+	cache.StockCache
+	latest map[string]*entity.StockQuote
+}
+
+func (c *latestCache) GetAllLatest() (map[string]*entity.StockQuote, error) {
+	latest := make(map[string]*entity.StockQuote, len(c.latest))
+	for symbol, quote := range c.latest {
+		latest[symbol] = quote
+	}
+	return latest, nil
+}
+
+func (c *latestCache) SetLatest(symbol string, stock *entity.StockQuote, expiration time.Duration) error {
+	c.latest[symbol] = stock
+	return nil
+}
+
+func TestGetAllQuotesPartialCache(t *testing.T) {
+	symbolList := config.AppConfig.SymbolList
+	defer func() { config.AppConfig.SymbolList = symbolList }()
+	config.AppConfig.SymbolList = []string{"AAPL", "MSFT", "TSLA", "NOPE"}
+
+	quote := func(symbol string) *entity.StockQuote {
+		return &entity.StockQuote{Symbol: symbol, Price: 100}
+	}
+	repo := &partialRepo{latest: map[string]*entity.StockQuote{"AAPL": quote("AAPL"), "MSFT": quote("MSFT"), "TSLA": quote("TSLA")}}
+	stockCache := &latestCache{latest: map[string]*entity.StockQuote{"AAPL": quote("AAPL"), "MSFT": quote("MSFT")}}
+	uc := NewStockServingUseCase(repo, stockCache, entity.NewLatestQuoteData(), nil)
+
+	quotes, source, err := uc.GetAllQuotes(false)
+	if err != nil {
+		t.Fatalf("GetAllQuotes() error = %v", err)
+	}
+	if len(repo.lookups) != 1 || !reflect.DeepEqual(repo.lookups[0], []string{"TSLA", "NOPE"}) {
+		t.Errorf("repo looked up %v, want only the symbols missing from the cache [TSLA NOPE]", repo.lookups)
+	}
+	if len(quotes) != 3 || quotes["TSLA"] == nil || source != SourceDB {
+		t.Errorf("GetAllQuotes() = %v from %q, want AAPL, MSFT and TSLA from the DB", quotes, source)
+	}
+	if _, cached := stockCache.latest["TSLA"]; !cached {
+		t.Error("GetAllQuotes() did not cache the quote fetched from the DB")
+	}
+
+	// TSLA is now cached and NOPE is remembered as missing, so the DB isn't queried again
+	if _, source, err := uc.GetAllQuotes(false); err != nil || source != SourceCache {
+		t.Errorf("second GetAllQuotes() source = %q, %v, want %q", source, err, SourceCache)
+	}
+	if len(repo.lookups) != 1 {
+		t.Errorf("repo looked up %v, want a single lookup", repo.lookups)
+	}
+}
+
+// staleCache is a StockCache holding the history of every symbol, stored at storedAt. Set marks the
+// history as stored now and signals stored.
+type staleCache struct {
+	cache.StockCache
+	mu       sync.Mutex
+	storedAt time.Time
+	stored   chan struct{}
+}
+
+func (c *staleCache) Get(symbol string, start, end time.Time) ([]*entity.StockQuote, bool) {
+	return []*entity.StockQuote{{Symbol: symbol, Timestamp: start}}, true
+}
+
+func (c *staleCache) Set(symbol string, stock []*entity.StockQuote, expiration time.Duration) error {
+	c.mu.Lock()
+	c.storedAt = time.Now()
+	c.mu.Unlock()
+	c.stored <- struct{}{}
+	return nil
+}
+
+func (c *staleCache) StoredAt(symbol string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.storedAt, true
+}
+
+func TestGetQuoteStaleWhileRevalidate(t *testing.T) {
+	defer func(saved config.Config) { config.AppConfig = saved }(config.AppConfig)
+	config.AppConfig.CacheStaleAfter = time.Minute
+
+	repo := &blockingRepo{started: make(chan struct{}, 2), release: make(chan struct{})}
+	stockCache := &staleCache{storedAt: time.Now().Add(-time.Hour), stored: make(chan struct{}, 2)}
+	uc := NewStockServingUseCase(repo, stockCache, entity.NewLatestQuoteData(), nil)
+	start := time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)
+
+	// The refresh is held open by the repo, so the stale hit must not wait for it
+	quotes, source, err := uc.GetQuote("AAPL", start, start.Add(time.Hour))
+	if err != nil || len(quotes) != 1 || source != SourceCache {
+		t.Fatalf("stale GetQuote() = %v from %q, %v, want the cached quote", quotes, source, err)
+	}
+	select {
+	case <-repo.started:
+	case <-time.After(time.Second):
+		t.Fatal("stale GetQuote() did not trigger a background refresh")
+	}
+	close(repo.release)
+	<-stockCache.stored
+
+	// The refresh marked the cache as fresh, so further hits don't trigger another one
+	if _, _, err := uc.GetQuote("AAPL", start, start.Add(time.Hour)); err != nil {
+		t.Fatalf("fresh GetQuote() error = %v", err)
+	}
+	select {
+	case <-repo.started:
+		t.Error("fresh GetQuote() triggered a background refresh")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if repo.peak != 1 {
+		t.Errorf("%d refreshes ran at once, want exactly 1", repo.peak)
+	}
+}
+
+func TestFilterOpeningGaps(t *testing.T) {
+	today := time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)
+	yesterday := today.AddDate(0, 0, -1)
+	gap := func(symbol string, date time.Time, percent float64) *entity.OpeningGap {
+		return &entity.OpeningGap{Symbol: symbol, Date: date, GapPercent: percent}
+	}
+
+	tests := []struct {
+		name       string
+		gaps       []*entity.OpeningGap
+		minPercent float64
+		want       []string
+	}{
+		{
+			name:       "known gap above the threshold",
+			gaps:       []*entity.OpeningGap{gap("AAPL", today, 3.5), gap("MSFT", today, 0.4)},
+			minPercent: 2,
+			want:       []string{"AAPL"},
+		},
+		{
+			name:       "gap down",
+			gaps:       []*entity.OpeningGap{gap("AAPL", today, -2.5), gap("MSFT", today, 1)},
+			minPercent: 2,
+			want:       []string{"AAPL"},
+		},
+		{
+			name:       "largest first",
+			gaps:       []*entity.OpeningGap{gap("AAPL", today, 2.5), gap("MSFT", today, -4), gap("TSLA", today, 3)},
+			minPercent: 2,
+			want:       []string{"MSFT", "TSLA", "AAPL"},
+		},
+		{
+			name:       "stale bar of a symbol that didn't trade",
+			gaps:       []*entity.OpeningGap{gap("AAPL", today, 2.5), gap("MSFT", yesterday, 9)},
+			minPercent: 2,
+			want:       []string{"AAPL"},
+		},
+		{
+			name:       "threshold is exclusive",
+			gaps:       []*entity.OpeningGap{gap("AAPL", today, 2)},
+			minPercent: 2,
+			want:       []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filterOpeningGaps(tt.gaps, tt.minPercent)
+			if len(got) != len(tt.want) {
+				t.Fatalf("filterOpeningGaps() returned %d gaps, want %v", len(got), tt.want)
+			}
+			for i, gap := range got {
+				if gap.Symbol != tt.want[i] {
+					t.Errorf("gap %d is of %s, want %s", i, gap.Symbol, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSortQuotes(t *testing.T) {
+	quotes := map[string]*entity.StockQuote{
+		"AAPL": {Symbol: "AAPL", Price: 201, Change: 2, ChangePercentage: 1},
+		"MSFT": {Symbol: "MSFT", Price: 450, Change: -3, ChangePercentage: -0.7},
+		"NVDA": {Symbol: "NVDA", Price: 120, Change: 2, ChangePercentage: 1.7},
+		"TSLA": {Symbol: "TSLA", Price: 180, Change: 0.5, ChangePercentage: 0.3},
+	}
+	minChange := func(change float64) *float64 { return &change }
+
+	tests := []struct {
+		name string
+		opts QuoteListOptions
+		want []string
+	}{
+		{name: "symbol by default", want: []string{"AAPL", "MSFT", "NVDA", "TSLA"}},
+		{name: "symbol descending", opts: QuoteListOptions{SortBy: QuoteSortSymbol, Descending: true}, want: []string{"TSLA", "NVDA", "MSFT", "AAPL"}},
+		{name: "price", opts: QuoteListOptions{SortBy: QuoteSortPrice}, want: []string{"NVDA", "TSLA", "AAPL", "MSFT"}},
+		{name: "price descending", opts: QuoteListOptions{SortBy: QuoteSortPrice, Descending: true}, want: []string{"MSFT", "AAPL", "TSLA", "NVDA"}},
+		// AAPL and NVDA tie on change, so they are ordered by symbol in either order
+		{name: "change", opts: QuoteListOptions{SortBy: QuoteSortChange}, want: []string{"MSFT", "TSLA", "AAPL", "NVDA"}},
+		{name: "change descending", opts: QuoteListOptions{SortBy: QuoteSortChange, Descending: true}, want: []string{"AAPL", "NVDA", "TSLA", "MSFT"}},
+		{name: "change percent", opts: QuoteListOptions{SortBy: QuoteSortChangePercent}, want: []string{"MSFT", "TSLA", "AAPL", "NVDA"}},
+		{name: "change percent descending", opts: QuoteListOptions{SortBy: QuoteSortChangePercent, Descending: true}, want: []string{"NVDA", "AAPL", "TSLA", "MSFT"}},
+		{name: "min change", opts: QuoteListOptions{MinChange: minChange(1)}, want: []string{"AAPL", "NVDA"}},
+		{name: "min change is inclusive", opts: QuoteListOptions{SortBy: QuoteSortChange, Descending: true, MinChange: minChange(0.5)}, want: []string{"AAPL", "NVDA", "TSLA"}},
+		{name: "negative min change", opts: QuoteListOptions{MinChange: minChange(-5)}, want: []string{"AAPL", "MSFT", "NVDA", "TSLA"}},
+		{name: "min change above every quote", opts: QuoteListOptions{MinChange: minChange(10)}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sortQuotes(quotes, tt.opts)
+			symbols := make([]string, len(got))
+			for i, quote := range got {
+				symbols[i] = quote.Symbol
+			}
+			if !reflect.DeepEqual(symbols, tt.want) {
+				t.Errorf("sortQuotes(%+v) = %v, want %v", tt.opts, symbols, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSymbol(t *testing.T) {
+	uc := &StockServingUseCase{aliases: map[string]string{"FB": "META"}}
+
+	tests := []struct {
+		symbol      string
+		want        string
+		wantAliased bool
+	}{
+		{symbol: "FB", want: "META", wantAliased: true},
+		{symbol: " fb ", want: "META", wantAliased: true},
+		{symbol: "META", want: "META"},
+		{symbol: "AAPL", want: "AAPL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			got, aliased := uc.ResolveSymbol(tt.symbol)
+			if got != tt.want || aliased != tt.wantAliased {
+				t.Errorf("ResolveSymbol(%q) = %q, %v, want %q, %v", tt.symbol, got, aliased, tt.want, tt.wantAliased)
+			}
+		})
+	}
+}
+
+// degradedCache is a StockCache holding the history of one symbol and its latest quote.
+type degradedCache struct {
+	cache.StockCache
+	history []*entity.StockQuote
+}
+
+func (c *degradedCache) Get(symbol string, start, end time.Time) ([]*entity.StockQuote, bool) {
+	var quotes []*entity.StockQuote
+	for _, quote := range c.history {
+		if quote.Symbol == symbol && !quote.Timestamp.Before(start) && !quote.Timestamp.After(end) {
+			quotes = append(quotes, quote)
+		}
+	}
+	return quotes, len(quotes) > 0
+}
+
+func (c *degradedCache) GetAllLatest() (map[string]*entity.StockQuote, error) {
+	if len(c.history) == 0 {
+		return nil, nil
+	}
+	latest := c.history[len(c.history)-1]
+	return map[string]*entity.StockQuote{latest.Symbol: latest}, nil
+}
+
+// failingRepo is a StockRepo whose latest data reads fail with err.
+type failingRepo struct {
+	repository.StockRepo
+	err error
+}
+
+func (repo *failingRepo) GetAllLatestData() (map[string]*entity.StockQuote, error) {
+	return nil, repo.err
+}
+
+func TestDegradedQuotes(t *testing.T) {
+	config.AppConfig.DegradeOnDBError = true
+	defer func() { config.AppConfig.DegradeOnDBError = false }()
+
+	minute := func(m int) time.Time {
+		return time.Date(2025, time.June, 11, 10, m, 0, 0, time.UTC)
+	}
+	uc := &StockServingUseCase{stockCache: &degradedCache{history: []*entity.StockQuote{
+		{Symbol: "AAPL", Timestamp: minute(0)},
+		{Symbol: "AAPL", Timestamp: minute(1)},
+		{Symbol: "AAPL", Timestamp: minute(2)},
+	}}}
+	dbErr := stderrors.New("connection refused")
+
+	tests := []struct {
+		name   string
+		symbol string
+		start  time.Time
+		end    time.Time
+		err    error
+		want   []time.Time
+		wantOK bool
+	}{
+		{name: "requested range only", symbol: "AAPL", start: minute(1), end: minute(1), err: dbErr, want: []time.Time{minute(1)}, wantOK: true},
+		{name: "whole range", symbol: "AAPL", start: minute(0), end: minute(5), err: dbErr, want: []time.Time{minute(0), minute(1), minute(2)}, wantOK: true},
+		{name: "nothing cached in range", symbol: "AAPL", start: minute(3), end: minute(5), err: dbErr},
+		{name: "nothing cached for symbol", symbol: "MSFT", start: minute(0), end: minute(5), err: dbErr},
+		{name: "missing data isn't degraded", symbol: "AAPL", start: minute(0), end: minute(5), err: &errors.NotFoundError{Resource: "historical data for AAPL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := uc.degradedQuotes(tt.symbol, tt.start, tt.end, tt.err)
+			if ok != tt.wantOK {
+				t.Fatalf("degradedQuotes() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("degradedQuotes() returned %d quotes, want %d", len(got), len(tt.want))
+			}
+			for i, quote := range got {
+				if !quote.Timestamp.Equal(tt.want[i]) {
+					t.Errorf("quote %d is at %v, want %v", i, quote.Timestamp, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadAllLatestDegrade(t *testing.T) {
+	config.AppConfig.DegradeOnDBError = true
+	defer func() { config.AppConfig.DegradeOnDBError = false }()
+
+	uc := &StockServingUseCase{
+		stockCache: &degradedCache{history: []*entity.StockQuote{{Symbol: "AAPL", Timestamp: time.Now()}}},
+		stockRepo:  &failingRepo{err: stderrors.New("connection refused")},
+	}
+
+	tests := []struct {
+		name       string
+		degrade    bool
+		wantSource string
+		wantErr    bool
+	}{
+		{name: "degraded", degrade: true, wantSource: SourceDegraded},
+		{name: "fresh read", degrade: false, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, source, err := uc.loadAllLatest(tt.degrade)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadAllLatest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if source != tt.wantSource {
+				t.Errorf("loadAllLatest() source = %q, want %q", source, tt.wantSource)
+			}
+		})
+	}
+}
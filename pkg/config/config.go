@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -16,17 +18,80 @@ import (
 type Config struct {
     AlphaVantageAPIKey     string
     TimeSeriesEndpoint     string
+    AlphaVantageRateLimit  int
+    UpstreamTimeout        time.Duration
+    RateLimitRetries       int
+    CircuitBreakerFailures int
+    CircuitBreakerCooldown time.Duration
     FinnhubAPIKey          string
     QuoteEndpoint          string
+    ProfileEndpoint        string
     RealTimeTradesEndpoint string
+    RealTimeReadTimeout    time.Duration
+    RealTimeWriteTimeout   time.Duration
+    RealTimeWriteInterval  time.Duration
+    RealTimeWriteBatchSize int
     SymbolList             []string
+    SymbolExchanges        map[string]string
+    SymbolAliases          map[string]string
+    MaxSymbols             int
+    DefaultSymbol          string
     DatabaseURL            string
+    DatabaseReplicaURL     string
     CacheClient            string
+    RedisCluster           bool
+    RedisAddrs             []string
     CacheShortTTL          time.Duration
     CacheLongTTL           time.Duration
+    TTLLatest              time.Duration
+    TTLHistory             time.Duration
+    TTLProfile             time.Duration
+    TTLNews                time.Duration
+    CacheReadConcurrency   int
+    CacheMaxEntries        int
+    CacheStaleAfter        time.Duration
+    MemoryQuoteMaxAge      time.Duration
+    StaleDataThreshold     time.Duration
+    CacheQuoteMaxAge       time.Duration
     HistoricalDataDuration time.Duration
+    MaxPointsPerSymbol     int
+    PrecomputedChanges     bool
+    LatestQueryStrategy    string
+    IntradayPrecedence     string
+    ChangeRecomputePeriod  time.Duration
+    MaxConcurrentQueries   int
+    QueryQueueTimeout      time.Duration
+    DegradeOnDBError       bool
     ServerPort             string
+    AdminPort              string
+    AdminAllowedNetworks   []string
+    HTTPReadTimeout        time.Duration
+    HTTPReadHeaderTimeout  time.Duration
+    HTTPWriteTimeout       time.Duration
+    HTTPIdleTimeout        time.Duration
+    StartupTimeout         time.Duration
+    AdminAPIKey            string
+    MaxRequestBodyBytes    int64
+    WSWriteTimeout         time.Duration
+    WSAllowedOrigins       []string
+    WSPingInterval         time.Duration
+    SSEKeepAliveInterval   time.Duration
+    HubBufferSize          int
+    IdempotencyKeyTTL      time.Duration
+    BlockUntilWarm         bool
+    SelfTestOnStart        bool
+    SelfTestFailFast       bool
+    ScheduledRefresh       bool
+    ScheduledRefreshPeriod time.Duration
+    DailyRefresh           bool
+    DailyRefreshDelay      time.Duration
+    RefreshLockTTL         time.Duration
+    RefreshHistorySize     int
     LogLevel               string
+    LogProgressEvery       int
+    AnomalyThreshold       float64
+    HighLowReset           string
+    FlatThreshold          float64
 }
 
 // AppConfig is the global configuration instance
@@ -43,18 +108,160 @@ func LoadConfig() {
     AppConfig = Config{
         AlphaVantageAPIKey:     getEnv("ALPHA_VANTAGE_API_KEY", ""),
         TimeSeriesEndpoint:     getEnv("TIMESERIES_ENDPOINT", ""),
+        AlphaVantageRateLimit:  getInt("ALPHA_VANTAGE_REQUESTS_PER_MINUTE", 5),
+        UpstreamTimeout:        getTimeDuration("UPSTREAM_TIMEOUT", 30),
+        RateLimitRetries:       getInt("RATE_LIMIT_RETRIES", 5),
+        CircuitBreakerFailures: getInt("CIRCUIT_BREAKER_FAILURES", 5),
+        CircuitBreakerCooldown: getTimeDuration("CIRCUIT_BREAKER_COOLDOWN", 60),
         FinnhubAPIKey:          getEnv("FINHUBB_API_KEY", ""),
         QuoteEndpoint:          getEnv("QUOTE_ENDPOINT", ""),
+        ProfileEndpoint:        getEnv("COMPANY_PROFILE_ENDPOINT", "https://finnhub.io/api/v1/stock/profile2"),
         RealTimeTradesEndpoint: getEnv("REAL_TIME_TRADES_ENDPOINT", ""),
-        SymbolList:             getSymbolList(getEnv("SYMBOL_LIST", "AAPL,TSLA,GOOGL,AMZN,MSFT")),
+        RealTimeReadTimeout:    getTimeDuration("REAL_TIME_READ_TIMEOUT", 60),
+        RealTimeWriteTimeout:   getTimeDuration("REAL_TIME_WRITE_TIMEOUT", 10),
+        RealTimeWriteInterval:  getTimeDuration("REALTIME_WRITE_INTERVAL", 10),
+        RealTimeWriteBatchSize: getInt("REALTIME_WRITE_BATCH_SIZE", 500),
+        SymbolList:             getSymbolList(getEnv("SYMBOL_LIST", "AAPL,TSLA,GOOGL,AMZN,MSFT"), getEnv("SYMBOL_LIST_FILE", "")),
+        MaxSymbols:             getInt("MAX_SYMBOLS", 50),
+        DefaultSymbol:          getEnv("DEFAULT_SYMBOL", "AAPL"),
         DatabaseURL:            getDBConnectionString(),
+        DatabaseReplicaURL:     getEnv("DB_REPLICA_URL", ""),
         CacheClient:            getRedisConnectionString(),
+        RedisCluster:           getBool("REDIS_CLUSTER", false),
+        RedisAddrs:             getList(getEnv("REDIS_ADDRS", "")),
+        SymbolExchanges:        getExchanges(getEnv("SYMBOL_EXCHANGES", "")),
+        SymbolAliases:          getAliases(getEnv("SYMBOL_ALIASES", "")),
         CacheShortTTL:          getTimeDuration("CACHE_SHORT_TTL", 10),
         CacheLongTTL:           getTimeDuration("CACHE_LONG_TTL", 60*60*24*3),
+        TTLLatest:              getTimeDuration("TTL_LATEST", 0),
+        TTLHistory:             getTimeDuration("TTL_HISTORY", 0),
+        TTLProfile:             getTimeDuration("TTL_PROFILE", 0),
+        TTLNews:                getTimeDuration("TTL_NEWS", 0),
+        CacheReadConcurrency:   getInt("CACHE_READ_CONCURRENCY", 10),
+        CacheMaxEntries:        getInt("CACHE_MAX_ENTRIES_PER_SYMBOL", 0),
+        CacheStaleAfter:        getTimeDuration("CACHE_STALE_AFTER", 0),
+        MemoryQuoteMaxAge:      getTimeDuration("MEMORY_QUOTE_MAX_AGE", 60),
+        StaleDataThreshold:     getTimeDuration("STALE_DATA_THRESHOLD", 300),
+        CacheQuoteMaxAge:       getTimeDuration("CACHE_QUOTE_MAX_AGE", 0),
         HistoricalDataDuration: getTimeDuration("HISTORICAL_DATA_DURATION", 60*60*24*30),
+        MaxPointsPerSymbol:     utils.ToInt(getEnv("MAX_POINTS_PER_SYMBOL", "0")),
+        PrecomputedChanges:     getBool("USE_PRECOMPUTED_CHANGES", false),
+        LatestQueryStrategy:    getEnv("LATEST_QUERY_STRATEGY", "cte"),
+        IntradayPrecedence:     getEnv("INTRADAY_PRECEDENCE", "market_hours"),
+        ChangeRecomputePeriod:  getTimeDuration("CHANGE_RECOMPUTE_INTERVAL", 60*60*24),
+        MaxConcurrentQueries:   getInt("MAX_CONCURRENT_QUERIES", 10),
+        QueryQueueTimeout:      getTimeDuration("QUERY_QUEUE_TIMEOUT", 2),
+        DegradeOnDBError:       getBool("DEGRADE_ON_DB_ERROR", true),
         ServerPort:             getEnv("SERVER_PORT", "8080"),
-        LogLevel:               getEnv("LOG_LEVEL", "debug"),
+        AdminPort:              getEnv("ADMIN_PORT", ""),
+        AdminAllowedNetworks:   getList(getEnv("ADMIN_ALLOWED_NETWORKS", "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7")),
+        HTTPReadTimeout:        getTimeDuration("HTTP_READ_TIMEOUT", 15),
+        HTTPReadHeaderTimeout:  getTimeDuration("HTTP_READ_HEADER_TIMEOUT", 5),
+        HTTPWriteTimeout:       getTimeDuration("HTTP_WRITE_TIMEOUT", 30),
+        HTTPIdleTimeout:        getTimeDuration("HTTP_IDLE_TIMEOUT", 120),
+        StartupTimeout:         getTimeDuration("STARTUP_TIMEOUT", 60),
+        AdminAPIKey:            getEnv("ADMIN_API_KEY", ""),
+        MaxRequestBodyBytes:    int64(utils.ToInt(getEnv("MAX_REQUEST_BODY_BYTES", "1048576"))),
+        WSWriteTimeout:         getTimeDuration("WS_WRITE_TIMEOUT", 5),
+        WSAllowedOrigins:       getList(getEnv("WS_ALLOWED_ORIGINS", "")),
+        WSPingInterval:         getTimeDuration("WS_PING_INTERVAL", 30),
+        SSEKeepAliveInterval:   getTimeDuration("SSE_KEEPALIVE_INTERVAL", 15),
+        HubBufferSize:          getInt("HUB_BUFFER_SIZE", 256),
+        IdempotencyKeyTTL:      getTimeDuration("IDEMPOTENCY_KEY_TTL", 60*60*24),
+        BlockUntilWarm:         getBool("BLOCK_UNTIL_WARM", true),
+        SelfTestOnStart:        getBool("SELF_TEST_ON_START", false),
+        SelfTestFailFast:       getBool("SELF_TEST_FAIL_FAST", false),
+        ScheduledRefresh:       getBool("ENABLE_SCHEDULED_REFRESH", false),
+        ScheduledRefreshPeriod: getTimeDuration("SCHEDULED_REFRESH_INTERVAL", 60*15),
+        DailyRefresh:           getBool("ENABLE_DAILY_REFRESH", false),
+        DailyRefreshDelay:      getTimeDuration("DAILY_REFRESH_DELAY", 60*30),
+        RefreshLockTTL:         getTimeDuration("REFRESH_LOCK_TTL", 60*30),
+        RefreshHistorySize:     getInt("REFRESH_HISTORY_SIZE", 100),
+        LogLevel:               getOption("LOG_LEVEL", "info"),
+        LogProgressEvery:       getInt("LOG_PROGRESS_EVERY", 1000),
+        AnomalyThreshold:       getFloat("ANOMALY_THRESHOLD_PERCENT", 20),
+        HighLowReset:           getEnv("HIGH_LOW_RESET", "day"),
+        FlatThreshold:          getFloat("FLAT_THRESHOLD_PERCENT", 0.01),
     }
+
+    // Market hours of each symbol follow the calendar of its configured exchange
+    if err := utils.SetSymbolExchanges(AppConfig.SymbolExchanges); err != nil {
+        log.Printf("Ignoring SYMBOL_EXCHANGES: %v", err)
+    }
+}
+
+// Cached data types with their own TTL settings.
+const (
+    CacheTypeLatest  = "latest"
+    CacheTypeHistory = "history"
+    CacheTypeProfile = "profile"
+    CacheTypeNews    = "news"
+)
+
+// CacheTTL returns the TTL configured for a cached data type, or fallback when it is not set.
+func CacheTTL(dataType string, fallback time.Duration) time.Duration {
+    var ttl time.Duration
+    switch dataType {
+    case CacheTypeLatest:
+        ttl = AppConfig.TTLLatest
+    case CacheTypeHistory:
+        ttl = AppConfig.TTLHistory
+    case CacheTypeProfile:
+        ttl = AppConfig.TTLProfile
+    case CacheTypeNews:
+        ttl = AppConfig.TTLNews
+    }
+    if ttl <= 0 {
+        return fallback
+    }
+    return ttl
+}
+
+// Validate checks the loaded configuration for values the external APIs would reject
+func Validate() error {
+    if AppConfig.MaxSymbols > 0 && len(AppConfig.SymbolList) > AppConfig.MaxSymbols {
+        return fmt.Errorf("%d symbols configured but MAX_SYMBOLS is %d: the Finnhub plan only allows subscribing to %d symbols, so reduce SYMBOL_LIST/SYMBOL_LIST_FILE or raise MAX_SYMBOLS to match your plan",
+            len(AppConfig.SymbolList), AppConfig.MaxSymbols, AppConfig.MaxSymbols)
+    }
+    if AppConfig.RealTimeTradesEndpoint != "" && AppConfig.RealTimeReadTimeout <= 0 {
+        return fmt.Errorf("REAL_TIME_READ_TIMEOUT must be positive, got %v: without it a half-open trades WebSocket is never detected", AppConfig.RealTimeReadTimeout)
+    }
+    for symbol, exchange := range AppConfig.SymbolExchanges {
+        if _, ok := utils.MarketByName(exchange); !ok {
+            return fmt.Errorf("SYMBOL_EXCHANGES sets unsupported exchange %s for %s: supported exchanges are US, LSE and TSE", exchange, symbol)
+        }
+    }
+    for _, network := range AppConfig.AdminAllowedNetworks {
+        if _, _, err := net.ParseCIDR(network); err != nil {
+            return fmt.Errorf("ADMIN_ALLOWED_NETWORKS has invalid network %q: networks are written in CIDR notation, e.g. 10.0.0.0/8", network)
+        }
+    }
+    if AppConfig.RefreshLockTTL <= 0 {
+        return fmt.Errorf("REFRESH_LOCK_TTL must be positive, got %v: without it the lock of a crashed instance never expires", AppConfig.RefreshLockTTL)
+    }
+    if err := checkOption("HIGH_LOW_RESET", AppConfig.HighLowReset, "day", "session"); err != nil {
+        return err
+    }
+    if err := checkOption("LATEST_QUERY_STRATEGY", AppConfig.LatestQueryStrategy, "cte", "distinct_on"); err != nil {
+        return err
+    }
+    if err := checkOption("INTRADAY_PRECEDENCE", AppConfig.IntradayPrecedence, "market_hours", "realtime", "api", "last"); err != nil {
+        return err
+    }
+    if err := checkOption("LOG_LEVEL", AppConfig.LogLevel, "panic", "fatal", "error", "warn", "warning", "info", "debug", "trace"); err != nil {
+        return err
+    }
+    return nil
+}
+
+// checkOption returns an error if value, read from the environment variable key, is not one of allowed
+func checkOption(key, value string, allowed ...string) error {
+    for _, option := range allowed {
+        if value == option {
+            return nil
+        }
+    }
+    return fmt.Errorf("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
 }
 
 // getEnv retrieves an environment variable or returns a default value if not set
@@ -83,15 +290,135 @@ func getRedisConnectionString() string {
     return host + ":" + port
 }
 
-// getSymbolList parses the SYMBOL_LIST environment variable into a slice of strings
-func getSymbolList(symbols string) []string {
-    if symbols == "" {
-        return []string{}
+// getSymbolList merges the comma-separated SYMBOL_LIST with the newline-delimited SYMBOL_LIST_FILE,
+// trimming, uppercasing and deduplicating the symbols. Blank lines and `#` comments in the file are skipped.
+func getSymbolList(symbols string, symbolFile string) []string {
+    all := strings.Split(symbols, ",")
+
+    if symbolFile != "" {
+        content, err := os.ReadFile(symbolFile)
+        if err != nil {
+            log.Printf("Failed to read symbol list file %s: %v", symbolFile, err)
+        } else {
+            for _, line := range strings.Split(string(content), "\n") {
+                line = strings.TrimSpace(line)
+                if line == "" || strings.HasPrefix(line, "#") {
+                    continue
+                }
+                all = append(all, line)
+            }
+        }
+    }
+
+    seen := make(map[string]bool)
+    list := []string{}
+    for _, symbol := range all {
+        symbol = utils.NormalizeSymbol(symbol)
+        if symbol == "" || seen[symbol] {
+            continue
+        }
+        seen[symbol] = true
+        list = append(list, symbol)
+    }
+    return list
+}
+
+// getList parses a comma-separated value into a slice of trimmed, non-empty strings
+func getList(value string) []string {
+    var list []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            list = append(list, item)
+        }
+    }
+    return list
+}
+
+// getExchanges parses comma-separated `SYMBOL=EXCHANGE` pairs into a map from normalized symbol to
+// uppercased exchange name. Malformed pairs are logged and skipped.
+func getExchanges(value string) map[string]string {
+    exchanges := make(map[string]string)
+    for _, pair := range getList(value) {
+        parts := strings.SplitN(pair, "=", 2)
+        if len(parts) != 2 {
+            log.Printf("Ignoring malformed symbol exchange %q, expected SYMBOL=EXCHANGE", pair)
+            continue
+        }
+        symbol, exchange := utils.NormalizeSymbol(parts[0]), strings.ToUpper(strings.TrimSpace(parts[1]))
+        if symbol == "" || exchange == "" {
+            log.Printf("Ignoring malformed symbol exchange %q, expected SYMBOL=EXCHANGE", pair)
+            continue
+        }
+        exchanges[symbol] = exchange
+    }
+    return exchanges
+}
+
+// getValue retrieves a non-empty environment variable. Empty values, such as the `KEY=#description`
+// placeholders of the sample .env whose comment is stripped, count as unset so numbers fall back to
+// their default instead of parsing as 0.
+func getValue(key string) (string, bool) {
+    value := strings.TrimSpace(os.Getenv(key))
+    return value, value != ""
+}
+
+// getOption retrieves one of a fixed set of string values from an environment variable
+func getOption(key, defaultValue string) string {
+    value, ok := getValue(key)
+    if !ok {
+        return defaultValue
     }
-    return strings.Split(symbols, ",")
+    return value
+}
+
+// getInt retrieves an int value from an environment variable
+func getInt(key string, defaultValue int) int {
+    value, ok := getValue(key)
+    if !ok {
+        return defaultValue
+    }
+    return utils.ToInt(value)
+}
+
+// getAliases parses comma-separated `OLD=NEW` pairs into a map from old to new symbol, normalizing
+// both. Malformed pairs are logged and skipped.
+func getAliases(value string) map[string]string {
+    aliases := make(map[string]string)
+    for _, pair := range getList(value) {
+        parts := strings.SplitN(pair, "=", 2)
+        if len(parts) != 2 {
+            log.Printf("Ignoring malformed symbol alias %q, expected OLD=NEW", pair)
+            continue
+        }
+        from, to := utils.NormalizeSymbol(parts[0]), utils.NormalizeSymbol(parts[1])
+        if from == "" || to == "" || from == to {
+            log.Printf("Ignoring malformed symbol alias %q, expected OLD=NEW", pair)
+            continue
+        }
+        aliases[from] = to
+    }
+    return aliases
 }
 
 // getTimeDuration retrieves a time.Duration value from an environment variable
 func getTimeDuration(key string, defaultTTL int) time.Duration {
-    return time.Duration(utils.ToInt(getEnv(key, strconv.Itoa(defaultTTL)))) * time.Second
+    return time.Duration(getInt(key, defaultTTL)) * time.Second
+}
+
+// getFloat retrieves a float64 value from an environment variable
+func getFloat(key string, defaultValue float64) float64 {
+    value, ok := getValue(key)
+    if !ok {
+        return defaultValue
+    }
+    return utils.ToFloat(value)
+}
+
+// getBool retrieves a boolean value from an environment variable
+func getBool(key string, defaultValue bool) bool {
+    value, err := strconv.ParseBool(strings.TrimSpace(getEnv(key, strconv.FormatBool(defaultValue))))
+    if err != nil {
+        return defaultValue
+    }
+    return value
 }
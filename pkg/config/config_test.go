@@ -0,0 +1,118 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestGetSymbolList(t *testing.T) {
+    file := filepath.Join(t.TempDir(), "symbols.txt")
+    content := "# Large caps\nAAPL\n  msft  \n\nTSLA\n# duplicates of the inline list and of earlier lines\nGOOGL\naapl\n\t\nnvda\r\n"
+    if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name       string
+        symbols    string
+        symbolFile string
+        want       []string
+    }{
+        {name: "inline only", symbols: "AAPL, msft,,AAPL", want: []string{"AAPL", "MSFT"}},
+        {name: "empty", want: []string{}},
+        {name: "file only", symbolFile: file, want: []string{"AAPL", "MSFT", "TSLA", "GOOGL", "NVDA"}},
+        {name: "inline and file", symbols: "googl,AMZN", symbolFile: file, want: []string{"GOOGL", "AMZN", "AAPL", "MSFT", "TSLA", "NVDA"}},
+        {name: "missing file", symbols: "AAPL", symbolFile: filepath.Join(t.TempDir(), "missing.txt"), want: []string{"AAPL"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := getSymbolList(tt.symbols, tt.symbolFile); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("getSymbolList(%q, %q) = %v, want %v", tt.symbols, tt.symbolFile, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestValidate(t *testing.T) {
+    tests := []struct {
+        name    string
+        modify  func(c *Config)
+        wantErr bool
+    }{
+        {name: "valid", modify: func(c *Config) {}},
+        {name: "at the symbol limit", modify: func(c *Config) { c.MaxSymbols, c.SymbolList = 2, []string{"AAPL", "MSFT"} }},
+        {name: "too many symbols", modify: func(c *Config) { c.MaxSymbols, c.SymbolList = 1, []string{"AAPL", "MSFT"} }, wantErr: true},
+        {name: "no symbol limit", modify: func(c *Config) { c.MaxSymbols, c.SymbolList = 0, []string{"AAPL", "MSFT"} }},
+        {name: "real-time read timeout", modify: func(c *Config) { c.RealTimeTradesEndpoint, c.RealTimeReadTimeout = "wss://ws.finnhub.io", time.Minute }},
+        {name: "no real-time read timeout", modify: func(c *Config) { c.RealTimeTradesEndpoint = "wss://ws.finnhub.io" }, wantErr: true},
+        {name: "no refresh lock TTL", modify: func(c *Config) { c.RefreshLockTTL = 0 }, wantErr: true},
+        {name: "session high/low reset", modify: func(c *Config) { c.HighLowReset = "session" }},
+        {name: "unknown high/low reset", modify: func(c *Config) { c.HighLowReset = "sesion" }, wantErr: true},
+        {name: "admin network", modify: func(c *Config) { c.AdminAllowedNetworks = []string{"10.0.0.0/8", "::1/128"} }},
+        {name: "admin address without prefix length", modify: func(c *Config) { c.AdminAllowedNetworks = []string{"10.0.0.1"} }, wantErr: true},
+        {name: "distinct on latest query", modify: func(c *Config) { c.LatestQueryStrategy = "distinct_on" }},
+        {name: "unknown latest query strategy", modify: func(c *Config) { c.LatestQueryStrategy = "distinct" }, wantErr: true},
+        {name: "last write precedence", modify: func(c *Config) { c.IntradayPrecedence = "last" }},
+        {name: "unknown intraday precedence", modify: func(c *Config) { c.IntradayPrecedence = "market-hours" }, wantErr: true},
+        {name: "unknown log level", modify: func(c *Config) { c.LogLevel = "verbose" }, wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            saved := AppConfig
+            defer func() { AppConfig = saved }()
+            AppConfig = Config{RefreshLockTTL: time.Minute, HighLowReset: "day", LatestQueryStrategy: "cte", IntradayPrecedence: "market_hours", LogLevel: "info"}
+            tt.modify(&AppConfig)
+
+            if err := Validate(); (err != nil) != tt.wantErr {
+                t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestCacheTTL(t *testing.T) {
+    saved := AppConfig
+    defer func() { AppConfig = saved }()
+    AppConfig = Config{TTLLatest: 5 * time.Second, TTLHistory: time.Hour, TTLProfile: 24 * time.Hour}
+
+    tests := []struct {
+        dataType string
+        want     time.Duration
+    }{
+        {dataType: CacheTypeLatest, want: 5 * time.Second},
+        {dataType: CacheTypeHistory, want: time.Hour},
+        {dataType: CacheTypeProfile, want: 24 * time.Hour},
+        {dataType: CacheTypeNews, want: time.Minute},
+        {dataType: "unknown", want: time.Minute},
+    }
+    for _, tt := range tests {
+        if got := CacheTTL(tt.dataType, time.Minute); got != tt.want {
+            t.Errorf("CacheTTL(%q, 1m) = %v, want %v", tt.dataType, got, tt.want)
+        }
+    }
+}
+
+func TestGetInt(t *testing.T) {
+    tests := []struct {
+        name  string
+        value string
+        want  int
+    }{
+        {name: "set", value: "42", want: 42},
+        {name: "surrounding spaces", value: " 42 ", want: 42},
+        {name: "unset", value: "", want: 7},
+        {name: "blank", value: "   ", want: 7},
+        {name: "negative", value: "-1", want: -1},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            t.Setenv("TEST_GET_INT", tt.value)
+            if got := getInt("TEST_GET_INT", 7); got != tt.want {
+                t.Errorf("getInt() = %d, want %d", got, tt.want)
+            }
+        })
+    }
+}
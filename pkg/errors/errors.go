@@ -1,6 +1,9 @@
 package errors
 
-import "fmt"
+import (
+    "fmt"
+    "time"
+)
 
 type NotFoundError struct {
     Resource string
@@ -17,3 +20,37 @@ type ValidationError struct {
 func (e *ValidationError) Error() string {
     return fmt.Sprintf("Invalid value for field: %s", e.Field)
 }
+
+type OverloadedError struct {
+    RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+    return fmt.Sprintf("server is overloaded, retry after %v", e.RetryAfter)
+}
+
+type PremiumEndpointError struct {
+    Function string
+    Message  string
+}
+
+func (e *PremiumEndpointError) Error() string {
+    return fmt.Sprintf("%s is a premium AlphaVantage endpoint not available with the configured API key, upgrade the plan or stop requesting it: %s", e.Function, e.Message)
+}
+
+type AuthError struct {
+    Provider string
+    Message  string
+}
+
+func (e *AuthError) Error() string {
+    return fmt.Sprintf("%s rejected the configured API key, check that it is valid and not expired: %s", e.Provider, e.Message)
+}
+
+type CircuitOpenError struct {
+    Provider string
+}
+
+func (e *CircuitOpenError) Error() string {
+    return fmt.Sprintf("%s is failing, requests are suspended until its circuit breaker cools down", e.Provider)
+}
@@ -10,14 +10,18 @@ type Logger struct {
     *logrus.Logger
 }
 
-// NewLogger initializes a new Logger instance with settings based on config.
-func NewLogger() *Logger {
+// NewLogger initializes a new Logger instance logging at the named level, e.g. the configured
+// LOG_LEVEL, or at info level when it is empty.
+func NewLogger(levelName string) *Logger {
     logger := logrus.New()
 
     // Set log level based on configuration
-    level, err := logrus.ParseLevel("debug")
+    if levelName == "" {
+        levelName = "info"
+    }
+    level, err := logrus.ParseLevel(levelName)
     if err != nil {
-        logger.Warnf("Invalid log level: %s, defaulting to InfoLevel", "debug")
+        logger.Warnf("Invalid log level: %s, defaulting to InfoLevel", levelName)
         level = logrus.InfoLevel
     }
     logger.SetLevel(level)
@@ -0,0 +1,300 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// clock is a time of day in a market's local time zone.
+type clock struct {
+	hour, min int
+}
+
+// tradingBreak is a pause of the regular session, such as a lunch break, from start until end.
+type tradingBreak struct {
+	start, end clock
+}
+
+// MarketCalendar describes the trading sessions of an exchange in its local time zone. Exchanges
+// without extended hours use the same times for the pre-market start and the open, and for the close
+// and the after-hours end. Breaks lists the pauses of the regular session, during which the market is
+// closed. Holidays lists the weekdays, as YYYY-MM-DD dates, the exchange is closed on.
+type MarketCalendar struct {
+	Name          string
+	TimeZone      string
+	PreMarketOpen clock
+	Open          clock
+	Close         clock
+	AfterHoursEnd clock
+	Breaks        []tradingBreak
+	Holidays      map[string]bool
+}
+
+// usHolidays are the full-day NYSE and Nasdaq closures.
+var usHolidays = holidays(
+	"2024-01-01", "2024-01-15", "2024-02-19", "2024-03-29", "2024-05-27", "2024-06-19", "2024-07-04", "2024-09-02", "2024-11-28", "2024-12-25",
+	"2025-01-01", "2025-01-09", "2025-01-20", "2025-02-17", "2025-04-18", "2025-05-26", "2025-06-19", "2025-07-04", "2025-09-01", "2025-11-27", "2025-12-25",
+	"2026-01-01", "2026-01-19", "2026-02-16", "2026-04-03", "2026-05-25", "2026-06-19", "2026-07-03", "2026-09-07", "2026-11-26", "2026-12-25",
+	"2027-01-01", "2027-01-18", "2027-02-15", "2027-03-26", "2027-05-31", "2027-06-18", "2027-07-05", "2027-09-06", "2027-11-25", "2027-12-24",
+)
+
+// holidays builds the Holidays set of a calendar from YYYY-MM-DD dates.
+func holidays(dates ...string) map[string]bool {
+	set := make(map[string]bool, len(dates))
+	for _, date := range dates {
+		set[date] = true
+	}
+	return set
+}
+
+// Calendars of the supported exchanges.
+var (
+	USMarket = MarketCalendar{
+		Name:          "US",
+		TimeZone:      "America/New_York",
+		PreMarketOpen: clock{4, 0},
+		Open:          clock{9, 30},
+		Close:         clock{16, 0},
+		AfterHoursEnd: clock{20, 0},
+		Holidays:      usHolidays,
+	}
+	LSEMarket = MarketCalendar{
+		Name:          "LSE",
+		TimeZone:      "Europe/London",
+		PreMarketOpen: clock{8, 0},
+		Open:          clock{8, 0},
+		Close:         clock{16, 30},
+		AfterHoursEnd: clock{16, 30},
+	}
+	TSEMarket = MarketCalendar{
+		Name:          "TSE",
+		TimeZone:      "Asia/Tokyo",
+		PreMarketOpen: clock{9, 0},
+		Open:          clock{9, 0},
+		Close:         clock{15, 30},
+		AfterHoursEnd: clock{15, 30},
+		Breaks:        []tradingBreak{{start: clock{11, 30}, end: clock{12, 30}}},
+	}
+)
+
+// markets maps the names of the supported exchanges to their calendar.
+var markets = map[string]MarketCalendar{
+	USMarket.Name:  USMarket,
+	LSEMarket.Name: LSEMarket,
+	TSEMarket.Name: TSEMarket,
+}
+
+// MarketByName returns the calendar of the exchange with the given name, e.g. LSE, and whether the
+// exchange is supported.
+func MarketByName(name string) (MarketCalendar, bool) {
+	calendar, ok := markets[name]
+	return calendar, ok
+}
+
+// symbolMarkets maps symbols to the calendar of the exchange they trade on, as configured.
+var (
+	symbolMarketsMu sync.RWMutex
+	symbolMarkets   = map[string]MarketCalendar{}
+)
+
+// SetSymbolExchanges sets the exchange each symbol trades on from a map of symbols to exchange names,
+// replacing the previous ones. It returns an error naming the first unsupported exchange.
+func SetSymbolExchanges(exchanges map[string]string) error {
+	calendars := make(map[string]MarketCalendar, len(exchanges))
+	for symbol, name := range exchanges {
+		calendar, ok := MarketByName(name)
+		if !ok {
+			return fmt.Errorf("unsupported exchange %s of symbol %s", name, symbol)
+		}
+		calendars[NormalizeSymbol(symbol)] = calendar
+	}
+
+	symbolMarketsMu.Lock()
+	defer symbolMarketsMu.Unlock()
+	symbolMarkets = calendars
+	return nil
+}
+
+// CalendarForSymbol returns the calendar of the exchange a symbol trades on, as set by
+// SetSymbolExchanges. Symbols without a configured exchange trade on US exchanges.
+func CalendarForSymbol(symbol string) MarketCalendar {
+	symbolMarketsMu.RLock()
+	defer symbolMarketsMu.RUnlock()
+	if calendar, ok := symbolMarkets[NormalizeSymbol(symbol)]; ok {
+		return calendar
+	}
+	return USMarket
+}
+
+// SymbolCalendars returns the calendars of the symbols with a configured exchange, keyed by normalized
+// symbol. Other symbols trade on US exchanges.
+func SymbolCalendars() map[string]MarketCalendar {
+	symbolMarketsMu.RLock()
+	defer symbolMarketsMu.RUnlock()
+	calendars := make(map[string]MarketCalendar, len(symbolMarkets))
+	for symbol, calendar := range symbolMarkets {
+		calendars[symbol] = calendar
+	}
+	return calendars
+}
+
+// Location returns the time zone of the market, or nil if it can't be loaded.
+func (mc MarketCalendar) Location() *time.Location {
+	loc, err := time.LoadLocation(mc.TimeZone)
+	if err != nil {
+		fmt.Println("Error loading location:", err)
+		return nil
+	}
+	return loc
+}
+
+// IsTradingDay reports whether the market trades on the day of t in its time zone, i.e. t falls on a
+// weekday that is not a holiday.
+func (mc MarketCalendar) IsTradingDay(t time.Time) bool {
+	if loc := mc.Location(); loc != nil {
+		t = t.In(loc)
+	}
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+	return !mc.Holidays[t.Format("2006-01-02")]
+}
+
+// RegularMinutes returns the length in minutes of the regular session of a trading day, excluding its
+// breaks.
+func (mc MarketCalendar) RegularMinutes() int {
+	minutes := func(c clock) int {
+		return c.hour*60 + c.min
+	}
+	total := minutes(mc.Close) - minutes(mc.Open)
+	for _, b := range mc.Breaks {
+		total -= minutes(b.end) - minutes(b.start)
+	}
+	return total
+}
+
+// Session returns the trading session of the market at the given time. Weekends, holidays and breaks
+// of the regular session are closed.
+func (mc MarketCalendar) Session(currentTime time.Time) MarketSession {
+	loc := mc.Location()
+	if loc == nil {
+		return SessionClosed
+	}
+
+	local := currentTime.In(loc)
+	if !mc.IsTradingDay(local) {
+		return SessionClosed
+	}
+
+	at := func(c clock) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day(), c.hour, c.min, 0, 0, loc)
+	}
+
+	switch {
+	case local.Before(at(mc.PreMarketOpen)):
+		return SessionClosed
+	case local.Before(at(mc.Open)):
+		return SessionPreMarket
+	case local.Before(at(mc.Close)):
+		for _, b := range mc.Breaks {
+			if !local.Before(at(b.start)) && local.Before(at(b.end)) {
+				return SessionClosed
+			}
+		}
+		return SessionRegular
+	case local.Before(at(mc.AfterHoursEnd)):
+		return SessionAfterHours
+	default:
+		return SessionClosed
+	}
+}
+
+// SessionAtWallClock returns the trading session of the market at the wall clock time of t, read as a
+// time in the market's time zone whatever the location of t, for intraday timestamps stored as wall
+// clock times of the exchange.
+func (mc MarketCalendar) SessionAtWallClock(t time.Time) MarketSession {
+	if mc.Location() == nil {
+		return SessionClosed
+	}
+	return mc.Session(mc.FromWallClock(t))
+}
+
+// WallClock returns the wall clock time of the market at t as a UTC time, the form intraday
+// timestamps are stored in. It returns t in UTC if the market's time zone can't be loaded.
+func (mc MarketCalendar) WallClock(t time.Time) time.Time {
+	loc := mc.Location()
+	if loc == nil {
+		return t.UTC()
+	}
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC)
+}
+
+// FromWallClock returns the instant at which the market's wall clock read the wall clock time of t,
+// whatever the location of t. It is the inverse of WallClock, and returns t if the market's time zone
+// can't be loaded.
+func (mc MarketCalendar) FromWallClock(t time.Time) time.Time {
+	loc := mc.Location()
+	if loc == nil {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// IsOpen reports whether the market is in its regular session at the given time.
+func (mc MarketCalendar) IsOpen(currentTime time.Time) bool {
+	return mc.Session(currentTime) == SessionRegular
+}
+
+// NextAfterClose returns the first time after currentTime that is delay past the close of a trading
+// day of the market, or the zero time if the market's time zone can't be loaded.
+func (mc MarketCalendar) NextAfterClose(currentTime time.Time, delay time.Duration) time.Time {
+	loc := mc.Location()
+	if loc == nil {
+		return time.Time{}
+	}
+
+	local := currentTime.In(loc)
+	for day := 0; ; day++ {
+		date := local.AddDate(0, 0, day)
+		if !mc.IsTradingDay(date) {
+			continue
+		}
+		next := time.Date(date.Year(), date.Month(), date.Day(), mc.Close.hour, mc.Close.min, 0, 0, loc).Add(delay)
+		if next.After(currentTime) {
+			return next
+		}
+	}
+}
+
+// LastAfterClose returns the latest time at or before currentTime that is delay past the close of a
+// trading day of the market, or the zero time if the market's time zone can't be loaded.
+func (mc MarketCalendar) LastAfterClose(currentTime time.Time, delay time.Duration) time.Time {
+	loc := mc.Location()
+	if loc == nil {
+		return time.Time{}
+	}
+
+	local := currentTime.In(loc)
+	for day := 0; ; day-- {
+		date := local.AddDate(0, 0, day)
+		if !mc.IsTradingDay(date) {
+			continue
+		}
+		last := time.Date(date.Year(), date.Month(), date.Day(), mc.Close.hour, mc.Close.min, 0, 0, loc).Add(delay)
+		if !last.After(currentTime) {
+			return last
+		}
+	}
+}
+
+// AnyMarketOpen reports whether the market of at least one of the symbols is in its regular session.
+func AnyMarketOpen(symbols []string, currentTime time.Time) bool {
+	for _, symbol := range symbols {
+		if CalendarForSymbol(symbol).IsOpen(currentTime) {
+			return true
+		}
+	}
+	return false
+}
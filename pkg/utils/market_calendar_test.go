@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns the given wall clock time of 2025-03-12, a Wednesday, in the named time zone.
+func at(t *testing.T, zone string, hour, min int) time.Time {
+	t.Helper()
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", zone, err)
+	}
+	return time.Date(2025, time.March, 12, hour, min, 0, 0, loc)
+}
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar MarketCalendar
+		time     time.Time
+		want     MarketSession
+	}{
+		{name: "US before pre-market", calendar: USMarket, time: at(t, "America/New_York", 3, 59), want: SessionClosed},
+		{name: "US pre-market", calendar: USMarket, time: at(t, "America/New_York", 4, 0), want: SessionPreMarket},
+		{name: "US open", calendar: USMarket, time: at(t, "America/New_York", 9, 30), want: SessionRegular},
+		{name: "US last regular minute", calendar: USMarket, time: at(t, "America/New_York", 15, 59), want: SessionRegular},
+		{name: "US close", calendar: USMarket, time: at(t, "America/New_York", 16, 0), want: SessionAfterHours},
+		{name: "US after-hours end", calendar: USMarket, time: at(t, "America/New_York", 20, 0), want: SessionClosed},
+		{name: "US from another zone", calendar: USMarket, time: at(t, "UTC", 14, 0), want: SessionRegular},
+		{name: "US holiday", calendar: USMarket, time: at(t, "America/New_York", 10, 0).AddDate(0, 0, 37), want: SessionClosed}, // Good Friday
+		{name: "US weekend", calendar: USMarket, time: at(t, "America/New_York", 10, 0).AddDate(0, 0, 3), want: SessionClosed},
+		{name: "TSE before open", calendar: TSEMarket, time: at(t, "Asia/Tokyo", 8, 59), want: SessionClosed},
+		{name: "TSE open", calendar: TSEMarket, time: at(t, "Asia/Tokyo", 9, 0), want: SessionRegular},
+		{name: "TSE lunch break", calendar: TSEMarket, time: at(t, "Asia/Tokyo", 11, 30), want: SessionClosed},
+		{name: "TSE end of lunch break", calendar: TSEMarket, time: at(t, "Asia/Tokyo", 12, 30), want: SessionRegular},
+		{name: "TSE close", calendar: TSEMarket, time: at(t, "Asia/Tokyo", 15, 30), want: SessionClosed},
+		{name: "LSE open", calendar: LSEMarket, time: at(t, "Europe/London", 8, 0), want: SessionRegular},
+		{name: "LSE close", calendar: LSEMarket, time: at(t, "Europe/London", 16, 30), want: SessionClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.calendar.Session(tt.time); got != tt.want {
+				t.Errorf("Session(%v) = %s, want %s", tt.time, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsUSMarketOpen(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		want bool
+	}{
+		{name: "exactly at the open", time: at(t, "America/New_York", 9, 30), want: false},
+		{name: "after the open", time: at(t, "America/New_York", 9, 31), want: true},
+		{name: "exactly at the close", time: at(t, "America/New_York", 16, 0), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUSMarketOpen(tt.time); got != tt.want {
+				t.Errorf("IsUSMarketOpen(%v) = %v, want %v", tt.time, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendarForSymbol(t *testing.T) {
+	if err := SetSymbolExchanges(map[string]string{"VOD.L": "LSE", "7203": "TSE"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetSymbolExchanges(nil)
+
+	tests := []struct {
+		symbol string
+		want   string
+	}{
+		{symbol: "VOD.L", want: "LSE"},
+		{symbol: "7203", want: "TSE"},
+		{symbol: "7203.T", want: "US"}, // Suffixes don't select an exchange
+		{symbol: "aapl", want: "US"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			if got := CalendarForSymbol(tt.symbol).Name; got != tt.want {
+				t.Errorf("CalendarForSymbol(%s) = %s, want %s", tt.symbol, got, tt.want)
+			}
+		})
+	}
+
+	if err := SetSymbolExchanges(map[string]string{"X": "NOPE"}); err == nil {
+		t.Error("SetSymbolExchanges accepted an unsupported exchange")
+	}
+}
+
+func TestWallClock(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		want time.Time
+	}{
+		{name: "daylight saving time", time: time.Date(2025, time.June, 11, 13, 30, 0, 0, time.UTC), want: time.Date(2025, time.June, 11, 9, 30, 0, 0, time.UTC)},
+		{name: "standard time", time: time.Date(2025, time.January, 10, 14, 30, 0, 0, time.UTC), want: time.Date(2025, time.January, 10, 9, 30, 0, 0, time.UTC)},
+		{name: "previous day", time: time.Date(2025, time.June, 11, 2, 0, 0, 0, time.UTC), want: time.Date(2025, time.June, 10, 22, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := USMarket.WallClock(tt.time); !got.Equal(tt.want) {
+				t.Errorf("USMarket.WallClock(%v) = %v, want %v", tt.time, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAfterClose(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	et := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2025, month, day, hour, min, 0, 0, newYork)
+	}
+	delay := 30 * time.Minute
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		wantNext time.Time
+		wantLast time.Time
+	}{
+		{name: "before today's run", now: et(time.March, 12, 10, 0), wantNext: et(time.March, 12, 16, 30), wantLast: et(time.March, 11, 16, 30)},
+		{name: "at today's run", now: et(time.March, 12, 16, 30), wantNext: et(time.March, 13, 16, 30), wantLast: et(time.March, 12, 16, 30)},
+		{name: "over the weekend", now: et(time.March, 15, 12, 0), wantNext: et(time.March, 17, 16, 30), wantLast: et(time.March, 14, 16, 30)},
+		{name: "over Good Friday", now: et(time.April, 17, 17, 0), wantNext: et(time.April, 21, 16, 30), wantLast: et(time.April, 17, 16, 30)},
+		{name: "on Good Friday", now: et(time.April, 18, 17, 0), wantNext: et(time.April, 21, 16, 30), wantLast: et(time.April, 17, 16, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := USMarket.NextAfterClose(tt.now, delay); !got.Equal(tt.wantNext) {
+				t.Errorf("NextAfterClose(%v) = %v, want %v", tt.now, got, tt.wantNext)
+			}
+			if got := USMarket.LastAfterClose(tt.now, delay); !got.Equal(tt.wantLast) {
+				t.Errorf("LastAfterClose(%v) = %v, want %v", tt.now, got, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestFromWallClock(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar MarketCalendar
+		wall     time.Time
+		want     time.Time
+	}{
+		{name: "US summer", calendar: USMarket, wall: time.Date(2025, time.June, 11, 10, 30, 0, 0, time.UTC), want: time.Date(2025, time.June, 11, 14, 30, 0, 0, time.UTC)},
+		{name: "US winter", calendar: USMarket, wall: time.Date(2025, time.January, 15, 10, 30, 0, 0, time.UTC), want: time.Date(2025, time.January, 15, 15, 30, 0, 0, time.UTC)},
+		{name: "TSE", calendar: TSEMarket, wall: time.Date(2025, time.June, 11, 9, 0, 0, 0, time.UTC), want: time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.calendar.FromWallClock(tt.wall)
+			if !got.Equal(tt.want) {
+				t.Errorf("FromWallClock(%v) = %v, want %v", tt.wall, got, tt.want)
+			}
+			if back := tt.calendar.WallClock(got); !back.Equal(tt.wall) {
+				t.Errorf("WallClock(FromWallClock(%v)) = %v", tt.wall, back)
+			}
+		})
+	}
+}
+
+func TestRegularMinutes(t *testing.T) {
+	tests := []struct {
+		calendar MarketCalendar
+		want     int
+	}{
+		{calendar: USMarket, want: 390},
+		{calendar: LSEMarket, want: 510},
+		{calendar: TSEMarket, want: 330}, // Without the lunch break
+	}
+	for _, tt := range tests {
+		t.Run(tt.calendar.Name, func(t *testing.T) {
+			if got := tt.calendar.RegularMinutes(); got != tt.want {
+				t.Errorf("RegularMinutes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
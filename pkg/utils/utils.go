@@ -2,8 +2,15 @@ package utils
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
+
+	"stock-app/pkg/errors"
 )
 
 // Helper functions to get max and min values
@@ -26,6 +33,20 @@ func ToFloat(s string) float64 {
 	return v
 }
 
+// FormatPrice formats v with exactly scale decimals for a NUMERIC(p, scale) column. Rounding is
+// done on the shortest decimal representation of v, with halves rounded away from zero like
+// Postgres does, so 1.005 formats as "1.01" rather than the "1.00" of its binary value.
+func FormatPrice(v float64, scale int) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(v, 'f', -1, 64))
+	if !ok {
+		return strconv.FormatFloat(v, 'f', scale, 64)
+	}
+	return r.FloatString(scale)
+}
+
 // ToInt converts a string to int.
 func ToInt(s string) int {
 	i, _ := strconv.Atoi(s)
@@ -62,3 +83,202 @@ func IsUSMarketOpen(currentTime time.Time) bool {
 	return currentEST.After(marketOpen) && currentEST.Before(marketClose)
 }
 
+// MarketSession is the trading session a point in time falls into.
+type MarketSession string
+
+const (
+	SessionClosed     MarketSession = "closed"
+	SessionPreMarket  MarketSession = "pre"
+	SessionRegular    MarketSession = "regular"
+	SessionAfterHours MarketSession = "after"
+)
+
+// ParseSession parses a trading session that bars can be filtered to: pre, regular or after.
+func ParseSession(s string) (MarketSession, error) {
+	switch session := MarketSession(s); session {
+	case SessionPreMarket, SessionRegular, SessionAfterHours:
+		return session, nil
+	default:
+		return "", fmt.Errorf("invalid session: %s", s)
+	}
+}
+
+// GetMarketSession returns the US trading session for the given time: pre-market (4:00-9:30 AM EST),
+// regular (9:30 AM-4:00 PM EST), after-hours (4:00-8:00 PM EST), or closed (otherwise and on weekends).
+// Use CalendarForSymbol for symbols that may trade on other exchanges.
+func GetMarketSession(currentTime time.Time) MarketSession {
+	return USMarket.Session(currentTime)
+}
+
+
+// resolutions maps the supported chart resolutions to their bucket size.
+var resolutions = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// ParseResolution converts a resolution string (1m/5m/15m/1h/1d) into its bucket size.
+func ParseResolution(resolution string) (time.Duration, error) {
+	bucket, ok := resolutions[resolution]
+	if !ok {
+		return 0, fmt.Errorf("unsupported resolution: %s", resolution)
+	}
+	return bucket, nil
+}
+
+// maxSymbolLength matches the width of the symbol column in the database.
+const maxSymbolLength = 20
+
+// knownExchangePrefixes are the Finnhub exchange prefixes allowed before a `:` in a symbol.
+var knownExchangePrefixes = map[string]bool{
+	"BINANCE":  true,
+	"COINBASE": true,
+	"KRAKEN":   true,
+	"BITFINEX": true,
+	"OANDA":    true,
+	"FXCM":     true,
+	"FOREX":    true,
+}
+
+// ValidateSymbol checks that a symbol only contains A-Z, 0-9, `.` and `-`, optionally
+// preceded by a known exchange prefix and `:` (e.g. BINANCE:BTCUSDT).
+func ValidateSymbol(symbol string) error {
+	if symbol == "" || len(symbol) > maxSymbolLength {
+		return &errors.ValidationError{Field: "symbol"}
+	}
+
+	ticker := symbol
+	if prefix, rest, found := strings.Cut(symbol, ":"); found {
+		if !knownExchangePrefixes[prefix] {
+			return &errors.ValidationError{Field: "symbol"}
+		}
+		ticker = rest
+	}
+
+	if ticker == "" {
+		return &errors.ValidationError{Field: "symbol"}
+	}
+	for _, r := range ticker {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '.' && r != '-' {
+			return &errors.ValidationError{Field: "symbol"}
+		}
+	}
+	return nil
+}
+
+// NormalizeSymbol trims and uppercases a symbol, since cache keys and DB rows are case-sensitive
+// and `aapl` must resolve to the same data as `AAPL`.
+func NormalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
+
+// FilterValidSymbols normalizes the symbols and returns those that pass ValidateSymbol, logging
+// the rejected ones.
+func FilterValidSymbols(symbols []string) []string {
+	valid := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		symbol = NormalizeSymbol(symbol)
+		if err := ValidateSymbol(symbol); err != nil {
+			fmt.Printf("Skipping invalid symbol %q: %v\n", symbol, err)
+			continue
+		}
+		valid = append(valid, symbol)
+	}
+	return valid
+}
+
+// defaultRetryAfter is used when a Retry-After header is missing or cannot be parsed.
+const defaultRetryAfter = time.Minute
+
+// ParseRetryAfter parses a Retry-After header given as integer seconds, an HTTP-date or a
+// Go duration string, defaulting to 60s when it is missing, invalid or already in the past.
+func ParseRetryAfter(header string) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return defaultRetryAfter
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+		return defaultRetryAfter
+	}
+
+	if duration, err := time.ParseDuration(header); err == nil && duration >= 0 {
+		return duration
+	}
+
+	return defaultRetryAfter
+}
+
+// credentialParams are the query parameters carrying API keys and tokens in provider URLs.
+var credentialParams = map[string]bool{
+	"token":   true,
+	"apikey":  true,
+	"api_key": true,
+}
+
+// RedactURL masks the password and the credential query parameters, e.g. `token`, of a URL so it
+// can be logged.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "xxxxx"
+	}
+	query := u.Query()
+	redacted := false
+	for key := range query {
+		if credentialParams[strings.ToLower(key)] {
+			query.Set(key, "xxxxx")
+			redacted = true
+		}
+	}
+	if redacted {
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// Bounds of the backoff between WaitFor attempts.
+const (
+	minWaitDelay = 500 * time.Millisecond
+	maxWaitDelay = 10 * time.Second
+)
+
+// WaitFor calls ping until it succeeds, backing off exponentially between attempts, and returns the
+// last error if it still fails once timeout has elapsed. It is used at startup to wait for
+// dependencies that may come up after the process, such as the database in a container deployment.
+func WaitFor(name string, timeout time.Duration, ping func() error) error {
+	deadline := time.Now().Add(timeout)
+	delay := minWaitDelay
+	for attempt := 1; ; attempt++ {
+		err := ping()
+		if err == nil {
+			if attempt > 1 {
+				fmt.Printf("Connected to %s after %d attempts\n", name, attempt)
+			}
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%s unavailable after %d attempts: %w", name, attempt, err)
+		}
+		if delay > remaining {
+			delay = remaining
+		}
+		fmt.Printf("Waiting for %s (attempt %d): %v, retrying in %v\n", name, attempt, err, delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxWaitDelay {
+			delay = maxWaitDelay
+		}
+	}
+}